@@ -0,0 +1,55 @@
+// Provides helpers to compute statistics over object sets.
+
+package zoossh
+
+// Aggregate folds all objects of the given set into a single value.  It
+// starts with seed and calls fn for every object with the value accumulated so
+// far.  The order in which objects are visited is unspecified.
+func Aggregate[A any](set ObjectSet, seed A, fn func(A, Object) A) A {
+
+	acc := seed
+	for obj := range set.Iterate(nil) {
+		acc = fn(acc, obj)
+	}
+
+	return acc
+}
+
+// objectBandwidth returns the bandwidth of the given object: the consensus
+// weight of router statuses, the observed bandwidth of router descriptors, and
+// the measured bandwidth of bandwidth file relay lines.  Other objects have a
+// bandwidth of zero.
+func objectBandwidth(obj Object) uint64 {
+
+	switch o := obj.(type) {
+	case *RouterStatus:
+		return o.Bandwidth
+	case *RouterDescriptor:
+		return o.BandwidthObs
+	case *BandwidthRelay:
+		return o.Bandwidth
+	}
+
+	return 0
+}
+
+// SumBandwidth returns the sum of the bandwidth of all objects in the given
+// set.  For a consensus, that is the sum of all consensus weights; for router
+// descriptors, the sum of all observed bandwidths.
+func SumBandwidth(set ObjectSet) uint64 {
+
+	return Aggregate(set, uint64(0), func(sum uint64, obj Object) uint64 {
+		return sum + objectBandwidth(obj)
+	})
+}
+
+// CountBy groups the objects of the given set by the key that the given
+// function returns and counts the objects in every group, e.g., the number of
+// relays per Tor version.
+func CountBy[K comparable](set ObjectSet, key func(Object) K) map[K]int {
+
+	return Aggregate(set, make(map[K]int), func(counts map[K]int, obj Object) map[K]int {
+		counts[key(obj)]++
+		return counts
+	})
+}
@@ -0,0 +1,36 @@
+// Tests functions from "aggregate.go".
+
+package zoossh
+
+import (
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := Aggregate(vote, 0, func(n int, obj Object) int {
+		return n + 1
+	})
+	if n != vote.Length() {
+		t.Errorf("Expected %d objects but aggregated %d.", vote.Length(), n)
+	}
+
+	if sum := SumBandwidth(vote); sum != 18+2670 {
+		t.Errorf("Expected bandwidth sum of %d but got %d.", 18+2670, sum)
+	}
+	if sum := SumBandwidth(NewRouterDescriptors()); sum != 0 {
+		t.Errorf("Expected bandwidth sum of 0 but got %d.", sum)
+	}
+
+	counts := CountBy(vote, func(obj Object) string {
+		return obj.(*RouterStatus).TorVersion
+	})
+	if len(counts) != 2 || counts["0.4.5.6"] != 1 || counts["0.4.4.7"] != 1 {
+		t.Errorf("Unexpected counts by Tor version: %v", counts)
+	}
+}
@@ -0,0 +1,171 @@
+// Provides the directory authorities and verification of their signatures.
+
+package zoossh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// DirectoryAuthority is a directory authority that tor ships with.
+type DirectoryAuthority struct {
+	Nickname string
+
+	// The fingerprint of the authority's v3 identity key, i.e., the
+	// "v3ident" of tor's authority list.
+	Identity Fingerprint
+
+	// The address and port of the authority's directory port, e.g.,
+	// "128.31.0.39:9231".
+	DirAddress string
+}
+
+// DirectoryAuthorities holds the directory authorities that tor ships with,
+// see tor's src/app/config/auth_dirs.inc.  Bridge authorities are not part of
+// the list because they do not sign consensuses.
+var DirectoryAuthorities = []DirectoryAuthority{
+	{"moria1", "F533C81CEF0BC0267857C99B2F471ADF249FA232", "128.31.0.39:9231"},
+	{"tor26", "2F3DF9CA0E5D36F2685A2DA67184EB8DCB8CBA8C", "217.196.147.77:80"},
+	{"dizum", "E8A9C45EDE6D711294FADF8E7951F4DE6CA56B58", "45.66.35.11:80"},
+	{"gabelmoo", "ED03BB616EB2F60BEC80151114BB25CEF515B226", "131.188.40.189:80"},
+	{"dannenberg", "0232AF901C31A04EE9848595AF9BB7620D4C5B2E", "193.23.244.244:80"},
+	{"maatuska", "49015F787433103580E3B66A1707A00E60F2D15B", "171.25.193.9:443"},
+	{"Faravahar", "70849B868D606BAECFB6128C5E3D782029AA394F", "154.35.175.225:80"},
+	{"longclaw", "23D15D965BC35114467363C165C4F724B64B4F66", "199.58.81.140:80"},
+	{"bastet", "27102BC123E7AF1D4741AE047E160C91ADC76B21", "204.13.164.118:80"},
+}
+
+// The signed portion of a network status document ends with the space after
+// the first "directory-signature" keyword.
+var signedPortionEnd = []byte("\ndirectory-signature ")
+
+// signedDigester is an io.Writer that computes the SHA-1 and SHA-256 digests
+// of the signed portion of the network status document written to it.
+type signedDigester struct {
+	sha1   hash.Hash
+	sha256 hash.Hash
+
+	// The end of the previous write, in case the end of the signed portion
+	// spans two writes.
+	tail []byte
+	done bool
+}
+
+func newSignedDigester() *signedDigester {
+
+	return &signedDigester{sha1: sha1.New(), sha256: sha256.New()}
+}
+
+func (d *signedDigester) Write(p []byte) (int, error) {
+
+	if d.done {
+		return len(p), nil
+	}
+
+	signed := p
+	data := append(d.tail, p...)
+	if i := bytes.Index(data, signedPortionEnd); i >= 0 {
+		signed = p[:i+len(signedPortionEnd)-len(d.tail)]
+		d.done = true
+	} else if len(data) >= len(signedPortionEnd) {
+		d.tail = append([]byte{}, data[len(data)-len(signedPortionEnd)+1:]...)
+	} else {
+		d.tail = data
+	}
+	d.sha1.Write(signed)
+	d.sha256.Write(signed)
+
+	return len(p), nil
+}
+
+// digests returns the digests of the signed portion, keyed by algorithm, or
+// nil if the document lacked a "directory-signature" line.
+func (d *signedDigester) digests() map[string][]byte {
+
+	if !d.done {
+		return nil
+	}
+
+	return map[string][]byte{
+		"sha1":   d.sha1.Sum(nil),
+		"sha256": d.sha256.Sum(nil),
+	}
+}
+
+// VerifySignatures verifies the consensus' signatures made by the given
+// authorities and returns the authorities whose signature is valid.
+// Consensuses only name the signing key of each signature, so the key
+// certificates of the authorities must be provided.  A certificate is only
+// used if its identity key certified it and if it was valid at the
+// consensus' ValidAfter time.
+func (c *Consensus) VerifySignatures(authorities []DirectoryAuthority, certs []*KeyCertificate) []DirectoryAuthority {
+
+	var valid []DirectoryAuthority
+
+	for _, authority := range authorities {
+		for _, sig := range c.Signatures {
+			if sig.Identity != authority.Identity {
+				continue
+			}
+			if c.verifySignature(&sig, certs) == nil {
+				valid = append(valid, authority)
+				break
+			}
+		}
+	}
+
+	return valid
+}
+
+// verifySignature verifies the given signature using the matching
+// certificate of the given ones.
+func (c *Consensus) verifySignature(sig *DirectorySignature, certs []*KeyCertificate) error {
+
+	digest, ok := c.signedDigests[sig.Algorithm]
+	if !ok {
+		return fmt.Errorf("no %q digest of the signed portion", sig.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(sig.Signature))
+	if block == nil {
+		return errors.New("malformed signature object")
+	}
+
+	for _, cert := range certs {
+		if cert.Identity != sig.Identity || cert.SigningKeyDigest != sig.SigningKeyDigest {
+			continue
+		}
+		if c.ValidAfter.Before(cert.Published) || c.ValidAfter.After(cert.Expires) {
+			continue
+		}
+		if cert.Verify() != nil {
+			continue
+		}
+		if rsa.VerifyPKCS1v15(cert.SigningKey, crypto.Hash(0), digest, block.Bytes) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no valid signature by %s", sig.Identity)
+}
+
+// VerifiedByMajority returns nil if more than half of the directory
+// authorities in DirectoryAuthorities validly signed the consensus, as tor
+// requires of consensuses.  The key certificates of the authorities must be
+// provided, see VerifySignatures.
+func (c *Consensus) VerifiedByMajority(certs []*KeyCertificate) error {
+
+	valid := c.VerifySignatures(DirectoryAuthorities, certs)
+	if len(valid) <= len(DirectoryAuthorities)/2 {
+		return fmt.Errorf("only %d of %d directory authorities validly signed the consensus",
+			len(valid), len(DirectoryAuthorities))
+	}
+
+	return nil
+}
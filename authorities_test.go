@@ -0,0 +1,117 @@
+// Tests functions from "authorities.go".
+
+package zoossh
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSignedVote returns the test vote with its signatures replaced by
+// signatures of the given signing keys, which belong to the given
+// certificates.
+func testSignedVote(t *testing.T, certs []*KeyCertificate, signingKeys []*rsa.PrivateKey) string {
+
+	unsigned := testVote[:strings.Index(testVote, "directory-signature")]
+	digest := sha256.Sum256([]byte(strings.TrimPrefix(unsigned, "@type network-status-vote-3 1.0\n") + "directory-signature "))
+	signed := unsigned
+	for i, cert := range certs {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, signingKeys[i], crypto.Hash(0), digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed += fmt.Sprintf("directory-signature sha256 %s %s\n%s", cert.Identity, cert.SigningKeyDigest,
+			pem.EncodeToMemory(&pem.Block{Type: "SIGNATURE", Bytes: sig}))
+	}
+
+	return signed
+}
+
+// Test the function VerifiedByMajority().
+func TestVerifiedByMajority(t *testing.T) {
+
+	// Three fake authorities sign the vote but the third signature is made
+	// by a key the authority never certified.
+	var authorities []DirectoryAuthority
+	var certs []*KeyCertificate
+	var identityKeys, signingKeys []*rsa.PrivateKey
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		identity, signing := testRSAKey(t), testRSAKey(t)
+		cert, err := ParseRawKeyCertificate(testKeyCertificate(t, identity, signing, published, published.AddDate(1, 0, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		authorities = append(authorities, DirectoryAuthority{Nickname: fmt.Sprintf("auth%d", i), Identity: cert.Identity})
+		certs = append(certs, cert)
+		identityKeys = append(identityKeys, identity)
+		signingKeys = append(signingKeys, signing)
+	}
+	signingKeys[2] = testRSAKey(t)
+
+	vote, err := ParseRawConsensus(testSignedVote(t, certs, signingKeys), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vote.Signatures) != 3 {
+		t.Fatalf("Expected three signatures but got %d.", len(vote.Signatures))
+	}
+
+	valid := vote.VerifySignatures(authorities, certs)
+	if len(valid) != 2 || valid[0] != authorities[0] || valid[1] != authorities[1] {
+		t.Error("Unexpected valid signatures.", valid)
+	}
+
+	defer func(saved []DirectoryAuthority) { DirectoryAuthorities = saved }(DirectoryAuthorities)
+	DirectoryAuthorities = authorities
+	if err := vote.VerifiedByMajority(certs); err != nil {
+		t.Error(err)
+	}
+	if err := vote.VerifiedByMajority(certs[1:]); err == nil {
+		t.Error("A single valid signature was accepted as majority.")
+	}
+
+	// Certificates must be valid at the document's valid-after time.
+	expired, err := ParseRawKeyCertificate(testKeyCertificate(t, identityKeys[0], signingKeys[0], published, published.AddDate(0, 1, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vote.VerifySignatures(authorities, []*KeyCertificate{expired})) != 0 {
+		t.Error("Expired key certificate was accepted.")
+	}
+
+	// The built-in authorities did not sign the vote.
+	DirectoryAuthorities = authorities[2:]
+	if err := vote.VerifiedByMajority(certs); err == nil {
+		t.Error("Vote without valid signatures was accepted.")
+	}
+}
+
+// Test the type signedDigester when the end of the signed portion spans
+// writes.
+func TestSignedDigester(t *testing.T) {
+
+	doc := "network-status-version 3\ndirectory-footer\ndirectory-signature abc\n-----BEGIN"
+	want := sha256.Sum256([]byte(doc[:strings.Index(doc, "abc")]))
+
+	for split := 0; split <= len(doc); split++ {
+		d := newSignedDigester()
+		d.Write([]byte(doc[:split]))
+		d.Write([]byte(doc[split:]))
+		digests := d.digests()
+		if digests == nil || string(digests["sha256"]) != string(want[:]) {
+			t.Fatalf("Unexpected digest when splitting at %d.", split)
+		}
+	}
+
+	if newSignedDigester().digests() != nil {
+		t.Error("Expected no digests for an empty document.")
+	}
+}
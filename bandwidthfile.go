@@ -0,0 +1,447 @@
+// Parses bandwidth files as produced by bandwidth scanners such as sbws.
+
+package zoossh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var bandwidthFileAnnotations = map[Annotation]bool{
+	// The file format we currently (try to) support.
+	Annotation{"bandwidth-file", "1", "0"}: true,
+}
+
+const (
+	// The layout of timestamps in bandwidth file headers, e.g.,
+	// "2019-03-28T14:45:41".
+	bandwidthFileTimeLayout = "2006-01-02T15:04:05"
+)
+
+// BandwidthFileHeader holds the header of a bandwidth file as defined in
+// bandwidth-file-spec.txt, Section 2.2.  The same header key-values are
+// embedded in votes via the "bandwidth-file-headers" line.
+type BandwidthFileHeader struct {
+	Timestamp         time.Time
+	Version           string
+	Software          string
+	SoftwareVersion   string
+	FileCreated       time.Time
+	GeneratorStarted  time.Time
+	EarliestBandwidth time.Time
+	LatestBandwidth   time.Time
+
+	// All header key-values, including the ones represented above.
+	KeyValues map[string]string
+}
+
+// BandwidthFileDigest holds a single digest of a bandwidth file as found on a
+// vote's "bandwidth-file-digest" line.
+type BandwidthFileDigest struct {
+	Algorithm string
+	Digest    string
+}
+
+// parseKeyValues splits the given words of the form "key=value" into a map.
+// Words without a "=" are mapped to an empty value.
+func parseKeyValues(words []string) map[string]string {
+
+	kvs := make(map[string]string)
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		kv := strings.SplitN(word, "=", 2)
+		if len(kv) == 2 {
+			kvs[kv[0]] = kv[1]
+		} else {
+			kvs[kv[0]] = ""
+		}
+	}
+
+	return kvs
+}
+
+// parseUnixTimestamp parses the given number of seconds since the epoch.
+func parseUnixTimestamp(s string) (time.Time, error) {
+
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(secs, 0).UTC(), nil
+}
+
+// newBandwidthFileHeader turns the given header key-values into a
+// BandwidthFileHeader.  Timestamps that fail to parse are left at their zero
+// value; the raw value remains available in KeyValues.
+func newBandwidthFileHeader(kvs map[string]string) *BandwidthFileHeader {
+
+	header := &BandwidthFileHeader{KeyValues: kvs}
+
+	parseTime := func(key string) time.Time {
+		t, _ := time.Parse(bandwidthFileTimeLayout, kvs[key])
+		return t
+	}
+
+	header.Timestamp, _ = parseUnixTimestamp(kvs["timestamp"])
+	header.Version = kvs["version"]
+	header.Software = kvs["software"]
+	header.SoftwareVersion = kvs["software_version"]
+	header.FileCreated = parseTime("file_created")
+	header.GeneratorStarted = parseTime("generator_started")
+	header.EarliestBandwidth = parseTime("earliest_bandwidth")
+	header.LatestBandwidth = parseTime("latest_bandwidth")
+
+	return header
+}
+
+// parseBandwidthFileHeaders parses the value of a vote's
+// "bandwidth-file-headers" line.
+func parseBandwidthFileHeaders(line []byte) *BandwidthFileHeader {
+
+	return newBandwidthFileHeader(parseKeyValues(strings.Fields(string(line))))
+}
+
+// parseBandwidthFileDigests parses the value of a vote's
+// "bandwidth-file-digest" line which consists of one or more
+// "algorithm=digest" pairs.
+func parseBandwidthFileDigests(line []byte) ([]BandwidthFileDigest, error) {
+
+	var digests []BandwidthFileDigest
+
+	for _, word := range strings.Fields(string(line)) {
+		kv := strings.SplitN(word, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed bandwidth file digest: %q", word)
+		}
+		digests = append(digests, BandwidthFileDigest{Algorithm: kv[0], Digest: kv[1]})
+	}
+
+	return digests, nil
+}
+
+// BandwidthRelay holds a single relay line of a bandwidth file as defined in
+// bandwidth-file-spec.txt, Section 2.3.  Besides the bandwidth itself, sbws
+// includes diagnostic counters and descriptor values which are useful to
+// understand why a relay was (not) measured.
+type BandwidthRelay struct {
+	Fingerprint      Fingerprint
+	MasterKeyEd25519 string
+	Nickname         string
+	Time             time.Time
+
+	// The bandwidth that is used for voting, in kilobytes per second.
+	Bandwidth       uint64
+	BandwidthMean   uint64
+	BandwidthMedian uint64
+
+	// The descriptor and consensus values the scanner saw, in bytes per
+	// second.
+	DescBandwidthAvg               uint64
+	DescBandwidthBurst             uint64
+	DescBandwidthObsLast           uint64
+	DescBandwidthObsMean           uint64
+	ConsensusBandwidth             uint64
+	ConsensusBandwidthIsUnmeasured bool
+
+	// Measurement success and error counters.
+	Success          uint64
+	ErrorCirc        uint64
+	ErrorStream      uint64
+	ErrorMisc        uint64
+	ErrorDestination uint64
+	ErrorSecondRelay uint64
+
+	RecentMeasurementAttemptCount uint64
+	RecentPriorityListCount       uint64
+	InRecentConsensusCount        uint64
+
+	UnderMinReport bool
+	Unmeasured     bool
+	Vote           bool
+
+	// All key-values of the relay line, including the ones represented
+	// above.
+	KeyValues map[string]string
+}
+
+// BandwidthRelayColumns names the comma-separated columns that
+// BandwidthRelay.String returns, in order.  New columns are only ever
+// appended, so consumers can rely on the position of existing columns.
+var BandwidthRelayColumns = []string{
+	"fingerprint",
+	"nickname",
+	"bandwidth",
+	"time",
+}
+
+// String implements the String as well as the Object interface.  It returns
+// the relay line's string representation whose columns are described by
+// BandwidthRelayColumns.
+func (r *BandwidthRelay) String() string {
+
+	return fmt.Sprintf("%s,%s,%d,%s",
+		r.Fingerprint,
+		strings.Replace(r.Nickname, ",", "", -1),
+		r.Bandwidth,
+		r.Time.Format(time.RFC3339))
+}
+
+// Header returns the comma-separated names of the columns that String
+// returns.
+func (r *BandwidthRelay) Header() string {
+
+	return strings.Join(BandwidthRelayColumns, ",")
+}
+
+// GetFingerprint implements the Object interface.  It returns the relay
+// line's fingerprint.
+func (r *BandwidthRelay) GetFingerprint() Fingerprint {
+
+	return r.Fingerprint
+}
+
+// ParseBandwidthRelayLine parses a single relay line of a bandwidth file and
+// returns the resulting BandwidthRelay.  An error is returned if the line
+// lacks a node_id or has a malformed bw value.  Other malformed values are
+// left at their zero value but remain available in KeyValues.
+func ParseBandwidthRelayLine(line string) (*BandwidthRelay, error) {
+
+	kvs := parseKeyValues(strings.Fields(line))
+	relay := &BandwidthRelay{KeyValues: kvs, Vote: true}
+
+	nodeID, ok := kvs["node_id"]
+	if !ok {
+		return nil, fmt.Errorf("bandwidth file relay line lacks node_id: %q", line)
+	}
+	relay.Fingerprint = SanitiseFingerprint(Fingerprint(strings.TrimPrefix(nodeID, "$")))
+
+	bw, err := strconv.ParseUint(kvs["bw"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed bw value in bandwidth file relay line: %q", line)
+	}
+	relay.Bandwidth = bw
+
+	parseUint := func(key string) uint64 {
+		v, _ := strconv.ParseUint(kvs[key], 10, 64)
+		return v
+	}
+	parseBool := func(key string) bool {
+		return kvs[key] == "1"
+	}
+
+	relay.MasterKeyEd25519 = kvs["master_key_ed25519"]
+	relay.Nickname = kvs["nick"]
+	relay.Time, _ = time.Parse(bandwidthFileTimeLayout, kvs["time"])
+
+	relay.BandwidthMean = parseUint("bw_mean")
+	relay.BandwidthMedian = parseUint("bw_median")
+
+	relay.DescBandwidthAvg = parseUint("desc_bw_avg")
+	relay.DescBandwidthBurst = parseUint("desc_bw_bur")
+	relay.DescBandwidthObsLast = parseUint("desc_bw_obs_last")
+	relay.DescBandwidthObsMean = parseUint("desc_bw_obs_mean")
+	relay.ConsensusBandwidth = parseUint("consensus_bandwidth")
+	relay.ConsensusBandwidthIsUnmeasured = strings.EqualFold(kvs["consensus_bandwidth_is_unmeasured"], "true") ||
+		parseBool("consensus_bandwidth_is_unmeasured")
+
+	relay.Success = parseUint("success")
+	relay.ErrorCirc = parseUint("error_circ")
+	relay.ErrorStream = parseUint("error_stream")
+	relay.ErrorMisc = parseUint("error_misc")
+	relay.ErrorDestination = parseUint("error_destination")
+	relay.ErrorSecondRelay = parseUint("error_second_relay")
+
+	relay.RecentMeasurementAttemptCount = parseUint("relay_recent_measurement_attempt_count")
+	relay.RecentPriorityListCount = parseUint("relay_recent_priority_list_count")
+	relay.InRecentConsensusCount = parseUint("relay_in_recent_consensus_count")
+
+	relay.UnderMinReport = parseBool("under_min_report")
+	relay.Unmeasured = parseBool("unmeasured")
+	if v, ok := kvs["vote"]; ok && v == "0" {
+		relay.Vote = false
+	}
+
+	return relay, nil
+}
+
+// BandwidthJoin holds the result of matching bandwidth file relay lines with
+// the router statuses of a consensus.
+type BandwidthJoin struct {
+	// Relays that were measured but are missing from the consensus, sorted
+	// by fingerprint.
+	MissingFromConsensus []*BandwidthRelay
+
+	// Router statuses in the consensus that were not measured, sorted by
+	// fingerprint.
+	NotMeasured []*RouterStatus
+
+	// A map from relay fingerprint to the ratio between the measured
+	// bandwidth and the relay's consensus weight.  Relays whose consensus
+	// weight is zero are not part of the map.
+	Ratios map[Fingerprint]float64
+}
+
+// JoinBandwidth matches the given bandwidth file relay lines with the router
+// statuses of the given consensus by fingerprint.  It reports relays that
+// were measured but are missing from the consensus and vice versa, and the
+// ratio between measured bandwidth and consensus weight for all relays that
+// are present in both.
+func JoinBandwidth(relays []*BandwidthRelay, c *Consensus) *BandwidthJoin {
+
+	join := &BandwidthJoin{Ratios: make(map[Fingerprint]float64)}
+	measured := make(map[Fingerprint]bool)
+
+	for _, relay := range relays {
+		fpr := SanitiseFingerprint(relay.Fingerprint)
+		measured[fpr] = true
+
+		status, exists := c.Get(fpr)
+		if !exists {
+			join.MissingFromConsensus = append(join.MissingFromConsensus, relay)
+			continue
+		}
+
+		if status.Bandwidth != 0 {
+			join.Ratios[fpr] = float64(relay.Bandwidth) / float64(status.Bandwidth)
+		}
+	}
+
+	for fpr, getStatus := range c.RouterStatuses {
+		if !measured[fpr] {
+			join.NotMeasured = append(join.NotMeasured, getStatus())
+		}
+	}
+	sort.Slice(join.MissingFromConsensus, func(i, j int) bool {
+		return join.MissingFromConsensus[i].Fingerprint < join.MissingFromConsensus[j].Fingerprint
+	})
+	sort.Slice(join.NotMeasured, func(i, j int) bool {
+		return join.NotMeasured[i].Fingerprint < join.NotMeasured[j].Fingerprint
+	})
+
+	return join
+}
+
+// BandwidthFile holds a bandwidth file as defined in bandwidth-file-spec.txt,
+// i.e., the header and the relay lines.
+type BandwidthFile struct {
+	Header *BandwidthFileHeader
+
+	// A map from relay fingerprint to the relay's line.
+	Relays map[Fingerprint]*BandwidthRelay
+}
+
+// isBandwidthFileTerminator returns true if the given line terminates the
+// header of a bandwidth file.  Version 1.1.0 introduced five "=" characters
+// while earlier generators used four.
+func isBandwidthFileTerminator(line string) bool {
+
+	return line == "=====" || line == "===="
+}
+
+// parseBandwidthFile parses the given bandwidth file.  The file may start with
+// a type annotation.  Files of version 1.0.0 lack a header terminator, so
+// their header ends with the first relay line.
+func parseBandwidthFile(r io.Reader) (*BandwidthFile, error) {
+
+	bf := &BandwidthFile{Relays: make(map[Fingerprint]*BandwidthRelay)}
+	kvs := make(map[string]string)
+	inHeader := true
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// The first line holds the timestamp, possibly preceded by a type
+		// annotation.
+		if _, exists := kvs["timestamp"]; !exists {
+			if strings.HasPrefix(line, "@type ") {
+				annotation, err := parseAnnotation(line)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := bandwidthFileAnnotations[*annotation]; !ok {
+					return nil, fmt.Errorf("%w: %s", ErrUnexpectedAnnotation, annotation)
+				}
+				continue
+			}
+			if _, err := parseUnixTimestamp(line); err != nil {
+				return nil, fmt.Errorf("malformed bandwidth file timestamp: %q", line)
+			}
+			kvs["timestamp"] = line
+			continue
+		}
+
+		if inHeader {
+			if isBandwidthFileTerminator(line) {
+				inHeader = false
+				continue
+			}
+			if !strings.Contains(line, "node_id=") {
+				for key, value := range parseKeyValues([]string{line}) {
+					kvs[key] = value
+				}
+				continue
+			}
+			inHeader = false
+		}
+
+		relay, err := ParseBandwidthRelayLine(line)
+		if err != nil {
+			return nil, err
+		}
+		bf.Relays[relay.Fingerprint] = relay
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, exists := kvs["timestamp"]; !exists {
+		return nil, fmt.Errorf("empty bandwidth file")
+	}
+	bf.Header = newBandwidthFileHeader(kvs)
+
+	return bf, nil
+}
+
+// ParseRawBandwidthFile parses a raw bandwidth file (in string format).
+func ParseRawBandwidthFile(rawBandwidthFile string) (*BandwidthFile, error) {
+
+	return parseBandwidthFile(strings.NewReader(rawBandwidthFile))
+}
+
+// ParseBandwidthFile parses the given bandwidth file, as produced by sbws or
+// archived by CollecTor.
+func ParseBandwidthFile(fileName string) (*BandwidthFile, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseBandwidthFile(fd)
+}
+
+// JoinConsensus matches the bandwidth file's relay lines with the router
+// statuses of the given consensus, see JoinBandwidth.
+func (bf *BandwidthFile) JoinConsensus(c *Consensus) *BandwidthJoin {
+
+	relays := make([]*BandwidthRelay, 0, len(bf.Relays))
+	for _, relay := range bf.Relays {
+		relays = append(relays, relay)
+	}
+
+	return JoinBandwidth(relays, c)
+}
@@ -0,0 +1,180 @@
+// Tests functions from "bandwidthfile.go".
+
+package zoossh
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test the function ParseBandwidthRelayLine().
+func TestParseBandwidthRelayLine(t *testing.T) {
+
+	line := "bw=760 bw_mean=803544 bw_median=837872 consensus_bandwidth=1000000 " +
+		"consensus_bandwidth_is_unmeasured=False desc_bw_avg=1073741824 desc_bw_bur=1073741824 " +
+		"desc_bw_obs_last=2006816 desc_bw_obs_mean=2006816 error_circ=1 error_destination=0 " +
+		"error_misc=0 error_second_relay=0 error_stream=2 master_key_ed25519=n0+6NeXwvZ5bsCOyhXfFFhHgALd+wKTXgNqA0/ktPOI " +
+		"nick=snowfall node_id=$68A483E05A2ABDCA6DA5A3EF8DB5177638A27F80 " +
+		"relay_in_recent_consensus_count=3 relay_recent_measurement_attempt_count=2 " +
+		"relay_recent_priority_list_count=2 success=3 time=2019-03-28T14:45:41 " +
+		"under_min_report=1 unmeasured=0 vote=0 xoff_recv=12"
+
+	relay, err := ParseBandwidthRelayLine(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if relay.Fingerprint != "68A483E05A2ABDCA6DA5A3EF8DB5177638A27F80" {
+		t.Error("Unexpected fingerprint.", relay.Fingerprint)
+	}
+	if relay.Nickname != "snowfall" || relay.Bandwidth != 760 || relay.BandwidthMean != 803544 {
+		t.Error("Unexpected nickname or bandwidth values.", relay)
+	}
+	if relay.DescBandwidthObsLast != 2006816 || relay.ConsensusBandwidth != 1000000 {
+		t.Error("Unexpected descriptor or consensus bandwidth.", relay)
+	}
+	if relay.ErrorCirc != 1 || relay.ErrorStream != 2 || relay.Success != 3 {
+		t.Error("Unexpected success or error counters.", relay)
+	}
+	if relay.InRecentConsensusCount != 3 || relay.RecentMeasurementAttemptCount != 2 {
+		t.Error("Unexpected recent counters.", relay)
+	}
+	if !relay.UnderMinReport || relay.Unmeasured || relay.Vote || relay.ConsensusBandwidthIsUnmeasured {
+		t.Error("Unexpected boolean values.", relay)
+	}
+	if relay.Time != time.Date(2019, time.March, 28, 14, 45, 41, 0, time.UTC) {
+		t.Error("Unexpected measurement time.", relay.Time)
+	}
+	if relay.KeyValues["xoff_recv"] != "12" {
+		t.Error("Unknown key-value was not preserved.")
+	}
+
+	if _, err := ParseBandwidthRelayLine("bw=760"); err == nil {
+		t.Error("Relay line without node_id did not raise an error.")
+	}
+	if _, err := ParseBandwidthRelayLine("node_id=$68A483E05A2ABDCA6DA5A3EF8DB5177638A27F80 bw=foo"); err == nil {
+		t.Error("Relay line with malformed bw did not raise an error.")
+	}
+}
+
+// Test the function JoinBandwidth().
+func TestJoinBandwidth(t *testing.T) {
+
+	consensus := NewConsensus()
+	consensus.Set("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+		&RouterStatus{Fingerprint: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", Bandwidth: 100})
+	consensus.Set("BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB",
+		&RouterStatus{Fingerprint: "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB", Bandwidth: 50})
+
+	relays := []*BandwidthRelay{
+		{Fingerprint: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", Bandwidth: 200},
+		{Fingerprint: "CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC", Bandwidth: 10},
+	}
+
+	join := JoinBandwidth(relays, consensus)
+
+	if len(join.MissingFromConsensus) != 1 || join.MissingFromConsensus[0].Fingerprint != "CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCC" {
+		t.Error("Failed to determine measured relays missing from consensus.")
+	}
+	if len(join.NotMeasured) != 1 || join.NotMeasured[0].Fingerprint != "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB" {
+		t.Error("Failed to determine unmeasured relays in consensus.")
+	}
+	if ratio, ok := join.Ratios["AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"]; !ok || ratio != 2 {
+		t.Error("Unexpected measured-vs-consensus ratio.", ratio)
+	}
+
+	// Unmeasured relays are sorted by fingerprint.
+	for _, fpr := range []Fingerprint{"DDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDD", "0000000000000000000000000000000000000000"} {
+		consensus.Set(fpr, &RouterStatus{Fingerprint: fpr})
+	}
+	join = JoinBandwidth(relays, consensus)
+	if len(join.NotMeasured) != 3 ||
+		join.NotMeasured[0].Fingerprint != "0000000000000000000000000000000000000000" ||
+		join.NotMeasured[1].Fingerprint != "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB" ||
+		join.NotMeasured[2].Fingerprint != "DDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDDD" {
+		t.Error("Unmeasured relays are not sorted by fingerprint.")
+	}
+
+	// So are measured relays that are missing from the consensus, even
+	// if they come from a bandwidth file's map.
+	bf := &BandwidthFile{Relays: make(map[Fingerprint]*BandwidthRelay)}
+	for _, fpr := range []Fingerprint{"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "1111111111111111111111111111111111111111",
+		"EEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEE", "2222222222222222222222222222222222222222"} {
+		bf.Relays[fpr] = &BandwidthRelay{Fingerprint: fpr}
+	}
+	join = bf.JoinConsensus(consensus)
+	if len(join.MissingFromConsensus) != 4 ||
+		join.MissingFromConsensus[0].Fingerprint != "1111111111111111111111111111111111111111" ||
+		join.MissingFromConsensus[1].Fingerprint != "2222222222222222222222222222222222222222" ||
+		join.MissingFromConsensus[2].Fingerprint != "EEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEEE" ||
+		join.MissingFromConsensus[3].Fingerprint != "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" {
+		t.Error("Relays missing from consensus are not sorted by fingerprint.")
+	}
+}
+
+// Test the function ParseRawBandwidthFile().
+func TestParseRawBandwidthFile(t *testing.T) {
+
+	raw := `@type bandwidth-file 1.0
+1553784341
+version=1.4.0
+software=sbws
+software_version=1.1.0
+file_created=2019-03-28T14:45:48
+number_eligible_relays=2
+=====
+bw=760 nick=snowfall node_id=$68A483E05A2ABDCA6DA5A3EF8DB5177638A27F80 time=2019-03-28T14:45:41
+bw=1 nick=seele node_id=$000A10D43011EA4928A35F610405F92B4433B4DC unmeasured=1 vote=0
+`
+
+	bf, err := ParseRawBandwidthFile(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bf.Header.Software != "sbws" || bf.Header.Version != "1.4.0" || !bf.Header.Timestamp.Equal(time.Unix(1553784341, 0)) {
+		t.Error("Unexpected bandwidth file header.", bf.Header)
+	}
+	if bf.Header.KeyValues["number_eligible_relays"] != "2" {
+		t.Error("Unknown header key-value was not preserved.")
+	}
+	if len(bf.Relays) != 2 {
+		t.Fatalf("Expected 2 relay lines but got %d.", len(bf.Relays))
+	}
+	relay := bf.Relays["000A10D43011EA4928A35F610405F92B4433B4DC"]
+	if relay == nil || !relay.Unmeasured || relay.Vote {
+		t.Error("Unexpected relay line.", relay)
+	}
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	join := bf.JoinConsensus(vote)
+	if len(join.MissingFromConsensus) != 1 || len(join.NotMeasured) != 1 || join.Ratios["000A10D43011EA4928A35F610405F92B4433B4DC"] != 1.0/18 {
+		t.Error("Unexpected join with consensus.", join)
+	}
+
+	// Files of other types are rejected.
+	other := strings.Replace(raw, "@type bandwidth-file 1.0", "@type bandwidth-file 2.0", 1)
+	if _, err := ParseRawBandwidthFile(other); !errors.Is(err, ErrUnexpectedAnnotation) {
+		t.Errorf("Expected ErrUnexpectedAnnotation but got %v.", err)
+	}
+
+	// Version 1.0.0 files lack both header key-values and terminator.
+	bf, err = ParseRawBandwidthFile("1523911758\nnode_id=$68A483E05A2ABDCA6DA5A3EF8DB5177638A27F80 bw=760 nick=snowfall\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bf.Relays) != 1 || bf.Header.Timestamp.IsZero() {
+		t.Error("Unexpected version 1.0.0 bandwidth file.", bf)
+	}
+
+	for _, malformed := range []string{"", "version=1.4.0\n", "1523911758\n=====\nbw=1\n"} {
+		if _, err := ParseRawBandwidthFile(malformed); err == nil {
+			t.Errorf("Expected error for %q.", malformed)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Provides helpers for sanitized bridge data.
+
+package zoossh
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// HashFingerprint returns the hashed fingerprint that sanitized bridge
+// documents use to identify the bridge with the given fingerprint, i.e., the
+// SHA-1 digest over the fingerprint's binary representation.  An error is
+// returned if the given fingerprint is not hex-encoded.
+func HashFingerprint(fingerprint Fingerprint) (Fingerprint, error) {
+
+	raw, err := hex.DecodeString(string(SanitiseFingerprint(fingerprint)))
+	if err != nil {
+		return "", fmt.Errorf("could not decode fingerprint %q: %s", fingerprint, err)
+	}
+
+	digest := sha1.Sum(raw)
+
+	return Fingerprint(strings.ToUpper(hex.EncodeToString(digest[:]))), nil
+}
+
+// matchesHashedFingerprint returns true if the given fingerprint hashes to
+// the given hashed fingerprint.
+func matchesHashedFingerprint(fingerprint, hashed Fingerprint) bool {
+
+	h, err := HashFingerprint(fingerprint)
+	if err != nil {
+		return false
+	}
+
+	return h == SanitiseFingerprint(hashed)
+}
+
+// GetByHashedFingerprint returns the router status whose fingerprint hashes
+// to the given hashed fingerprint and a boolean value indicating if such a
+// status could be found in the consensus.  This takes linear time because
+// every fingerprint in the consensus has to be hashed.
+func (c *Consensus) GetByHashedFingerprint(hashed Fingerprint) (*RouterStatus, bool) {
+
+	for fingerprint, getStatus := range c.RouterStatuses {
+		if matchesHashedFingerprint(fingerprint, hashed) {
+			return getStatus(), true
+		}
+	}
+
+	return nil, false
+}
+
+// GetByHashedFingerprint returns the router descriptor whose fingerprint
+// hashes to the given hashed fingerprint and a boolean value indicating if
+// such a descriptor could be found.  This takes linear time because every
+// fingerprint in the set has to be hashed.
+func (rds *RouterDescriptors) GetByHashedFingerprint(hashed Fingerprint) (*RouterDescriptor, bool) {
+
+	for fingerprint, getDescriptor := range rds.RouterDescriptors {
+		if matchesHashedFingerprint(fingerprint, hashed) {
+			return getDescriptor(), true
+		}
+	}
+
+	return nil, false
+}
+
+var (
+	// Sanitized bridge descriptors replace IPv4 addresses with addresses in
+	// 10.0.0.0/8 and IPv6 addresses with addresses in fd9f:2e19:3bcf::/48.
+	// See <https://metrics.torproject.org/bridge-descriptors.html>.
+	sanitizedIPv4Net = mustParseCIDR("10.0.0.0/8")
+	sanitizedIPv6Net = mustParseCIDR("fd9f:2e19:3bcf::/48")
+
+	hexFingerprintRegexp = regexp.MustCompile(`^[0-9A-F]{40}$`)
+)
+
+// The contact line that sanitized bridge descriptors contain in place of the
+// operator's contact information.
+const sanitizedContact = "somebody"
+
+// SanitizationViolation describes a field of a bridge document that does not
+// appear to be sanitized.
+type SanitizationViolation struct {
+	Fingerprint Fingerprint
+	Field       string
+	Value       string
+}
+
+// String implements the Stringer interface for pretty printing.
+func (v SanitizationViolation) String() string {
+
+	return fmt.Sprintf("%s: unsanitized %s %q", v.Fingerprint, v.Field, v.Value)
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return ipNet
+}
+
+// checkSanitizedFingerprint returns a violation if the given fingerprint is
+// not a 40-digit hex string as produced by HashFingerprint.
+func checkSanitizedFingerprint(fingerprint Fingerprint) []SanitizationViolation {
+
+	if hexFingerprintRegexp.MatchString(string(fingerprint)) {
+		return nil
+	}
+
+	return []SanitizationViolation{{fingerprint, "fingerprint", string(fingerprint)}}
+}
+
+// checkSanitizedAddress returns a violation if the given address is set but
+// not part of the given network.
+func checkSanitizedAddress(fingerprint Fingerprint, field string, addr net.IP, ipNet *net.IPNet) []SanitizationViolation {
+
+	if addr == nil || ipNet.Contains(addr) {
+		return nil
+	}
+
+	return []SanitizationViolation{{fingerprint, field, addr.String()}}
+}
+
+// CheckSanitizedConsensus checks if the router statuses of the given bridge
+// network status are sanitized, i.e., if fingerprints are hashed and
+// addresses are scrubbed.  It returns all violations it found.
+func CheckSanitizedConsensus(c *Consensus) []SanitizationViolation {
+
+	var violations []SanitizationViolation
+
+	for _, getStatus := range c.RouterStatuses {
+		status := getStatus()
+		fpr := status.Fingerprint
+		violations = append(violations, checkSanitizedFingerprint(fpr)...)
+		violations = append(violations, checkSanitizedAddress(fpr, "IPv4 address", status.Address.IPv4Address, sanitizedIPv4Net)...)
+		violations = append(violations, checkSanitizedAddress(fpr, "IPv6 address", status.Address.IPv6Address, sanitizedIPv6Net)...)
+	}
+
+	return violations
+}
+
+// CheckSanitizedDescriptors checks if the given bridge descriptors are
+// sanitized, i.e., if fingerprints are hashed, addresses are scrubbed, and
+// contact information was replaced.  It returns all violations it found.
+func CheckSanitizedDescriptors(rds *RouterDescriptors) []SanitizationViolation {
+
+	var violations []SanitizationViolation
+
+	for _, getDescriptor := range rds.RouterDescriptors {
+		desc := getDescriptor()
+		fpr := desc.Fingerprint
+		violations = append(violations, checkSanitizedFingerprint(fpr)...)
+		violations = append(violations, checkSanitizedAddress(fpr, "address", desc.Address, sanitizedIPv4Net)...)
+		if desc.Contact != "" && desc.Contact != sanitizedContact {
+			violations = append(violations, SanitizationViolation{fpr, "contact", desc.Contact})
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,81 @@
+// Tests functions from "bridge.go".
+
+package zoossh
+
+import (
+	"net"
+	"testing"
+)
+
+// Test the function HashFingerprint().
+func TestHashFingerprint(t *testing.T) {
+
+	// The SHA-1 digest over twenty zero bytes.
+	hashed, err := HashFingerprint("0000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashed != "6768033E216468247BD031A0A2D9876D79818F8F" {
+		t.Error("Unexpected hashed fingerprint.", hashed)
+	}
+
+	if _, err := HashFingerprint("not a fingerprint"); err == nil {
+		t.Error("Invalid fingerprint did not raise an error.")
+	}
+}
+
+// Test the function GetByHashedFingerprint().
+func TestGetByHashedFingerprint(t *testing.T) {
+
+	fpr := Fingerprint("0000000000000000000000000000000000000000")
+	hashed := Fingerprint("6768033E216468247BD031A0A2D9876D79818F8F")
+
+	consensus := NewConsensus()
+	consensus.Set(fpr, &RouterStatus{Fingerprint: fpr})
+	if status, found := consensus.GetByHashedFingerprint(hashed); !found || status.Fingerprint != fpr {
+		t.Error("Failed to find router status by hashed fingerprint.")
+	}
+	if _, found := consensus.GetByHashedFingerprint(fpr); found {
+		t.Error("Found router status by unhashed fingerprint.")
+	}
+
+	descs := NewRouterDescriptors()
+	descs.Set(fpr, &RouterDescriptor{Fingerprint: fpr})
+	if desc, found := descs.GetByHashedFingerprint(hashed); !found || desc.Fingerprint != fpr {
+		t.Error("Failed to find router descriptor by hashed fingerprint.")
+	}
+}
+
+// Test the functions CheckSanitizedConsensus() and CheckSanitizedDescriptors().
+func TestCheckSanitized(t *testing.T) {
+
+	hashed := Fingerprint("6768033E216468247BD031A0A2D9876D79818F8F")
+
+	consensus := NewConsensus()
+	status := &RouterStatus{Fingerprint: hashed}
+	status.Address.IPv4Address = net.ParseIP("10.1.2.3")
+	status.Address.IPv6Address = net.ParseIP("fd9f:2e19:3bcf::1:2")
+	consensus.Set(hashed, status)
+	if violations := CheckSanitizedConsensus(consensus); len(violations) != 0 {
+		t.Error("Sanitized bridge status considered unsanitized.", violations)
+	}
+
+	status.Address.IPv4Address = net.ParseIP("193.11.166.194")
+	status.Address.IPv6Address = net.ParseIP("2002:470:6e:80d::2")
+	if violations := CheckSanitizedConsensus(consensus); len(violations) != 2 {
+		t.Error("Failed to detect unsanitized addresses.", violations)
+	}
+
+	descs := NewRouterDescriptors()
+	desc := &RouterDescriptor{Fingerprint: "foo", Address: net.ParseIP("10.0.0.1"), Contact: "Jane <jane@example.com>"}
+	descs.Set(desc.Fingerprint, desc)
+	if violations := CheckSanitizedDescriptors(descs); len(violations) != 2 {
+		t.Error("Failed to detect unsanitized fingerprint and contact.", violations)
+	}
+
+	desc.Fingerprint = hashed
+	desc.Contact = "somebody"
+	if violations := CheckSanitizedDescriptors(descs); len(violations) != 0 {
+		t.Error("Sanitized bridge descriptor considered unsanitized.", violations)
+	}
+}
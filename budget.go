@@ -0,0 +1,201 @@
+// Provides a memory budget for lazily parsed entries.
+
+package zoossh
+
+import (
+	"container/list"
+	"sync"
+)
+
+// budgetEntry is a single lazily parsed entry whose parsed form may be
+// retained by a MemoryBudget.
+type budgetEntry struct {
+	cost  int64
+	value interface{}
+
+	// The entry's position in the budget's LRU list, or nil if the entry is
+	// currently not materialised.
+	elem *list.Element
+}
+
+// MemoryBudget bounds the memory that is used by materialised entries of
+// lazily parsed documents.  Lazily parsed entries normally retain only their
+// raw text and are parsed whenever they are accessed.  Entries that are
+// parsed using a budget instead keep their parsed form until the budget is
+// exceeded, at which point the least recently used ones are evicted and
+// re-parsed from their raw text on the next access.  This lets interactive
+// tools keep many documents loaded within a fixed amount of memory.
+//
+// The cost of an entry is approximated by the length of its raw text.  As
+// evicted entries are re-parsed, changes that callers make to them may be
+// lost; callers should treat them as read-only.  A MemoryBudget is safe for
+// concurrent use and can be shared across documents.
+type MemoryBudget struct {
+	sync.Mutex
+
+	limit int64
+	used  int64
+
+	// Materialised entries, with the most recently used one at the front.
+	lru *list.List
+}
+
+// NewMemoryBudget returns a new memory budget that retains materialised
+// entries up to the given number of bytes.
+func NewMemoryBudget(limit int64) *MemoryBudget {
+
+	return &MemoryBudget{limit: limit, lru: list.New()}
+}
+
+// get returns the parsed form of the given entry, calling parse if the entry
+// is not materialised, and evicts the least recently used entries if the
+// budget is exceeded.
+func (b *MemoryBudget) get(entry *budgetEntry, parse func() interface{}) interface{} {
+
+	b.Lock()
+	if entry.elem != nil {
+		b.lru.MoveToFront(entry.elem)
+		value := entry.value
+		b.Unlock()
+		return value
+	}
+	b.Unlock()
+
+	// Parse without holding the lock, so other entries remain accessible.
+	value := parse()
+
+	b.Lock()
+	defer b.Unlock()
+
+	// Another goroutine may have materialised the entry in the meantime.
+	if entry.elem != nil {
+		b.lru.MoveToFront(entry.elem)
+		return entry.value
+	}
+
+	entry.value = value
+	entry.elem = b.lru.PushFront(entry)
+	b.used += entry.cost
+
+	for b.used > b.limit && b.lru.Len() > 1 {
+		b.evict(b.lru.Back().Value.(*budgetEntry))
+	}
+
+	return value
+}
+
+// evict drops the parsed form of the given entry.  The caller must hold the
+// lock.
+func (b *MemoryBudget) evict(entry *budgetEntry) {
+
+	b.lru.Remove(entry.elem)
+	b.used -= entry.cost
+	entry.elem = nil
+	entry.value = nil
+}
+
+// Stats returns the number of bytes that are currently accounted to
+// materialised entries and the number of those entries.
+func (b *MemoryBudget) Stats() (used int64, materialised int) {
+
+	b.Lock()
+	defer b.Unlock()
+
+	return b.used, b.lru.Len()
+}
+
+// Purge evicts all materialised entries.
+func (b *MemoryBudget) Purge() {
+
+	b.Lock()
+	defer b.Unlock()
+
+	for b.lru.Len() > 0 {
+		b.evict(b.lru.Back().Value.(*budgetEntry))
+	}
+}
+
+// wrapStatusParser wraps the given lazy router status parser so that parsed
+// router statuses are retained within the budget.
+func (b *MemoryBudget) wrapStatusParser(parser func(string) (Fingerprint, GetStatus, error)) func(string) (Fingerprint, GetStatus, error) {
+
+	return func(rawStatus string) (Fingerprint, GetStatus, error) {
+		fingerprint, getStatus, err := parser(rawStatus)
+		if err != nil {
+			return "", nil, err
+		}
+		return fingerprint, b.wrapStatus(getStatus, int64(len(rawStatus))), nil
+	}
+}
+
+// wrapStatus wraps the given lazy router status getter, whose raw router
+// status is of the given size, so that its parsed router status is retained
+// within the budget.
+func (b *MemoryBudget) wrapStatus(getStatus GetStatus, cost int64) GetStatus {
+
+	entry := &budgetEntry{cost: cost}
+	return func() *RouterStatus {
+		return b.get(entry, func() interface{} { return getStatus() }).(*RouterStatus)
+	}
+}
+
+// wrapDescriptorParser wraps the given lazy router descriptor parser so that
+// parsed router descriptors are retained within the budget.
+func (b *MemoryBudget) wrapDescriptorParser(parser func(string) (Fingerprint, GetDescriptor, error)) func(string) (Fingerprint, GetDescriptor, error) {
+
+	return func(rawDescriptor string) (Fingerprint, GetDescriptor, error) {
+		fingerprint, getDescriptor, err := parser(rawDescriptor)
+		if err != nil {
+			return "", nil, err
+		}
+		return fingerprint, b.wrapDescriptor(getDescriptor, int64(len(rawDescriptor))), nil
+	}
+}
+
+// wrapDescriptor wraps the given lazy router descriptor getter, whose raw
+// router descriptor is of the given size, so that its parsed router
+// descriptor is retained within the budget.
+func (b *MemoryBudget) wrapDescriptor(getDescriptor GetDescriptor, cost int64) GetDescriptor {
+
+	entry := &budgetEntry{cost: cost}
+	return func() *RouterDescriptor {
+		return b.get(entry, func() interface{} { return getDescriptor() }).(*RouterDescriptor)
+	}
+}
+
+// wrapMicrodescriptorParser wraps the given lazy microdescriptor parser so
+// that parsed microdescriptors are retained within the budget.
+func (b *MemoryBudget) wrapMicrodescriptorParser(parser func(string) (string, GetMicrodescriptor, error)) func(string) (string, GetMicrodescriptor, error) {
+
+	return func(rawMicrodescriptor string) (string, GetMicrodescriptor, error) {
+		digest, getMicrodescriptor, err := parser(rawMicrodescriptor)
+		if err != nil {
+			return "", nil, err
+		}
+		entry := &budgetEntry{cost: int64(len(rawMicrodescriptor))}
+		return digest, func() *Microdescriptor {
+			return b.get(entry, func() interface{} { return getMicrodescriptor() }).(*Microdescriptor)
+		}, nil
+	}
+}
+
+// ParseConsensusFile lazily parses the given annotated consensus file and
+// retains accessed router statuses within the budget.
+func (b *MemoryBudget) ParseConsensusFile(fileName string) (*Consensus, error) {
+
+	return parseConsensusFile(fileName, parseOptions{lazy: true, budget: b})
+}
+
+// ParseDescriptorFile lazily parses the given annotated router descriptor file
+// and retains accessed router descriptors within the budget.
+func (b *MemoryBudget) ParseDescriptorFile(fileName string) (*RouterDescriptors, error) {
+
+	return parseDescriptorFile(fileName, parseOptions{lazy: true, budget: b})
+}
+
+// ParseMicrodescriptorFile lazily parses the given annotated microdescriptor
+// file and retains accessed microdescriptors within the budget.
+func (b *MemoryBudget) ParseMicrodescriptorFile(fileName string) (*Microdescriptors, error) {
+
+	return parseMicrodescriptorFile(fileName, parseOptions{lazy: true, budget: b})
+}
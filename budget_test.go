@@ -0,0 +1,49 @@
+// Tests functions from "budget.go".
+
+package zoossh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryBudget(t *testing.T) {
+
+	// Large enough for a single router status only.
+	budget := NewMemoryBudget(400)
+
+	consensus, err := parseConsensus(strings.NewReader(testVote), parseOptions{lazy: true, budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seele := Fingerprint("000A10D43011EA4928A35F610405F92B4433B4DC")
+	karlstad := Fingerprint("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+
+	// Parsing may already have materialised router statuses.
+	budget.Purge()
+
+	a, _ := consensus.Get(seele)
+	b, _ := consensus.Get(seele)
+	if a != b {
+		t.Error("Materialised router status was parsed again.")
+	}
+
+	// Accessing another router status must evict the first one.
+	c, _ := consensus.Get(karlstad)
+	if c.Nickname != "Karlstad0" {
+		t.Errorf("Expected Karlstad0 but got %s.", c.Nickname)
+	}
+	if _, materialised := budget.Stats(); materialised != 1 {
+		t.Errorf("Expected 1 materialised entry but got %d.", materialised)
+	}
+	d, _ := consensus.Get(seele)
+	if d == a || d.Nickname != "seele" {
+		t.Error("Evicted router status was not parsed again.")
+	}
+
+	budget.Purge()
+	if used, materialised := budget.Stats(); used != 0 || materialised != 0 {
+		t.Errorf("Expected empty budget but got %d bytes in %d entries.", used, materialised)
+	}
+}
@@ -0,0 +1,141 @@
+// Provides churn statistics for series of bridge network statuses.
+
+package zoossh
+
+import (
+	"fmt"
+	"time"
+)
+
+// BridgeChurnDay describes how the bridge population changed on a single day
+// compared to the previous day in the series.
+type BridgeChurnDay struct {
+	// Midnight UTC of the day.
+	Day time.Time
+
+	// The number of distinct bridges listed on this day.
+	Bridges int
+
+	// The number of hashed fingerprints that no earlier day listed.
+	New int
+
+	// The number of bridges that the previous day listed but this day does
+	// not, and their fraction of the previous day's bridges.
+	Disappeared       int
+	DisappearanceRate float64
+
+	// Maps a flag to the fraction of bridges listed on both this and the
+	// previous day whose flag did not change.  Only flags that at least one
+	// of these bridges had on either day are present.
+	FlagStability map[string]float64
+}
+
+// bridgeDay holds the flags of all bridges that were listed on a day.  If a
+// bridge was listed several times, its last flags count.
+type bridgeDay struct {
+	day   time.Time
+	flags map[Fingerprint]map[string]bool
+}
+
+// flagSet turns the given flags into a set of flag names.
+func flagSet(flags RouterFlags) map[string]bool {
+
+	set := make(map[string]bool)
+	for _, name := range flags.flagNames() {
+		set[name] = true
+	}
+
+	return set
+}
+
+// compareBridgeDays computes the churn between the given days.
+func compareBridgeDays(prev, cur *bridgeDay, everSeen map[Fingerprint]bool) *BridgeChurnDay {
+
+	churn := &BridgeChurnDay{
+		Day:           cur.day,
+		Bridges:       len(cur.flags),
+		FlagStability: make(map[string]float64),
+	}
+
+	for fpr := range cur.flags {
+		if !everSeen[fpr] {
+			churn.New++
+			everSeen[fpr] = true
+		}
+	}
+	if prev == nil {
+		return churn
+	}
+
+	// Determine the bridges that are listed on both days, and the flags
+	// that any of them had.
+	var continuing []Fingerprint
+	names := make(map[string]bool)
+	for fpr, prevFlags := range prev.flags {
+		curFlags, exists := cur.flags[fpr]
+		if !exists {
+			churn.Disappeared++
+			continue
+		}
+		continuing = append(continuing, fpr)
+		for name := range prevFlags {
+			names[name] = true
+		}
+		for name := range curFlags {
+			names[name] = true
+		}
+	}
+
+	if len(prev.flags) > 0 {
+		churn.DisappearanceRate = float64(churn.Disappeared) / float64(len(prev.flags))
+	}
+	for name := range names {
+		unchanged := 0
+		for _, fpr := range continuing {
+			if prev.flags[fpr][name] == cur.flags[fpr][name] {
+				unchanged++
+			}
+		}
+		churn.FlagStability[name] = float64(unchanged) / float64(len(continuing))
+	}
+
+	return churn
+}
+
+// BridgeChurn merges the given chronological series of bridge network
+// statuses into days and reports for every day how many bridges appeared,
+// how many disappeared, and how stable their flags were.  Bridges are
+// identified by their hashed fingerprints.  Days without any network status
+// are skipped, so the churn of a day is computed relative to the previous
+// day that is part of the series.
+func BridgeChurn(in <-chan *Consensus) ([]*BridgeChurnDay, error) {
+
+	var report []*BridgeChurnDay
+	var prev, cur *bridgeDay
+	everSeen := make(map[Fingerprint]bool)
+
+	for c := range in {
+		day := utcDay(c.ValidAfter)
+
+		if cur != nil && day.Before(cur.day) {
+			drain(in)
+			return nil, fmt.Errorf("bridge network status of %s arrived after one of %s", day, cur.day)
+		}
+		if cur == nil || day.After(cur.day) {
+			if cur != nil {
+				report = append(report, compareBridgeDays(prev, cur, everSeen))
+			}
+			prev = cur
+			cur = &bridgeDay{day: day, flags: make(map[Fingerprint]map[string]bool)}
+		}
+
+		for fpr, getStatus := range c.RouterStatuses {
+			cur.flags[fpr] = flagSet(getStatus().Flags)
+		}
+	}
+	if cur != nil {
+		report = append(report, compareBridgeDays(prev, cur, everSeen))
+	}
+
+	return report, nil
+}
@@ -0,0 +1,65 @@
+// Tests functions from "churn.go".
+
+package zoossh
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBridgeChurn(t *testing.T) {
+
+	start := time.Date(2017, time.April, 15, 0, 0, 0, 0, time.UTC)
+	a := Fingerprint(strings.Repeat("A", 40))
+	b := Fingerprint(strings.Repeat("B", 40))
+	c := Fingerprint(strings.Repeat("C", 40))
+
+	statuses := []map[Fingerprint]RouterFlags{
+		// Two statuses on the first day.
+		{a: {Running: true}},
+		{a: {Running: true, Stable: true}, b: {Running: true}},
+		// One status on the second day.
+		{a: {Running: true}, c: {Running: true}},
+	}
+	times := []time.Time{start, start.Add(12 * time.Hour), start.Add(Day)}
+
+	in := make(chan *Consensus)
+	go func() {
+		for i, flags := range statuses {
+			consensus := NewConsensus()
+			consensus.ValidAfter = times[i]
+			for fpr, f := range flags {
+				consensus.Set(fpr, &RouterStatus{Fingerprint: fpr, Flags: f})
+			}
+			in <- consensus
+		}
+		close(in)
+	}()
+
+	report, err := BridgeChurn(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 2 {
+		t.Fatalf("Expected 2 days but got %d.", len(report))
+	}
+
+	if first := report[0]; first.Bridges != 2 || first.New != 2 || first.Disappeared != 0 {
+		t.Errorf("Unexpected first day %+v.", first)
+	}
+
+	second := report[1]
+	if second.Bridges != 2 || second.New != 1 || second.Disappeared != 1 || second.DisappearanceRate != 0.5 {
+		t.Errorf("Unexpected second day %+v.", second)
+	}
+	if second.FlagStability["Running"] != 1 || second.FlagStability["Stable"] != 0 {
+		t.Errorf("Unexpected flag stability %v.", second.FlagStability)
+	}
+
+	unordered, done := unorderedSeries(start)
+	if _, err := BridgeChurn(unordered); err == nil {
+		t.Error("Out-of-order bridge network statuses did not raise an error.")
+	}
+	expectDrained(t, done)
+}
@@ -0,0 +1,474 @@
+// Provides a caching HTTP client for fetching the current consensus and the
+// key certificates of the directory authorities.
+
+package zoossh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// The path under which directory caches serve the current consensus,
+	// as per dir-spec.txt, Section 6.2.
+	consensusURLPath = "/tor/status-vote/current/consensus"
+
+	// The path under which directory caches serve the key certificates of
+	// all directory authorities, as per dir-spec.txt, Section 6.2.
+	keyCertificatesURLPath = "/tor/keys/all"
+
+	// The paths under which directory caches serve server descriptors and
+	// microdescriptors by digest, as per dir-spec.txt, Section 6.2.
+	serverDescriptorsURLPath = "/tor/server/d/"
+	microdescriptorsURLPath  = "/tor/micro/d/"
+
+	// The number of descriptors and microdescriptors that tor requests at
+	// once, which keeps URLs short enough for directory caches.
+	maxDescriptorsPerRequest      = 96
+	maxMicrodescriptorsPerRequest = 92
+
+	// The suffix of the file that holds the HTTP validators of the cached
+	// consensus.
+	cacheMetaSuffix = ".meta"
+)
+
+// ConsensusClient fetches the current consensus from directory mirrors.  It
+// caches the last consensus on disk, only contacts mirrors once the cached
+// consensus is no longer fresh, and then uses conditional requests so
+// unchanged consensuses are not downloaded again.  Mirrors are tried in order
+// until one of them returns a consensus that is valid.
+type ConsensusClient struct {
+	// Base URLs of directory mirrors, e.g., "http://128.31.0.34:9131".
+	Mirrors []string
+
+	// The file in which the last consensus is cached.  Caching is disabled
+	// if empty.
+	CacheFile string
+
+	// The HTTP client used for requests.  http.DefaultClient is used if
+	// nil.
+	HTTPClient *http.Client
+
+	// Returns the current time.  time.Now is used if nil.
+	Now func() time.Time
+}
+
+// NewConsensusClient returns a new client that caches consensuses in the
+// given file and fetches them from the given mirrors.
+func NewConsensusClient(cacheFile string, mirrors ...string) *ConsensusClient {
+
+	return &ConsensusClient{
+		Mirrors:    mirrors,
+		CacheFile:  cacheFile,
+		HTTPClient: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// NewAuthorityConsensusClient returns a new client that caches consensuses in
+// the given file and fetches them from the directory ports of the directory
+// authorities in DirectoryAuthorities.
+func NewAuthorityConsensusClient(cacheFile string) *ConsensusClient {
+
+	var mirrors []string
+	for _, authority := range DirectoryAuthorities {
+		mirrors = append(mirrors, "http://"+authority.DirAddress)
+	}
+
+	return NewConsensusClient(cacheFile, mirrors...)
+}
+
+// cachedConsensus is a consensus along with the HTTP validators that were
+// sent when it was downloaded.
+type cachedConsensus struct {
+	raw          []byte
+	consensus    *Consensus
+	etag         string
+	lastModified string
+}
+
+func (cc *ConsensusClient) now() time.Time {
+
+	if cc.Now != nil {
+		return cc.Now()
+	}
+	return time.Now()
+}
+
+func (cc *ConsensusClient) httpClient() *http.Client {
+
+	if cc.HTTPClient != nil {
+		return cc.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// parseDirectoryConsensus parses a consensus as served by directory caches,
+// i.e., without type annotation.
+func parseDirectoryConsensus(raw []byte) (*Consensus, error) {
+
+	return parseConsensusUnchecked(bytes.NewReader(raw), parseOptions{strict: true})
+}
+
+// loadCache returns the cached consensus, or nil if there is none.
+func (cc *ConsensusClient) loadCache() *cachedConsensus {
+
+	if cc.CacheFile == "" {
+		return nil
+	}
+
+	raw, err := ioutil.ReadFile(cc.CacheFile)
+	if err != nil {
+		return nil
+	}
+	consensus, err := parseDirectoryConsensus(raw)
+	if err != nil {
+		return nil
+	}
+	cached := &cachedConsensus{raw: raw, consensus: consensus}
+
+	meta, err := ioutil.ReadFile(cc.CacheFile + cacheMetaSuffix)
+	if err != nil {
+		return cached
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(meta))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), " ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "etag":
+			cached.etag = kv[1]
+		case "last-modified":
+			cached.lastModified = kv[1]
+		}
+	}
+
+	return cached
+}
+
+// writeFileAtomically writes the given data to a temporary file that then
+// replaces the named file.
+func writeFileAtomically(fileName string, data []byte) error {
+
+	fd, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		os.Remove(fd.Name())
+		return err
+	}
+
+	return os.Rename(fd.Name(), fileName)
+}
+
+// storeCache writes the given consensus to the cache.
+func (cc *ConsensusClient) storeCache(cached *cachedConsensus) error {
+
+	if cc.CacheFile == "" {
+		return nil
+	}
+
+	// The consensus goes first.  If we fail in between, the old validators
+	// describe an older consensus and merely cause the next request to fetch
+	// the consensus again, whereas new validators next to an old consensus
+	// would keep us from ever updating it.
+	if err := writeFileAtomically(cc.CacheFile, cached.raw); err != nil {
+		return err
+	}
+	meta := fmt.Sprintf("etag %s\nlast-modified %s\n", cached.etag, cached.lastModified)
+
+	return writeFileAtomically(cc.CacheFile+cacheMetaSuffix, []byte(meta))
+}
+
+// checkValidity returns an error if the given consensus is not valid at the
+// given time.
+func checkValidity(c *Consensus, now time.Time) error {
+
+	if now.Before(c.ValidAfter) {
+		return fmt.Errorf("consensus is not valid before %s", c.ValidAfter)
+	}
+	if !now.Before(c.ValidUntil) {
+		return fmt.Errorf("consensus expired at %s", c.ValidUntil)
+	}
+
+	return nil
+}
+
+// fetchFrom requests the consensus from the given mirror.  If the mirror
+// reports that the cached consensus is unchanged, the cached consensus is
+// returned.
+func (cc *ConsensusClient) fetchFrom(mirror string, cached *cachedConsensus) (*cachedConsensus, error) {
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(mirror, "/")+consensusURLPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		} else {
+			req.Header.Set("If-Modified-Since", cached.consensus.ValidAfter.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	resp, err := cc.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if cached == nil {
+			return nil, errors.New("unexpected 304 response")
+		}
+		return cached, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected HTTP status %q", resp.Status)
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	consensus, err := parseDirectoryConsensus(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachedConsensus{
+		raw:          raw,
+		consensus:    consensus,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// Fetch returns the current consensus.  The cached consensus is returned as
+// long as it is fresh.  Otherwise, mirrors are asked for a newer consensus
+// and the first valid one is cached and returned.  If no mirror provides a
+// valid consensus, the cached consensus is returned as long as it is still
+// valid.  An error is returned if no valid consensus is available.
+func (cc *ConsensusClient) Fetch() (*Consensus, error) {
+
+	now := cc.now()
+	cached := cc.loadCache()
+	if cached != nil && now.Before(cached.consensus.FreshUntil) && checkValidity(cached.consensus, now) == nil {
+		return cached.consensus, nil
+	}
+
+	var errs []string
+	for _, mirror := range cc.Mirrors {
+		fetched, err := cc.fetchFrom(mirror, cached)
+		if err == nil {
+			err = checkValidity(fetched.consensus, now)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", mirror, err))
+			continue
+		}
+
+		if fetched != cached {
+			if err := cc.storeCache(fetched); err != nil {
+				return nil, err
+			}
+		}
+		return fetched.consensus, nil
+	}
+
+	if cached != nil && checkValidity(cached.consensus, now) == nil {
+		return cached.consensus, nil
+	}
+
+	return nil, fmt.Errorf("no valid consensus available: %s", strings.Join(errs, "; "))
+}
+
+// getFrom requests the given path from the given mirror and passes the body
+// of the response to parse.
+func (cc *ConsensusClient) getFrom(mirror, path string, parse func(io.Reader) error) error {
+
+	resp, err := cc.httpClient().Get(strings.TrimSuffix(mirror, "/") + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %q", resp.Status)
+	}
+
+	return parse(resp.Body)
+}
+
+// getFromMirrors requests the given path from the mirrors in order until
+// parsing the response of one of them succeeds.  The given description of the
+// requested documents is used in the error message.
+func (cc *ConsensusClient) getFromMirrors(what, path string, parse func(io.Reader) error) error {
+
+	var errs []string
+	for _, mirror := range cc.Mirrors {
+		err := cc.getFrom(mirror, path, parse)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", mirror, err))
+	}
+
+	return fmt.Errorf("no %s available: %s", what, strings.Join(errs, "; "))
+}
+
+// FetchKeyCertificates returns the key certificates of all directory
+// authorities.  Mirrors are tried in order until one of them returns
+// certificates.  Certificates are neither cached nor verified; VerifySignatures
+// only uses certificates that their identity key certified.
+func (cc *ConsensusClient) FetchKeyCertificates() ([]*KeyCertificate, error) {
+
+	var certs []*KeyCertificate
+	err := cc.getFromMirrors("key certificates", keyCertificatesURLPath, func(r io.Reader) error {
+		var err error
+		if certs, err = ParseKeyCertificates(r); err != nil {
+			return err
+		}
+		if len(certs) == 0 {
+			return errors.New("no key certificates")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// FetchVerified is like Fetch but also fetches the key certificates of the
+// directory authorities and returns an error unless the majority of the
+// authorities in DirectoryAuthorities validly signed the consensus.
+func (cc *ConsensusClient) FetchVerified() (*Consensus, error) {
+
+	consensus, err := cc.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	certs, err := cc.FetchKeyCertificates()
+	if err != nil {
+		return nil, err
+	}
+	if err := consensus.VerifiedByMajority(certs); err != nil {
+		return nil, err
+	}
+
+	return consensus, nil
+}
+
+// batches splits the given digests into batches of at most the given size.
+func batches(digests []string, size int) [][]string {
+
+	var batches [][]string
+	for len(digests) > size {
+		batches = append(batches, digests[:size])
+		digests = digests[size:]
+	}
+	if len(digests) > 0 {
+		batches = append(batches, digests)
+	}
+
+	return batches
+}
+
+// FetchDescriptors requests the server descriptors with the given hex-encoded
+// digests, e.g., the Digest fields of router statuses, from the mirrors.
+// Large requests are split into several requests and each of them is sent to
+// the mirrors in order until one of them answers.  Descriptors whose digest
+// was not requested are rejected, so mirrors cannot substitute descriptors.
+// Descriptors the mirrors do not know are missing from the result.
+func (cc *ConsensusClient) FetchDescriptors(digests ...string) (*RouterDescriptors, error) {
+
+	requested := make(map[string]bool)
+	for _, digest := range digests {
+		requested[strings.ToLower(digest)] = true
+	}
+
+	descriptors := NewRouterDescriptors()
+	for _, batch := range batches(digests, maxDescriptorsPerRequest) {
+		path := serverDescriptorsURLPath + strings.ToUpper(strings.Join(batch, "+"))
+		err := cc.getFromMirrors("server descriptors", path, func(r io.Reader) error {
+			fetched, err := parseDescriptorUnchecked(r, parseOptions{})
+			if err != nil {
+				return err
+			}
+			for fingerprint, getDescriptor := range fetched.RouterDescriptors {
+				if digest := getDescriptor().Digest(); !requested[digest] {
+					return fmt.Errorf("unexpected descriptor %s of %s", digest, fingerprint)
+				}
+			}
+			for fingerprint, getDescriptor := range fetched.RouterDescriptors {
+				descriptors.RouterDescriptors[fingerprint] = getDescriptor
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return descriptors, nil
+}
+
+// FetchMicrodescriptors requests the microdescriptors with the given
+// base64-encoded digests, e.g., the MicrodescDigest fields of router statuses
+// of a microdescriptor consensus, from the mirrors.  Requests are split and
+// checked as in FetchDescriptors.
+func (cc *ConsensusClient) FetchMicrodescriptors(digests ...string) (*Microdescriptors, error) {
+
+	var trimmed []string
+	requested := make(map[string]bool)
+	for _, digest := range digests {
+		digest = strings.TrimRight(digest, "=")
+		trimmed = append(trimmed, digest)
+		requested[digest] = true
+	}
+
+	mds := NewMicrodescriptors()
+	for _, batch := range batches(trimmed, maxMicrodescriptorsPerRequest) {
+		path := microdescriptorsURLPath + strings.Join(batch, "-")
+		err := cc.getFromMirrors("microdescriptors", path, func(r io.Reader) error {
+			fetched, err := parseMicrodescriptorUnchecked(r, parseOptions{})
+			if err != nil {
+				return err
+			}
+			for digest := range fetched.Microdescriptors {
+				if !requested[digest] {
+					return fmt.Errorf("unexpected microdescriptor %s", digest)
+				}
+			}
+			mds.Merge(fetched)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mds, nil
+}
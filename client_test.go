@@ -0,0 +1,299 @@
+// Tests functions from "client.go".
+
+package zoossh
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDirectoryConsensus returns the test vote as served by directory caches,
+// i.e., without type annotation.
+func testDirectoryConsensus() string {
+
+	return strings.SplitN(testVote, "\n", 2)[1]
+}
+
+func TestConsensusClient(t *testing.T) {
+
+	const etag = `"abc"`
+	var requests, notModified int
+
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != consensusURLPath {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(testDirectoryConsensus()))
+	}))
+	defer good.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	now, _ := time.Parse(publishedTimeLayout, "2021-03-05 01:30:00")
+	cc := NewConsensusClient(filepath.Join(t.TempDir(), "consensus"), broken.URL, good.URL)
+	cc.Now = func() time.Time { return now }
+
+	// The first mirror fails, so the client must fall back to the second.
+	consensus, err := cc.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.Length() == 0 || requests != 1 {
+		t.Errorf("Expected one request that returns router statuses but got %d requests.", requests)
+	}
+
+	// The cached consensus is still fresh.
+	if _, err = cc.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected fresh cached consensus to be used but got %d requests.", requests)
+	}
+
+	// Once the cached consensus is no longer fresh, the client asks again
+	// and learns that the consensus has not changed.
+	now = now.Add(time.Hour)
+	if _, err = cc.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if notModified != 1 {
+		t.Errorf("Expected conditional request but got %d 304 responses.", notModified)
+	}
+
+	// An expired consensus must not be returned.
+	now = now.Add(24 * time.Hour)
+	if _, err = cc.Fetch(); err == nil {
+		t.Error("Expected error for expired consensus.")
+	}
+}
+
+func TestConsensusClientStoreCache(t *testing.T) {
+
+	cacheFile := filepath.Join(t.TempDir(), "consensus")
+	cc := NewConsensusClient(cacheFile)
+
+	raw := []byte(testDirectoryConsensus())
+	consensus, err := parseDirectoryConsensus(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// If the validators cannot be written, the consensus must already be
+	// in place so that stale validators never describe it.
+	if err := os.Mkdir(cacheFile+cacheMetaSuffix, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.storeCache(&cachedConsensus{raw: raw, consensus: consensus, etag: "\"v1\""}); err == nil {
+		t.Error("Expected error when writing validators.")
+	}
+	cached := cc.loadCache()
+	if cached == nil || cached.etag != "" {
+		t.Errorf("Expected cached consensus without validators but got %+v.", cached)
+	}
+}
+
+func TestConsensusClientFetchVerified(t *testing.T) {
+
+	var authorities []DirectoryAuthority
+	var certs []*KeyCertificate
+	var rawCerts string
+	var signingKeys []*rsa.PrivateKey
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		identity, signing := testRSAKey(t), testRSAKey(t)
+		rawCert := testKeyCertificate(t, identity, signing, published, published.AddDate(1, 0, 0))
+		cert, err := ParseRawKeyCertificate(rawCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		authorities = append(authorities, DirectoryAuthority{Nickname: fmt.Sprintf("auth%d", i), Identity: cert.Identity})
+		certs = append(certs, cert)
+		rawCerts += rawCert
+		signingKeys = append(signingKeys, signing)
+	}
+	signed := strings.SplitN(testSignedVote(t, certs, signingKeys), "\n", 2)[1]
+
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case consensusURLPath:
+			w.Write([]byte(signed))
+		case keyCertificatesURLPath:
+			w.Write([]byte(rawCerts))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mirror.Close()
+
+	now, _ := time.Parse(publishedTimeLayout, "2021-03-05 01:30:00")
+	cc := NewConsensusClient("", mirror.URL)
+	cc.Now = func() time.Time { return now }
+
+	fetched, err := cc.FetchKeyCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != len(certs) {
+		t.Errorf("Expected %d key certificates but got %d.", len(certs), len(fetched))
+	}
+
+	defer func(saved []DirectoryAuthority) { DirectoryAuthorities = saved }(DirectoryAuthorities)
+	DirectoryAuthorities = authorities
+	if _, err := cc.FetchVerified(); err != nil {
+		t.Error(err)
+	}
+
+	// Only one of three authorities signed the vote.
+	DirectoryAuthorities = []DirectoryAuthority{
+		authorities[0],
+		{Nickname: "other1", Identity: "1111111111111111111111111111111111111111"},
+		{Nickname: "other2", Identity: "2222222222222222222222222222222222222222"},
+	}
+	if _, err := cc.FetchVerified(); err == nil {
+		t.Error("Consensus without valid signatures was accepted.")
+	}
+}
+
+func TestNewAuthorityConsensusClient(t *testing.T) {
+
+	cc := NewAuthorityConsensusClient("")
+	if len(cc.Mirrors) != len(DirectoryAuthorities) {
+		t.Fatalf("Expected %d mirrors but got %d.", len(DirectoryAuthorities), len(cc.Mirrors))
+	}
+	if cc.Mirrors[0] != "http://"+DirectoryAuthorities[0].DirAddress {
+		t.Error("Unexpected mirror.", cc.Mirrors[0])
+	}
+}
+
+// testDirectoryCache returns a directory cache that serves the given
+// documents by the digests in the request path.  The documents are keyed by
+// digest.
+func testDirectoryCache(prefix, separator string, documents map[string]string, requests *int) *httptest.Server {
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		found := false
+		for _, digest := range strings.Split(strings.TrimPrefix(r.URL.Path, prefix), separator) {
+			if document, ok := documents[digest]; ok {
+				w.Write([]byte(document))
+				found = true
+			}
+		}
+		if !found {
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestConsensusClientFetchDescriptors(t *testing.T) {
+
+	fd, err := os.Open(serverDescriptorFile)
+	if err != nil {
+		t.Skipf("Cannot open test data: %s", err)
+	}
+	defer fd.Close()
+	_, r, err := readAnnotation(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Serve more descriptors than fit into a single request.
+	var digests []string
+	documents := make(map[string]string)
+	queue := make(chan QueueUnit)
+	go DissectFile(r, extractDescriptor, queue)
+	for unit := range queue {
+		_, getDescriptor, err := ParseRawDescriptor(unit.Blurb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := strings.ToUpper(getDescriptor().Digest())
+		if _, ok := documents[digest]; !ok && len(digests) < maxDescriptorsPerRequest+10 {
+			digests = append(digests, digest)
+		}
+		documents[digest] = unit.Blurb
+	}
+
+	var requests int
+	cache := testDirectoryCache(serverDescriptorsURLPath, "+", documents, &requests)
+	defer cache.Close()
+
+	cc := NewConsensusClient("", cache.URL)
+	descriptors, err := cc.FetchDescriptors(digests...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected two requests but got %d.", requests)
+	}
+	if descriptors.Length() == 0 {
+		t.Fatal("Expected descriptors but got none.")
+	}
+	for _, getDescriptor := range descriptors.RouterDescriptors {
+		found := false
+		for _, digest := range digests {
+			found = found || strings.EqualFold(digest, getDescriptor().Digest())
+		}
+		if !found {
+			t.Error("Unexpected descriptor.", getDescriptor().Digest())
+		}
+	}
+
+	// Descriptors that were not requested must be rejected.
+	substituted := make(map[string]string)
+	substituted[digests[0]] = documents[digests[1]]
+	liar := testDirectoryCache(serverDescriptorsURLPath, "+", substituted, &requests)
+	defer liar.Close()
+	if _, err := NewConsensusClient("", liar.URL).FetchDescriptors(digests[0]); err == nil {
+		t.Error("Substituted descriptor was accepted.")
+	}
+}
+
+func TestConsensusClientFetchMicrodescriptors(t *testing.T) {
+
+	digest1 := MicrodescriptorDigest(testMicrodescriptor1)
+	digest2 := MicrodescriptorDigest(testMicrodescriptor2)
+	documents := map[string]string{digest1: testMicrodescriptor1, digest2: testMicrodescriptor2}
+
+	var requests int
+	cache := testDirectoryCache(microdescriptorsURLPath, "-", documents, &requests)
+	defer cache.Close()
+
+	// Digests of "m" lines may carry padding.
+	mds, err := NewConsensusClient("", cache.URL).FetchMicrodescriptors(digest1+"=", digest2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mds.Length() != 2 || requests != 1 {
+		t.Errorf("Expected two microdescriptors in one request but got %d in %d.", mds.Length(), requests)
+	}
+	if _, ok := mds.Get(digest1); !ok {
+		t.Error("Microdescriptor is missing.", digest1)
+	}
+
+	if _, err := NewConsensusClient("", cache.URL).FetchMicrodescriptors("unknown"); err == nil {
+		t.Error("Expected error for unknown microdescriptor.")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/NullHypothesis/zoossh"
+)
+
+// parseConsensusFile parses the given file, which must hold a consensus or a
+// vote.
+func parseConsensusFile(fileName string) (*zoossh.Consensus, error) {
+
+	set, err := zoossh.ParseUnknownFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	consensus, ok := set.(*zoossh.Consensus)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a network status document", fileName)
+	}
+
+	return consensus, nil
+}
+
+// describeChange returns a human-readable description of the given change.
+func describeChange(sc *zoossh.StatusChange) string {
+
+	var changes []string
+
+	if sc.FlagsChanged() {
+		var flags []string
+		for _, name := range sc.FlagsAdded {
+			flags = append(flags, "+"+name)
+		}
+		for _, name := range sc.FlagsRemoved {
+			flags = append(flags, "-"+name)
+		}
+		changes = append(changes, "flags "+strings.Join(flags, " "))
+	}
+	if sc.NicknameChanged {
+		changes = append(changes, fmt.Sprintf("nickname %s -> %s", sc.Old.Nickname, sc.New.Nickname))
+	}
+	if sc.AddressChanged {
+		changes = append(changes, fmt.Sprintf("address %s:%d -> %s:%d",
+			sc.Old.Address.IPv4Address, sc.Old.Address.IPv4ORPort,
+			sc.New.Address.IPv4Address, sc.New.Address.IPv4ORPort))
+	}
+	if sc.BandwidthChanged {
+		changes = append(changes, fmt.Sprintf("bandwidth %d -> %d", sc.Old.Bandwidth, sc.New.Bandwidth))
+	}
+	if sc.VersionChanged {
+		changes = append(changes, fmt.Sprintf("version %s -> %s", sc.Old.TorVersion, sc.New.TorVersion))
+	}
+	if sc.ExitPolicyChanged {
+		changes = append(changes, "exit policy")
+	}
+
+	return strings.Join(changes, "; ")
+}
+
+func runDiff(args []string) error {
+
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return fmt.Errorf("need exactly two consensuses to compare")
+	}
+	old, err := parseConsensusFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	new, err := parseConsensusFile(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diff := old.Diff(new)
+	for _, status := range diff.Removed {
+		fmt.Printf("- %s %s\n", status.Fingerprint, status.Nickname)
+	}
+	for _, status := range diff.Added {
+		fmt.Printf("+ %s %s\n", status.Fingerprint, status.Nickname)
+	}
+	for _, sc := range diff.Changed {
+		fmt.Printf("~ %s %s: %s\n", sc.New.Fingerprint, sc.New.Nickname, describeChange(sc))
+	}
+	fmt.Printf("%d removed, %d added, %d changed\n", len(diff.Removed), len(diff.Added), len(diff.Changed))
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/NullHypothesis/zoossh"
+)
+
+// writeJSON writes the given set to stdout as JSON.  Consensuses are written
+// with their header; other sets as an array of their entries, sorted by
+// fingerprint.
+func writeJSON(set zoossh.ObjectSet) error {
+
+	enc := json.NewEncoder(os.Stdout)
+
+	if consensus, ok := set.(*zoossh.Consensus); ok {
+		return enc.Encode(consensus)
+	}
+
+	objects := []zoossh.Object{}
+	for obj := range set.Iterate(nil) {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].GetFingerprint() < objects[j].GetFingerprint()
+	})
+
+	return enc.Encode(objects)
+}
+
+func runExport(args []string) error {
+
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "json", "Output format: json, csv, or yaml.")
+	columns := flags.String("columns", "", "Comma-separated list of CSV columns, e.g., \"fingerprint,nickname,flags\".")
+	query := flags.String("query", "", "Only export entries matching the given query, e.g., \"flag:Exit and bandwidth>5000\".")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("need exactly one file to export")
+	}
+	if *columns != "" && *format != "csv" {
+		return fmt.Errorf("columns can only be chosen for CSV")
+	}
+
+	set, err := zoossh.ParseUnknownFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *query != "" {
+		predicate, err := zoossh.ParseQuery(*query)
+		if err != nil {
+			return err
+		}
+		if set, err = selectEntries(set, nil, predicate); err != nil {
+			return err
+		}
+	}
+
+	switch *format {
+	case "json":
+		return writeJSON(set)
+	case "csv":
+		return zoossh.WriteCSV(os.Stdout, set, nil, splitList(*columns)...)
+	case "yaml":
+		return zoossh.WriteYAML(os.Stdout, set, nil)
+	}
+
+	return fmt.Errorf("unknown format %q", *format)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/NullHypothesis/zoossh"
+)
+
+// selectEntries returns the entries of the given set that pass the given
+// filter and predicate.  Only consensuses and router descriptors can be
+// filtered; other sets are returned as they are if filter and predicate are
+// nil.
+func selectEntries(set zoossh.ObjectSet, filter *zoossh.ObjectFilter, predicate zoossh.Predicate) (zoossh.ObjectSet, error) {
+
+	if filter != nil && filter.IsEmpty() {
+		filter = nil
+	}
+
+	switch s := set.(type) {
+	case *zoossh.Consensus:
+		if filter != nil {
+			s = s.Filter(filter)
+		}
+		if predicate != nil {
+			s.RemoveIf(func(status *zoossh.RouterStatus) bool { return !predicate(status) })
+		}
+		return s, nil
+
+	case *zoossh.RouterDescriptors:
+		selected := zoossh.NewRouterDescriptors()
+		for obj := range s.Iterate(filter) {
+			if desc := obj.(*zoossh.RouterDescriptor); predicate == nil || predicate(desc) {
+				selected.Set(desc.Fingerprint, desc)
+			}
+		}
+		return selected, nil
+	}
+
+	if filter != nil || predicate != nil {
+		return nil, fmt.Errorf("cannot filter %T", set)
+	}
+
+	return set, nil
+}
+
+func runFilter(args []string) error {
+
+	flags := flag.NewFlagSet("filter", flag.ExitOnError)
+	fingerprints := flags.String("fingerprint", "", "Comma-separated list of fingerprints to keep.")
+	addresses := flags.String("address", "", "Comma-separated list of IP addresses to keep.")
+	nicknames := flags.String("nickname", "", "Comma-separated list of nicknames to keep.")
+	query := flags.String("query", "", "Only keep entries matching the given query, e.g., \"flag:Exit and bandwidth>5000\".")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("need exactly one file to filter")
+	}
+	filter, err := objectFilter(*fingerprints, *addresses, *nicknames)
+	if err != nil {
+		return err
+	}
+	var predicate zoossh.Predicate
+	if *query != "" {
+		if predicate, err = zoossh.ParseQuery(*query); err != nil {
+			return err
+		}
+	}
+
+	set, err := zoossh.ParseUnknownFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if set, err = selectEntries(set, filter, predicate); err != nil {
+		return err
+	}
+
+	switch s := set.(type) {
+	case *zoossh.Consensus:
+		_, err = s.WriteTo(os.Stdout)
+	case *zoossh.RouterDescriptors:
+		_, err = s.WriteTo(os.Stdout)
+	default:
+		err = fmt.Errorf("cannot write %T", set)
+	}
+
+	return err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NullHypothesis/zoossh"
+)
+
+// printConsensusInfo prints a summary of the given consensus or vote.
+func printConsensusInfo(c *zoossh.Consensus) {
+
+	kind := "consensus"
+	if string(c.MetaInfo["vote-status"]) == "vote" {
+		kind = "vote"
+	}
+	if c.Flavour != "" {
+		kind += " (flavour " + c.Flavour + ")"
+	}
+	fmt.Printf("  type:             network status %s\n", kind)
+	if c.ConsensusMethod != 0 {
+		fmt.Printf("  consensus method: %d\n", c.ConsensusMethod)
+	}
+	fmt.Printf("  valid after:      %s\n", c.ValidAfter.Format(time.RFC3339))
+	fmt.Printf("  fresh until:      %s\n", c.FreshUntil.Format(time.RFC3339))
+	fmt.Printf("  valid until:      %s\n", c.ValidUntil.Format(time.RFC3339))
+	fmt.Printf("  relays:           %d\n", c.Length())
+	fmt.Printf("  bandwidth:        %d\n", zoossh.SumBandwidth(c))
+
+	counts := make(map[string]int)
+	for _, getStatus := range c.RouterStatuses {
+		for _, flag := range strings.Split(getStatus().Flags.String(), "|") {
+			if flag != "" {
+				counts[flag]++
+			}
+		}
+	}
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-17s %d\n", name+":", counts[name])
+	}
+}
+
+// printDescriptorsInfo prints a summary of the given router descriptors.
+func printDescriptorsInfo(rds *zoossh.RouterDescriptors) {
+
+	var first, last time.Time
+	for _, getDescriptor := range rds.RouterDescriptors {
+		published := getDescriptor().Published
+		if first.IsZero() || published.Before(first) {
+			first = published
+		}
+		if published.After(last) {
+			last = published
+		}
+	}
+
+	fmt.Printf("  type:             server descriptors\n")
+	fmt.Printf("  relays:           %d\n", rds.Length())
+	fmt.Printf("  bandwidth:        %d\n", zoossh.SumBandwidth(rds))
+	if !first.IsZero() {
+		fmt.Printf("  first published:  %s\n", first.Format(time.RFC3339))
+		fmt.Printf("  last published:   %s\n", last.Format(time.RFC3339))
+	}
+}
+
+func runInfo(args []string) error {
+
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("need at least one file")
+	}
+
+	for _, fileName := range flags.Args() {
+		set, err := zoossh.ParseUnknownFile(fileName)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fileName, err)
+		}
+
+		fmt.Printf("%s:\n", fileName)
+		switch s := set.(type) {
+		case *zoossh.Consensus:
+			printConsensusInfo(s)
+		case *zoossh.RouterDescriptors:
+			printDescriptorsInfo(s)
+		default:
+			fmt.Printf("  type:             %T\n", set)
+			fmt.Printf("  entries:          %d\n", set.Length())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+// Command zoossh provides command line access to the zoossh parsers.
+//
+// Usage:
+//
+//	zoossh scan [-fingerprint FPR] [-address ADDR] [-nickname NICK] [-query QUERY] PATH...
+//	zoossh info FILE...
+//	zoossh filter [-fingerprint FPR] [-address ADDR] [-nickname NICK] [-query QUERY] FILE
+//	zoossh diff OLD NEW
+//	zoossh export [-format json|csv|yaml] [-columns COLUMNS] [-query QUERY] FILE
+//
+// Files can be of any type that zoossh supports.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/NullHypothesis/zoossh"
+)
+
+// command is a single subcommand of the CLI.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"scan":   {"search archive files for relays without fully parsing them", runScan},
+	"info":   {"summarise the contents of files", runInfo},
+	"filter": {"print the matching entries of a file in the file's format", runFilter},
+	"diff":   {"show how the relays of two consensuses differ", runDiff},
+	"export": {"print the entries of a file as JSON, CSV, or YAML", runExport},
+}
+
+func usage() {
+
+	fmt.Fprintf(os.Stderr, "Usage: %s COMMAND [ARGS]\n\nCommands:\n", os.Args[0])
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].usage)
+	}
+}
+
+// splitList splits the given comma-separated list, ignoring empty elements.
+func splitList(list string) []string {
+
+	var elems []string
+	for _, elem := range strings.Split(list, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+
+	return elems
+}
+
+// queryPredicate turns the given query into a predicate.  An empty query
+// matches all objects.
+func queryPredicate(query string) (zoossh.Predicate, error) {
+
+	if query == "" {
+		return func(zoossh.Object) bool { return true }, nil
+	}
+
+	return zoossh.ParseQuery(query)
+}
+
+// objectFilter returns an object filter for the given comma-separated lists
+// of fingerprints, IP addresses, and nicknames.
+func objectFilter(fingerprints, addresses, nicknames string) (*zoossh.ObjectFilter, error) {
+
+	filter := zoossh.NewObjectFilter()
+	for _, fpr := range splitList(fingerprints) {
+		filter.AddFingerprint(zoossh.SanitiseFingerprint(zoossh.Fingerprint(fpr)))
+	}
+	for _, addr := range splitList(addresses) {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", addr)
+		}
+		filter.AddIPAddr(ip)
+	}
+	for _, nickname := range splitList(nicknames) {
+		filter.AddNickname(nickname)
+	}
+
+	return filter, nil
+}
+
+// walkFiles calls fn for every regular file in the given paths, descending
+// into directories.
+func walkFiles(paths []string, fn func(fileName string) error) error {
+
+	for _, path := range paths {
+		err := filepath.Walk(path, func(fileName string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			return fn(fileName)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runScan(args []string) error {
+
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	fingerprints := flags.String("fingerprint", "", "Comma-separated list of fingerprints to search for.")
+	addresses := flags.String("address", "", "Comma-separated list of IP addresses to search for.")
+	nicknames := flags.String("nickname", "", "Comma-separated list of nicknames to search for.")
+	query := flags.String("query", "", "Only print objects matching the given query, e.g., \"flag:Exit and bandwidth>5000\".")
+	flags.Parse(args)
+
+	predicate, err := queryPredicate(*query)
+	if err != nil {
+		return err
+	}
+	filter, err := objectFilter(*fingerprints, *addresses, *nicknames)
+	if err != nil {
+		return err
+	}
+	if filter.IsEmpty() && *query == "" {
+		return fmt.Errorf("need at least one fingerprint, address, nickname, or query")
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("need at least one file or directory to scan")
+	}
+
+	return walkFiles(flags.Args(), func(fileName string) error {
+		objs, err := zoossh.ScanFile(fileName, filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", fileName, err)
+			return nil
+		}
+		for obj := range zoossh.Select(objs, predicate) {
+			fmt.Printf("%s: %s\n", fileName, obj)
+		}
+		return nil
+	})
+}
+
+func main() {
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
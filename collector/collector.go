@@ -0,0 +1,283 @@
+// Package collector lists and downloads the archives of CollecTor, the Tor
+// Project's data collection service, and parses them on the fly using zoossh.
+//
+// Here's how you can parse all consensuses of January 2024:
+//
+//	client := collector.NewClient()
+//	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+//	end := start.AddDate(0, 1, 0)
+//	err := client.Fetch("network-status-consensus-3", start, end,
+//		func(name string, set zoossh.ObjectSet, err error) error {
+//			// Handle the parsed file.
+//			return nil
+//		})
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NullHypothesis/zoossh"
+)
+
+const (
+	// The base URL of the Tor Project's CollecTor instance.
+	DefaultBaseURL = "https://collector.torproject.org"
+
+	// The path of CollecTor's index of all files, as per
+	// <https://metrics.torproject.org/collector.html#index-json>.
+	indexPath = "/index/index.json"
+
+	// The layout of the time stamps of the index.
+	indexTimeLayout = "2006-01-02 15:04"
+)
+
+// File is a single file that CollecTor serves.
+type File struct {
+	// The path relative to the base URL, e.g.,
+	// "archive/relay-descriptors/consensuses/consensuses-2024-01.tar.xz".
+	Path string
+
+	Size         int64
+	LastModified time.Time
+
+	// The document types that the file contains, e.g.,
+	// "network-status-consensus-3 1.0".
+	Types []string
+
+	// The publication times of the first and the last document that the
+	// file contains.  Both are zero if the index lacks them.
+	FirstPublished time.Time
+	LastPublished  time.Time
+}
+
+// HasType returns true if the file contains documents of the given type.  The
+// type's version is optional, i.e., "server-descriptor" matches
+// "server-descriptor 1.0".
+func (f *File) HasType(docType string) bool {
+
+	for _, t := range f.Types {
+		if t == docType || strings.SplitN(t, " ", 2)[0] == docType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Overlaps returns true if the file contains documents that were published in
+// the interval [start, end).  Files without publication times in the index
+// are assumed to overlap.
+func (f *File) Overlaps(start, end time.Time) bool {
+
+	if f.FirstPublished.IsZero() || f.LastPublished.IsZero() {
+		return true
+	}
+
+	return f.FirstPublished.Before(end) && !f.LastPublished.Before(start)
+}
+
+// Client lists and downloads CollecTor's files.
+type Client struct {
+	// The base URL of the CollecTor instance, e.g., DefaultBaseURL.
+	BaseURL string
+
+	// The HTTP client used for requests.  http.DefaultClient is used if
+	// nil.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a new client for the Tor Project's CollecTor instance.
+func NewClient() *Client {
+
+	return &Client{BaseURL: DefaultBaseURL, HTTPClient: http.DefaultClient}
+}
+
+func (c *Client) httpClient() *http.Client {
+
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// get requests the given path and returns the response if its status is 200.
+func (c *Client) get(path string) (*http.Response, error) {
+
+	resp, err := c.httpClient().Get(strings.TrimSuffix(c.BaseURL, "/") + "/" + strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected HTTP status %q", path, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// indexFile is a file object of the index.
+type indexFile struct {
+	Path           string   `json:"path"`
+	Size           int64    `json:"size"`
+	LastModified   string   `json:"last_modified"`
+	Types          []string `json:"types"`
+	FirstPublished string   `json:"first_published"`
+	LastPublished  string   `json:"last_published"`
+}
+
+// indexDirectory is a directory object of the index.
+type indexDirectory struct {
+	Path        string           `json:"path"`
+	Directories []indexDirectory `json:"directories"`
+	Files       []indexFile      `json:"files"`
+}
+
+// parseIndexTime parses the given time stamp of the index, which may be
+// empty.
+func parseIndexTime(s string) (time.Time, error) {
+
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(indexTimeLayout, s)
+}
+
+// flatten appends the files of the given directory and its subdirectories to
+// files.
+func (dir *indexDirectory) flatten(prefix string, files []File) ([]File, error) {
+
+	for _, f := range dir.Files {
+		file := File{Path: prefix + f.Path, Size: f.Size, Types: f.Types}
+		var err error
+		if file.LastModified, err = parseIndexTime(f.LastModified); err != nil {
+			return nil, err
+		}
+		if file.FirstPublished, err = parseIndexTime(f.FirstPublished); err != nil {
+			return nil, err
+		}
+		if file.LastPublished, err = parseIndexTime(f.LastPublished); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	var err error
+	for i := range dir.Directories {
+		sub := &dir.Directories[i]
+		if files, err = sub.flatten(prefix+sub.Path+"/", files); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// Index returns all files that CollecTor serves, according to its index.
+func (c *Client) Index() ([]File, error) {
+
+	resp, err := c.get(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var root indexDirectory
+	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return nil, fmt.Errorf("malformed index: %w", err)
+	}
+
+	return root.flatten("", nil)
+}
+
+// Files returns the files that contain documents of the given type, e.g.,
+// "server-descriptor", that were published in the interval [start, end),
+// sorted by path.  CollecTor serves the documents of the last days both in
+// monthly tarballs under "archive/" and as single files under "recent/", so
+// both may be returned.
+func (c *Client) Files(docType string, start, end time.Time) ([]File, error) {
+
+	index, err := c.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for i := range index {
+		if index[i].HasType(docType) && index[i].Overlaps(start, end) {
+			files = append(files, index[i])
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	return files, nil
+}
+
+// isTarball returns true if the given path refers to a tarball.
+func isTarball(path string) bool {
+
+	return strings.Contains(path[strings.LastIndex(path, "/")+1:], ".tar")
+}
+
+// FetchFile downloads the given file and parses it while it is being
+// downloaded.  Tarballs are parsed as in zoossh.ParseTarballReader and fn is
+// called for each of their members.  Other files are parsed as in
+// zoossh.ParseUnknown and fn is called once, with the file's path.
+func (c *Client) FetchFile(file File, fn zoossh.FileFunc) error {
+
+	resp, err := c.get(file.Path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if isTarball(file.Path) {
+		return zoossh.ParseTarballReader(resp.Body, file.Path, fn)
+	}
+
+	set, err := zoossh.ParseUnknown(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", file.Path, err)
+	}
+	if err := fn(file.Path, set, err); err != nil && err != zoossh.ErrStop {
+		return err
+	}
+
+	return nil
+}
+
+// Fetch downloads and parses all files that contain documents of the given
+// type that were published in the interval [start, end), see Files and
+// FetchFile.  Tarballs may contain documents outside of the interval, which
+// fn has to skip if necessary.  Returning zoossh.ErrStop from fn stops
+// fetching further files without error.
+func (c *Client) Fetch(docType string, start, end time.Time, fn zoossh.FileFunc) error {
+
+	files, err := c.Files(docType, start, end)
+	if err != nil {
+		return err
+	}
+
+	stopped := false
+	stop := func(name string, set zoossh.ObjectSet, err error) error {
+		err = fn(name, set, err)
+		if err == zoossh.ErrStop {
+			stopped = true
+		}
+		return err
+	}
+	for _, file := range files {
+		if err := c.FetchFile(file, stop); err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+
+	return nil
+}
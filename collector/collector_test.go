@@ -0,0 +1,151 @@
+// Tests functions from "collector.go".
+
+package collector
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NullHypothesis/zoossh"
+)
+
+const consensusFile = "../testdata/consensus"
+
+const testIndex = `{"index_created":"2024-02-03 04:05","path":"%s","directories":[
+{"path":"archive","directories":[{"path":"relay-descriptors","directories":[
+ {"path":"consensuses","files":[
+  {"path":"consensuses-2015-07.tar.gz","size":1,"last_modified":"2015-08-01 04:12",
+   "types":["network-status-consensus-3 1.0"],"first_published":"2015-07-01 00:00","last_published":"2015-07-31 23:00"},
+  {"path":"consensuses-2015-08.tar.gz","size":1,"last_modified":"2015-09-01 04:12",
+   "types":["network-status-consensus-3 1.0"],"first_published":"2015-08-01 00:00","last_published":"2015-08-31 23:00"}]},
+ {"path":"server-descriptors","files":[
+  {"path":"server-descriptors-2015-08.tar.xz","size":1,"last_modified":"2015-09-01 04:12",
+   "types":["server-descriptor 1.0"],"first_published":"2015-07-25 12:00","last_published":"2015-08-31 23:59"}]}]}]},
+{"path":"recent","directories":[{"path":"relay-descriptors","directories":[
+ {"path":"consensuses","files":[
+  {"path":"2015-08-04-20-00-00-consensus","size":1,"last_modified":"2015-08-04 20:05",
+   "types":["network-status-consensus-3 1.0"],"first_published":"2015-08-04 20:00","last_published":"2015-08-04 20:00"}]}]}]}]}`
+
+// testServer returns a CollecTor instance that serves the test consensus as
+// a single file and in a tarball.
+func testServer(t *testing.T) *httptest.Server {
+
+	consensus, err := ioutil.ReadFile(consensusFile)
+	if err != nil {
+		t.Skipf("Cannot read test data: %s", err)
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range []string{"consensuses-2015-08/04/2015-08-04-20-00-00-consensus", "consensuses-2015-08/04/2015-08-04-21-00-00-consensus"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(consensus))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(consensus)
+	}
+	tw.Close()
+	gw.Close()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case indexPath:
+			fmt.Fprintf(w, testIndex, server.URL)
+		case "/archive/relay-descriptors/consensuses/consensuses-2015-08.tar.gz":
+			w.Write(buf.Bytes())
+		case "/recent/relay-descriptors/consensuses/2015-08-04-20-00-00-consensus":
+			w.Write(consensus)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return server
+}
+
+// Test the method Files().
+func TestFiles(t *testing.T) {
+
+	server := testServer(t)
+	defer server.Close()
+	client := &Client{BaseURL: server.URL}
+
+	index, err := client.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 4 {
+		t.Fatalf("Expected four files in index but got %d.", len(index))
+	}
+
+	start := time.Date(2015, 8, 1, 0, 0, 0, 0, time.UTC)
+	files, err := client.Files("network-status-consensus-3", start, start.AddDate(0, 0, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected two files but got %d.", len(files))
+	}
+	if files[0].Path != "archive/relay-descriptors/consensuses/consensuses-2015-08.tar.gz" {
+		t.Error("Unexpected file.", files[0].Path)
+	}
+	if !files[1].FirstPublished.Equal(time.Date(2015, 8, 4, 20, 0, 0, 0, time.UTC)) {
+		t.Error("Unexpected publication time.", files[1].FirstPublished)
+	}
+
+	// The end of the interval is exclusive.
+	files, err = client.Files("server-descriptor", start.AddDate(0, -1, 0), time.Date(2015, 7, 25, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected no files but got %d.", len(files))
+	}
+}
+
+// Test the method Fetch().
+func TestFetch(t *testing.T) {
+
+	server := testServer(t)
+	defer server.Close()
+	client := &Client{BaseURL: server.URL}
+
+	start := time.Date(2015, 8, 1, 0, 0, 0, 0, time.UTC)
+	var names []string
+	err := client.Fetch("network-status-consensus-3", start, start.AddDate(0, 1, 0),
+		func(name string, set zoossh.ObjectSet, err error) error {
+			if err != nil {
+				return err
+			}
+			if set.Length() == 0 {
+				t.Errorf("%s contains no router statuses.", name)
+			}
+			names = append(names, name)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Errorf("Expected three parsed files but got %v.", names)
+	}
+
+	// Stopping must not fetch further files.
+	names = nil
+	err = client.Fetch("network-status-consensus-3", start, start.AddDate(0, 1, 0),
+		func(name string, set zoossh.ObjectSet, err error) error {
+			names = append(names, name)
+			return zoossh.ErrStop
+		})
+	if err != nil || len(names) != 1 {
+		t.Errorf("Expected to stop after one file but got %v (%v).", names, err)
+	}
+}
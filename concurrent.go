@@ -0,0 +1,163 @@
+// Provides a consensus that is safe for concurrent use.
+
+package zoossh
+
+import (
+	"sync"
+)
+
+// ConcurrentConsensus wraps a consensus so that it is safe for concurrent use,
+// e.g., by a long-running service that answers Get calls while another
+// goroutine merges in a newer consensus.  Reads share a read lock while
+// modifications take the write lock.  ConcurrentConsensus implements the
+// ObjectSet interface.
+//
+// The wrapped consensus must not be accessed directly once it is wrapped, and
+// callers must not modify the router statuses they obtain.
+type ConcurrentConsensus struct {
+	mu        sync.RWMutex
+	consensus *Consensus
+}
+
+// NewConcurrentConsensus wraps the given consensus, or a new and empty
+// consensus if the given one is nil.
+func NewConcurrentConsensus(c *Consensus) *ConcurrentConsensus {
+
+	if c == nil {
+		c = NewConsensus()
+	}
+
+	return &ConcurrentConsensus{consensus: c}
+}
+
+// Length implements the ObjectSet interface.  It returns the length of the
+// consensus.
+func (cc *ConcurrentConsensus) Length() int {
+
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
+	return cc.consensus.Length()
+}
+
+// Iterate implements the ObjectSet interface.  It iterates over a snapshot of
+// the router statuses, so the consensus can be modified during iteration.
+func (cc *ConcurrentConsensus) Iterate(filter *ObjectFilter) <-chan Object {
+
+	return cc.Snapshot().Iterate(filter)
+}
+
+// GetObject implements the ObjectSet interface.  It returns the object
+// identified by the given fingerprint.
+func (cc *ConcurrentConsensus) GetObject(fingerprint Fingerprint) (Object, bool) {
+
+	return cc.Get(fingerprint)
+}
+
+// Contains implements the ObjectSet interface.  It returns true if the router
+// status identified by the given fingerprint is part of the consensus.
+func (cc *ConcurrentConsensus) Contains(fingerprint Fingerprint) bool {
+
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
+	return cc.consensus.Contains(fingerprint)
+}
+
+// Merge implements the ObjectSet interface.  It adds the router statuses of
+// the given object set that are not yet part of the consensus.
+func (cc *ConcurrentConsensus) Merge(objs ObjectSet) {
+
+	// Collect the objects first, so we don't hold the lock while objs is
+	// being iterated, which may be this very consensus.
+	var statuses []*RouterStatus
+	for obj := range objs.Iterate(nil) {
+		if status, ok := obj.(*RouterStatus); ok {
+			statuses = append(statuses, status)
+		}
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for _, status := range statuses {
+		if !cc.consensus.Contains(status.Fingerprint) {
+			cc.consensus.Set(status.Fingerprint, status)
+		}
+	}
+}
+
+// Get returns the router status for the given fingerprint and a boolean value
+// indicating if the status could be found in the consensus.
+func (cc *ConcurrentConsensus) Get(fingerprint Fingerprint) (*RouterStatus, bool) {
+
+	cc.mu.RLock()
+	getStatus, exists := cc.consensus.RouterStatuses[SanitiseFingerprint(fingerprint)]
+	cc.mu.RUnlock()
+
+	// Lazily parsed statuses are parsed without holding the lock.
+	if !exists {
+		return nil, false
+	}
+	return getStatus(), true
+}
+
+// Set adds or replaces the router status of the given fingerprint.
+func (cc *ConcurrentConsensus) Set(fingerprint Fingerprint, status *RouterStatus) {
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.consensus.Set(fingerprint, status)
+}
+
+// Remove removes the router status of the given fingerprint and returns true
+// if the consensus contained it.
+func (cc *ConcurrentConsensus) Remove(fingerprint Fingerprint) bool {
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.consensus.Remove(fingerprint)
+}
+
+// Update merges the given newer consensus: its router statuses replace the
+// statuses of the same relays, and relays that the newer consensus lacks are
+// kept.  The meta information of the consensus is left unchanged.
+func (cc *ConcurrentConsensus) Update(newer *Consensus) {
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.consensus.mustNotBeFrozen()
+	for fingerprint, getStatus := range newer.RouterStatuses {
+		cc.consensus.RouterStatuses[fingerprint] = getStatus
+	}
+}
+
+// Replace atomically replaces the wrapped consensus with the given one, which
+// must not be accessed directly afterwards.
+func (cc *ConcurrentConsensus) Replace(c *Consensus) {
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.consensus = c
+}
+
+// Snapshot returns a copy of the wrapped consensus.  The copy has its own map
+// of router statuses, so it can be used without locking, but it shares its
+// router statuses and meta information with the wrapped consensus.
+func (cc *ConcurrentConsensus) Snapshot() *Consensus {
+
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
+	snapshot := *cc.consensus
+	snapshot.RouterStatuses = make(map[Fingerprint]GetStatus, len(cc.consensus.RouterStatuses))
+	for fingerprint, getStatus := range cc.consensus.RouterStatuses {
+		snapshot.RouterStatuses[fingerprint] = getStatus
+	}
+
+	return &snapshot
+}
@@ -0,0 +1,73 @@
+// Tests functions from "concurrent.go".
+
+package zoossh
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// testStatus returns a router status with the given fingerprint suffix.
+func testStatus(i int) *RouterStatus {
+
+	return &RouterStatus{Fingerprint: Fingerprint(fmt.Sprintf("%040X", i)), Nickname: fmt.Sprintf("relay%d", i)}
+}
+
+// Test concurrent reads and updates.  Run with -race.
+func TestConcurrentConsensus(t *testing.T) {
+
+	old := NewConsensus()
+	for i := 0; i < 100; i++ {
+		old.Set(testStatus(i).Fingerprint, testStatus(i))
+	}
+	cc := NewConcurrentConsensus(old)
+
+	newer := NewConsensus()
+	for i := 50; i < 150; i++ {
+		status := testStatus(i)
+		status.Nickname = "updated"
+		newer.Set(status.Fingerprint, status)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, ok := cc.Get(testStatus(j).Fingerprint); !ok {
+					t.Errorf("Relay %d is missing.", j)
+				}
+				for range cc.Iterate(nil) {
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cc.Update(newer)
+		cc.Set(testStatus(200).Fingerprint, testStatus(200))
+	}()
+	wg.Wait()
+
+	if cc.Length() != 151 {
+		t.Errorf("Expected 151 relays but got %d.", cc.Length())
+	}
+	if status, _ := cc.Get(testStatus(60).Fingerprint); status.Nickname != "updated" {
+		t.Error("Router status was not updated.", status.Nickname)
+	}
+	if status, _ := cc.Get(testStatus(10).Fingerprint); status.Nickname != "relay10" {
+		t.Error("Router status was changed.", status.Nickname)
+	}
+
+	// Merging keeps existing statuses and snapshots are independent.
+	snapshot := cc.Snapshot()
+	cc.Merge(newer)
+	cc.Merge(cc)
+	cc.Replace(NewConsensus())
+	if cc.Contains(testStatus(10).Fingerprint) || snapshot.Length() != 151 {
+		t.Error("Snapshot is not independent of the replaced consensus.")
+	}
+}
@@ -0,0 +1,297 @@
+// Parses consensus diffs as served by directory caches.
+
+package zoossh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The first line of consensus diffs, see proposal 140.
+const networkStatusDiffVersion = "network-status-diff-version 1"
+
+// DiffToEnd is the end line of a DiffCommand whose range extends to the
+// last line of the document, i.e., that was given as "$".
+const DiffToEnd = -1
+
+// DiffCommand is a single ed-style command of a consensus diff.  Lines are
+// numbered starting at one.
+type DiffCommand struct {
+	// The command: 'a' appends Lines after line Start, 'c' replaces lines
+	// Start to End with Lines, and 'd' deletes lines Start to End.
+	Op byte
+
+	// The range of lines that the command applies to.  End equals Start
+	// for single lines and is DiffToEnd for ranges that end with "$".
+	// Start is zero for lines that are appended to the beginning.
+	Start int
+	End   int
+
+	// The lines that the 'a' and 'c' commands insert.
+	Lines []string
+}
+
+// String returns the command as it appears in a consensus diff.
+func (cmd *DiffCommand) String() string {
+
+	lines := []string{strconv.Itoa(cmd.Start)}
+	switch {
+	case cmd.End == DiffToEnd:
+		lines[0] += ",$"
+	case cmd.End != cmd.Start:
+		lines[0] += "," + strconv.Itoa(cmd.End)
+	}
+	lines[0] += string(cmd.Op)
+	if cmd.Op != 'd' {
+		lines = append(append(lines, cmd.Lines...), ".")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// NetworkStatusDiff is a consensus diff, which turns a base consensus into a
+// target consensus, as defined in proposal 140.  Directory caches
+// serve such diffs to clients that already have an older consensus.  It is
+// not called ConsensusDiff because that name already holds the result of
+// Consensus.Diff.
+type NetworkStatusDiff struct {
+	// The hex-encoded SHA3-256 digests of the base consensus and of the
+	// target consensus, as given on the "hash" line.  Go's standard library
+	// lacks SHA3, so the digests are not verified.
+	BaseDigest   string
+	TargetDigest string
+
+	// The commands in the order of the diff, i.e., in the order of
+	// descending line numbers, so that every command can be applied to the
+	// base consensus without regard to the other commands.
+	Commands []DiffCommand
+}
+
+// parseDiffLineNumber parses a line number of a diff command.
+func parseDiffLineNumber(s string) (int, error) {
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("malformed line number %q", s)
+	}
+
+	return n, nil
+}
+
+// parseDiffCommand parses the given line of a diff command, e.g., "12,14c",
+// without the lines that the command inserts.
+func parseDiffCommand(line string) (*DiffCommand, error) {
+
+	if line == "" {
+		return nil, errors.New("empty diff command")
+	}
+	cmd := &DiffCommand{Op: line[len(line)-1]}
+	if cmd.Op != 'a' && cmd.Op != 'c' && cmd.Op != 'd' {
+		return nil, fmt.Errorf("unknown diff command %q", line)
+	}
+
+	var err error
+	lineRange := strings.SplitN(line[:len(line)-1], ",", 2)
+	if cmd.Start, err = parseDiffLineNumber(lineRange[0]); err != nil {
+		return nil, err
+	}
+	cmd.End = cmd.Start
+	if len(lineRange) == 2 {
+		if lineRange[1] == "$" {
+			cmd.End = DiffToEnd
+		} else if cmd.End, err = parseDiffLineNumber(lineRange[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cmd.validate(); err != nil {
+		return nil, fmt.Errorf("%s in %q", err, line)
+	}
+
+	return cmd, nil
+}
+
+// validate returns an error if the command's operation or range is invalid.
+func (cmd *DiffCommand) validate() error {
+
+	switch {
+	case cmd.Op != 'a' && cmd.Op != 'c' && cmd.Op != 'd':
+		return fmt.Errorf("unknown diff command %q", cmd.Op)
+	case cmd.Start < 0 || (cmd.Op != 'a' && cmd.Start == 0):
+		return errors.New("invalid line number")
+	case cmd.Op == 'a' && cmd.End != cmd.Start:
+		return errors.New("append command with range")
+	case cmd.End != DiffToEnd && cmd.End < cmd.Start:
+		return errors.New("invalid range")
+	}
+
+	return nil
+}
+
+// ParseNetworkStatusDiff parses a consensus diff.  Commands must be sorted by
+// descending line numbers and must not overlap, as proposal 140 requires.
+func ParseNetworkStatusDiff(r io.Reader) (*NetworkStatusDiff, error) {
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		lineNum++
+		return scanner.Text(), true
+	}
+
+	if line, _ := next(); line != networkStatusDiffVersion {
+		return nil, atLine(fmt.Errorf("expected %q but got %q", networkStatusDiffVersion, line), 1)
+	}
+	line, _ := next()
+	words := strings.Split(line, " ")
+	if len(words) != 3 || words[0] != "hash" {
+		return nil, atLine(fmt.Errorf("malformed \"hash\" line %q", line), 2)
+	}
+	diff := &NetworkStatusDiff{BaseDigest: strings.ToUpper(words[1]), TargetDigest: strings.ToUpper(words[2])}
+
+	// The lowest line that the previous command touched.
+	previous := -1
+	for {
+		line, ok := next()
+		if !ok {
+			break
+		}
+		cmdLine := lineNum
+		cmd, err := parseDiffCommand(line)
+		if err != nil {
+			return nil, atLine(err, cmdLine)
+		}
+
+		// Only the first command may extend to the end of the document.
+		if cmd.End == DiffToEnd && previous != -1 {
+			return nil, atLine(errors.New("range ends with \"$\" but is not the last range"), cmdLine)
+		}
+		if previous != -1 && cmd.End >= previous {
+			return nil, atLine(errors.New("commands are not in descending order"), cmdLine)
+		}
+		previous = cmd.Start
+
+		if cmd.Op != 'd' {
+			terminated := false
+			for !terminated {
+				line, ok := next()
+				if !ok {
+					return nil, atLine(errors.New("unterminated lines of diff command"), cmdLine)
+				}
+				if line == "." {
+					terminated = true
+				} else {
+					cmd.Lines = append(cmd.Lines, line)
+				}
+			}
+		}
+		diff.Commands = append(diff.Commands, *cmd)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// ParseRawNetworkStatusDiff parses a raw consensus diff (in string format).
+func ParseRawNetworkStatusDiff(rawDiff string) (*NetworkStatusDiff, error) {
+
+	return ParseNetworkStatusDiff(strings.NewReader(rawDiff))
+}
+
+// ParseNetworkStatusDiffFile is a wrapper around ParseNetworkStatusDiff that
+// parses the named file.
+func ParseNetworkStatusDiffFile(fileName string) (*NetworkStatusDiff, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return ParseNetworkStatusDiff(fd)
+}
+
+// ApplyDiff applies the given consensus diff to the given base consensus and
+// returns the target consensus.  The base consensus must be the document that
+// the diff was computed for, as served by directory caches.  A leading type
+// annotation, as found in CollecTor's archives, is removed before the diff is
+// applied, so the target consensus lacks the annotation.  Go's standard
+// library lacks SHA3, so the digests of the diff's "hash" line are not
+// checked; the result is only as good as the match between diff and base.
+func ApplyDiff(base []byte, diff *NetworkStatusDiff) ([]byte, error) {
+
+	if bytes.HasPrefix(base, []byte("@")) {
+		if i := bytes.IndexByte(base, '\n'); i >= 0 {
+			base = base[i+1:]
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(string(base), "\n"), "\n")
+	if len(base) == 0 {
+		lines = nil
+	}
+
+	// Commands are sorted by descending line numbers, so applying a command
+	// does not shift the lines that later commands refer to.  Diffs need not
+	// come from ParseNetworkStatusDiff, so we check every command.
+	previous := -1
+	for i := range diff.Commands {
+		cmd := &diff.Commands[i]
+		header := strings.SplitN(cmd.String(), "\n", 2)[0]
+		if err := cmd.validate(); err != nil {
+			return nil, fmt.Errorf("%s in %q", err, header)
+		}
+		if previous != -1 && (cmd.End == DiffToEnd || cmd.End >= previous) {
+			return nil, fmt.Errorf("diff command %q is not in descending order", header)
+		}
+		previous = cmd.Start
+
+		end := cmd.End
+		if end == DiffToEnd {
+			end = len(lines)
+		}
+		if end > len(lines) || cmd.Start > len(lines) {
+			return nil, fmt.Errorf("diff command %q exceeds base consensus of %d lines", header, len(lines))
+		}
+
+		var head, tail []string
+		switch cmd.Op {
+		case 'a':
+			head, tail = lines[:cmd.Start], lines[cmd.Start:]
+		default:
+			head, tail = lines[:cmd.Start-1], lines[end:]
+		}
+		result := make([]string, 0, len(head)+len(cmd.Lines)+len(tail))
+		result = append(append(append(result, head...), cmd.Lines...), tail...)
+		lines = result
+	}
+
+	if len(lines) == 0 {
+		return nil, errors.New("diff results in an empty consensus")
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// ApplyDiffAndParse is a wrapper around ApplyDiff that parses and returns the
+// target consensus.  The target consensus is parsed strictly, so a diff that
+// does not match its base consensus is likely to result in an error.
+func ApplyDiffAndParse(base []byte, diff *NetworkStatusDiff) (*Consensus, error) {
+
+	target, err := ApplyDiff(base, diff)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseConsensusUnchecked(bytes.NewReader(target), parseOptions{strict: true})
+}
@@ -0,0 +1,160 @@
+// Tests functions from "consdiff.go".
+
+package zoossh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testNetworkStatusDiff = `network-status-diff-version 1
+hash 2AB9DCB17F4D7CE8C6CF7B1CB4C2C4AD1D45CE1F4E5F1AB5A4F7C4A9B7C6D5E4 0c6a3f0e8ad66db2e1bf08d0c2c5d8d4a4f9b2f4e1d2c3b4a5968778695a4b3c
+14,$d
+9,10c
+r seele AAoQ1DAR6kkoo19hBAX5K0QztNw OSdIi4HtkwTSq6P1YQ2yo9CHfpc 2021-03-05 00:52:13 73.15.150.172 9001 0
+s Running Stable Valid
+.
+4d
+0a
+@type network-status-vote-3 1.0
+.
+`
+
+// Test the function ParseNetworkStatusDiff().
+func TestParseNetworkStatusDiff(t *testing.T) {
+
+	diff, err := ParseRawNetworkStatusDiff(testNetworkStatusDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.BaseDigest != "2AB9DCB17F4D7CE8C6CF7B1CB4C2C4AD1D45CE1F4E5F1AB5A4F7C4A9B7C6D5E4" ||
+		!strings.HasPrefix(diff.TargetDigest, "0C6A3F0E") {
+		t.Error("Unexpected digests.", diff.BaseDigest, diff.TargetDigest)
+	}
+	if len(diff.Commands) != 4 {
+		t.Fatalf("Expected four commands but got %d.", len(diff.Commands))
+	}
+
+	expected := []DiffCommand{
+		{Op: 'd', Start: 14, End: DiffToEnd},
+		{Op: 'c', Start: 9, End: 10},
+		{Op: 'd', Start: 4, End: 4},
+		{Op: 'a', Start: 0, End: 0},
+	}
+	for i, cmd := range diff.Commands {
+		if cmd.Op != expected[i].Op || cmd.Start != expected[i].Start || cmd.End != expected[i].End {
+			t.Errorf("Expected command %q but got %q.", expected[i].String(), cmd.String())
+		}
+	}
+	if len(diff.Commands[1].Lines) != 2 || !strings.HasPrefix(diff.Commands[1].Lines[1], "s Running") {
+		t.Error("Unexpected lines of change command.", diff.Commands[1].Lines)
+	}
+
+	// Commands are printed as they appear in the diff.
+	var printed []string
+	for _, cmd := range diff.Commands {
+		printed = append(printed, cmd.String())
+	}
+	if body := strings.SplitN(testNetworkStatusDiff, "\n", 3)[2]; strings.Join(printed, "\n")+"\n" != body {
+		t.Errorf("Unexpected printed commands:\n%s", strings.Join(printed, "\n"))
+	}
+}
+
+// Test that ParseNetworkStatusDiff() rejects malformed diffs.
+func TestParseMalformedNetworkStatusDiff(t *testing.T) {
+
+	header := "network-status-diff-version 1\nhash AA BB\n"
+	for _, test := range []struct {
+		diff string
+		line int
+	}{
+		{"network-status-diff-version 2\nhash AA BB\n", 1},
+		{"network-status-diff-version 1\nhash AA\n", 2},
+		{header + "3x\n", 3},
+		{header + "0d\n", 3},
+		{header + "5,3d\n", 3},
+		{header + "3,4a\nfoo\n.\n", 3},
+		{header + "3d\n5d\n", 4},
+		{header + "5d\n3,$d\n", 4},
+		{header + "5d\n3c\nfoo\n", 4},
+	} {
+		_, err := ParseRawNetworkStatusDiff(test.diff)
+		var perr *ParseError
+		if !errors.As(err, &perr) || perr.Line != test.line {
+			t.Errorf("Expected error in line %d of %q but got %v.", test.line, test.diff, err)
+		}
+	}
+}
+
+// Test the functions ApplyDiff() and ApplyDiffAndParse().
+func TestApplyDiff(t *testing.T) {
+
+	base := testDirectoryConsensus()
+	seele := lineOf(base, "s Fast Running Stable Valid")
+	karlstadStart := lineOf(base, "r Karlstad0")
+	karlstadEnd := lineOf(base, "id ed25519 4eFK")
+
+	// Remove Karlstad0 and give seele the Exit flag.
+	rawDiff := fmt.Sprintf("network-status-diff-version 1\nhash AA BB\n%d,%dd\n%dc\ns Exit Fast Running Stable Valid\n.\n",
+		karlstadStart, karlstadEnd, seele)
+	diff, err := ParseRawNetworkStatusDiff(rawDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := ApplyDiff([]byte(base), diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(target), "Karlstad0") || strings.Count(string(target), "\n") != strings.Count(base, "\n")-(karlstadEnd-karlstadStart+1) {
+		t.Error("Unexpected target consensus.")
+	}
+
+	// The type annotation of archived consensuses is ignored.
+	annotated, err := ApplyDiff([]byte(testVote), diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(annotated) != string(target) {
+		t.Error("Diff of annotated consensus differs.")
+	}
+
+	consensus, err := ApplyDiffAndParse([]byte(base), diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, ok := consensus.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if consensus.Length() != 1 || !ok || !status.Flags.Exit {
+		t.Error("Unexpected router statuses of target consensus.")
+	}
+
+	// Commands must not exceed the base consensus.
+	diff.Commands = []DiffCommand{{Op: 'd', Start: 1, End: strings.Count(base, "\n") + 1}}
+	if _, err := ApplyDiff([]byte(base), diff); err == nil {
+		t.Error("Expected error for command beyond the base consensus.")
+	}
+
+	// Commands that were not parsed are checked, too.
+	for _, commands := range [][]DiffCommand{
+		{{Op: 'c', Start: 0, End: 0}},
+		{{Op: 'd', Start: 0, End: 2}},
+		{{Op: 'x', Start: 1, End: 1}},
+		{{Op: 'd', Start: 3, End: 2}},
+		{{Op: 'd', Start: 2, End: 2}, {Op: 'd', Start: 3, End: 3}},
+	} {
+		diff.Commands = commands
+		if _, err := ApplyDiff([]byte(base), diff); err == nil {
+			t.Errorf("Expected error for commands %v.", commands)
+		}
+	}
+
+	// The target consensus is parsed strictly.
+	footer := lineOf(base, "directory-footer")
+	diff.Commands = []DiffCommand{{Op: 'd', Start: footer, End: DiffToEnd}}
+	if _, err := ApplyDiffAndParse([]byte(base), diff); err == nil {
+		t.Error("Expected error for target consensus without footer.")
+	}
+}
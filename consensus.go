@@ -5,6 +5,7 @@ package zoossh
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,14 +21,28 @@ import (
 
 var consensusAnnotations = map[Annotation]bool{
 	// The file format we currently (try to) support.
-	Annotation{"network-status-consensus-3", "1", "0"}: true,
+	Annotation{"network-status-consensus-3", "1", "0"}:           true,
+	Annotation{"network-status-microdesc-consensus-3", "1", "0"}: true,
 }
 
 var bridgeNetworkStatusAnnotations = map[Annotation]bool{
 	// The file format we currently (try to) support.
+	Annotation{"bridge-network-status", "1", "0"}: true,
+	Annotation{"bridge-network-status", "1", "1"}: true,
 	Annotation{"bridge-network-status", "1", "2"}: true,
 }
 
+// Consensus flavours as given on the "network-status-version" line.
+const (
+	FlavourNS        = "ns"
+	FlavourMicrodesc = "microdesc"
+)
+
+// FixedPublicationTime is the publication time that, as per proposal 275,
+// consensuses use for all router statuses instead of the real publication
+// time of the relays' descriptors.
+var FixedPublicationTime = time.Date(2038, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 type GetStatus func() *RouterStatus
 
 type RouterFlags struct {
@@ -42,6 +58,74 @@ type RouterFlags struct {
 	Unnamed   bool
 	Valid     bool
 	V2Dir     bool
+
+	// Flags that were introduced after the ones above.
+	MiddleOnly    bool
+	StaleDesc     bool
+	NoEdConsensus bool
+	Sybil         bool
+}
+
+// routerFlagTable maps the names of router flags to their fields.  The order
+// determines the order of flags in String and the bits of snapshot records,
+// so new flags must only ever be appended.
+var routerFlagTable = []struct {
+	name  string
+	field func(*RouterFlags) *bool
+}{
+	{"Authority", func(f *RouterFlags) *bool { return &f.Authority }},
+	{"BadExit", func(f *RouterFlags) *bool { return &f.BadExit }},
+	{"Exit", func(f *RouterFlags) *bool { return &f.Exit }},
+	{"Fast", func(f *RouterFlags) *bool { return &f.Fast }},
+	{"Guard", func(f *RouterFlags) *bool { return &f.Guard }},
+	{"HSDir", func(f *RouterFlags) *bool { return &f.HSDir }},
+	{"Named", func(f *RouterFlags) *bool { return &f.Named }},
+	{"Stable", func(f *RouterFlags) *bool { return &f.Stable }},
+	{"Running", func(f *RouterFlags) *bool { return &f.Running }},
+	{"Unnamed", func(f *RouterFlags) *bool { return &f.Unnamed }},
+	{"Valid", func(f *RouterFlags) *bool { return &f.Valid }},
+	{"V2Dir", func(f *RouterFlags) *bool { return &f.V2Dir }},
+	{"MiddleOnly", func(f *RouterFlags) *bool { return &f.MiddleOnly }},
+	{"StaleDesc", func(f *RouterFlags) *bool { return &f.StaleDesc }},
+	{"NoEdConsensus", func(f *RouterFlags) *bool { return &f.NoEdConsensus }},
+	{"Sybil", func(f *RouterFlags) *bool { return &f.Sybil }},
+}
+
+// routerFlagIndices maps flag names to their index in routerFlagTable.
+var routerFlagIndices = func() map[string]int {
+
+	indices := make(map[string]int, len(routerFlagTable))
+	for i, flag := range routerFlagTable {
+		indices[flag.name] = i
+	}
+
+	return indices
+}()
+
+// flagFields returns pointers to the given flags in the order of
+// routerFlagTable.
+func flagFields(flags *RouterFlags) []*bool {
+
+	fields := make([]*bool, len(routerFlagTable))
+	for i, flag := range routerFlagTable {
+		fields[i] = flag.field(flags)
+	}
+
+	return fields
+}
+
+// flagNames returns the names of all flags that are set, in the same order
+// as String.
+func (flags RouterFlags) flagNames() []string {
+
+	names := []string{}
+	for i, isSet := range flagFields(&flags) {
+		if *isSet {
+			names = append(names, routerFlagTable[i].name)
+		}
+	}
+
+	return names
 }
 
 type RouterAddress struct {
@@ -53,6 +137,36 @@ type RouterAddress struct {
 	IPv6ORPort  uint16
 }
 
+// Package is a recommended software package as given on a "package" line of
+// a network status document, see dir-spec.txt, Section 3.4.1.
+type Package struct {
+	Name    string
+	Version string
+	URL     string
+
+	// Maps a digest algorithm, e.g., "sha256", to the package's digest.
+	Digests map[string]string
+}
+
+// DirSource is a directory authority as listed in the "dir-source" section
+// of a network status document, see dir-spec.txt, Section 3.4.2.
+type DirSource struct {
+	// The single fields of a "dir-source" line.
+	Nickname string
+	Identity Fingerprint
+	Hostname string
+	Address  net.IP
+	DirPort  uint16
+	ORPort   uint16
+
+	// The single fields of a "contact" line.
+	Contact string
+
+	// The hex-encoded digest of the authority's vote as given on the
+	// "vote-digest" line.  Only present in consensuses.
+	VoteDigest string
+}
+
 type RouterStatus struct {
 
 	// The single fields of an "r" line.
@@ -78,39 +192,147 @@ type RouterStatus struct {
 	// The single fields of a "p" line.
 	Accept   bool
 	PortList string
+
+	// The digest of the relay's microdescriptor, as given on the "m" line
+	// of a microdesc-flavoured consensus.
+	MicrodescDigest string
+
+	// Maps a consensus method to the SHA-256 digest of the relay's
+	// microdescriptor under that method, as given on the "m" lines of a
+	// vote.  Nil for consensuses.
+	MicrodescDigests map[int]string
+
+	// The lines that the parser does not know of, e.g., because they were
+	// added to dir-spec.txt after the parser was written.
+	UnknownLines []string
+
+	// The position of the status within its source document.  Only set if
+	// offsets were requested during parsing.
+	SourceOffset int64
+	SourceLength int
+}
+
+// ignoredStatusKeywords holds the keywords of router status lines that the
+// parser knows of but does not extract.  Lines of all other keywords that the
+// parser does not extract end up in the status' UnknownLines.
+var ignoredStatusKeywords = map[string]bool{
+	"id":    true,
+	"pr":    true,
+	"stats": true,
 }
 
 type Consensus struct {
 	// Generic map of consensus metadata
 	MetaInfo map[string][]byte
 
+	// The consensus flavour, i.e., FlavourNS or FlavourMicrodesc.
+	Flavour string
+
 	// Document validity period
 	ValidAfter time.Time
 	FreshUntil time.Time
 	ValidUntil time.Time
 
+	// The single fields of the "consensus-method" line.  Zero for votes.
+	ConsensusMethod int
+
+	// The packages of the "package" lines.
+	Packages []Package
+
+	// The recommended versions of the "client-versions" and
+	// "server-versions" lines in ascending order.
+	ClientVersions []Version
+	ServerVersions []Version
+
+	// The parameters of the "params" line, e.g., "CircuitPriorityHalflifeMsec".
+	Params map[string]int
+
 	// Shared randomness
 	SharedRandPrevious []byte
 	SharedRandCurrent  []byte
 
+	// The shared randomness protocol state of votes: whether the voting
+	// authority participates and the commits that it knows of.
+	SharedRandParticipate bool
+	SharedRandCommits     []SharedRandCommit
+
+	// The directory authorities of the "dir-source" section.  Votes only
+	// list the voting authority.
+	DirSources []DirSource
+
+	// The bridge authority's fingerprint of the "fingerprint" line, which
+	// bridge network statuses carry as of version 1.2.  Empty otherwise.
+	AuthorityFingerprint Fingerprint
+
+	// The authority signatures of the "directory-signature" lines in the
+	// document's footer.
+	Signatures []DirectorySignature
+
+	// The weights of the footer's "bandwidth-weights" line.  Nil for votes
+	// and for consensuses without weights.
+	BandwidthWeights *BandwidthWeights
+
+	// Bandwidth file provenance; only present in votes.
+	BandwidthFileHeaders *BandwidthFileHeader
+	BandwidthFileDigests []BandwidthFileDigest
+
+	// False if router statuses carry the fixed publication time of proposal
+	// 275 instead of the real publication time of their descriptors.
+	HasRealPublicationTimes bool
+
 	// A map from relay fingerprint to a function which returns the relay
 	// status.
 	RouterStatuses map[Fingerprint]GetStatus
+
+	// The document's annotations other than the type annotation, e.g.,
+	// "@source", keyed by their keyword without the leading "@".  Nil if the
+	// document had none.
+	AnnotationMetadata map[string]string
+
+	// Frozen consensuses reject modifications and hand out copies of their
+	// router statuses.
+	frozen bool
+
+	// The digests of the document's signed portion, keyed by algorithm.
+	signedDigests map[string][]byte
+}
+
+// RouterStatusColumns names the comma-separated columns that
+// RouterStatus.String returns, in order.  The "ipv6_address" column is empty
+// for router statuses without an IPv6 address.  New columns are only ever
+// appended, so consumers can rely on the position of existing columns.
+var RouterStatusColumns = []string{
+	"fingerprint",
+	"nickname",
+	"ipv4_address",
+	"ipv6_address",
+	"flags",
+	"published",
+	"tor_version",
 }
 
 // String implements the String as well as the Object interface.  It returns
-// the status' string representation.
+// the status' string representation whose columns are described by
+// RouterStatusColumns.
 func (s *RouterStatus) String() string {
 
-	return fmt.Sprintf("%s,%s,%+v,%s,%s,%s",
+	return fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s",
 		s.Fingerprint,
 		s.Nickname,
-		s.Address,
+		s.Address.ipv4String(),
+		s.Address.ipv6String(),
 		s.Flags,
 		s.Publication.Format(time.RFC3339),
 		strings.Replace(s.TorVersion, ",", "", -1))
 }
 
+// Header returns the comma-separated names of the columns that String
+// returns.
+func (s *RouterStatus) Header() string {
+
+	return strings.Join(RouterStatusColumns, ",")
+}
+
 // GetFingerprint implements the Object interface.  It returns the router
 // status' fingerprint.
 func (s *RouterStatus) GetFingerprint() Fingerprint {
@@ -153,9 +375,19 @@ func (c *Consensus) GetObject(fingerprint Fingerprint) (Object, bool) {
 	return c.Get(fingerprint)
 }
 
+// Contains implements the ObjectSet interface.  It returns true if the router
+// status identified by the given fingerprint is part of the consensus.
+func (c *Consensus) Contains(fingerprint Fingerprint) bool {
+
+	_, exists := c.RouterStatuses[SanitiseFingerprint(fingerprint)]
+	return exists
+}
+
 // Merge merges the given object set with itself.
 func (c *Consensus) Merge(objs ObjectSet) {
 
+	c.mustNotBeFrozen()
+
 	for obj := range objs.Iterate(nil) {
 		fpr := obj.GetFingerprint()
 		_, exists := c.Get(fpr)
@@ -169,7 +401,10 @@ func (c *Consensus) Merge(objs ObjectSet) {
 // allocated and empty Consensus.
 func NewConsensus() *Consensus {
 
-	return &Consensus{RouterStatuses: make(map[Fingerprint]GetStatus)}
+	return &Consensus{
+		RouterStatuses:          make(map[Fingerprint]GetStatus),
+		HasRealPublicationTimes: true,
+	}
 }
 
 // ToSlice converts the given consensus to a slice.  Consensus meta information
@@ -204,11 +439,69 @@ func (c *Consensus) Get(fingerprint Fingerprint) (*RouterStatus, bool) {
 // to the consensus.
 func (c *Consensus) Set(fingerprint Fingerprint, status *RouterStatus) {
 
+	c.mustNotBeFrozen()
 	c.RouterStatuses[SanitiseFingerprint(fingerprint)] = func() *RouterStatus {
 		return status
 	}
 }
 
+// Remove removes the router status of the given fingerprint from the
+// consensus and returns true if the consensus contained it.
+func (c *Consensus) Remove(fingerprint Fingerprint) bool {
+
+	c.mustNotBeFrozen()
+
+	fingerprint = SanitiseFingerprint(fingerprint)
+	if _, exists := c.RouterStatuses[fingerprint]; !exists {
+		return false
+	}
+	delete(c.RouterStatuses, fingerprint)
+
+	return true
+}
+
+// RemoveIf removes all router statuses for which drop returns true, e.g., the
+// statuses of relays without the Running flag, and returns the number of
+// removed statuses.
+func (c *Consensus) RemoveIf(drop func(*RouterStatus) bool) int {
+
+	c.mustNotBeFrozen()
+
+	removed := 0
+	for fingerprint, getStatus := range c.RouterStatuses {
+		if drop(getStatus()) {
+			delete(c.RouterStatuses, fingerprint)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Filter returns a sub-consensus of all router statuses that match the given
+// object filter.  An empty or nil filter matches all router statuses.  The
+// sub-consensus shares its router statuses and meta information with the
+// original consensus.
+func (c *Consensus) Filter(filter *ObjectFilter) *Consensus {
+
+	// Fingerprints are the consensus' keys, so there is no need to parse
+	// router statuses that are not wanted.
+	if filter != nil && filter.hasOnlyFingerprints() {
+		sub := *c
+		sub.RouterStatuses = make(map[Fingerprint]GetStatus)
+		for fingerprint := range filter.Fingerprints {
+			if getStatus, exists := c.RouterStatuses[fingerprint]; exists {
+				sub.RouterStatuses[fingerprint] = getStatus
+			}
+		}
+		return &sub
+	}
+
+	return c.filterStatuses(func(s *RouterStatus) bool {
+		return filter == nil || filter.IsEmpty() || filter.MatchesRouterStatus(s)
+	})
+}
+
 // Subtract removes all routers which are part of the given consensus b from
 // consensus a.  It returns a new consensus which is the result of the
 // subtraction.
@@ -245,104 +538,188 @@ func (c *Consensus) Intersect(b *Consensus) *Consensus {
 	return intersection
 }
 
+// filterStatuses returns a new consensus that holds the router statuses for
+// which keep returns true.  The new consensus shares its router statuses and
+// meta information with the original consensus.
+func (c *Consensus) filterStatuses(keep func(*RouterStatus) bool) *Consensus {
+
+	sub := *c
+	sub.RouterStatuses = make(map[Fingerprint]GetStatus)
+
+	for fingerprint, getStatus := range c.RouterStatuses {
+		if keep(getStatus()) {
+			sub.RouterStatuses[fingerprint] = getStatus
+		}
+	}
+
+	return &sub
+}
+
+// publicationTimeSample is the number of router statuses that
+// detectPublicationTimes inspects.
+const publicationTimeSample = 16
+
+// detectPublicationTimes determines if the consensus' router statuses carry
+// real publication times.  Proposal 275 applies to all statuses of a
+// consensus, so it suffices to inspect the statuses with the lowest
+// fingerprints, which keeps the result deterministic without parsing all
+// statuses of lazily parsed consensuses.  The consensus has real publication
+// times if any of these statuses lacks the fixed publication time.
+func (c *Consensus) detectPublicationTimes() {
+
+	fingerprints := make([]string, 0, len(c.RouterStatuses))
+	for fingerprint := range c.RouterStatuses {
+		fingerprints = append(fingerprints, string(fingerprint))
+	}
+	sort.Strings(fingerprints)
+	if len(fingerprints) > publicationTimeSample {
+		fingerprints = fingerprints[:publicationTimeSample]
+	}
+
+	c.HasRealPublicationTimes = false
+	for _, fingerprint := range fingerprints {
+		if !c.RouterStatuses[Fingerprint(fingerprint)]().Publication.Equal(FixedPublicationTime) {
+			c.HasRealPublicationTimes = true
+			return
+		}
+	}
+}
+
+// AttachDescriptors attaches the given router descriptors to the consensus.
+// If the consensus lacks real publication times, router statuses returned by
+// the consensus henceforth carry the publication time of their descriptor
+// instead of FixedPublicationTime.  Statuses without descriptor keep the fixed
+// publication time.  The returned statuses are copies, so consensuses that
+// share router statuses, e.g., through a StatusPool, are not affected.
+func (c *Consensus) AttachDescriptors(rds *RouterDescriptors) {
+
+	c.mustNotBeFrozen()
+	if c.HasRealPublicationTimes {
+		return
+	}
+
+	for fingerprint, getStatus := range c.RouterStatuses {
+		getDescriptor, exists := rds.RouterDescriptors[fingerprint]
+		if !exists {
+			continue
+		}
+		getStatus := getStatus
+		c.RouterStatuses[fingerprint] = func() *RouterStatus {
+			status := getStatus().Copy()
+			status.Publication = getDescriptor().Published
+			return status
+		}
+	}
+}
+
+// MicrodescDigestFor returns the digest of the microdescriptor that the
+// router status refers to.  Statuses of microdesc-flavoured consensuses carry
+// a single digest, so the given consensus method only matters for statuses of
+// votes.  The returned string is empty if there is no such digest.
+func (s *RouterStatus) MicrodescDigestFor(method int) string {
+
+	if s.MicrodescDigest != "" {
+		return s.MicrodescDigest
+	}
+
+	return strings.TrimRight(s.MicrodescDigests[method], "=")
+}
+
+// JoinMicrodescriptors returns a map from relay fingerprint to the
+// microdescriptor that the relay's router status refers to.  For votes, the
+// digests of the given consensus method are used.  Relays whose
+// microdescriptor is missing from the given microdescriptors are left out.
+func (c *Consensus) JoinMicrodescriptors(mds *Microdescriptors, method int) map[Fingerprint]*Microdescriptor {
+
+	joined := make(map[Fingerprint]*Microdescriptor)
+
+	for fingerprint, getStatus := range c.RouterStatuses {
+		digest := getStatus().MicrodescDigestFor(method)
+		if digest == "" {
+			continue
+		}
+		if md, exists := mds.Get(digest); exists {
+			joined[fingerprint] = md
+		}
+	}
+
+	return joined
+}
+
+// Exits returns a sub-consensus of all relays that have the Exit flag.
+func (c *Consensus) Exits() *Consensus {
+
+	return c.filterStatuses(func(s *RouterStatus) bool { return s.Flags.Exit })
+}
+
+// Guards returns a sub-consensus of all relays that have the Guard flag.
+func (c *Consensus) Guards() *Consensus {
+
+	return c.filterStatuses(func(s *RouterStatus) bool { return s.Flags.Guard })
+}
+
+// HSDirs returns a sub-consensus of all relays that have the HSDir flag.
+func (c *Consensus) HSDirs() *Consensus {
+
+	return c.filterStatuses(func(s *RouterStatus) bool { return s.Flags.HSDir })
+}
+
+// Authorities returns a sub-consensus of all relays that have the Authority
+// flag.
+func (c *Consensus) Authorities() *Consensus {
+
+	return c.filterStatuses(func(s *RouterStatus) bool { return s.Flags.Authority })
+}
+
 // Implement the Stringer interface for pretty printing.
 func (address RouterAddress) String() string {
+
+	ipV4Join := address.ipv4String()
+	if address.IPv6Address == nil {
+		return ipV4Join
+	}
+
+	return ipV4Join + "," + address.ipv6String()
+}
+
+// ipv4String returns the IPv4 address and its ports, separated by "|".
+func (address RouterAddress) ipv4String() string {
 	var ipV4stringAddress []string
-	var ipV6stringAddress []string
 
 	if address.IPv4Address != nil {
 		ipV4stringAddress = append(ipV4stringAddress, address.IPv4Address.String())
 	}
 	ipV4stringAddress = append(ipV4stringAddress, fmt.Sprintf("%v", address.IPv4ORPort))
 	ipV4stringAddress = append(ipV4stringAddress, fmt.Sprintf("%v", address.IPv4DirPort))
-	ipV4Join := fmt.Sprint(strings.Join(ipV4stringAddress, "|"))
+
+	return strings.Join(ipV4stringAddress, "|")
+}
+
+// ipv6String returns the IPv6 address and its port, separated by "|", or an
+// empty string if there is no IPv6 address.
+func (address RouterAddress) ipv6String() string {
 
 	if address.IPv6Address == nil {
-		return ipV4Join
+		return ""
 	}
 
-	ipV6stringAddress = append(ipV6stringAddress, address.IPv6Address.String())
-	ipV6stringAddress = append(ipV6stringAddress, fmt.Sprintf("%v", address.IPv6ORPort))
-
-	ipV6Join := fmt.Sprint(strings.Join(ipV6stringAddress, "|"))
-	return ipV4Join + "," + ipV6Join
+	return address.IPv6Address.String() + "|" + fmt.Sprintf("%v", address.IPv6ORPort)
 }
 
 // Implement the Stringer interface for pretty printing.
 func (flags RouterFlags) String() string {
 
-	var stringFlags []string
-
-	if flags.Authority {
-		stringFlags = append(stringFlags, "Authority")
-	}
-	if flags.BadExit {
-		stringFlags = append(stringFlags, "BadExit")
-	}
-	if flags.Exit {
-		stringFlags = append(stringFlags, "Exit")
-	}
-	if flags.Fast {
-		stringFlags = append(stringFlags, "Fast")
-	}
-	if flags.Guard {
-		stringFlags = append(stringFlags, "Guard")
-	}
-	if flags.HSDir {
-		stringFlags = append(stringFlags, "HSDir")
-	}
-	if flags.Named {
-		stringFlags = append(stringFlags, "Named")
-	}
-	if flags.Stable {
-		stringFlags = append(stringFlags, "Stable")
-	}
-	if flags.Running {
-		stringFlags = append(stringFlags, "Running")
-	}
-	if flags.Unnamed {
-		stringFlags = append(stringFlags, "Unnamed")
-	}
-	if flags.Valid {
-		stringFlags = append(stringFlags, "Valid")
-	}
-	if flags.V2Dir {
-		stringFlags = append(stringFlags, "V2Dir")
-	}
-
-	return fmt.Sprint(strings.Join(stringFlags, "|"))
+	return strings.Join(flags.flagNames(), "|")
 }
 
 func parseRouterFlags(flags []string) *RouterFlags {
 
 	var routerFlags = new(RouterFlags)
+	fields := flagFields(routerFlags)
 
 	for _, flag := range flags {
-		switch flag {
-		case "Authority":
-			routerFlags.Authority = true
-		case "BadExit":
-			routerFlags.BadExit = true
-		case "Exit":
-			routerFlags.Exit = true
-		case "Fast":
-			routerFlags.Fast = true
-		case "Guard":
-			routerFlags.Guard = true
-		case "HSDir":
-			routerFlags.HSDir = true
-		case "Named":
-			routerFlags.Named = true
-		case "Stable":
-			routerFlags.Stable = true
-		case "Running":
-			routerFlags.Running = true
-		case "Unnamed":
-			routerFlags.Unnamed = true
-		case "Valid":
-			routerFlags.Valid = true
-		case "V2Dir":
-			routerFlags.V2Dir = true
+		if i, ok := routerFlagIndices[flag]; ok {
+			*fields[i] = true
 		}
 	}
 
@@ -364,9 +741,21 @@ func parseIPv6AddressAndPort(addressAndPort string) (address net.IP, port uint16
 // delayed until the returned function is executed.
 func LazyParseRawStatus(rawStatus string) (Fingerprint, GetStatus, error) {
 
+	return lazyParseRawStatus(rawStatus, FlavourNS)
+}
+
+// LazyParseRawMicrodescStatus is like LazyParseRawStatus but expects a router
+// status of a microdesc-flavoured consensus.
+func LazyParseRawMicrodescStatus(rawStatus string) (Fingerprint, GetStatus, error) {
+
+	return lazyParseRawStatus(rawStatus, FlavourMicrodesc)
+}
+
+func lazyParseRawStatus(rawStatus string, flavour string) (Fingerprint, GetStatus, error) {
+
 	// Delay parsing of the router status until this function is executed.
 	getStatus := func() *RouterStatus {
-		_, f, _ := ParseRawStatus(rawStatus)
+		_, f, _ := parseRawStatus(rawStatus, flavour)
 		return f()
 	}
 
@@ -381,7 +770,7 @@ func LazyParseRawStatus(rawStatus string) (Fingerprint, GetStatus, error) {
 		}
 	}
 
-	return "", nil, fmt.Errorf("could not extract relay fingerprint")
+	return "", nil, ErrNoFingerprint
 }
 
 // ParseRawStatus parses a raw router status (in string format) and returns the
@@ -389,29 +778,52 @@ func LazyParseRawStatus(rawStatus string) (Fingerprint, GetStatus, error) {
 // if there were any during parsing.
 func ParseRawStatus(rawStatus string) (Fingerprint, GetStatus, error) {
 
+	return parseRawStatus(rawStatus, FlavourNS)
+}
+
+// ParseRawMicrodescStatus is like ParseRawStatus but expects a router status
+// of a microdesc-flavoured consensus, whose "r" line lacks the descriptor
+// digest.
+func ParseRawMicrodescStatus(rawStatus string) (Fingerprint, GetStatus, error) {
+
+	return parseRawStatus(rawStatus, FlavourMicrodesc)
+}
+
+func parseRawStatus(rawStatus string, flavour string) (Fingerprint, GetStatus, error) {
+
 	var status = new(RouterStatus)
 
 	lines := strings.Split(rawStatus, "\n")
 
 	// Go over raw statuses line by line and extract the fields we are
 	// interested in.
-	for _, line := range lines {
+	for i, line := range lines {
 
 		words := strings.Split(line, " ")
 
 		switch words[0] {
 
 		case "r":
+			if len(words) < 8 || (flavour != FlavourMicrodesc && len(words) < 9) {
+				return "", nil, atLine(fieldError("r", "field count", strconv.Itoa(len(words)-1),
+					errors.New("too few fields")), i+1)
+			}
 			status.Nickname = words[1]
 			fingerprint, err := Base64ToString(words[2])
 			if err != nil {
-				return "", nil, err
+				return "", nil, atLine(fieldError("r", "identity", words[2], err), i+1)
 			}
 			status.Fingerprint = SanitiseFingerprint(Fingerprint(fingerprint))
 
-			status.Digest, err = Base64ToString(words[3])
-			if err != nil {
-				return "", nil, err
+			// Microdesc-flavoured statuses lack the descriptor digest, so we
+			// remove it from our view of the line.
+			if flavour == FlavourMicrodesc {
+				words = append(words[:3], append([]string{""}, words[3:]...)...)
+			} else {
+				status.Digest, err = Base64ToString(words[3])
+				if err != nil {
+					return "", nil, atLine(fieldError("r", "digest", words[3], err), i+1)
+				}
 			}
 
 			time, _ := time.Parse(publishedTimeLayout, strings.Join(words[4:6], " "))
@@ -430,9 +842,9 @@ func ParseRawStatus(rawStatus string) (Fingerprint, GetStatus, error) {
 			status.TorVersion = words[2]
 
 		case "w":
-			bwExpr := words[1]
-			values := strings.Split(bwExpr, "=")
-			status.Bandwidth, _ = strconv.ParseUint(values[1], 10, 64)
+			// Malformed values are only rejected when validating, by
+			// validateStatusEntry, so we keep what we could parse.
+			parseWeightLine(words[1:], status)
 
 		case "p":
 			if words[1] == "accept" {
@@ -441,48 +853,272 @@ func ParseRawStatus(rawStatus string) (Fingerprint, GetStatus, error) {
 				status.Accept = false
 			}
 			status.PortList = strings.Join(words[2:], " ")
+
+		case "m":
+			if flavour == FlavourMicrodesc && len(words) > 1 {
+				status.MicrodescDigest = words[1]
+			} else if len(words) > 2 {
+				if status.MicrodescDigests == nil {
+					status.MicrodescDigests = make(map[int]string)
+				}
+				if err := parseVoteMicrodescDigests(words[1:], status.MicrodescDigests); err != nil {
+					return "", nil, atLine(err, i+1)
+				}
+			}
+
+		default:
+			if line != "" && !ignoredStatusKeywords[words[0]] {
+				status.UnknownLines = append(status.UnknownLines, line)
+			}
 		}
 	}
 
 	return status.Fingerprint, func() *RouterStatus { return status }, nil
 }
 
+// parseWeightLine parses the given words of a "w" line, without the keyword,
+// and writes them to the given router status.  Unknown keywords are ignored.
+// A malformed value does not stop parsing; the first one is returned as error.
+func parseWeightLine(words []string, status *RouterStatus) error {
+
+	var firstErr error
+	for key, value := range parseKeyValues(words) {
+		var err error
+		switch key {
+		case "Bandwidth":
+			status.Bandwidth, err = strconv.ParseUint(value, 10, 64)
+		case "Measured":
+			status.Measured, err = strconv.ParseUint(value, 10, 64)
+		case "Unmeasured":
+			status.Unmeasured = value == "1"
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fieldError("w", key, value, err)
+		}
+	}
+
+	return firstErr
+}
+
+// parseVoteMicrodescDigests parses the fields of a vote's "m" line, e.g.,
+// "28,29,30 sha256=0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I", and adds the
+// SHA-256 digest for each of the consensus methods to the given map.
+func parseVoteMicrodescDigests(words []string, digests map[int]string) error {
+
+	digest, ok := parseKeyValues(words[1:])["sha256"]
+	if !ok {
+		return nil
+	}
+
+	for _, method := range strings.Split(words[0], ",") {
+		n, err := strconv.Atoi(method)
+		if err != nil {
+			return fieldError("m", "consensus method", method, err)
+		}
+		digests[n] = digest
+	}
+
+	return nil
+}
+
+// ErrNoDirectorySignature is returned when strictly parsing a network status
+// document that lacks the "directory-signature" footer, e.g., because it was
+// truncated.
+var ErrNoDirectorySignature = errors.New("missing \"directory-signature\" footer")
+
 // extractStatusEntry is a bufio.SplitFunc that extracts individual network
-// status entries.
+// status entries.  It tolerates documents that lack the "directory-signature"
+// footer, in which case the last entry extends to the end of the input.
 func extractStatusEntry(data []byte, atEOF bool) (advance int, token []byte, err error) {
 
+	return splitStatusEntry(data, atEOF, false)
+}
+
+// extractStatusEntryStrict is like extractStatusEntry but returns
+// ErrNoDirectorySignature if the input ends without "directory-signature"
+// footer.
+func extractStatusEntryStrict(data []byte, atEOF bool) (advance int, token []byte, err error) {
+
+	return splitStatusEntry(data, atEOF, true)
+}
+
+// hasKeyword returns true if the given line starts with the given keyword,
+// i.e., the keyword is followed by whitespace or ends the line.  Unlike a
+// prefix match, "r" does not match a line starting with "rr".
+func hasKeyword(line []byte, keyword string) bool {
+
+	if !bytes.HasPrefix(line, []byte(keyword)) {
+		return false
+	}
+	rest := line[len(keyword):]
+
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r'
+}
+
+// findKeywordLine returns the position of the first complete line in data,
+// starting at the given position, whose keyword is one of the given keywords.
+// Incomplete last lines only count if atEOF is set.  It returns -1 if there
+// is no such line.
+func findKeywordLine(data []byte, pos int, atEOF bool, keywords ...string) int {
+
+	for pos < len(data) {
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end < 0 && !atEOF {
+			return -1
+		}
+		line := data[pos:]
+		if end >= 0 {
+			line = data[pos : pos+end]
+		}
+		for _, keyword := range keywords {
+			if hasKeyword(line, keyword) {
+				return pos
+			}
+		}
+		if end < 0 {
+			return -1
+		}
+		pos += end + 1
+	}
+
+	return -1
+}
+
+// splitStatusEntry implements extractStatusEntry and
+// extractStatusEntryStrict.  Entries are delimited at line level by their
+// keywords, so unknown lines within entries cannot break extraction.  An entry
+// starts with an "r" line and extends to the next "r" line or to the footer,
+// which starts with a "directory-footer" or "directory-signature" line.
+func splitStatusEntry(data []byte, atEOF bool, strict bool) (advance int, token []byte, err error) {
+
 	if atEOF && len(data) == 0 {
+		if strict {
+			return 0, nil, ErrNoDirectorySignature
+		}
 		return 0, nil, nil
 	}
 
-	start := 0
-	if !bytes.HasPrefix(data, []byte("r ")) {
-		start = bytes.Index(data, []byte("\nr "))
-		if start < 0 {
-			if atEOF {
-				return 0, nil, fmt.Errorf("cannot find beginning of status entry: \"\\nr \"")
-			}
-			// Request more data.
-			return 0, nil, nil
+	start := findKeywordLine(data, 0, atEOF, "r")
+	if start < 0 {
+		if atEOF {
+			return 0, nil, fmt.Errorf("%w: \"\\nr \"", ErrNoEntry)
 		}
-		start++
+		// Request more data.
+		return 0, nil, nil
 	}
 
-	end := bytes.Index(data[start:], []byte("\nr "))
-	if end >= 0 {
-		return start + end + 1, data[start : start+end+1], nil
+	// Skip the entry's own "r" line.
+	next := len(data)
+	if i := bytes.IndexByte(data[start:], '\n'); i >= 0 {
+		next = start + i + 1
+	}
+
+	end := findKeywordLine(data, next, atEOF, "r", "directory-footer", "directory-signature")
+	if end >= 0 && hasKeyword(data[end:], "r") {
+		return end, data[start:end], nil
 	}
-	end = bytes.Index(data[start:], []byte("directory-signature"))
 	if end >= 0 {
-		// "directory-signature" means this is the last status; stop
-		// scanning.
-		return start + end, data[start : start+end], bufio.ErrFinalToken
+		// The footer means this is the last status; stop scanning once we
+		// know that the footer contains a signature.
+		if findKeywordLine(data, end, atEOF, "directory-signature") >= 0 {
+			return end, data[start:end], bufio.ErrFinalToken
+		}
+		if !atEOF {
+			// Request more data.
+			return start, nil, nil
+		}
+		if strict {
+			return 0, nil, ErrNoDirectorySignature
+		}
+		return end, data[start:end], bufio.ErrFinalToken
 	}
 	if atEOF {
-		return len(data[start:]), data[start:], bufio.ErrFinalToken
+		if strict {
+			return 0, nil, ErrNoDirectorySignature
+		}
+		return len(data), data[start:], bufio.ErrFinalToken
 	}
 	// Request more data.
-	return 0, nil, nil
+	return start, nil, nil
+}
+
+// parseFlavour returns the consensus flavour given on a
+// "network-status-version" line.  Consensuses without explicit flavour are of
+// flavour "ns".
+func parseFlavour(version []byte) string {
+
+	words := strings.Fields(string(version))
+	if len(words) < 2 {
+		return FlavourNS
+	}
+
+	return words[1]
+}
+
+// parsePackage parses the given words of a "package" line, without the
+// keyword.
+func parsePackage(words []string) (*Package, error) {
+
+	if len(words) < 3 {
+		return nil, fmt.Errorf("malformed package line with %d arguments", len(words))
+	}
+
+	pkg := &Package{
+		Name:    words[0],
+		Version: words[1],
+		URL:     words[2],
+		Digests: make(map[string]string),
+	}
+	for _, digest := range words[3:] {
+		kv := strings.SplitN(digest, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed package digest %q", digest)
+		}
+		pkg.Digests[kv[0]] = kv[1]
+	}
+
+	return pkg, nil
+}
+
+// parseIntKeyValues parses the given words of the form "key=value" with
+// 32-bit integer values into a map.  Errors name the kind of the words, e.g.,
+// "parameter".
+func parseIntKeyValues(words []string, kind string) (map[string]int, error) {
+
+	kvs := make(map[string]int)
+	for _, word := range words {
+		kv := strings.SplitN(word, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed %s %q", kind, word)
+		}
+		value, err := strconv.ParseInt(kv[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed value of %s %q", kind, kv[0])
+		}
+		kvs[kv[0]] = int(value)
+	}
+
+	return kvs, nil
+}
+
+// parseParams parses the value of a "params" line, i.e., space-separated
+// key-value pairs with integer values.
+func parseParams(line []byte) (map[string]int, error) {
+
+	return parseIntKeyValues(strings.Fields(string(line)), "parameter")
+}
+
+// parseSharedRandValue parses the value of a "shared-rand-previous-value" or
+// "shared-rand-current-value" line and returns the decoded random value.
+func parseSharedRandValue(line []byte) ([]byte, error) {
+
+	split := bytes.SplitN(line, []byte(" "), 2)
+	if len(split) != 2 {
+		return nil, errors.New("malformed shared random line")
+	}
+	// should split to (vote count, b64 bytes)
+	_, rand := split[0], split[1]
+	return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(rand)))
 }
 
 // extractMetainfo extracts meta information of the open consensus document
@@ -501,12 +1137,28 @@ func extractMetaInfo(br *bufio.Reader, c *Consensus) error {
 
 		// splits to (key, value)
 		split := bytes.SplitN(line, []byte(" "), 2)
-		if len(split) != 2 {
+		key := string(bytes.TrimSpace(split[0]))
+		if key == "" {
 			return errors.New("malformed metainfo line")
 		}
 
-		key := string(split[0])
-		c.MetaInfo[key] = bytes.TrimSpace(split[1])
+		// Unlike other keywords, "package" lines may repeat.
+		if key == "package" && len(split) == 2 {
+			pkg, err := parsePackage(strings.Fields(string(split[1])))
+			if err != nil {
+				return err
+			}
+			c.Packages = append(c.Packages, *pkg)
+		}
+
+		// Some keywords, e.g., "shared-rand-participate", have no arguments.
+		// ReadSlice returns the reader's buffer, which later reads
+		// overwrite, so we copy the value.
+		if len(split) == 2 {
+			c.MetaInfo[key] = append([]byte{}, bytes.TrimSpace(split[1])...)
+		} else {
+			c.MetaInfo[key] = []byte{}
+		}
 
 		// Look ahead to check if we've reached the end of the unique keys.
 		nextKey, err := br.Peek(11)
@@ -518,6 +1170,8 @@ func extractMetaInfo(br *bufio.Reader, c *Consensus) error {
 		}
 	}
 
+	c.Flavour = parseFlavour(c.MetaInfo["network-status-version"])
+
 	var err error
 	// Define a parser for validity timestamps
 	parseTime := func(line []byte) (time.Time, error) {
@@ -538,41 +1192,188 @@ func extractMetaInfo(br *bufio.Reader, c *Consensus) error {
 		return err
 	}
 
-	// Reads a shared-rand line from the consensus and returns decoded bytes.
-	parseRand := func(line []byte) ([]byte, error) {
-		split := bytes.SplitN(line, []byte(" "), 2)
-		if len(split) != 2 {
-			return nil, errors.New("malformed shared random line")
+	if line, ok := c.MetaInfo["consensus-method"]; ok {
+		c.ConsensusMethod, err = strconv.Atoi(string(line))
+		if err != nil {
+			return fmt.Errorf("malformed consensus method %q", line)
+		}
+	}
+
+	if line, ok := c.MetaInfo["client-versions"]; ok {
+		c.ClientVersions, err = parseVersionList(line)
+		if err != nil {
+			return err
+		}
+	}
+	if line, ok := c.MetaInfo["server-versions"]; ok {
+		c.ServerVersions, err = parseVersionList(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	if line, ok := c.MetaInfo["params"]; ok {
+		c.Params, err = parseParams(line)
+		if err != nil {
+			return err
 		}
-		// should split to (vote count, b64 bytes)
-		_, rand := split[0], split[1]
-		return base64.StdEncoding.DecodeString(string(rand))
 	}
 
 	// Only the newer consensus documents have these values.
 	if line, ok := c.MetaInfo["shared-rand-previous-value"]; ok {
-		val, err := parseRand(line)
+		val, err := parseSharedRandValue(line)
 		if err != nil {
 			return err
 		}
 		c.SharedRandPrevious = val
 	}
 	if line, ok := c.MetaInfo["shared-rand-current-value"]; ok {
-		val, err := parseRand(line)
+		val, err := parseSharedRandValue(line)
 		if err != nil {
 			return err
 		}
 		c.SharedRandCurrent = val
 	}
 
-	return nil
+	return extractVoteMetaInfo(c)
+}
+
+// extractAuthoritySection reads the authority section that follows the meta
+// information of the open network status document and writes its "dir-source"
+// entries and, for votes, the voting authority's shared randomness state to
+// the provided consensus.  The "fingerprint" line of bridge network statuses
+// is only extracted if the given annotation, if any, supports it.  It stops at
+// the first router status or at the footer, leaving them in the reader.
+func extractAuthoritySection(br *bufio.Reader, c *Consensus, annotation *Annotation) error {
+
+	var source *DirSource
+
+	for {
+		next, _ := br.Peek(len("directory-signature "))
+		if i := bytes.IndexByte(next, '\n'); i >= 0 {
+			next = next[:i]
+		}
+		if len(next) == 0 || hasKeyword(next, "r") ||
+			hasKeyword(next, "directory-footer") || hasKeyword(next, "directory-signature") {
+			return nil
+		}
+
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		switch words[0] {
+		case "fingerprint":
+			if annotation != nil && !annotation.Supports(CapabilityAuthorityFingerprint) {
+				break
+			}
+			if len(words) != 2 || !hexFingerprintRegexp.MatchString(words[1]) {
+				return fmt.Errorf("malformed \"fingerprint\" line: %q", strings.TrimSpace(line))
+			}
+			c.AuthorityFingerprint = Fingerprint(words[1])
+
+		case "dir-source":
+			if len(words) != 7 {
+				return fmt.Errorf("malformed \"dir-source\" line: %q", strings.TrimSpace(line))
+			}
+			address := net.ParseIP(words[4])
+			if address == nil {
+				return fmt.Errorf("malformed address in \"dir-source\" line: %q", words[4])
+			}
+			c.DirSources = append(c.DirSources, DirSource{
+				Nickname: words[1],
+				Identity: SanitiseFingerprint(Fingerprint(words[2])),
+				Hostname: words[3],
+				Address:  address,
+				DirPort:  StringToPort(words[5]),
+				ORPort:   StringToPort(words[6]),
+			})
+			source = &c.DirSources[len(c.DirSources)-1]
+		case "contact":
+			if source != nil {
+				source.Contact = strings.Join(words[1:], " ")
+			}
+		case "vote-digest":
+			if source != nil && len(words) == 2 {
+				source.VoteDigest = strings.ToUpper(words[1])
+			}
+
+		// Votes carry their shared randomness state in the authority
+		// section rather than in the header.
+		case "shared-rand-participate":
+			c.SharedRandParticipate = true
+		case "shared-rand-commit":
+			commit, err := parseSharedRandCommit(words[1:])
+			if err != nil {
+				return err
+			}
+			c.SharedRandCommits = append(c.SharedRandCommits, *commit)
+		case "shared-rand-previous-value", "shared-rand-current-value":
+			value, err := parseSharedRandValue([]byte(strings.Join(words[1:], " ")))
+			if err != nil {
+				return err
+			}
+			if words[0] == "shared-rand-previous-value" {
+				c.SharedRandPrevious = value
+			} else {
+				c.SharedRandCurrent = value
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// extractFooter parses the footer of a network status document, i.e., the
+// "directory-footer" line and everything that follows it, and writes its
+// information to the provided consensus.
+func extractFooter(footer string, c *Consensus) error {
+
+	return readPEMObjects(footer, func(words []string, object string) error {
+
+		switch words[0] {
+		case "directory-signature":
+			sig, err := parseDirectorySignature(words[1:])
+			if err != nil {
+				return err
+			}
+			sig.Signature = object
+			c.Signatures = append(c.Signatures, *sig)
+
+		case "bandwidth-weights":
+			weights, err := parseBandwidthWeights(words[1:])
+			if err != nil {
+				return err
+			}
+			c.BandwidthWeights = weights
+		}
+
+		return nil
+	})
 }
 
 // MatchesRouterStatus returns true if fields of the given router status are
 // present in the object filter, e.g., the router's nickname is part of the
-// object filter.
+// object filter, and if the router status meets the filter's requirements.
 func (filter *ObjectFilter) MatchesRouterStatus(status *RouterStatus) bool {
 
+	if !filter.HasFlags(status.Flags) ||
+		!filter.HasVersion(status.TorVersion) ||
+		!filter.exitsTo(status.AcceptsPort) {
+		return false
+	}
+
+	if !filter.hasIdentities() {
+		return true
+	}
+
 	if filter.HasIPAddr(status.Address.IPv4Address) || (filter.HasIPAddr(status.Address.IPv6Address)) {
 		return true
 	}
@@ -581,7 +1382,7 @@ func (filter *ObjectFilter) MatchesRouterStatus(status *RouterStatus) bool {
 		return true
 	}
 
-	if filter.HasNickname(status.Nickname) {
+	if filter.MatchesNickname(status.Nickname) {
 		return true
 	}
 
@@ -593,91 +1394,249 @@ func (filter *ObjectFilter) MatchesRouterStatus(status *RouterStatus) bool {
 // i.e., the type annotation should already have been read and checked to be the
 // correct type.  The function returns a network consensus if parsing was
 // successful.  If there were any errors, an error string is returned.  If the
-// lazy argument is set to true, parsing of the router statuses is delayed until
-// they are accessed. If strict it will only accept valid consensus files, not
-// strict is used to parse bridge networkstatus files or when unknown what kind is.
-func parseConsensusUnchecked(r io.Reader, lazy bool, strict bool) (*Consensus, error) {
+// lazy option is set, parsing of the router statuses is delayed until they are
+// accessed. If strict it will only accept valid consensus files, not strict is
+// used to parse bridge networkstatus files or when unknown what kind is.
+func parseConsensusUnchecked(r io.Reader, opts parseOptions) (*Consensus, error) {
 
 	var consensus = NewConsensus()
+	consensus.AnnotationMetadata = opts.metadata
 	var statusParser func(string) (Fingerprint, GetStatus, error)
 
-	if lazy {
+	digester := newSignedDigester()
+	cr := &countingReader{r: io.TeeReader(r, digester)}
+	br := bufio.NewReader(cr)
+	err := extractMetaInfo(br, consensus)
+	if opts.strict && err != nil {
+		return nil, locateError(err, opts.source, "", 0)
+	}
+	err = extractAuthoritySection(br, consensus, opts.annotation)
+	if opts.strict && err != nil {
+		return nil, locateError(err, opts.source, "", 0)
+	}
+
+	// The flavour determines the layout of router statuses.
+	switch {
+	case consensus.Flavour == FlavourMicrodesc && opts.lazy:
+		statusParser = LazyParseRawMicrodescStatus
+	case consensus.Flavour == FlavourMicrodesc:
+		statusParser = ParseRawMicrodescStatus
+	case opts.lazy:
 		statusParser = LazyParseRawStatus
-	} else {
+	default:
 		statusParser = ParseRawStatus
 	}
+	// With offsets, router statuses are retained only once they carry their
+	// position; see below.
+	if opts.lazy && opts.budget != nil && !opts.offsets {
+		statusParser = opts.budget.wrapStatusParser(statusParser)
+	}
 
-	br := bufio.NewReader(r)
-	err := extractMetaInfo(br, consensus)
-	if strict && err != nil {
-		return nil, err
+	// The position of the first router status relative to the beginning of
+	// the document.
+	base := opts.baseOffset + cr.n - int64(br.Buffered())
+	buffered, _ := br.Peek(br.Buffered())
+	line := opts.baseLine + cr.lines - bytes.Count(buffered, []byte{'\n'}) + 1
+
+	// Strict parsing requires the "directory-signature" footer while
+	// tolerant parsing accepts truncated documents.
+	extractor := extractStatusEntry
+	if opts.strict {
+		extractor = extractStatusEntryStrict
 	}
 
-	// We will read raw router statuses from this channel.
+	// The footer follows the last router status.  Part of it may already
+	// be in the scanner's buffer when the extractor returns the final
+	// token, so we hold on to that part.
+	var footer []byte
+	split := func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := extractor(data, atEOF)
+		if err == bufio.ErrFinalToken {
+			footer = append([]byte{}, data[advance:]...)
+		}
+		return advance, token, err
+	}
+
+	// We will read raw router statuses from this channel.  Cancelling the
+	// context stops the dissecting goroutine if we return early.
+	ctx, cancel := context.WithCancel(opts.context())
+	defer cancel()
 	queue := make(chan QueueUnit)
-	go DissectFile(br, extractStatusEntry, queue)
+	go DissectFileContext(ctx, br, split, queue)
+
+	// Validating and parsing router statuses is independent of other
+	// statuses, so we can spread it over several workers.
+	process := func(blurb string) (result statusResult) {
+		if opts.validate {
+			result.invalid, result.err = validateStatusEntry(blurb, consensus.Flavour)
+			if result.err != nil {
+				return
+			}
+		}
+		if opts.prefilter != nil && !opts.prefilter(blurb) {
+			result.skip = true
+			return
+		}
+		if opts.pool != nil && !opts.offsets {
+			result.fingerprint, result.getStatus, result.err = opts.pool.intern(blurb, statusParser)
+		} else {
+			result.fingerprint, result.getStatus, result.err = statusParser(blurb)
+		}
+		return
+	}
 
 	// Parse incoming router statuses until the channel is closed by the remote
 	// end.
-	for unit := range queue {
-		if unit.Err != nil && strict {
-			return nil, unit.Err
+	for unit := range processUnits(ctx, queue, opts.workers, process) {
+		if unit.Err != nil {
+			if opts.strict {
+				return nil, unit.Err
+			}
+			continue
 		}
+		opts.stats.splitDone(unit.QueueUnit)
 
-		fingerprint, getStatus, err := statusParser(unit.Blurb)
-		if err != nil {
-			return nil, err
+		// Entries are contiguous, so the next one starts where this one
+		// ends.
+		first := line
+		line += strings.Count(unit.Blurb, "\n")
+
+		result := unit.result
+		if result.err != nil {
+			return nil, locateError(result.err, opts.source, result.invalid, first)
+		}
+		if result.skip {
+			continue
 		}
 
-		consensus.RouterStatuses[SanitiseFingerprint(fingerprint)] = getStatus
+		getStatus := result.getStatus
+		if opts.offsets {
+			getStatus = withStatusSpan(getStatus, base+unit.Offset, len(unit.Blurb), opts.lazy)
+			if opts.lazy && opts.budget != nil {
+				getStatus = opts.budget.wrapStatus(getStatus, int64(len(unit.Blurb)))
+			}
+		}
+
+		if opts.statusSink != nil {
+			if err := opts.statusSink(getStatus()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		start := opts.stats.parsed(unit.elapsed)
+		consensus.RouterStatuses[SanitiseFingerprint(result.fingerprint)] = getStatus
+		opts.stats.insertDone(start)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// The scanner stopped reading after the final token, so the remainder
+	// of the footer is still in the reader.
+	rest, err := io.ReadAll(br)
+	if err != nil && opts.strict {
+		return nil, err
+	}
+	err = extractFooter(string(footer)+string(rest), consensus)
+	if err != nil && opts.strict {
+		return nil, locateError(err, opts.source, "", 0)
 	}
+	consensus.signedDigests = digester.digests()
+
+	consensus.detectPublicationTimes()
 
 	return consensus, nil
 }
 
+// statusResult is the result of validating and parsing a raw router status.
+type statusResult struct {
+	fingerprint Fingerprint
+	getStatus   GetStatus
+
+	// Set if the status was skipped by a prefilter.
+	skip bool
+
+	// The fingerprint of a status that failed validation, if known.
+	invalid Fingerprint
+
+	err error
+}
+
+// withStatusSpan records the given position within its source document in
+// the router status of the given function.  Eagerly parsed router statuses
+// are updated once, right away.  Lazy functions parse a new router status on
+// every call, so the returned function records the position in each of them.
+func withStatusSpan(getStatus GetStatus, offset int64, length int, lazy bool) GetStatus {
+
+	if !lazy {
+		status := getStatus()
+		status.SourceOffset = offset
+		status.SourceLength = length
+		return getStatus
+	}
+
+	return func() *RouterStatus {
+		status := getStatus()
+		status.SourceOffset = offset
+		status.SourceLength = length
+		return status
+	}
+}
+
 // parseConsensus is a wrapper around parseConsensusUnchecked that first reads
 // and checks the type annotation to make sure it belongs to
 // consensusAnnotations.
-func parseConsensus(r io.Reader, lazy bool) (*Consensus, error) {
+func parseConsensus(r io.Reader, opts parseOptions) (*Consensus, error) {
 
-	strict := false
-	annotation, r, err := readAnnotation(r)
+	opts.strict = opts.validate
+	header, r, err := readAnnotationHeader(r)
 	if err != nil {
 		return nil, err
 	}
+	annotation := header.annotation
 	if _, ok := consensusAnnotations[*annotation]; ok {
-		strict = true
+		opts.strict = !opts.tolerant
+	} else if _, ok := voteAnnotations[*annotation]; ok {
+		opts.strict = !opts.tolerant
 	} else if _, ok := bridgeNetworkStatusAnnotations[*annotation]; !ok {
-		return nil, fmt.Errorf("unexpected file annotation: %s", annotation)
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedAnnotation, annotation)
 	}
+	opts.annotation = annotation
+	opts.metadata = header.annotationMetadata()
+	opts.baseOffset += header.length
+	opts.baseLine += header.lines
 
-	return parseConsensusUnchecked(r, lazy, strict)
+	return parseConsensusUnchecked(r, opts)
 }
 
 // parseConsensusFile is a wrapper around parseConsensus that opens the named
 // file for parsing.
-func parseConsensusFile(fileName string, lazy bool) (*Consensus, error) {
+func parseConsensusFile(fileName string, opts parseOptions) (*Consensus, error) {
 
 	fd, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
 	defer fd.Close()
+	opts.source = fileName
 
-	return parseConsensus(fd, lazy)
+	return parseConsensus(fd, opts)
 }
 
 // parseConsensusFileUnchecked is a wrapper around parseConsensusUnchecked that opens the named
 // file for parsing.
-func parseConsensusFileUnchecked(fileName string, lazy bool) (*Consensus, error) {
+func parseConsensusFileUnchecked(fileName string, opts parseOptions) (*Consensus, error) {
 
 	fd, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
 	defer fd.Close()
+	opts.source = fileName
 
-	return parseConsensusUnchecked(fd, lazy, false)
+	return parseConsensusUnchecked(fd, opts)
 }
 
 // ParseRawConsensus parses a raw consensus (in string format) and
@@ -685,7 +1644,7 @@ func parseConsensusFileUnchecked(fileName string, lazy bool) (*Consensus, error)
 func ParseRawConsensus(rawConsensus string, lazy bool) (*Consensus, error) {
 	r := strings.NewReader(rawConsensus)
 
-	return parseConsensus(r, lazy)
+	return parseConsensus(r, parseOptions{lazy: lazy})
 }
 
 // LazilyParseConsensusFile parses the given file and returns a network
@@ -695,7 +1654,7 @@ func ParseRawConsensus(rawConsensus string, lazy bool) (*Consensus, error) {
 // recommended as long as you won't access more than ~50% of all statuses.
 func LazilyParseConsensusFile(fileName string) (*Consensus, error) {
 
-	return parseConsensusFile(fileName, true)
+	return parseConsensusFile(fileName, parseOptions{lazy: true})
 }
 
 // ParseConsensusFile parses the given file and returns a network consensus if
@@ -705,7 +1664,7 @@ func LazilyParseConsensusFile(fileName string) (*Consensus, error) {
 // long as you will access most of all statuses.
 func ParseConsensusFile(fileName string) (*Consensus, error) {
 
-	return parseConsensusFile(fileName, false)
+	return parseConsensusFile(fileName, parseOptions{})
 }
 
 // ParseRawUnsafeConsensus parses a raw consensus (in string format) and
@@ -713,7 +1672,7 @@ func ParseConsensusFile(fileName string) (*Consensus, error) {
 func ParseRawUnsafeConsensus(rawConsensus string, lazy bool) (*Consensus, error) {
 	r := strings.NewReader(rawConsensus)
 
-	return parseConsensusUnchecked(r, lazy, false)
+	return parseConsensusUnchecked(r, parseOptions{lazy: lazy})
 }
 
 // LazilyParseUnsafeConsensusFile parses the given file without checking the
@@ -725,7 +1684,7 @@ func ParseRawUnsafeConsensus(rawConsensus string, lazy bool) (*Consensus, error)
 // statuses.
 func LazilyParseUnsafeConsensusFile(fileName string) (*Consensus, error) {
 
-	return parseConsensusFileUnchecked(fileName, true)
+	return parseConsensusFileUnchecked(fileName, parseOptions{lazy: true})
 }
 
 // ParseUnsafeConsensusFile parses the given file without checking the annotations
@@ -735,5 +1694,29 @@ func LazilyParseUnsafeConsensusFile(fileName string) (*Consensus, error) {
 // recommended as long as you will access most of all statuses.
 func ParseUnsafeConsensusFile(fileName string) (*Consensus, error) {
 
-	return parseConsensusFileUnchecked(fileName, false)
+	return parseConsensusFileUnchecked(fileName, parseOptions{})
+}
+
+// ParseConsensusFileWithOffsets works like ParseConsensusFile but additionally
+// records the byte offset and length of every router status within the given
+// file in the status' SourceOffset and SourceLength fields.
+func ParseConsensusFileWithOffsets(fileName string) (*Consensus, error) {
+
+	return parseConsensusFile(fileName, parseOptions{offsets: true})
+}
+
+// ParseConsensusContext works like ParseConsensus but stops parsing with the
+// context's error once the given context is done.
+func ParseConsensusContext(ctx context.Context, r io.Reader, options ...Option) (*Consensus, error) {
+
+	return ParseConsensus(r, append(options[:len(options):len(options)], WithContext(ctx))...)
+}
+
+// StrictlyParseConsensusFile works like ParseConsensusFile but rejects
+// truncated documents and router statuses whose "r" or "w" lines are
+// malformed, instead of ignoring the malformed fields.  Errors name the file,
+// the line, the router status' fingerprint, and the malformed field.
+func StrictlyParseConsensusFile(fileName string) (*Consensus, error) {
+
+	return parseConsensusFile(fileName, parseOptions{validate: true})
 }
@@ -4,8 +4,11 @@ package zoossh
 
 import (
 	"bufio"
+	"context"
 	"encoding/base64"
+	"errors"
 	"io/ioutil"
+	"net"
 	"os"
 	"reflect"
 	"strings"
@@ -114,6 +117,107 @@ func TestConsensusOperations(t *testing.T) {
 	if exists || (status != nil) {
 		t.Error("Retrieved fingerprint which should not exist.")
 	}
+
+	if !consensus.Contains(validFingerprint1) {
+		t.Error("Consensus should contain fingerprint regardless of case.")
+	}
+	if consensus.Contains(invalidFingerprint) {
+		t.Error("Consensus should not contain fingerprint.")
+	}
+}
+
+func TestConsensusRoles(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exits := vote.Exits()
+	if exits.Length() != 1 || !exits.Contains("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645") {
+		t.Error("Unexpected exit relays.", exits.Length())
+	}
+	if !exits.ValidAfter.Equal(vote.ValidAfter) {
+		t.Error("Sub-consensus lacks meta information.")
+	}
+	if vote.Guards().Length() != 1 || vote.HSDirs().Length() != 1 {
+		t.Error("Unexpected number of guard or HSDir relays.")
+	}
+	if vote.Authorities().Length() != 0 {
+		t.Error("Unexpected authority relays.")
+	}
+	if vote.Length() != 2 {
+		t.Error("Extracting roles modified the original consensus.")
+	}
+}
+
+func TestFixedPublicationTime(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vote.HasRealPublicationTimes {
+		t.Error("Failed to detect real publication times.")
+	}
+
+	raw := strings.Replace(testVote, "2021-03-04 12:27:05", "2038-01-01 00:00:00", 1)
+	raw = strings.Replace(raw, "2021-03-04 06:57:54", "2038-01-01 00:00:00", 1)
+	vote, err = ParseRawConsensus(raw, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.HasRealPublicationTimes {
+		t.Fatal("Failed to detect fixed publication times.")
+	}
+
+	// The result must not depend on which router status is inspected.
+	mixed := strings.Replace(testVote, "2021-03-04 06:57:54", "2038-01-01 00:00:00", 1)
+	for i := 0; i < 10; i++ {
+		vote, err := ParseRawConsensus(mixed, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !vote.HasRealPublicationTimes {
+			t.Fatal("Publication time detection is not deterministic.")
+		}
+	}
+
+	published := time.Date(2021, time.March, 4, 12, 0, 0, 0, time.UTC)
+	desc := NewRouterDescriptor()
+	desc.Published = published
+	descs := NewRouterDescriptors()
+	descs.Set("000A10D43011EA4928A35F610405F92B4433B4DC", desc)
+	vote.AttachDescriptors(descs)
+
+	status, _ := vote.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if !status.Publication.Equal(published) {
+		t.Error("Failed to fall back to descriptor publication time.", status.Publication)
+	}
+	status, _ = vote.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+	if !status.Publication.Equal(FixedPublicationTime) {
+		t.Error("Unexpected publication time for status without descriptor.", status.Publication)
+	}
+
+	// Consensuses that share router statuses must not see each other's
+	// descriptors.
+	pool := NewStatusPool()
+	pooled1, err := pool.ParseConsensus(strings.NewReader(raw), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pooled2, err := pool.ParseConsensus(strings.NewReader(raw), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pooled1.AttachDescriptors(descs)
+	if status, _ := pooled1.Get("000A10D43011EA4928A35F610405F92B4433B4DC"); !status.Publication.Equal(published) {
+		t.Error("Failed to attach descriptor to pooled router status.")
+	}
+	status, _ = pooled2.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if !status.Publication.Equal(FixedPublicationTime) {
+		t.Error("Attaching descriptors affected another consensus.", status.Publication)
+	}
 }
 
 func TestStatusParsing(t *testing.T) {
@@ -177,6 +281,43 @@ p reject 1-65535`)
 	if intersect.Length() != 1 {
 		t.Error("Bad consensus intersection.")
 	}
+
+	// Keep only relays with the Guard flag, i.e., Karlstad0 and Karlstad1.
+	if removed := consensus1.RemoveIf(func(s *RouterStatus) bool { return !s.Flags.Guard }); removed != 1 {
+		t.Errorf("Expected to remove one status but removed %d.", removed)
+	}
+	if !consensus1.Remove(Fingerprint(strings.ToLower(string(fingerprint1)))) || consensus1.Remove(fingerprint1) {
+		t.Error("Unexpected result of removing a router status.")
+	}
+	if consensus1.Length() != 1 || !consensus1.Contains(fingerprint0) {
+		t.Error("Unexpected router statuses after removal.")
+	}
+
+	filter := NewObjectFilter()
+	filter.AddNickname("Karlstad2")
+	filtered := consensus2.Filter(filter)
+	if filtered.Length() != 1 || consensus2.Filter(NewObjectFilter()).Length() != 1 {
+		t.Error("Bad consensus filtering.")
+	}
+	filter = NewObjectFilter()
+	filter.AddNickname("Karlstad0")
+	if consensus2.Filter(filter).Length() != 0 || consensus2.Length() != 1 {
+		t.Error("Bad consensus filtering.")
+	}
+
+	// Filtering by fingerprint alone does not parse router statuses.
+	parsed := 0
+	lazy := NewConsensus()
+	for _, fpr := range []Fingerprint{fingerprint0, fingerprint1} {
+		status := &RouterStatus{Fingerprint: fpr}
+		lazy.RouterStatuses[fpr] = func() *RouterStatus { parsed++; return status }
+	}
+	filter = NewObjectFilter()
+	filter.AddFingerprint(fingerprint1)
+	filter.AddFingerprint(Fingerprint(strings.Repeat("F", 40)))
+	if filtered := lazy.Filter(filter); filtered.Length() != 1 || !filtered.Contains(fingerprint1) || parsed != 0 {
+		t.Errorf("Bad filtering by fingerprint; parsed %d router statuses.", parsed)
+	}
 }
 
 func TestExtractStatusEntry(t *testing.T) {
@@ -462,3 +603,510 @@ func TestParseRawConsensus(t *testing.T) {
 		t.Error("Expected getting the consensus data from the file or string made from said file to be the same.")
 	}
 }
+
+func TestParseConsensusFileWithOffsets(t *testing.T) {
+
+	// Only run this test if the consensus file is there.
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+
+	raw, err := ioutil.ReadFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consensus, err := ParseConsensusFileWithOffsets(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for status := range consensus.Iterate(nil) {
+		s := status.(*RouterStatus)
+		if s.SourceLength == 0 {
+			t.Fatal("Router status lacks source position.")
+		}
+		blurb := string(raw[s.SourceOffset : s.SourceOffset+int64(s.SourceLength)])
+		if !strings.HasPrefix(blurb, "r "+s.Nickname+" ") {
+			t.Fatalf("Source position of %s points to unexpected bytes: %q", s.Fingerprint, blurb)
+		}
+	}
+
+	// Offsets are opt-in.
+	consensus, err = ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for status := range consensus.Iterate(nil) {
+		if status.(*RouterStatus).SourceLength != 0 {
+			t.Fatal("Router status has source position although it was not requested.")
+		}
+	}
+}
+
+func TestRouterStatusColumns(t *testing.T) {
+
+	// Without an IPv6 address, the "ipv6_address" column is empty.
+	status := &RouterStatus{}
+	columns := strings.Split(status.String(), ",")
+	if len(columns) != len(RouterStatusColumns) {
+		t.Errorf("String() returned %d columns but expected %d.", len(columns), len(RouterStatusColumns))
+	} else if columns[3] != "" {
+		t.Errorf("Expected empty IPv6 column but got %q.", columns[3])
+	}
+	if status.Header() != strings.Join(RouterStatusColumns, ",") {
+		t.Error("Unexpected header.", status.Header())
+	}
+
+	status.Address.IPv6Address = net.ParseIP("2002:470:6e:80d::2")
+	status.TorVersion = "0.2.4.23,foo"
+	if n := len(strings.Split(status.String(), ",")); n != len(RouterStatusColumns) {
+		t.Errorf("String() returned %d columns but expected %d.", n, len(RouterStatusColumns))
+	}
+
+	if status.Header() != strings.Join(RouterStatusColumns, ",") {
+		t.Error("Unexpected header.", status.Header())
+	}
+}
+
+func TestModernRouterFlags(t *testing.T) {
+
+	flags := parseRouterFlags([]string{"MiddleOnly", "Running", "StaleDesc", "NoEdConsensus", "Sybil"})
+	if !flags.MiddleOnly || !flags.StaleDesc || !flags.NoEdConsensus || !flags.Sybil {
+		t.Fatalf("Unexpected flags %+v.", flags)
+	}
+	if flags.String() != "Running|MiddleOnly|StaleDesc|NoEdConsensus|Sybil" {
+		t.Errorf("Unexpected flag string %q.", flags.String())
+	}
+	if bitsToFlags(flagsToBits(*flags)) != *flags {
+		t.Error("Flags did not survive snapshot encoding.")
+	}
+
+	p, err := ParseQuery("flag:MiddleOnly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p(&RouterStatus{Flags: *flags}) || p(&RouterStatus{}) {
+		t.Error("Unexpected query result for MiddleOnly flag.")
+	}
+}
+
+func TestMissingDirectorySignature(t *testing.T) {
+
+	truncated := testVote[:strings.Index(testVote, "directory-signature")]
+
+	if _, err := ParseRawConsensus(truncated, false); err != ErrNoDirectorySignature {
+		t.Errorf("Expected ErrNoDirectorySignature but got %v.", err)
+	}
+
+	// Tolerant parsing recovers the last router status.
+	withoutAnnotation := truncated[strings.Index(truncated, "\n")+1:]
+	consensus, err := ParseRawUnsafeConsensus(withoutAnnotation, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.Length() != 2 {
+		t.Errorf("Expected 2 router statuses but got %d.", consensus.Length())
+	}
+	if _, found := consensus.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"); !found {
+		t.Error("Expected last router status to be recovered.")
+	}
+}
+
+func TestParseMicrodescConsensus(t *testing.T) {
+
+	raw := `@type network-status-microdesc-consensus-3 1.0
+network-status-version 3 microdesc
+vote-status consensus
+valid-after 2021-03-05 01:00:00
+fresh-until 2021-03-05 02:00:00
+valid-until 2021-03-05 04:00:00
+dir-source moria1 D586D18309DED4CD6D57C18FDB97EFA96D330566 128.31.0.34 128.31.0.34 9131 9101
+r seele AAoQ1DAR6kkoo19hBAX5K0QztNw 2021-03-04 12:27:05 73.15.150.172 9001 0
+m 0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I
+s Fast Running Stable Valid
+v Tor 0.4.5.6
+w Bandwidth=18
+directory-footer
+directory-signature 0232AF901C31A04EE9848595AF9BB7620D4C5B2E 9F2AD7B6CB02C8D17C1B8E77A8B5A3AA2CB6A3F2
+-----BEGIN SIGNATURE-----
+-----END SIGNATURE-----
+`
+
+	for _, lazy := range []bool{false, true} {
+		consensus, err := ParseRawConsensus(raw, lazy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if consensus.Flavour != FlavourMicrodesc {
+			t.Errorf("Expected flavour %q but got %q.", FlavourMicrodesc, consensus.Flavour)
+		}
+		status, found := consensus.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+		if !found {
+			t.Fatal("Failed to find router status in microdesc consensus.")
+		}
+		if status.MicrodescDigest != "0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I" {
+			t.Errorf("Unexpected microdescriptor digest %q.", status.MicrodescDigest)
+		}
+		if status.Digest != "" || status.Address.IPv4ORPort != 9001 || status.TorVersion != "0.4.5.6" {
+			t.Error("Unexpected microdesc router status.", status)
+		}
+	}
+}
+
+func TestExtractStatusEntryKeywords(t *testing.T) {
+
+	// Unknown lines whose keywords start with "r" or that mention
+	// "directory-signature" must not split entries.
+	raw := strings.Replace(testVote, "s Fast Running Stable Valid\n",
+		"s Fast Running Stable Valid\nrx 1 2 3\nr-future foo\nx-note see directory-signature below\n", 1)
+
+	consensus, err := ParseRawConsensus(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.Length() != 2 {
+		t.Fatalf("Expected 2 router statuses but got %d.", consensus.Length())
+	}
+	status, _ := consensus.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if status.TorVersion != "0.4.5.6" || status.Bandwidth != 18 {
+		t.Error("Unknown lines broke router status.", status)
+	}
+
+	// The last entry ends at the footer.
+	footer := "directory-footer\nbandwidth-weights Wbd=0\n"
+	withFooter := strings.Replace(testVote, "directory-signature", footer+"directory-signature", 1)
+	end := strings.Index(withFooter, "directory-footer")
+	start := strings.LastIndex(withFooter[:end], "\nr ") + 1
+
+	advance, token, err := extractStatusEntryStrict([]byte(withFooter[start:]), true)
+	if err != bufio.ErrFinalToken || advance != end-start || string(token) != withFooter[start:end] {
+		t.Errorf("Unexpected last entry %q (advance %d, error %v).", token, advance, err)
+	}
+
+	// A footer without signature is only accepted by tolerant parsing.
+	truncated := withFooter[start : end+len(footer)]
+	if _, _, err := extractStatusEntryStrict([]byte(truncated), true); err != ErrNoDirectorySignature {
+		t.Errorf("Expected ErrNoDirectorySignature but got %v.", err)
+	}
+	if _, token, _ := extractStatusEntry([]byte(truncated), true); string(token) != withFooter[start:end] {
+		t.Errorf("Unexpected last entry %q.", token)
+	}
+
+	// Incomplete input requests more data.
+	if advance, token, err := extractStatusEntry([]byte(withFooter[start:end]), false); advance != 0 || token != nil || err != nil {
+		t.Error("Expected request for more data.")
+	}
+}
+
+func TestExtractDirSources(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vote.DirSources) != 1 {
+		t.Fatalf("Expected one dir-source entry but got %d.", len(vote.DirSources))
+	}
+	source := vote.DirSources[0]
+	if source.Nickname != "moria1" || source.Identity != "D586D18309DED4CD6D57C18FDB97EFA96D330566" {
+		t.Error("Unexpected authority.", source)
+	}
+	if source.Address.String() != "128.31.0.34" || source.DirPort != 9131 || source.ORPort != 9101 {
+		t.Error("Unexpected authority address.", source)
+	}
+	if source.Contact != "1024D/EB5A896A28988BF5 arma mit edu" || source.VoteDigest != "" {
+		t.Error("Unexpected authority contact or vote digest.", source)
+	}
+	if vote.Length() != 2 {
+		t.Errorf("Expected 2 router statuses but got %d.", vote.Length())
+	}
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consensus.DirSources) != 9 {
+		t.Fatalf("Expected 9 dir-source entries but got %d.", len(consensus.DirSources))
+	}
+	source = consensus.DirSources[0]
+	if source.Nickname != "tor26" || source.Hostname != "86.59.21.38" ||
+		source.Contact != "Peter Palfrader" || source.VoteDigest != "6746D336091F0D6F9A1D4871832AF3E394D3228D" {
+		t.Error("Unexpected authority.", source)
+	}
+
+	// Malformed entries are rejected.
+	raw := strings.Replace(testVote, "128.31.0.34 9131", "128.31.0.34", 1)
+	if _, err := ParseRawConsensus(raw, false); err == nil {
+		t.Error("Malformed \"dir-source\" line was accepted.")
+	}
+}
+
+func TestExtractFooterSignatures(t *testing.T) {
+
+	for _, lazy := range []bool{false, true} {
+		vote, err := ParseRawConsensus(testVote, lazy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vote.Signatures) != 1 {
+			t.Fatalf("Expected one signature but got %d.", len(vote.Signatures))
+		}
+		sig := vote.Signatures[0]
+		if sig.Algorithm != "sha256" || sig.Identity != "D586D18309DED4CD6D57C18FDB97EFA96D330566" ||
+			sig.SigningKeyDigest != "C0A0C5F5AE9C2E49A4F2A3DBBA4A0F6AF8E5B6CD" {
+			t.Error("Unexpected signature.", sig)
+		}
+		if !strings.HasPrefix(sig.Signature, "-----BEGIN SIGNATURE-----\nMg1/8gSr5wf1") ||
+			!strings.HasSuffix(sig.Signature, "-----END SIGNATURE-----") {
+			t.Errorf("Unexpected signature object %q.", sig.Signature)
+		}
+	}
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consensus.Signatures) != 9 {
+		t.Fatalf("Expected 9 signatures but got %d.", len(consensus.Signatures))
+	}
+	sig := consensus.Signatures[0]
+	if sig.Algorithm != "sha1" || sig.Identity != "14C131DFC5C6F93646BE72FA1401C02A8DF2E8B4" {
+		t.Error("Unexpected signature.", sig)
+	}
+	for _, sig := range consensus.Signatures {
+		if sig.Signature == "" {
+			t.Errorf("Signature of %s lacks signature object.", sig.Identity)
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{"CircuitPriorityHalflifeMsec": 30000, "DoSCircuitCreationEnabled": 1}
+	if !reflect.DeepEqual(vote.Params, expected) {
+		t.Errorf("Expected params %v but got %v.", expected, vote.Params)
+	}
+
+	params, err := parseParams([]byte("cbtmin=-5 bwweightscale=10000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params["cbtmin"] != -5 || params["bwweightscale"] != 10000 {
+		t.Error("Unexpected params.", params)
+	}
+
+	for _, line := range []string{"foo", "foo=bar", "foo=4294967296"} {
+		if _, err := parseParams([]byte(line)); err == nil {
+			t.Errorf("Malformed params %q were accepted.", line)
+		}
+	}
+}
+
+func TestParseConsensusMethodAndPackages(t *testing.T) {
+
+	raw := strings.Replace(testVote, "vote-status vote\n", "vote-status consensus\nconsensus-method 31\n", 1)
+	raw = strings.Replace(raw, "known-flags", "package tor 0.4.5.6 https://dist.torproject.org/tor-0.4.5.6.tar.gz sha256=abcd sha1=1234\n"+
+		"package tor-browser 10.0.12 https://www.torproject.org/download/\nknown-flags", 1)
+
+	consensus, err := ParseRawConsensus(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.ConsensusMethod != 31 {
+		t.Errorf("Expected consensus method 31 but got %d.", consensus.ConsensusMethod)
+	}
+	if len(consensus.Packages) != 2 {
+		t.Fatalf("Expected 2 packages but got %d.", len(consensus.Packages))
+	}
+	pkg := consensus.Packages[0]
+	if pkg.Name != "tor" || pkg.Version != "0.4.5.6" || pkg.URL != "https://dist.torproject.org/tor-0.4.5.6.tar.gz" {
+		t.Error("Unexpected package.", pkg)
+	}
+	if !reflect.DeepEqual(pkg.Digests, map[string]string{"sha256": "abcd", "sha1": "1234"}) {
+		t.Error("Unexpected package digests.", pkg.Digests)
+	}
+	if consensus.Packages[1].Name != "tor-browser" || len(consensus.Packages[1].Digests) != 0 {
+		t.Error("Unexpected package.", consensus.Packages[1])
+	}
+
+	if _, err := parsePackage([]string{"tor", "0.4.5.6"}); err == nil {
+		t.Error("Malformed package line was accepted.")
+	}
+	if _, err := parsePackage([]string{"tor", "0.4.5.6", "https://example.com", "sha256"}); err == nil {
+		t.Error("Malformed package digest was accepted.")
+	}
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+	consensus, err = ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.ConsensusMethod != 18 {
+		t.Errorf("Expected consensus method 18 but got %d.", consensus.ConsensusMethod)
+	}
+}
+
+func TestParseWeightLine(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ := vote.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if status.Bandwidth != 18 || status.Measured != 20 || status.Unmeasured {
+		t.Error("Unexpected bandwidth values.", status.Bandwidth, status.Measured, status.Unmeasured)
+	}
+
+	status = &RouterStatus{}
+	if err := parseWeightLine(strings.Fields("Bandwidth=20 Unmeasured=1 Future=x"), status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Bandwidth != 20 || status.Measured != 0 || !status.Unmeasured {
+		t.Error("Unexpected bandwidth values.", status.Bandwidth, status.Measured, status.Unmeasured)
+	}
+
+	for _, line := range []string{"Bandwidth=x", "Bandwidth=20 Measured=-1", "Bandwidth"} {
+		if err := parseWeightLine(strings.Fields(line), &RouterStatus{}); err == nil {
+			t.Errorf("Malformed \"w\" line %q was accepted.", line)
+		}
+	}
+}
+
+func TestParseMalformedWeightLine(t *testing.T) {
+
+	_, getStatus, err := ParseRawStatus("r seele AAoQ1DAR6kkoo19hBAX5K0QztNw bdrzhG0Kk/8DUsnSdmzj7DjFQjY 2021-03-04 12:27:05 73.15.150.172 9001 0\n" +
+		"s Running\nw Bandwidth=18 Measured=x")
+	if err != nil {
+		t.Fatal("Malformed \"w\" line was rejected outside of strict mode:", err)
+	}
+	if status := getStatus(); status.Bandwidth != 18 || status.Measured != 0 {
+		t.Error("Unexpected bandwidth values.", status.Bandwidth, status.Measured)
+	}
+
+	broken := strings.Replace(testVote, "Measured=20", "Measured=x", 1)
+	if _, err := ParseRawConsensus(broken, false); err != nil {
+		t.Error("Malformed \"w\" line was rejected outside of strict mode:", err)
+	}
+	if _, err := ParseConsensus(strings.NewReader(broken), WithStrict()); err == nil {
+		t.Error("Malformed \"w\" line was accepted in strict mode.")
+	}
+}
+
+func TestJoinMicrodescriptors(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mds := NewMicrodescriptors()
+	md := NewMicrodescriptor()
+	md.Digest = "xUvv2n4sTHjS2lKIf4B1s1DqZFm4wBpwPE8lDxLgnwY"
+	mds.Set(md.Digest, md)
+
+	// Only seele's microdescriptor under consensus method 31 is present.
+	joined := vote.JoinMicrodescriptors(mds, 31)
+	if len(joined) != 1 || joined["000A10D43011EA4928A35F610405F92B4433B4DC"] != md {
+		t.Error("Unexpected joined microdescriptors.", joined)
+	}
+	if joined := vote.JoinMicrodescriptors(mds, 30); len(joined) != 0 {
+		t.Error("Unexpected joined microdescriptors.", joined)
+	}
+
+	status := &RouterStatus{MicrodescDigest: md.Digest}
+	if status.MicrodescDigestFor(0) != md.Digest {
+		t.Error("Unexpected microdescriptor digest.", status.MicrodescDigestFor(0))
+	}
+}
+
+func TestStatusUnknownLines(t *testing.T) {
+
+	raw := strings.Replace(testVote, "id ed25519 none\n", "id ed25519 none\nfuture-keyword 42\n", 1)
+	vote, err := ParseRawConsensus(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ := vote.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if len(status.UnknownLines) != 1 || status.UnknownLines[0] != "future-keyword 42" {
+		t.Errorf("Unexpected unknown lines %q.", status.UnknownLines)
+	}
+	status, _ = vote.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+	if status.UnknownLines != nil {
+		t.Errorf("Unexpected unknown lines %q.", status.UnknownLines)
+	}
+}
+
+// Test the function ParseConsensusContext().
+func TestParseConsensusContext(t *testing.T) {
+
+	vote, err := ParseConsensusContext(context.Background(), strings.NewReader(testVote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.Length() != 2 {
+		t.Errorf("Expected two router statuses but got %d.", vote.Length())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseConsensusContext(ctx, strings.NewReader(testVote)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v.", err)
+	}
+
+	// The caller's options must not be overwritten, even if their slice
+	// has spare capacity.
+	backing := []Option{WithLazy(), nil}
+	if _, err := ParseConsensusContext(context.Background(), strings.NewReader(testVote), backing[:1]...); err != nil {
+		t.Fatal(err)
+	}
+	if backing[1] != nil {
+		t.Error("ParseConsensusContext wrote into the caller's options.")
+	}
+}
+
+func TestBridgeAuthorityFingerprint(t *testing.T) {
+
+	status := `published 2016-06-30 23:40:28
+flag-thresholds stable-uptime=3 fast-speed=1 guard-wfu=0.000% guard-tk=0
+fingerprint 4A0CCD2DDC7995083D73F5D667100C8A5831F16D
+r Unnamed AAj2Ae6fy4BmdIvbDk6z6m0ehHw 2hPlwOXP+ke5G46Wx/zx3SahB4Y 2016-06-30 15:29:56 10.46.201.116 443 0
+s Fast Running Stable Valid
+w Bandwidth=32
+p reject 1-65535
+`
+	parse := func(version string) *Consensus {
+		raw := "@type bridge-network-status " + version + "\n" + status
+		set, err := ParseUnknown(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return set.(*Consensus)
+	}
+
+	c := parse("1.2")
+	if c.AuthorityFingerprint != "4A0CCD2DDC7995083D73F5D667100C8A5831F16D" {
+		t.Errorf("Unexpected authority fingerprint %q.", c.AuthorityFingerprint)
+	}
+	if c.Length() != 1 {
+		t.Errorf("Expected 1 router status but got %d.", c.Length())
+	}
+
+	// Versions before 1.2 lack the capability.
+	if c = parse("1.1"); c.AuthorityFingerprint != "" {
+		t.Errorf("Unexpected authority fingerprint %q for version 1.1.", c.AuthorityFingerprint)
+	}
+}
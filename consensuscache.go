@@ -0,0 +1,656 @@
+// Provides a compact binary cache format for parsed consensuses.
+
+package zoossh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"time"
+)
+
+// A consensus cache file starts with consensusCacheMagic, followed by the
+// format version and the consensus.  Integers are varints and strings and
+// byte slices are prefixed with their length.  Router statuses follow the
+// consensus' header and footer fields.
+const (
+	consensusCacheMagic   = "ZOOSCACH"
+	consensusCacheVersion = 2
+)
+
+// cacheEncoder appends the fields of a consensus cache to a buffer.
+type cacheEncoder struct {
+	buf []byte
+}
+
+func (e *cacheEncoder) uint(u uint64) {
+
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], u)]...)
+}
+
+func (e *cacheEncoder) int(i int64) {
+
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], i)]...)
+}
+
+func (e *cacheEncoder) bool(b bool) {
+
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *cacheEncoder) bytes(b []byte) {
+
+	e.uint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *cacheEncoder) string(s string) {
+
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *cacheEncoder) strings(ss []string) {
+
+	e.uint(uint64(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+// time encodes the given time in seconds, which is the precision of all times
+// in network status documents.  The zero time is kept as such.
+func (e *cacheEncoder) time(t time.Time) {
+
+	e.bool(t.IsZero())
+	if !t.IsZero() {
+		e.int(t.Unix())
+	}
+}
+
+// ip encodes the given address as four or 16 bytes, or as empty slice if the
+// address is not set.
+func (e *cacheEncoder) ip(ip net.IP) {
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+	e.bytes(ip)
+}
+
+// fingerprint encodes the given fingerprint as 20 bytes.
+func (e *cacheEncoder) fingerprint(fpr Fingerprint) error {
+
+	raw, err := hex.DecodeString(string(fpr))
+	if err != nil || len(raw) != 20 {
+		return fmt.Errorf("invalid fingerprint: %q", fpr)
+	}
+	e.buf = append(e.buf, raw...)
+
+	return nil
+}
+
+// stringMap encodes the given map with its keys in lexical order.
+func (e *cacheEncoder) stringMap(m map[string]string) {
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	e.uint(uint64(len(keys)))
+	for _, key := range keys {
+		e.string(key)
+		e.string(m[key])
+	}
+}
+
+// cacheDecoder reads the fields of a consensus cache.  The first error
+// sticks and turns all further reads into no-ops, so callers only have to
+// check for errors once they are done.
+type cacheDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+var errTruncatedCache = errors.New("truncated consensus cache")
+
+func (d *cacheDecoder) uint() uint64 {
+
+	if d.err != nil {
+		return 0
+	}
+	u, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.err = errTruncatedCache
+		return 0
+	}
+	d.pos += n
+
+	return u
+}
+
+func (d *cacheDecoder) int() int64 {
+
+	if d.err != nil {
+		return 0
+	}
+	i, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.err = errTruncatedCache
+		return 0
+	}
+	d.pos += n
+
+	return i
+}
+
+// length reads a length prefix and checks that that many bytes remain.
+func (d *cacheDecoder) length() int {
+
+	n := d.uint()
+	if d.err == nil && n > uint64(len(d.data)-d.pos) {
+		d.err = errTruncatedCache
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *cacheDecoder) raw(n int) []byte {
+
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.pos {
+		d.err = errTruncatedCache
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return b
+}
+
+func (d *cacheDecoder) bool() bool {
+
+	b := d.raw(1)
+	return b != nil && b[0] != 0
+}
+
+// bytes returns a copy of the next byte slice, or nil if it is empty.
+func (d *cacheDecoder) bytes() []byte {
+
+	b := d.raw(d.length())
+	if len(b) == 0 {
+		return nil
+	}
+
+	return append([]byte{}, b...)
+}
+
+func (d *cacheDecoder) string() string {
+
+	return string(d.raw(d.length()))
+}
+
+func (d *cacheDecoder) strings() []string {
+
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = d.string()
+	}
+
+	return ss
+}
+
+func (d *cacheDecoder) time() time.Time {
+
+	if d.bool() {
+		return time.Time{}
+	}
+
+	return time.Unix(d.int(), 0).UTC()
+}
+
+func (d *cacheDecoder) ip() net.IP {
+
+	return net.IP(d.bytes())
+}
+
+func (d *cacheDecoder) fingerprint() Fingerprint {
+
+	return Fingerprint(hexUpper(d.raw(20)))
+}
+
+func (d *cacheDecoder) stringMap() map[string]string {
+
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := d.string()
+		m[key] = d.string()
+	}
+
+	return m
+}
+
+// hexUpper returns the upper-case hex encoding of the given bytes.
+func hexUpper(b []byte) string {
+
+	const digits = "0123456789ABCDEF"
+
+	s := make([]byte, len(b)*2)
+	for i, c := range b {
+		s[i*2] = digits[c>>4]
+		s[i*2+1] = digits[c&0x0f]
+	}
+
+	return string(s)
+}
+
+// status appends the given router status to the cache.
+func (e *cacheEncoder) status(s *RouterStatus) error {
+
+	if err := e.fingerprint(s.Fingerprint); err != nil {
+		return err
+	}
+	e.string(s.Nickname)
+	e.string(s.Digest)
+	e.time(s.Publication)
+	e.ip(s.Address.IPv4Address)
+	e.uint(uint64(s.Address.IPv4ORPort))
+	e.uint(uint64(s.Address.IPv4DirPort))
+	e.ip(s.Address.IPv6Address)
+	e.uint(uint64(s.Address.IPv6ORPort))
+	e.uint(uint64(flagsToBits(s.Flags)))
+	e.string(s.TorVersion)
+	e.uint(s.Bandwidth)
+	e.uint(s.Measured)
+	e.bool(s.Unmeasured)
+	e.bool(s.Accept)
+	e.string(s.PortList)
+	e.string(s.MicrodescDigest)
+
+	methods := make([]int, 0, len(s.MicrodescDigests))
+	for method := range s.MicrodescDigests {
+		methods = append(methods, method)
+	}
+	sort.Ints(methods)
+	e.uint(uint64(len(methods)))
+	for _, method := range methods {
+		e.int(int64(method))
+		e.string(s.MicrodescDigests[method])
+	}
+
+	e.strings(s.UnknownLines)
+	e.int(s.SourceOffset)
+	e.int(int64(s.SourceLength))
+
+	return nil
+}
+
+// status reads a router status that was written by cacheEncoder.status.
+func (d *cacheDecoder) status() *RouterStatus {
+
+	s := &RouterStatus{
+		Fingerprint: d.fingerprint(),
+		Nickname:    d.string(),
+		Digest:      d.string(),
+		Publication: d.time(),
+	}
+	s.Address.IPv4Address = d.ip()
+	s.Address.IPv4ORPort = uint16(d.uint())
+	s.Address.IPv4DirPort = uint16(d.uint())
+	s.Address.IPv6Address = d.ip()
+	s.Address.IPv6ORPort = uint16(d.uint())
+	s.Flags = bitsToFlags(uint32(d.uint()))
+	s.TorVersion = d.string()
+	s.Bandwidth = d.uint()
+	s.Measured = d.uint()
+	s.Unmeasured = d.bool()
+	s.Accept = d.bool()
+	s.PortList = d.string()
+	s.MicrodescDigest = d.string()
+
+	if n := d.length(); n > 0 {
+		s.MicrodescDigests = make(map[int]string, n)
+		for i := 0; i < n; i++ {
+			method := int(d.int())
+			s.MicrodescDigests[method] = d.string()
+		}
+	}
+
+	s.UnknownLines = d.strings()
+	s.SourceOffset = d.int()
+	s.SourceLength = int(d.int())
+
+	return s
+}
+
+// WriteCache writes the consensus to w in a compact binary format that
+// ReadCache reads much faster than the parser parses the consensus' text.
+// All fields of the consensus and its router statuses are kept.  An error is
+// returned if a router status has a fingerprint that is not 40 hex digits.
+func (c *Consensus) WriteCache(w io.Writer) error {
+
+	e := &cacheEncoder{buf: []byte(consensusCacheMagic)}
+	e.uint(consensusCacheVersion)
+
+	e.string(c.Flavour)
+	e.int(int64(c.ConsensusMethod))
+	e.time(c.ValidAfter)
+	e.time(c.FreshUntil)
+	e.time(c.ValidUntil)
+	e.bool(c.HasRealPublicationTimes)
+
+	metaInfo := make(map[string]string, len(c.MetaInfo))
+	for key, value := range c.MetaInfo {
+		metaInfo[key] = string(value)
+	}
+	e.stringMap(metaInfo)
+
+	e.uint(uint64(len(c.Packages)))
+	for _, pkg := range c.Packages {
+		e.string(pkg.Name)
+		e.string(pkg.Version)
+		e.string(pkg.URL)
+		e.stringMap(pkg.Digests)
+	}
+
+	e.strings(versionStrings(c.ClientVersions))
+	e.strings(versionStrings(c.ServerVersions))
+
+	params := make([]string, 0, len(c.Params))
+	for key := range c.Params {
+		params = append(params, key)
+	}
+	sort.Strings(params)
+	e.uint(uint64(len(params)))
+	for _, key := range params {
+		e.string(key)
+		e.int(int64(c.Params[key]))
+	}
+
+	e.bytes(c.SharedRandPrevious)
+	e.bytes(c.SharedRandCurrent)
+	e.bool(c.SharedRandParticipate)
+	e.uint(uint64(len(c.SharedRandCommits)))
+	for _, commit := range c.SharedRandCommits {
+		e.int(int64(commit.Version))
+		e.string(commit.Algorithm)
+		e.string(string(commit.Identity))
+		e.bytes(commit.Commit)
+		e.bytes(commit.Reveal)
+	}
+
+	e.uint(uint64(len(c.DirSources)))
+	for _, source := range c.DirSources {
+		e.string(source.Nickname)
+		e.string(string(source.Identity))
+		e.string(source.Hostname)
+		e.ip(source.Address)
+		e.uint(uint64(source.DirPort))
+		e.uint(uint64(source.ORPort))
+		e.string(source.Contact)
+		e.string(source.VoteDigest)
+	}
+	e.string(string(c.AuthorityFingerprint))
+
+	e.uint(uint64(len(c.Signatures)))
+	for _, sig := range c.Signatures {
+		e.string(sig.Algorithm)
+		e.string(string(sig.Identity))
+		e.string(sig.SigningKeyDigest)
+		e.string(sig.Signature)
+	}
+
+	e.bool(c.BandwidthWeights != nil)
+	if c.BandwidthWeights != nil {
+		weights := c.BandwidthWeights.weights()
+		keys := make([]string, 0, len(weights))
+		for key := range weights {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		e.uint(uint64(len(keys)))
+		for _, key := range keys {
+			e.string(key)
+			e.int(int64(*weights[key]))
+		}
+	}
+
+	e.bool(c.BandwidthFileHeaders != nil)
+	if h := c.BandwidthFileHeaders; h != nil {
+		e.time(h.Timestamp)
+		e.string(h.Version)
+		e.string(h.Software)
+		e.string(h.SoftwareVersion)
+		e.time(h.FileCreated)
+		e.time(h.GeneratorStarted)
+		e.time(h.EarliestBandwidth)
+		e.time(h.LatestBandwidth)
+		e.stringMap(h.KeyValues)
+	}
+	e.uint(uint64(len(c.BandwidthFileDigests)))
+	for _, digest := range c.BandwidthFileDigests {
+		e.string(digest.Algorithm)
+		e.string(digest.Digest)
+	}
+
+	signedDigests := make(map[string]string, len(c.signedDigests))
+	for algorithm, digest := range c.signedDigests {
+		signedDigests[algorithm] = string(digest)
+	}
+	e.stringMap(signedDigests)
+
+	e.uint(uint64(len(c.RouterStatuses)))
+	for _, getStatus := range c.RouterStatuses {
+		if err := e.status(getStatus()); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(e.buf)
+	return err
+}
+
+// SaveCache is a wrapper around WriteCache that writes the consensus to the
+// named file.  The file is replaced atomically, so concurrent readers never
+// see a partially written cache.
+func (c *Consensus) SaveCache(fileName string) error {
+
+	var buf bytes.Buffer
+	if err := c.WriteCache(&buf); err != nil {
+		return err
+	}
+
+	return writeFileAtomically(fileName, buf.Bytes())
+}
+
+// decodeCache decodes the given consensus cache.
+func decodeCache(data []byte) (*Consensus, error) {
+
+	if !bytes.HasPrefix(data, []byte(consensusCacheMagic)) {
+		return nil, errors.New("not a consensus cache")
+	}
+	d := &cacheDecoder{data: data, pos: len(consensusCacheMagic)}
+	if version := d.uint(); d.err == nil && version != consensusCacheVersion {
+		return nil, fmt.Errorf("unsupported consensus cache version %d", version)
+	}
+
+	c := NewConsensus()
+	c.Flavour = d.string()
+	c.ConsensusMethod = int(d.int())
+	c.ValidAfter = d.time()
+	c.FreshUntil = d.time()
+	c.ValidUntil = d.time()
+	c.HasRealPublicationTimes = d.bool()
+
+	if metaInfo := d.stringMap(); metaInfo != nil {
+		c.MetaInfo = make(map[string][]byte, len(metaInfo))
+		for key, value := range metaInfo {
+			c.MetaInfo[key] = []byte(value)
+		}
+	}
+
+	for i, n := 0, d.length(); i < n; i++ {
+		c.Packages = append(c.Packages, Package{
+			Name:    d.string(),
+			Version: d.string(),
+			URL:     d.string(),
+			Digests: d.stringMap(),
+		})
+	}
+
+	var err error
+	clientVersions, serverVersions := d.strings(), d.strings()
+	if c.ClientVersions, err = parseVersions(clientVersions); err != nil {
+		return nil, err
+	}
+	if c.ServerVersions, err = parseVersions(serverVersions); err != nil {
+		return nil, err
+	}
+
+	if n := d.length(); n > 0 {
+		c.Params = make(map[string]int, n)
+		for i := 0; i < n; i++ {
+			key := d.string()
+			c.Params[key] = int(d.int())
+		}
+	}
+
+	c.SharedRandPrevious = d.bytes()
+	c.SharedRandCurrent = d.bytes()
+	c.SharedRandParticipate = d.bool()
+	for i, n := 0, d.length(); i < n; i++ {
+		c.SharedRandCommits = append(c.SharedRandCommits, SharedRandCommit{
+			Version:   int(d.int()),
+			Algorithm: d.string(),
+			Identity:  Fingerprint(d.string()),
+			Commit:    d.bytes(),
+			Reveal:    d.bytes(),
+		})
+	}
+
+	for i, n := 0, d.length(); i < n; i++ {
+		c.DirSources = append(c.DirSources, DirSource{
+			Nickname:   d.string(),
+			Identity:   Fingerprint(d.string()),
+			Hostname:   d.string(),
+			Address:    d.ip(),
+			DirPort:    uint16(d.uint()),
+			ORPort:     uint16(d.uint()),
+			Contact:    d.string(),
+			VoteDigest: d.string(),
+		})
+	}
+	c.AuthorityFingerprint = Fingerprint(d.string())
+
+	for i, n := 0, d.length(); i < n; i++ {
+		c.Signatures = append(c.Signatures, DirectorySignature{
+			Algorithm:        d.string(),
+			Identity:         Fingerprint(d.string()),
+			SigningKeyDigest: d.string(),
+			Signature:        d.string(),
+		})
+	}
+
+	if d.bool() {
+		c.BandwidthWeights = &BandwidthWeights{}
+		weights := c.BandwidthWeights.weights()
+		for i, n := 0, d.length(); i < n; i++ {
+			key, value := d.string(), d.int()
+			if field, ok := weights[key]; ok {
+				*field = int(value)
+			}
+		}
+	}
+
+	if d.bool() {
+		c.BandwidthFileHeaders = &BandwidthFileHeader{
+			Timestamp:         d.time(),
+			Version:           d.string(),
+			Software:          d.string(),
+			SoftwareVersion:   d.string(),
+			FileCreated:       d.time(),
+			GeneratorStarted:  d.time(),
+			EarliestBandwidth: d.time(),
+			LatestBandwidth:   d.time(),
+			KeyValues:         d.stringMap(),
+		}
+	}
+	for i, n := 0, d.length(); i < n; i++ {
+		c.BandwidthFileDigests = append(c.BandwidthFileDigests, BandwidthFileDigest{
+			Algorithm: d.string(),
+			Digest:    d.string(),
+		})
+	}
+
+	if signedDigests := d.stringMap(); signedDigests != nil {
+		c.signedDigests = make(map[string][]byte, len(signedDigests))
+		for algorithm, digest := range signedDigests {
+			c.signedDigests[algorithm] = []byte(digest)
+		}
+	}
+
+	n := d.length()
+	c.RouterStatuses = make(map[Fingerprint]GetStatus, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		status := d.status()
+		c.RouterStatuses[status.Fingerprint] = func() *RouterStatus { return status }
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.pos != len(d.data) {
+		return nil, errors.New("trailing data after consensus cache")
+	}
+
+	return c, nil
+}
+
+// ReadCache reads a consensus that was written by WriteCache.
+func ReadCache(r io.Reader) (*Consensus, error) {
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCache(data)
+}
+
+// LoadCache is a wrapper around ReadCache that reads the consensus from the
+// named file, which was written by SaveCache.
+func LoadCache(fileName string) (*Consensus, error) {
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCache(data)
+}
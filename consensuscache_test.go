@@ -0,0 +1,103 @@
+// Tests functions from "consensuscache.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// Benchmark the time it takes to load a cached consensus, to be compared with
+// BenchmarkConsensusParsing.
+func BenchmarkLoadCache(b *testing.B) {
+
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		b.Skipf("Cannot parse test data: %s", err)
+	}
+	fileName := filepath.Join(b.TempDir(), "consensus.cache")
+	if err := consensus.SaveCache(fileName); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadCache(fileName); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Test the methods SaveCache() and LoadCache().
+func TestConsensusCache(t *testing.T) {
+
+	for _, fileName := range []string{consensusFile, sharedRandConsensusFile} {
+		consensus, err := ParseConsensusFile(fileName)
+		if err != nil {
+			t.Skipf("Cannot parse test data: %s", err)
+		}
+
+		cacheFile := filepath.Join(t.TempDir(), "consensus.cache")
+		if err := consensus.SaveCache(cacheFile); err != nil {
+			t.Fatal(err)
+		}
+		cached, err := LoadCache(cacheFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		original, _ := json.Marshal(consensus)
+		loaded, _ := json.Marshal(cached)
+		if !bytes.Equal(original, loaded) {
+			t.Errorf("Cached consensus differs from %s.", fileName)
+		}
+		if len(cached.MetaInfo) != len(consensus.MetaInfo) ||
+			string(cached.MetaInfo["known-flags"]) != string(consensus.MetaInfo["known-flags"]) {
+			t.Error("Cached consensus has unexpected meta information.")
+		}
+		if cached.HasRealPublicationTimes != consensus.HasRealPublicationTimes {
+			t.Error("Cached consensus has unexpected publication time detection.")
+		}
+		for algorithm, digest := range consensus.signedDigests {
+			if !bytes.Equal(cached.signedDigests[algorithm], digest) {
+				t.Errorf("Cached consensus lacks %s digest.", algorithm)
+			}
+		}
+	}
+}
+
+// Test that ReadCache() rejects malformed caches.
+func TestReadCacheMalformed(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := vote.WriteCache(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if _, err := ReadCache(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for i := len(consensusCacheMagic); i < len(data); i += 7 {
+		if _, err := ReadCache(bytes.NewReader(data[:i])); err == nil {
+			t.Fatalf("Cache truncated to %d bytes was accepted.", i)
+		}
+	}
+	if _, err := ReadCache(bytes.NewReader(append(data, 0))); err == nil {
+		t.Error("Cache with trailing data was accepted.")
+	}
+	if _, err := ReadCache(bytes.NewReader([]byte("foo"))); err == nil {
+		t.Error("Data without magic was accepted.")
+	}
+
+	vote.Set("foo", &RouterStatus{Fingerprint: "foo"})
+	if err := vote.WriteCache(&buf); err == nil {
+		t.Error("Invalid fingerprint was accepted.")
+	}
+}
@@ -0,0 +1,112 @@
+// Provides normalization of relay contact information.
+
+package zoossh
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// Common obfuscations of the "@" and "." in email addresses, e.g.,
+	// "foo [at] example [dot] com".
+	contactAtRegexp  = regexp.MustCompile(`(?i)\s*(\[at\]|\(at\)|\{at\}|<at>|\sat\s|\[\])\s*`)
+	contactDotRegexp = regexp.MustCompile(`(?i)\s*(\[dot\]|\(dot\)|\{dot\}|<dot>|\sdot\s)\s*`)
+
+	emailRegexp = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+)
+
+// ContactInfo is a normalized contact line of a router descriptor.  Fields
+// follow the ContactInfo Information Sharing Specification, which encodes
+// key-value pairs such as "email:foo[]example.com ciissversion:2".
+type ContactInfo struct {
+	// The contact line as it appears in the descriptor.
+	Raw string
+
+	// The operator's email address in lower case, if one could be found.
+	Email string
+
+	// The "url" field.
+	URL string
+
+	// The "ciissversion" field.  Contact lines that do not follow the
+	// specification lack it.
+	CIISSVersion string
+
+	// All key-value fields of the contact line.
+	Fields map[string]string
+}
+
+// extractEmail returns the first email address in the given text after undoing
+// common obfuscations, or the empty string.
+func extractEmail(text string) string {
+
+	text = contactAtRegexp.ReplaceAllString(text, "@")
+	text = contactDotRegexp.ReplaceAllString(text, ".")
+
+	return strings.ToLower(emailRegexp.FindString(text))
+}
+
+// ParseContactInfo normalizes the given contact line.
+func ParseContactInfo(contact string) *ContactInfo {
+
+	ci := &ContactInfo{Raw: contact, Fields: make(map[string]string)}
+
+	for _, word := range strings.Fields(contact) {
+		kv := strings.SplitN(word, ":", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			continue
+		}
+		key := strings.ToLower(kv[0])
+		// Skip URL schemes such as "https://" that are not part of a field.
+		if strings.HasPrefix(kv[1], "//") {
+			continue
+		}
+		ci.Fields[key] = kv[1]
+	}
+
+	ci.CIISSVersion = ci.Fields["ciissversion"]
+	ci.URL = ci.Fields["url"]
+	if email, ok := ci.Fields["email"]; ok {
+		ci.Email = extractEmail(strings.Replace(email, "[]", "@", 1))
+	}
+	if ci.Email == "" {
+		ci.Email = extractEmail(contact)
+	}
+
+	return ci
+}
+
+// OperatorID returns a key that identifies the operator: the email address,
+// or else the URL, or else the whitespace-normalized contact line in lower
+// case.  Relays without contact information have an empty key.
+func (ci *ContactInfo) OperatorID() string {
+
+	if ci.Email != "" {
+		return ci.Email
+	}
+	if ci.URL != "" {
+		return strings.ToLower(strings.TrimSuffix(ci.URL, "/"))
+	}
+
+	return strings.ToLower(strings.Join(strings.Fields(ci.Raw), " "))
+}
+
+// GroupByOperator groups the given router descriptors by the operator that
+// their normalized contact line identifies.  Descriptors without contact
+// information are grouped under the empty key.  The returned sets can be
+// passed to SumBandwidth to learn how much bandwidth an operator controls.
+func GroupByOperator(rds *RouterDescriptors) map[string]*RouterDescriptors {
+
+	groups := make(map[string]*RouterDescriptors)
+
+	for fpr, getDescriptor := range rds.RouterDescriptors {
+		id := ParseContactInfo(getDescriptor().Contact).OperatorID()
+		if groups[id] == nil {
+			groups[id] = NewRouterDescriptors()
+		}
+		groups[id].RouterDescriptors[fpr] = getDescriptor
+	}
+
+	return groups
+}
@@ -0,0 +1,59 @@
+// Tests functions from "contact.go".
+
+package zoossh
+
+import (
+	"testing"
+)
+
+func TestParseContactInfo(t *testing.T) {
+
+	for contact, email := range map[string]string{
+		"TOR Admin <abuse at router dot pm>":                            "abuse@router.pm",
+		"Foo Bar <Foo@Example.com>":                                     "foo@example.com",
+		"foo [at] example [dot] org":                                    "foo@example.org",
+		"email:tor[]example.net url:https://example.net ciissversion:2": "tor@example.net",
+		"no email here":                                                 "",
+	} {
+		if ci := ParseContactInfo(contact); ci.Email != email {
+			t.Errorf("Expected email %q for %q but got %q.", email, contact, ci.Email)
+		}
+	}
+
+	ci := ParseContactInfo("email:tor[]example.net url:https://example.net/ ciissversion:2")
+	if ci.CIISSVersion != "2" || ci.URL != "https://example.net/" {
+		t.Errorf("Unexpected fields %+v.", ci)
+	}
+
+	ci = ParseContactInfo("url:https://example.net/ ciissversion:2")
+	if ci.OperatorID() != "https://example.net" {
+		t.Errorf("Unexpected operator ID %q.", ci.OperatorID())
+	}
+	if id := ParseContactInfo("  Some   Operator ").OperatorID(); id != "some operator" {
+		t.Errorf("Unexpected operator ID %q.", id)
+	}
+}
+
+func TestGroupByOperator(t *testing.T) {
+
+	rds := NewRouterDescriptors()
+	for fpr, contact := range map[Fingerprint]string{
+		"0000000000000000000000000000000000000001": "foo AT example DOT com",
+		"0000000000000000000000000000000000000002": "<foo@example.com>",
+		"0000000000000000000000000000000000000003": "bar@example.com",
+	} {
+		desc := NewRouterDescriptor()
+		desc.Fingerprint = fpr
+		desc.Contact = contact
+		desc.BandwidthObs = 10
+		rds.Set(fpr, desc)
+	}
+
+	groups := GroupByOperator(rds)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 operators but got %d.", len(groups))
+	}
+	if bw := SumBandwidth(groups["foo@example.com"]); bw != 20 {
+		t.Errorf("Expected operator bandwidth 20 but got %d.", bw)
+	}
+}
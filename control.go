@@ -0,0 +1,229 @@
+// Provides an adapter that obtains data from a running tor's control port.
+
+package zoossh
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// ControlConn is a connection to the control port of a running tor process.
+// It obtains router statuses and router descriptors from tor's memory, so
+// neither the file system nor the directory protocol is involved.  See
+// control-spec.txt for details.
+type ControlConn struct {
+	conn *textproto.Conn
+}
+
+// controlReplyLine is a single line of a control port reply.  Data replies,
+// i.e., lines with the separator '+', carry the data that followed them.
+type controlReplyLine struct {
+	status int
+	sep    byte
+	text   string
+	data   string
+}
+
+// DialControl connects to the control port at the given address, e.g.,
+// "tcp", "127.0.0.1:9051" or "unix", "/var/run/tor/control".
+func DialControl(network, address string) (*ControlConn, error) {
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewControlConn(conn), nil
+}
+
+// NewControlConn returns a control connection that uses the given, already
+// established connection.
+func NewControlConn(conn net.Conn) *ControlConn {
+
+	return &ControlConn{conn: textproto.NewConn(conn)}
+}
+
+// Close closes the control connection.
+func (cc *ControlConn) Close() error {
+
+	return cc.conn.Close()
+}
+
+// readReply reads a reply, which may span several lines, from the control
+// port.  Replies with a status code other than 250 are turned into errors.
+func (cc *ControlConn) readReply() ([]controlReplyLine, error) {
+
+	var lines []controlReplyLine
+
+	for {
+		line, err := cc.conn.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 4 {
+			return nil, fmt.Errorf("malformed control reply line %q", line)
+		}
+
+		reply := controlReplyLine{sep: line[3], text: line[4:]}
+		if _, err := fmt.Sscanf(line[:3], "%d", &reply.status); err != nil {
+			return nil, fmt.Errorf("malformed control reply status in %q", line)
+		}
+		if reply.sep == '+' {
+			data, err := cc.conn.ReadDotBytes()
+			if err != nil {
+				return nil, err
+			}
+			reply.data = string(data)
+		}
+		lines = append(lines, reply)
+
+		if reply.sep == ' ' {
+			break
+		}
+	}
+
+	if last := lines[len(lines)-1]; last.status != 250 {
+		return nil, fmt.Errorf("control port error %d: %s", last.status, last.text)
+	}
+
+	return lines, nil
+}
+
+// command sends the given command and returns its reply.
+func (cc *ControlConn) command(format string, args ...interface{}) ([]controlReplyLine, error) {
+
+	if err := cc.conn.PrintfLine(format, args...); err != nil {
+		return nil, err
+	}
+
+	return cc.readReply()
+}
+
+// Authenticate authenticates to the control port using the given password.
+// An empty password authenticates to control ports that require no
+// authentication.
+func (cc *ControlConn) Authenticate(password string) error {
+
+	if password == "" {
+		_, err := cc.command("AUTHENTICATE")
+		return err
+	}
+
+	_, err := cc.command("AUTHENTICATE %s", quoteControlString(password))
+	return err
+}
+
+// quoteControlString returns the given string as a quoted string of the
+// control protocol, which only escapes backslashes and double quotes.  Go's
+// %q verb would also escape non-printable and non-ASCII characters in a way
+// that tor does not understand.
+func quoteControlString(s string) string {
+
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+
+	return `"` + s + `"`
+}
+
+// AuthenticateCookie authenticates to the control port using the content of
+// the given cookie file, typically "control_auth_cookie" in tor's data
+// directory.
+func (cc *ControlConn) AuthenticateCookie(cookieFile string) error {
+
+	cookie, err := ioutil.ReadFile(cookieFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = cc.command("AUTHENTICATE %s", hex.EncodeToString(cookie))
+	return err
+}
+
+// GetInfo returns the value of the given GETINFO key, e.g., "version" or
+// "md/all".
+func (cc *ControlConn) GetInfo(key string) (string, error) {
+
+	lines, err := cc.command("GETINFO %s", key)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range lines {
+		if !strings.HasPrefix(line.text, key+"=") {
+			continue
+		}
+		if line.sep == '+' {
+			return line.data, nil
+		}
+		return strings.TrimPrefix(line.text, key+"="), nil
+	}
+
+	return "", fmt.Errorf("no value for GETINFO key %q", key)
+}
+
+// RouterStatuses returns the router statuses that tor currently knows of, as
+// reported by "GETINFO ns/all".  As tor only provides router statuses, the
+// meta information of the returned consensus is empty.
+func (cc *ControlConn) RouterStatuses() (*Consensus, error) {
+
+	raw, err := cc.GetInfo("ns/all")
+	if err != nil {
+		return nil, err
+	}
+
+	consensus := NewConsensus()
+	consensus.MetaInfo = make(map[string][]byte)
+	if strings.TrimSpace(raw) == "" {
+		return consensus, nil
+	}
+
+	queue := make(chan QueueUnit)
+	go DissectFile(strings.NewReader(raw), extractStatusEntry, queue)
+
+	for unit := range queue {
+		if unit.Err != nil {
+			return nil, unit.Err
+		}
+		fingerprint, getStatus, err := ParseRawStatus(unit.Blurb)
+		if err != nil {
+			return nil, err
+		}
+		consensus.RouterStatuses[SanitiseFingerprint(fingerprint)] = getStatus
+	}
+
+	return consensus, nil
+}
+
+// RouterDescriptors returns the router descriptors that tor currently knows
+// of, as reported by "GETINFO desc/all-recent".  Note that tor only keeps
+// router descriptors if it is configured to fetch them, e.g., by using
+// "FetchUselessDescriptors 1" or "UseMicrodescriptors 0".
+func (cc *ControlConn) RouterDescriptors() (*RouterDescriptors, error) {
+
+	raw, err := cc.GetInfo("desc/all-recent")
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(raw) == "" {
+		return NewRouterDescriptors(), nil
+	}
+
+	return parseDescriptorUnchecked(strings.NewReader(raw), parseOptions{})
+}
+
+// Microdescriptors returns the microdescriptors that tor currently knows of,
+// as reported by "GETINFO md/all".
+func (cc *ControlConn) Microdescriptors() (*Microdescriptors, error) {
+
+	raw, err := cc.GetInfo("md/all")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMicrodescriptorUnchecked(strings.NewReader(raw), parseOptions{})
+}
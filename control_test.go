@@ -0,0 +1,133 @@
+// Tests functions from "control.go".
+
+package zoossh
+
+import (
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeControlPort answers GETINFO requests on the given connection using the
+// given values.
+func fakeControlPort(conn net.Conn, values map[string]string) {
+
+	tc := textproto.NewConn(conn)
+	defer tc.Close()
+
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		words := strings.Fields(line)
+		switch {
+		case words[0] == "AUTHENTICATE" && len(words) == 1:
+			tc.PrintfLine("250 OK")
+		case words[0] == "AUTHENTICATE":
+			tc.PrintfLine("515 Authentication failed")
+		case words[0] == "GETINFO":
+			value, ok := values[words[1]]
+			if !ok {
+				tc.PrintfLine("552 Unrecognized key %q", words[1])
+				continue
+			}
+			if !strings.Contains(value, "\n") {
+				tc.PrintfLine("250-%s=%s", words[1], value)
+			} else {
+				tc.PrintfLine("250+%s=", words[1])
+				w := tc.DotWriter()
+				w.Write([]byte(value))
+				w.Close()
+			}
+			tc.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestQuoteControlString(t *testing.T) {
+
+	tests := map[string]string{
+		"secret":         `"secret"`,
+		`se"cr\et`:       `"se\"cr\\et"`,
+		"p\xe4ssw\x01rd": "\"p\xe4ssw\x01rd\"",
+	}
+	for in, expected := range tests {
+		if quoted := quoteControlString(in); quoted != expected {
+			t.Errorf("Expected %q to be quoted as %q but got %q.", in, expected, quoted)
+		}
+	}
+}
+
+func TestControlConn(t *testing.T) {
+
+	statuses := testDirectoryConsensus()
+	statuses = statuses[strings.Index(statuses, "\nr ")+1:]
+
+	values := map[string]string{
+		"version": "0.4.5.6",
+		"ns/all":  statuses,
+		"md/all":  testMicrodescriptor1 + testMicrodescriptor2,
+	}
+	if raw, err := ioutil.ReadFile(serverDescriptorFile); err == nil {
+		values["desc/all-recent"] = strings.SplitN(string(raw), "\n", 2)[1]
+	}
+
+	client, server := net.Pipe()
+	go fakeControlPort(server, values)
+	cc := NewControlConn(client)
+	defer cc.Close()
+
+	if err := cc.Authenticate("secret"); err == nil {
+		t.Error("Expected authentication with wrong password to fail.")
+	}
+	if err := cc.Authenticate(""); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := cc.GetInfo("version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "0.4.5.6" {
+		t.Errorf("Expected version \"0.4.5.6\" but got %q.", version)
+	}
+
+	if _, err = cc.GetInfo("foo"); err == nil {
+		t.Error("Expected error for unknown GETINFO key.")
+	}
+
+	consensus, err := cc.RouterStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, found := consensus.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if !found {
+		t.Fatal("Expected router status to be present.")
+	}
+	if status.Nickname != "seele" {
+		t.Errorf("Expected nickname \"seele\" but got %q.", status.Nickname)
+	}
+
+	mds, err := cc.Microdescriptors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mds.Length() != 2 {
+		t.Errorf("Expected 2 microdescriptors but got %d.", mds.Length())
+	}
+
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+	descriptors, err := cc.RouterDescriptors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if descriptors.Length() == 0 {
+		t.Error("Expected router descriptors.")
+	}
+}
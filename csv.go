@@ -0,0 +1,220 @@
+// Provides CSV export of object sets.
+
+package zoossh
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCSVColumns holds the columns that WriteCSV writes if the caller does
+// not choose any.
+var DefaultCSVColumns = []string{
+	"fingerprint",
+	"nickname",
+	"ipv4_address",
+	"flags",
+	"bandwidth",
+}
+
+// csvColumns maps the name of every column that WriteCSV supports to a
+// function that returns the column's value for the given object.  Columns
+// that do not apply to an object's type are empty.
+var csvColumns = map[string]func(obj Object, locate Locator) string{
+	"fingerprint": func(obj Object, locate Locator) string {
+		return string(obj.GetFingerprint())
+	},
+	"nickname": func(obj Object, locate Locator) string {
+		return objectNickname(obj)
+	},
+	"ipv4_address": func(obj Object, locate Locator) string {
+		switch o := obj.(type) {
+		case *RouterStatus:
+			return ipString(o.Address.IPv4Address)
+		case *RouterDescriptor:
+			return ipString(o.Address)
+		}
+		return ""
+	},
+	"ipv6_address": func(obj Object, locate Locator) string {
+		if o, ok := obj.(*RouterStatus); ok {
+			return ipString(o.Address.IPv6Address)
+		}
+		return ""
+	},
+	"or_port": func(obj Object, locate Locator) string {
+		switch o := obj.(type) {
+		case *RouterStatus:
+			return strconv.Itoa(int(o.Address.IPv4ORPort))
+		case *RouterDescriptor:
+			return strconv.Itoa(int(o.ORPort))
+		}
+		return ""
+	},
+	"dir_port": func(obj Object, locate Locator) string {
+		switch o := obj.(type) {
+		case *RouterStatus:
+			return strconv.Itoa(int(o.Address.IPv4DirPort))
+		case *RouterDescriptor:
+			return strconv.Itoa(int(o.DirPort))
+		}
+		return ""
+	},
+	"flags": func(obj Object, locate Locator) string {
+		if o, ok := obj.(*RouterStatus); ok {
+			return strings.Join(sortedFlagNames(o.Flags), " ")
+		}
+		return ""
+	},
+	"bandwidth": func(obj Object, locate Locator) string {
+		return strconv.FormatUint(objectBandwidth(obj), 10)
+	},
+	"published": func(obj Object, locate Locator) string {
+		switch o := obj.(type) {
+		case *RouterStatus:
+			return csvTime(o.Publication)
+		case *RouterDescriptor:
+			return csvTime(o.Published)
+		}
+		return ""
+	},
+	"tor_version": func(obj Object, locate Locator) string {
+		return objectTorVersion(obj)
+	},
+	"digest": func(obj Object, locate Locator) string {
+		switch o := obj.(type) {
+		case *RouterStatus:
+			return o.Digest
+		case *RouterDescriptor:
+			return o.Digest()
+		}
+		return ""
+	},
+	"exit_policy": func(obj Object, locate Locator) string {
+		switch o := obj.(type) {
+		case *RouterStatus:
+			if o.PortList == "" {
+				return ""
+			}
+			if o.Accept {
+				return "accept " + o.PortList
+			}
+			return "reject " + o.PortList
+		case *RouterDescriptor:
+			return strings.Replace(strings.TrimSpace(o.RawExitPolicy), "\n", ", ", -1)
+		}
+		return ""
+	},
+	"operating_system": func(obj Object, locate Locator) string {
+		if o, ok := obj.(*RouterDescriptor); ok {
+			return o.OperatingSystem
+		}
+		return ""
+	},
+	"uptime": func(obj Object, locate Locator) string {
+		if o, ok := obj.(*RouterDescriptor); ok {
+			return strconv.FormatUint(o.Uptime, 10)
+		}
+		return ""
+	},
+	"contact": func(obj Object, locate Locator) string {
+		if o, ok := obj.(*RouterDescriptor); ok {
+			return o.Contact
+		}
+		return ""
+	},
+	"country": func(obj Object, locate Locator) string {
+		for _, addr := range objectAddresses(obj) {
+			if location := locate(addr); location != "" {
+				return location
+			}
+		}
+		return ""
+	},
+}
+
+// CSVColumnNames returns the names of all columns that WriteCSV supports, in
+// lexical order.
+func CSVColumnNames() []string {
+
+	var names []string
+	for name := range csvColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// csvTime formats the given time as RFC 3339 string or returns an empty string
+// for the zero time.
+func csvTime(t time.Time) string {
+
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// WriteCSV writes all objects of the given object set that pass the given
+// filter to w as CSV with a header row, sorted by fingerprint.  The columns
+// are named by the given column names, see CSVColumnNames, or are
+// DefaultCSVColumns if no names are given.  Flags are sorted and separated by
+// spaces.  Columns that do not apply to an object's type, e.g., "flags" for
+// router descriptors, are empty.
+func WriteCSV(w io.Writer, objs ObjectSet, filter *ObjectFilter, columns ...string) error {
+
+	return WriteCSVWithLocator(w, objs, filter, nil, columns...)
+}
+
+// WriteCSVWithLocator is like WriteCSV but additionally supports the
+// "country" column, which holds the location that the given locator maps an
+// object's first locatable IP address to.
+func WriteCSVWithLocator(w io.Writer, objs ObjectSet, filter *ObjectFilter, locate Locator, columns ...string) error {
+
+	if len(columns) == 0 {
+		columns = DefaultCSVColumns
+	}
+	values := make([]func(Object, Locator) string, len(columns))
+	for i, column := range columns {
+		value, ok := csvColumns[column]
+		if !ok {
+			return fmt.Errorf("unknown CSV column %q", column)
+		}
+		if column == "country" && locate == nil {
+			return fmt.Errorf("CSV column %q requires a locator", column)
+		}
+		values[i] = value
+	}
+
+	var objects []Object
+	for obj := range objs.Iterate(filter) {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].GetFingerprint() < objects[j].GetFingerprint()
+	})
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, obj := range objects {
+		for i, value := range values {
+			record[i] = value(obj, locate)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
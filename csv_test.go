@@ -0,0 +1,78 @@
+// Tests functions from "csv.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, vote, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := "fingerprint,nickname,ipv4_address,flags,bandwidth\n" +
+		"000A10D43011EA4928A35F610405F92B4433B4DC,seele,73.15.150.172,Fast Running Stable Valid,18\n" +
+		"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645,Karlstad0,193.11.166.194,Exit Fast Guard HSDir Running Stable V2Dir Valid,2670\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CSV output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteCSV(&buf, vote, nil, "nickname", "exit_policy", "published"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != vote.Length()+1 {
+		t.Fatalf("Expected %d records but got %d.", vote.Length()+1, len(records))
+	}
+	if records[1][0] != "seele" || records[1][1] != "reject 1-65535" || records[1][2] == "" {
+		t.Errorf("Unexpected record %q.", records[1])
+	}
+
+	if err := WriteCSV(&buf, vote, nil, "nickname", "foo"); err == nil {
+		t.Error("Unknown column did not raise an error.")
+	}
+	if err := WriteCSV(&buf, vote, nil, "country"); err == nil {
+		t.Error("Country column without locator did not raise an error.")
+	}
+
+	locate := func(ip net.IP) string {
+		if ip.Equal(net.ParseIP("73.15.150.172")) {
+			return "US"
+		}
+		return ""
+	}
+	buf.Reset()
+	if err := WriteCSVWithLocator(&buf, vote, nil, locate, "nickname", "country"); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := csv.NewReader(&buf).ReadAll(); records[1][1] != "US" || records[2][1] != "" {
+		t.Errorf("Unexpected countries in %q.", records)
+	}
+}
+
+func TestCSVColumnNames(t *testing.T) {
+
+	names := CSVColumnNames()
+	if len(names) != len(csvColumns) {
+		t.Errorf("Expected %d column names but got %d.", len(csvColumns), len(names))
+	}
+	for _, column := range DefaultCSVColumns {
+		if _, ok := csvColumns[column]; !ok {
+			t.Errorf("Default column %q is not supported.", column)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Parses the cache files in a tor data directory.
+
+package zoossh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The names of tor's cache files within its data directory.
+const (
+	cachedConsensusFile          = "cached-consensus"
+	cachedMicrodescConsensusFile = "cached-microdesc-consensus"
+	cachedDescriptorsFile        = "cached-descriptors"
+	cachedDescriptorsNewFile     = "cached-descriptors.new"
+	cachedMicrodescsFile         = "cached-microdescs"
+	cachedMicrodescsNewFile      = "cached-microdescs.new"
+)
+
+// DataDirectory holds what a tor process currently knows about the network,
+// as found in the cache files of its data directory.  Fields are nil if the
+// respective cache file does not exist.
+type DataDirectory struct {
+	Consensus          *Consensus
+	MicrodescConsensus *Consensus
+	Descriptors        *RouterDescriptors
+	Microdescriptors   *Microdescriptors
+}
+
+// extractCachedDescriptor is a bufio.SplitFunc that extracts individual router
+// descriptors along with the annotations that precede them in tor's cache
+// files.
+func extractCachedDescriptor(data []byte, atEOF bool) (advance int, token []byte, err error) {
+
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	// An entry starts with its first annotation or, if it has none, with
+	// its "router" line.
+	start := -1
+	if bytes.HasPrefix(data, []byte("@")) || bytes.HasPrefix(data, []byte("router ")) {
+		start = 0
+	} else {
+		for _, prefix := range []string{"\n@", "\nrouter "} {
+			if i := bytes.Index(data, []byte(prefix)); i >= 0 && (start < 0 || i+1 < start) {
+				start = i + 1
+			}
+		}
+	}
+	if start < 0 {
+		if atEOF {
+			return 0, nil, fmt.Errorf("cannot find beginning of descriptor: \"\\nrouter \"")
+		}
+		// Request more data.
+		return 0, nil, nil
+	}
+
+	marker := []byte("\n-----END SIGNATURE-----\n")
+	end := bytes.Index(data[start:], marker)
+	if end >= 0 {
+		return start + end + len(marker), data[start : start+end+len(marker)], nil
+	}
+	if atEOF {
+		return start, nil, fmt.Errorf("cannot find end of descriptor: %q", marker)
+	}
+	// Request more data.
+	return start, nil, nil
+}
+
+// ParseRawCachedDescriptor parses a raw router descriptor from one of tor's
+// cache files.  Unlike ParseRawDescriptor, it accepts the "@downloaded-at" and
+// "@source" annotations that precede the descriptor.
+func ParseRawCachedDescriptor(rawDescriptor string) (Fingerprint, GetDescriptor, error) {
+
+	var downloadedAt time.Time
+	var source string
+
+	for strings.HasPrefix(rawDescriptor, "@") {
+		var line string
+		if i := strings.Index(rawDescriptor, "\n"); i >= 0 {
+			line, rawDescriptor = rawDescriptor[:i], rawDescriptor[i+1:]
+		} else {
+			line, rawDescriptor = rawDescriptor, ""
+		}
+
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "@downloaded-at":
+			t, err := time.Parse(publishedTimeLayout, kv[1])
+			if err != nil {
+				return "", nil, fmt.Errorf("malformed annotation %q", line)
+			}
+			downloadedAt = t
+		case "@source":
+			source = strings.Trim(kv[1], "\"")
+		}
+	}
+
+	fingerprint, getDescriptor, err := ParseRawDescriptor(rawDescriptor)
+	if err != nil {
+		return "", nil, err
+	}
+	descriptor := getDescriptor()
+	descriptor.DownloadedAt = downloadedAt
+	descriptor.Source = source
+
+	return fingerprint, func() *RouterDescriptor { return descriptor }, nil
+}
+
+// ParseCachedDescriptorFile parses one of tor's router descriptor caches,
+// i.e., "cached-descriptors" or "cached-descriptors.new".  Unlike archived
+// descriptor files, these files have no type annotation.
+func ParseCachedDescriptorFile(fileName string) (*RouterDescriptors, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	descriptors := NewRouterDescriptors()
+
+	queue := make(chan QueueUnit)
+	go DissectFile(fd, extractCachedDescriptor, queue)
+
+	for unit := range queue {
+		if unit.Err != nil {
+			return nil, unit.Err
+		}
+		fingerprint, getDescriptor, err := ParseRawCachedDescriptor(unit.Blurb)
+		if err != nil {
+			return nil, err
+		}
+		descriptors.RouterDescriptors[SanitiseFingerprint(fingerprint)] = getDescriptor
+	}
+
+	return descriptors, nil
+}
+
+// ParseCachedConsensusFile parses one of tor's consensus caches, i.e.,
+// "cached-consensus" or "cached-microdesc-consensus".  Unlike archived
+// consensuses, these files have no type annotation.
+func ParseCachedConsensusFile(fileName string) (*Consensus, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseConsensusUnchecked(fd, parseOptions{strict: true})
+}
+
+// ParseCachedMicrodescriptorFile parses one of tor's microdescriptor caches,
+// i.e., "cached-microdescs" or "cached-microdescs.new".  Unlike archived
+// microdescriptor files, these files have no type annotation.
+func ParseCachedMicrodescriptorFile(fileName string) (*Microdescriptors, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseMicrodescriptorUnchecked(fd, parseOptions{})
+}
+
+// ParseDataDirectory parses the cache files in the given tor data directory.
+// Descriptors in "cached-descriptors.new" supersede those in
+// "cached-descriptors", and the same holds for microdescriptors.
+func ParseDataDirectory(dir string) (*DataDirectory, error) {
+
+	var err error
+	dd := &DataDirectory{}
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	if exists(cachedConsensusFile) {
+		dd.Consensus, err = ParseCachedConsensusFile(filepath.Join(dir, cachedConsensusFile))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", cachedConsensusFile, err)
+		}
+	}
+
+	if exists(cachedMicrodescConsensusFile) {
+		dd.MicrodescConsensus, err = ParseCachedConsensusFile(filepath.Join(dir, cachedMicrodescConsensusFile))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", cachedMicrodescConsensusFile, err)
+		}
+	}
+
+	for _, name := range []string{cachedDescriptorsFile, cachedDescriptorsNewFile} {
+		if !exists(name) {
+			continue
+		}
+		descriptors, err := ParseCachedDescriptorFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		if dd.Descriptors == nil {
+			dd.Descriptors = NewRouterDescriptors()
+		}
+		for fpr, getDescriptor := range descriptors.RouterDescriptors {
+			dd.Descriptors.RouterDescriptors[fpr] = getDescriptor
+		}
+	}
+
+	for _, name := range []string{cachedMicrodescsFile, cachedMicrodescsNewFile} {
+		if !exists(name) {
+			continue
+		}
+		mds, err := ParseCachedMicrodescriptorFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		if dd.Microdescriptors == nil {
+			dd.Microdescriptors = NewMicrodescriptors()
+		}
+		for digest, getMicrodescriptor := range mds.Microdescriptors {
+			dd.Microdescriptors.Microdescriptors[digest] = getMicrodescriptor
+		}
+	}
+
+	return dd, nil
+}
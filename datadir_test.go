@@ -0,0 +1,85 @@
+// Tests functions from "datadir.go".
+
+package zoossh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRawCachedDescriptor(t *testing.T) {
+
+	raw := "@downloaded-at 2021-03-05 01:02:03\n@source \"1.2.3.4\"\n" +
+		"router leenuts 46.14.245.206 9001 0 0\n" +
+		"fingerprint F8E9 F7D3 0ED7 F541 FD24 8945 FAA2 B593 AD5E 584D\n"
+
+	fpr, getDescriptor, err := ParseRawCachedDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fpr != "F8E9F7D30ED7F541FD248945FAA2B593AD5E584D" {
+		t.Errorf("Unexpected fingerprint %q.", fpr)
+	}
+	desc := getDescriptor()
+	if desc.Source != "1.2.3.4" {
+		t.Errorf("Expected source \"1.2.3.4\" but got %q.", desc.Source)
+	}
+	if desc.DownloadedAt.Format(publishedTimeLayout) != "2021-03-05 01:02:03" {
+		t.Errorf("Unexpected download time %s.", desc.DownloadedAt)
+	}
+
+	if _, _, err = ParseRawCachedDescriptor("@downloaded-at yesterday\n" + raw); err == nil {
+		t.Error("Expected error for malformed download time.")
+	}
+}
+
+func TestParseDataDirectory(t *testing.T) {
+
+	dir := t.TempDir()
+
+	dd, err := ParseDataDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dd.Consensus != nil || dd.Descriptors != nil {
+		t.Error("Expected nil fields for empty data directory.")
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, cachedConsensusFile), []byte(testDirectoryConsensus()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if raw, err := ioutil.ReadFile(serverDescriptorFile); err == nil {
+		annotations := "@downloaded-at 2021-03-05 01:02:03\n@source \"1.2.3.4\"\n"
+		descs := "\n" + strings.SplitN(string(raw), "\n", 2)[1]
+		descs = strings.Replace(descs, "\nrouter ", "\n"+annotations+"router ", -1)
+		err = ioutil.WriteFile(filepath.Join(dir, cachedDescriptorsNewFile), []byte(descs), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dd, err = ParseDataDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := dd.Consensus.Get("000A10D43011EA4928A35F610405F92B4433B4DC"); !found {
+		t.Error("Expected router status to be present in cached consensus.")
+	}
+
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+	if dd.Descriptors == nil || dd.Descriptors.Length() == 0 {
+		t.Fatal("Expected cached router descriptors.")
+	}
+	for obj := range dd.Descriptors.Iterate(nil) {
+		if desc := obj.(*RouterDescriptor); desc.Source != "1.2.3.4" {
+			t.Errorf("Expected source \"1.2.3.4\" but got %q.", desc.Source)
+		}
+	}
+}
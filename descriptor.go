@@ -4,6 +4,17 @@ package zoossh
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -30,6 +41,14 @@ type GetDescriptor func() *RouterDescriptor
 type ExitPattern struct {
 	AddressSpec string
 	PortSpec    string
+
+	// The network of the address spec.  Nil if the pattern covers all
+	// addresses, i.e., "*".
+	Network *net.IPNet
+
+	// The inclusive port range of the port spec.
+	PortLow  uint16
+	PortHigh uint16
 }
 
 // An (incomplete) router descriptor as defined in dirspec.txt, Section 2.1.1.
@@ -42,13 +61,17 @@ type RouterDescriptor struct {
 	SOCKSPort uint16
 	DirPort   uint16
 
+	// The additional addresses of "or-address" lines.
+	ORAddresses []Endpoint
+
 	// The single fields of a "bandwidth" line.  All bandwidth values are in
 	// bytes per second.
 	BandwidthAvg   uint64
 	BandwidthBurst uint64
 	BandwidthObs   uint64
 
-	// The single fields of a "platform" line.
+	// The single fields of a "platform" line.  TorVersion includes the name
+	// of the implementation, e.g., "Tor 0.4.5.6".
 	OperatingSystem string
 	TorVersion      string
 
@@ -81,12 +104,61 @@ type RouterDescriptor struct {
 	NTorOnionKey string
 	SigningKey   string
 
+	// The certificate of the "identity-ed25519" line, which certifies the
+	// relay's Ed25519 signing key and is signed by its master key.
+	IdentityEd25519 *Ed25519Certificate
+
+	// The single fields of a "master-key-ed25519" line, i.e., the relay's
+	// Ed25519 identity.
+	MasterKeyEd25519 ed25519.PublicKey
+
+	// The decoded signature of the "router-sig-ed25519" line.
+	RouterSigEd25519 []byte
+
+	// The decoded RSA signature of the "router-signature" object.
+	RouterSignature []byte
+
+	// The decoded RSA signature of the "onion-key-crosscert" object.
+	OnionKeyCrosscert []byte
+
+	// The certificate and sign bit of the "ntor-onion-key-crosscert" line.
+	NTorOnionKeyCrosscert     *Ed25519Certificate
+	NTorOnionKeyCrosscertSign int
+
 	RawAccept     string
 	RawReject     string
 	RawExitPolicy string
 
 	Accept []*ExitPattern
 	Reject []*ExitPattern
+
+	// The "accept", "reject", "accept6", and "reject6" lines in order of
+	// appearance.
+	ExitPolicy ExitPolicy
+
+	// The single fields of an "ipv6-policy" line.
+	Accept6   bool
+	PortList6 string
+
+	// The lines that the parser does not know of, e.g., because they were
+	// added to dir-spec.txt after the parser was written, along with their
+	// objects.
+	UnknownLines []string
+
+	// The SHA-1 and SHA-256 digests over the signed portion of the
+	// descriptor.  Nil if the descriptor lacks a "router-signature" line.
+	digestSHA1   []byte
+	digestSHA256 []byte
+
+	// The "@downloaded-at" and "@source" annotations that tor adds to
+	// descriptors in its cache files.
+	DownloadedAt time.Time
+	Source       string
+
+	// The position of the descriptor within its source document.  Only set
+	// if offsets were requested during parsing.
+	SourceOffset int64
+	SourceLength int
 }
 
 type RouterDescriptors struct {
@@ -94,10 +166,36 @@ type RouterDescriptors struct {
 	// A map from relay fingerprint to a function which returns the router
 	// descriptor.
 	RouterDescriptors map[Fingerprint]GetDescriptor
+
+	// The document's annotations other than the type annotation, e.g.,
+	// "@source", keyed by their keyword without the leading "@".  Nil if the
+	// document had none.
+	AnnotationMetadata map[string]string
+
+	// Frozen sets reject modifications and hand out copies of their
+	// descriptors.
+	frozen bool
+}
+
+// RouterDescriptorColumns names the comma-separated columns that
+// RouterDescriptor.String returns, in order.  New columns are only ever
+// appended, so consumers can rely on the position of existing columns.
+var RouterDescriptorColumns = []string{
+	"fingerprint",
+	"nickname",
+	"address",
+	"or_port",
+	"dir_port",
+	"published",
+	"uptime",
+	"operating_system",
+	"tor_version",
+	"contact",
 }
 
 // String implements the String as well as the Object interface.  It returns
-// the descriptor's string representation.
+// the descriptor's string representation whose columns are described by
+// RouterDescriptorColumns.
 func (rd *RouterDescriptor) String() string {
 
 	return fmt.Sprintf("%s,%s,%s,%d,%d,%s,%d,%s,%s,%s",
@@ -113,6 +211,13 @@ func (rd *RouterDescriptor) String() string {
 		strings.Replace(rd.Contact, ",", "", -1))
 }
 
+// Header returns the comma-separated names of the columns that String
+// returns.
+func (rd *RouterDescriptor) Header() string {
+
+	return strings.Join(RouterDescriptorColumns, ",")
+}
+
 // GetFingerprint implements the Object interface.  It returns the descriptor's
 // fingerprint.
 func (rd *RouterDescriptor) GetFingerprint() Fingerprint {
@@ -163,9 +268,19 @@ func (rds *RouterDescriptors) GetObject(fingerprint Fingerprint) (Object, bool)
 	return rds.Get(fingerprint)
 }
 
+// Contains implements the ObjectSet interface.  It returns true if the router
+// descriptor identified by the given fingerprint is part of the set.
+func (rds *RouterDescriptors) Contains(fingerprint Fingerprint) bool {
+
+	_, exists := rds.RouterDescriptors[SanitiseFingerprint(fingerprint)]
+	return exists
+}
+
 // Merge merges the given object set with itself.
 func (rds *RouterDescriptors) Merge(objs ObjectSet) {
 
+	rds.mustNotBeFrozen()
+
 	for rdesc := range rds.Iterate(nil) {
 		fpr := rdesc.GetFingerprint()
 		_, exists := rds.Get(fpr)
@@ -220,6 +335,7 @@ func (rds *RouterDescriptors) Get(fingerprint Fingerprint) (*RouterDescriptor, b
 // descriptor.
 func (rds *RouterDescriptors) Set(fingerprint Fingerprint, descriptor *RouterDescriptor) {
 
+	rds.mustNotBeFrozen()
 	rds.RouterDescriptors[SanitiseFingerprint(fingerprint)] = func() *RouterDescriptor {
 		return descriptor
 	}
@@ -253,7 +369,67 @@ func LazyParseRawDescriptor(rawDescriptor string) (Fingerprint, GetDescriptor, e
 		}
 	}
 
-	return "", nil, fmt.Errorf("could not extract descriptor fingerprint")
+	return "", nil, ErrNoFingerprint
+}
+
+// ignoredDescriptorKeywords holds the keywords of router descriptor lines that
+// the parser knows of but does not extract.  Lines of all other keywords that
+// the parser does not extract end up in the descriptor's UnknownLines.
+var ignoredDescriptorKeywords = map[string]bool{
+	"allow-single-hop-exits": true,
+	"caches-extra-info":      true,
+	"eventdns":               true,
+	"extra-info-digest":      true,
+	"overload-general":       true,
+	"proto":                  true,
+	"protocols":              true,
+	"read-history":           true,
+	"tunnelled-dir-server":   true,
+	"write-history":          true,
+}
+
+// parseExitRule parses the exit pattern of an "accept", "reject", "accept6",
+// or "reject6" line.
+func parseExitRule(keyword, value string) (*ExitPattern, error) {
+
+	var pattern *ExitPattern
+	var err error
+	if strings.HasSuffix(keyword, "6") {
+		pattern, err = parseExitPattern6(value)
+	} else {
+		pattern, err = ParseExitPattern(value)
+	}
+	if err != nil {
+		return nil, fieldError(keyword, "exit pattern", value, err)
+	}
+
+	return pattern, nil
+}
+
+// addExitRule adds the exit pattern of an "accept", "reject", "accept6", or
+// "reject6" line to the descriptor's exit policy.  A malformed pattern only
+// ends up in the raw exit policy; strict parsing rejects it in
+// validateDescriptor.
+func (rd *RouterDescriptor) addExitRule(keyword, value string) {
+
+	accept := strings.HasPrefix(keyword, "accept")
+	if accept {
+		rd.RawAccept += value + " "
+	} else {
+		rd.RawReject += value + " "
+	}
+	rd.RawExitPolicy += keyword + " " + value + "\n"
+
+	pattern, err := parseExitRule(keyword, value)
+	if err != nil {
+		return
+	}
+	if accept {
+		rd.Accept = append(rd.Accept, pattern)
+	} else {
+		rd.Reject = append(rd.Reject, pattern)
+	}
+	rd.ExitPolicy.Rules = append(rd.ExitPolicy.Rules, ExitRule{accept, pattern})
 }
 
 // ParseRawDescriptor parses a raw router descriptor (in string format) and
@@ -266,16 +442,41 @@ func ParseRawDescriptor(rawDescriptor string) (Fingerprint, GetDescriptor, error
 
 	lines := strings.Split(rawDescriptor, "\n")
 
+	// The keyword of the last line, the lines of the object that follows
+	// it, and whether the line is unknown.
+	var keyword string
+	var object []string
+	var unknown bool
+
 	// Go over raw descriptor line by line and extract the fields we are
 	// interested in.
 	for _, line := range lines {
 
+		if strings.HasPrefix(line, "-----BEGIN") {
+			object = []string{}
+		}
+		if object != nil {
+			if unknown {
+				descriptor.UnknownLines = append(descriptor.UnknownLines, line)
+			}
+			object = append(object, line)
+			if strings.HasPrefix(line, "-----END") {
+				// Malformed objects are only rejected by
+				// validateDescriptor.
+				descriptor.parseObject(keyword, strings.Join(object, "\n"))
+				object = nil
+			}
+			continue
+		}
+		unknown = false
+
 		words := strings.Split(line, " ")
 
 		// Ignore lines starting with "opt".
 		if words[0] == "opt" {
 			words = words[1:]
 		}
+		keyword = words[0]
 
 		switch words[0] {
 
@@ -286,11 +487,18 @@ func ParseRawDescriptor(rawDescriptor string) (Fingerprint, GetDescriptor, error
 			descriptor.SOCKSPort = StringToPort(words[4])
 			descriptor.DirPort = StringToPort(words[5])
 
+		case "or-address":
+			if len(words) > 1 {
+				if endpoint, err := parseEndpoint(words[1]); err == nil {
+					descriptor.ORAddresses = append(descriptor.ORAddresses, endpoint)
+				}
+			}
+
 		case "platform":
 			for i := 0; i < len(words); i++ {
 				if (strings.TrimSpace(words[i]) == "on") && (i < len(words)-1) {
 					descriptor.OperatingSystem = strings.Join(words[i+1:], " ")
-					descriptor.TorVersion = strings.Join(words[1:i-1], " ")
+					descriptor.TorVersion = strings.Join(words[1:i], " ")
 					break
 				}
 			}
@@ -325,22 +533,205 @@ func ParseRawDescriptor(rawDescriptor string) (Fingerprint, GetDescriptor, error
 		case "hidden-service-dir":
 			descriptor.HiddenServiceDir = true
 
-		case "reject":
-			descriptor.RawReject += words[1] + " "
-			descriptor.RawExitPolicy += words[0] + " " + words[1] + "\n"
+		case "accept", "reject", "accept6", "reject6":
+			descriptor.addExitRule(words[0], words[1])
+
+		case "ipv6-policy":
+			if err := parseIPv6Policy(words); err == nil {
+				descriptor.Accept6 = words[1] == "accept"
+				descriptor.PortList6 = words[2]
+			}
+
+		case "identity-ed25519", "onion-key-crosscert", "onion-key", "signing-key", "router-signature":
+			// The object that follows is handled by parseObject.
+
+		case "ntor-onion-key":
+			if len(words) > 1 {
+				descriptor.NTorOnionKey = words[1]
+			}
+
+		case "master-key-ed25519", "router-sig-ed25519":
+			// Like the fields below, malformed keys and signatures are
+			// left empty and only rejected by validateDescriptor.
+			decoded, err := parseEd25519Line(words)
+			if err != nil {
+				break
+			}
+			if words[0] == "router-sig-ed25519" {
+				descriptor.RouterSigEd25519 = decoded
+			} else {
+				descriptor.MasterKeyEd25519 = ed25519.PublicKey(decoded)
+			}
 
-		case "accept":
-			descriptor.RawAccept += words[1] + " "
-			descriptor.RawExitPolicy += words[0] + " " + words[1] + "\n"
+		case "ntor-onion-key-crosscert":
+			if sign, err := parseCrosscertSign(words); err == nil {
+				descriptor.NTorOnionKeyCrosscertSign = sign
+			}
 
 		case "bridge-distribution-request":
 			descriptor.BridgeDistributionRequest = words[1]
+
+		default:
+			if line != "" && !ignoredDescriptorKeywords[words[0]] {
+				descriptor.UnknownLines = append(descriptor.UnknownLines, line)
+				unknown = true
+			}
 		}
 	}
 
+	descriptor.computeDigests(rawDescriptor)
+
 	return descriptor.Fingerprint, func() *RouterDescriptor { return descriptor }, nil
 }
 
+// Digest returns the hex-encoded SHA-1 digest over the signed portion of the
+// descriptor, i.e., from the "router" line up to and including the
+// "router-signature" line.  Consensuses refer to descriptors using this
+// digest, so it can be compared to RouterStatus.Digest.  The digest is empty
+// if the descriptor lacks a "router-signature" line.
+func (rd *RouterDescriptor) Digest() string {
+
+	return hex.EncodeToString(rd.digestSHA1)
+}
+
+// DigestSHA256 returns the base64-encoded SHA-256 digest over the signed
+// portion of the descriptor, without trailing "=" characters.  The digest is
+// empty if the descriptor lacks a "router-signature" line.
+func (rd *RouterDescriptor) DigestSHA256() string {
+
+	return base64.RawStdEncoding.EncodeToString(rd.digestSHA256)
+}
+
+// VerifySignature checks the descriptor's "router-signature" against its
+// signing key and checks that the signing key matches the descriptor's
+// fingerprint.  It returns nil if the descriptor is authentic.  Ed25519
+// signatures are not checked.
+func (rd *RouterDescriptor) VerifySignature() error {
+
+	if rd.digestSHA1 == nil || rd.RouterSignature == nil {
+		return errors.New("descriptor is not signed")
+	}
+
+	block, _ := pem.Decode([]byte(rd.SigningKey))
+	if block == nil {
+		return errors.New("missing or malformed signing key")
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("malformed signing key: %s", err)
+	}
+
+	keyDigest := sha1.Sum(block.Bytes)
+	if fingerprint := Fingerprint(strings.ToUpper(hex.EncodeToString(keyDigest[:]))); fingerprint != rd.Fingerprint {
+		return fmt.Errorf("signing key %s does not match fingerprint %s", fingerprint, rd.Fingerprint)
+	}
+
+	// Relays sign the PKCS#1-padded digest without DigestInfo prefix.
+	if err := rsa.VerifyPKCS1v15(key, crypto.Hash(0), rd.digestSHA1, rd.RouterSignature); err != nil {
+		return errors.New("invalid descriptor signature")
+	}
+
+	return nil
+}
+
+// computeDigests computes the digests over the signed portion of the given
+// raw descriptor.
+func (rd *RouterDescriptor) computeDigests(rawDescriptor string) {
+
+	start := 0
+	if !strings.HasPrefix(rawDescriptor, "router ") {
+		start = strings.Index(rawDescriptor, "\nrouter ") + 1
+	}
+	end := strings.Index(rawDescriptor, "\nrouter-signature\n")
+	if end < start {
+		return
+	}
+	signed := []byte(rawDescriptor[start : end+len("\nrouter-signature\n")])
+
+	digest := sha1.Sum(signed)
+	rd.digestSHA1 = digest[:]
+	digest256 := sha256.Sum256(signed)
+	rd.digestSHA256 = digest256[:]
+}
+
+// parseEd25519Line parses the base64-encoded key or signature of a
+// "master-key-ed25519" or "router-sig-ed25519" line, including the keyword.
+func parseEd25519Line(words []string) ([]byte, error) {
+
+	if len(words) != 2 {
+		return nil, fmt.Errorf("malformed %q line", words[0])
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(words[1], "="))
+	if err != nil {
+		return nil, fieldError(words[0], "key", words[1], err)
+	}
+	if words[0] == "master-key-ed25519" && len(decoded) != ed25519.PublicKeySize {
+		return nil, fieldError(words[0], "key", words[1],
+			fmt.Errorf("expected %d bytes", ed25519.PublicKeySize))
+	}
+
+	return decoded, nil
+}
+
+// parseCrosscertSign parses the sign bit of an "ntor-onion-key-crosscert"
+// line, including the keyword.
+func parseCrosscertSign(words []string) (int, error) {
+
+	if len(words) != 2 || (words[1] != "0" && words[1] != "1") {
+		return 0, errors.New("malformed \"ntor-onion-key-crosscert\" line")
+	}
+
+	return strconv.Atoi(words[1])
+}
+
+// parseIPv6Policy checks the given words of an "ipv6-policy" line, including
+// the keyword.
+func parseIPv6Policy(words []string) error {
+
+	if len(words) != 3 || (words[1] != "accept" && words[1] != "reject") {
+		return fmt.Errorf("malformed \"ipv6-policy\" line: %q", strings.Join(words, " "))
+	}
+
+	return nil
+}
+
+// parseObject parses the given PEM-encoded object that follows a line of the
+// given keyword.  Objects of other keywords are ignored.
+func (rd *RouterDescriptor) parseObject(keyword, object string) error {
+
+	var err error
+
+	switch keyword {
+	case "identity-ed25519":
+		rd.IdentityEd25519, err = parseEd25519CertificatePEM(object)
+
+	case "ntor-onion-key-crosscert":
+		rd.NTorOnionKeyCrosscert, err = parseEd25519CertificatePEM(object)
+
+	case "onion-key":
+		rd.OnionKey = object
+
+	case "signing-key":
+		rd.SigningKey = object
+
+	case "onion-key-crosscert", "router-signature":
+		block, _ := pem.Decode([]byte(object))
+		if block == nil {
+			return fmt.Errorf("malformed %q object", keyword)
+		}
+		if keyword == "router-signature" {
+			rd.RouterSignature = block.Bytes
+		} else {
+			rd.OnionKeyCrosscert = block.Bytes
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("malformed %q object: %s", keyword, err)
+	}
+	return nil
+}
+
 // extractDescriptor is a bufio.SplitFunc that extracts individual router
 // descriptors.
 func extractDescriptor(data []byte, atEOF bool) (advance int, token []byte, err error) {
@@ -354,7 +745,7 @@ func extractDescriptor(data []byte, atEOF bool) (advance int, token []byte, err
 		start = bytes.Index(data, []byte("\nrouter "))
 		if start < 0 {
 			if atEOF {
-				return 0, nil, fmt.Errorf("cannot find beginning of descriptor: \"\\nrouter \"")
+				return 0, nil, fmt.Errorf("%w: \"\\nrouter \"", ErrNoEntry)
 			}
 			// Request more data.
 			return 0, nil, nil
@@ -376,9 +767,19 @@ func extractDescriptor(data []byte, atEOF bool) (advance int, token []byte, err
 
 // MatchesRouterDescriptor returns true if fields of the given router
 // descriptor are present in the object filter, e.g., the descriptor's nickname
-// is part of the object filter.
+// is part of the object filter, and if the descriptor meets the filter's
+// requirements.  Router descriptors have no flags, so they never match a
+// filter that requires flags.
 func (filter *ObjectFilter) MatchesRouterDescriptor(desc *RouterDescriptor) bool {
 
+	if filter.requiresFlags() || !filter.HasVersion(desc.TorVersion) || !filter.exitsTo(desc.AcceptsPort) {
+		return false
+	}
+
+	if !filter.hasIdentities() {
+		return true
+	}
+
 	if filter.HasIPAddr(desc.Address) {
 		return true
 	}
@@ -387,7 +788,7 @@ func (filter *ObjectFilter) MatchesRouterDescriptor(desc *RouterDescriptor) bool
 		return true
 	}
 
-	if filter.HasNickname(desc.Nickname) {
+	if filter.MatchesNickname(desc.Nickname) {
 		return true
 	}
 
@@ -399,78 +800,177 @@ func (filter *ObjectFilter) MatchesRouterDescriptor(desc *RouterDescriptor) bool
 // should already have been read and checked to be the correct type.  The
 // function returns a pointer to RouterDescriptors containing the router
 // descriptors.  If there were any errors, an error string is returned.  If the
-// lazy argument is set to true, parsing of the router descriptors is delayed
-// until they are accessed.
-func parseDescriptorUnchecked(r io.Reader, lazy bool) (*RouterDescriptors, error) {
+// lazy option is set, parsing of the router descriptors is delayed until they
+// are accessed.
+func parseDescriptorUnchecked(r io.Reader, opts parseOptions) (*RouterDescriptors, error) {
 
 	var descriptors = NewRouterDescriptors()
+	descriptors.AnnotationMetadata = opts.metadata
 	var descriptorParser func(descriptor string) (Fingerprint, GetDescriptor, error)
 
-	if lazy {
+	if opts.lazy {
 		descriptorParser = LazyParseRawDescriptor
 	} else {
 		descriptorParser = ParseRawDescriptor
 	}
+	// With offsets, router descriptors are retained only once they carry
+	// their position; see below.
+	if opts.lazy && opts.budget != nil && !opts.offsets {
+		descriptorParser = opts.budget.wrapDescriptorParser(descriptorParser)
+	}
+
+	// The line of the document at which the next descriptor starts.
+	line := opts.baseLine + 1
 
-	// We will read raw router descriptors from this channel.
+	// We will read raw router descriptors from this channel.  Cancelling
+	// the context stops the dissecting goroutine if we return early.
+	ctx, cancel := context.WithCancel(opts.context())
+	defer cancel()
 	queue := make(chan QueueUnit)
-	go DissectFile(r, extractDescriptor, queue)
+	go DissectFileContext(ctx, r, extractDescriptor, queue)
+
+	// Validating and parsing descriptors is independent of other
+	// descriptors, so we can spread it over several workers.
+	process := func(blurb string) (result descriptorResult) {
+		if opts.validate {
+			result.invalid, result.err = validateDescriptor(blurb)
+			if result.err != nil {
+				return
+			}
+		}
+		if opts.prefilter != nil && !opts.prefilter(blurb) {
+			result.skip = true
+			return
+		}
+		result.fingerprint, result.getDescriptor, result.err = descriptorParser(blurb)
+		return
+	}
 
 	// Parse incoming descriptors until the channel is closed by the remote
 	// end.
-	for unit := range queue {
+	for unit := range processUnits(ctx, queue, opts.workers, process) {
 		if unit.Err != nil {
 			return nil, unit.Err
 		}
+		opts.stats.splitDone(unit.QueueUnit)
+
+		first := line
+		line += strings.Count(unit.Blurb, "\n")
+
+		result := unit.result
+		if result.err != nil {
+			return nil, locateError(result.err, opts.source, result.invalid, first)
+		}
+		if result.skip {
+			continue
+		}
+
+		getDescriptor := result.getDescriptor
+		if opts.offsets {
+			getDescriptor = withDescriptorSpan(getDescriptor, opts.baseOffset+unit.Offset, len(unit.Blurb), opts.lazy)
+			if opts.lazy && opts.budget != nil {
+				getDescriptor = opts.budget.wrapDescriptor(getDescriptor, int64(len(unit.Blurb)))
+			}
+		}
 
-		fingerprint, getDescriptor, err := descriptorParser(unit.Blurb)
-		if err != nil {
-			return nil, err
+		if opts.descriptorSink != nil {
+			if err := opts.descriptorSink(getDescriptor()); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
-		descriptors.RouterDescriptors[SanitiseFingerprint(fingerprint)] = getDescriptor
+		start := opts.stats.parsed(unit.elapsed)
+		descriptors.RouterDescriptors[SanitiseFingerprint(result.fingerprint)] = getDescriptor
+		opts.stats.insertDone(start)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	return descriptors, nil
 }
 
+// descriptorResult is the result of validating and parsing a raw router
+// descriptor.
+type descriptorResult struct {
+	fingerprint   Fingerprint
+	getDescriptor GetDescriptor
+
+	// Set if the descriptor was skipped by a prefilter.
+	skip bool
+
+	// The fingerprint of a descriptor that failed validation, if known.
+	invalid Fingerprint
+
+	err error
+}
+
+// withDescriptorSpan records the given position within its source document
+// in the router descriptor of the given function.  Eagerly parsed router
+// descriptors are updated once, right away.  Lazy functions parse a new router
+// descriptor on every call, so the returned function records the position in
+// each of them.
+func withDescriptorSpan(getDescriptor GetDescriptor, offset int64, length int, lazy bool) GetDescriptor {
+
+	if !lazy {
+		desc := getDescriptor()
+		desc.SourceOffset = offset
+		desc.SourceLength = length
+		return getDescriptor
+	}
+
+	return func() *RouterDescriptor {
+		desc := getDescriptor()
+		desc.SourceOffset = offset
+		desc.SourceLength = length
+		return desc
+	}
+}
+
 // parseDescriptor is a wrapper around parseDescriptorUnchecked that first reads
 // and checks the type annotation to make sure it belongs to
 // descriptorAnnotations.
-func parseDescriptor(r io.Reader, lazy bool) (*RouterDescriptors, error) {
+func parseDescriptor(r io.Reader, opts parseOptions) (*RouterDescriptors, error) {
 
-	r, err := readAndCheckAnnotation(r, descriptorAnnotations)
+	header, r, err := readAndCheckAnnotation(r, descriptorAnnotations)
 	if err != nil {
 		return nil, err
 	}
+	opts.metadata = header.annotationMetadata()
+	opts.baseOffset += header.length
+	opts.baseLine += header.lines
 
-	return parseDescriptorUnchecked(r, lazy)
+	return parseDescriptorUnchecked(r, opts)
 }
 
 // parseDescriptorFile is a wrapper around parseDescriptor that opens the named
 // file for parsing.
-func parseDescriptorFile(fileName string, lazy bool) (*RouterDescriptors, error) {
+func parseDescriptorFile(fileName string, opts parseOptions) (*RouterDescriptors, error) {
 
 	fd, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
 	defer fd.Close()
+	opts.source = fileName
 
-	return parseDescriptor(fd, lazy)
+	return parseDescriptor(fd, opts)
 }
 
 // parseDescriptorFileUnchecked is a wrapper around parseDescriptorUnchecked
 // that opens the named file for parsing.
-func parseDescriptorFileUnchecked(fileName string, lazy bool) (*RouterDescriptors, error) {
+func parseDescriptorFileUnchecked(fileName string, opts parseOptions) (*RouterDescriptors, error) {
 
 	fd, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
 	defer fd.Close()
+	opts.source = fileName
 
-	return parseDescriptorUnchecked(fd, lazy)
+	return parseDescriptorUnchecked(fd, opts)
 }
 
 // LazilyParseDescriptorFile parses the given file and returns a pointer to
@@ -480,7 +980,7 @@ func parseDescriptorFileUnchecked(fileName string, lazy bool) (*RouterDescriptor
 // pays off when you know that you will not parse most router descriptors.
 func LazilyParseDescriptorFile(fileName string) (*RouterDescriptors, error) {
 
-	return parseDescriptorFile(fileName, true)
+	return parseDescriptorFile(fileName, parseOptions{lazy: true})
 }
 
 // ParseDescriptorFile parses the given file and returns a pointer to
@@ -490,7 +990,7 @@ func LazilyParseDescriptorFile(fileName string) (*RouterDescriptors, error) {
 // know that you will parse most router descriptors.
 func ParseDescriptorFile(fileName string) (*RouterDescriptors, error) {
 
-	return parseDescriptorFile(fileName, false)
+	return parseDescriptorFile(fileName, parseOptions{})
 }
 
 // LazilyParseDescriptorFile parses the given file without checking the annotations
@@ -500,7 +1000,7 @@ func ParseDescriptorFile(fileName string) (*RouterDescriptors, error) {
 // That pays off when you know that you will not parse most router descriptors.
 func LazilyParseUnsafeDescriptorFile(fileName string) (*RouterDescriptors, error) {
 
-	return parseDescriptorFileUnchecked(fileName, true)
+	return parseDescriptorFileUnchecked(fileName, parseOptions{lazy: true})
 }
 
 // ParseDescriptorFile parses the given file without checking the annotations and
@@ -510,5 +1010,31 @@ func LazilyParseUnsafeDescriptorFile(fileName string) (*RouterDescriptors, error
 // know that you will parse most router descriptors.
 func ParseUnsafeDescriptorFile(fileName string) (*RouterDescriptors, error) {
 
-	return parseDescriptorFileUnchecked(fileName, false)
+	return parseDescriptorFileUnchecked(fileName, parseOptions{})
+}
+
+// ParseDescriptorFileWithOffsets works like ParseDescriptorFile but
+// additionally records the byte offset and length of every router descriptor
+// within the given file in the descriptor's SourceOffset and SourceLength
+// fields.
+func ParseDescriptorFileWithOffsets(fileName string) (*RouterDescriptors, error) {
+
+	return parseDescriptorFile(fileName, parseOptions{offsets: true})
+}
+
+// ParseDescriptorsContext works like ParseDescriptors but stops parsing with
+// the context's error once the given context is done.
+func ParseDescriptorsContext(ctx context.Context, r io.Reader, options ...Option) (*RouterDescriptors, error) {
+
+	return ParseDescriptors(r, append(options[:len(options):len(options)], WithContext(ctx))...)
+}
+
+// StrictlyParseDescriptorFile works like ParseDescriptorFile but rejects
+// router descriptors whose "bandwidth" line, exit policy, Ed25519 keys, or
+// objects are malformed, instead of ignoring the malformed fields.
+// Errors name the file, the line, the descriptor's fingerprint, and the
+// malformed field.
+func StrictlyParseDescriptorFile(fileName string) (*RouterDescriptors, error) {
+
+	return parseDescriptorFile(fileName, parseOptions{validate: true})
 }
@@ -4,9 +4,17 @@ package zoossh
 
 import (
 	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 // The number of unique fingerprints in the descriptor test file.  The number
@@ -200,6 +208,14 @@ func TestNewRouterDescriptors(t *testing.T) {
 	if descs.RouterDescriptors == nil {
 		t.Error("RouterDescriptors map is not initialised.")
 	}
+
+	descs.Set("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", NewRouterDescriptor())
+	if !descs.Contains("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA") {
+		t.Error("Descriptors should contain fingerprint regardless of case.")
+	}
+	if descs.Contains("BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB") {
+		t.Error("Descriptors should not contain fingerprint.")
+	}
 }
 
 func TestString(t *testing.T) {
@@ -234,3 +250,309 @@ func TestDescriptorsToSlice(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDescriptorFileWithOffsets(t *testing.T) {
+
+	// Only run this test if the descriptors file is there.
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+
+	raw, err := ioutil.ReadFile(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	descs, err := ParseDescriptorFileWithOffsets(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for desc := range descs.Iterate(nil) {
+		d := desc.(*RouterDescriptor)
+		blurb := string(raw[d.SourceOffset : d.SourceOffset+int64(d.SourceLength)])
+		if !strings.HasPrefix(blurb, "router "+d.Nickname+" ") ||
+			!strings.HasSuffix(blurb, "-----END SIGNATURE-----\n") {
+			t.Fatalf("Source position of %s points to unexpected bytes: %q", d.Fingerprint, blurb)
+		}
+	}
+}
+
+func TestRouterDescriptorColumns(t *testing.T) {
+
+	desc := NewRouterDescriptor()
+	desc.Contact = "foo, bar"
+	if n := len(strings.Split(desc.String(), ",")); n != len(RouterDescriptorColumns) {
+		t.Errorf("String() returned %d columns but expected %d.", n, len(RouterDescriptorColumns))
+	}
+	if len(strings.Split(desc.Header(), ",")) != len(RouterDescriptorColumns) {
+		t.Error("Unexpected header.", desc.Header())
+	}
+}
+
+// Test that ParseRawDescriptor() preserves unknown lines and their objects.
+func TestDescriptorUnknownLines(t *testing.T) {
+
+	raw := `router leenuts 46.14.245.206 9001 0 0
+fingerprint F8E9 F7D3 0ED7 F541 FD24 8945 FAA2 B593 AD5E 584D
+signing-key
+-----BEGIN RSA PUBLIC KEY-----
+MIGJAoGBAL7ZgD+iMdXECit8bkXInwwvLbVg8fbZ352CvzGdW38nCYj5yo+tv7Vc
+-----END RSA PUBLIC KEY-----
+future-keyword 1 2 3
+future-object
+-----BEGIN FUTURE OBJECT-----
+Zm9vYmFy
+-----END FUTURE OBJECT-----
+opt another-future-keyword
+reject *:*
+`
+
+	_, getDescriptor, err := ParseRawDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"future-keyword 1 2 3",
+		"future-object",
+		"-----BEGIN FUTURE OBJECT-----",
+		"Zm9vYmFy",
+		"-----END FUTURE OBJECT-----",
+		"opt another-future-keyword",
+	}
+	unknown := getDescriptor().UnknownLines
+	if strings.Join(unknown, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected unknown lines %q but got %q.", expected, unknown)
+	}
+}
+
+// Test that ParseRawDescriptor() parses Ed25519 keys and cross-certificates.
+func TestDescriptorEd25519(t *testing.T) {
+
+	_, master, _ := ed25519.GenerateKey(rand.Reader)
+	signing, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, ntor, _ := ed25519.GenerateKey(rand.Reader)
+
+	encode := func(typ string, raw []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: raw}))
+	}
+	masterKey := master.Public().(ed25519.PublicKey)
+	sig := make([]byte, ed25519.SignatureSize)
+
+	raw := "router foo 1.2.3.4 9001 0 0\n" +
+		"identity-ed25519\n" + encode("ED25519 CERT", testEd25519Certificate(CertTypeSigningKey, signing, master)) +
+		"master-key-ed25519 " + base64.RawStdEncoding.EncodeToString(masterKey) + "\n" +
+		"onion-key-crosscert\n" + encode("CROSSCERT", []byte("crosscert")) +
+		"ntor-onion-key-crosscert 1\n" + encode("ED25519 CERT", testEd25519Certificate(CertTypeNTorOnionKeyCross, masterKey, ntor)) +
+		"router-sig-ed25519 " + base64.RawStdEncoding.EncodeToString(sig) + "\n"
+
+	_, getDescriptor, err := ParseRawDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := getDescriptor()
+
+	if desc.IdentityEd25519 == nil || !desc.IdentityEd25519.SigningKey.Equal(masterKey) ||
+		string(desc.IdentityEd25519.CertifiedKey) != string(signing) {
+		t.Error("Unexpected identity certificate.", desc.IdentityEd25519)
+	}
+	if !desc.MasterKeyEd25519.Equal(masterKey) {
+		t.Error("Unexpected master key.")
+	}
+	if string(desc.OnionKeyCrosscert) != "crosscert" {
+		t.Errorf("Unexpected onion key cross-certificate %q.", desc.OnionKeyCrosscert)
+	}
+	if desc.NTorOnionKeyCrosscertSign != 1 || desc.NTorOnionKeyCrosscert == nil ||
+		desc.NTorOnionKeyCrosscert.Type != CertTypeNTorOnionKeyCross {
+		t.Error("Unexpected ntor onion key cross-certificate.", desc.NTorOnionKeyCrosscert)
+	}
+	if len(desc.RouterSigEd25519) != ed25519.SignatureSize {
+		t.Error("Unexpected Ed25519 signature.", desc.RouterSigEd25519)
+	}
+	if desc.UnknownLines != nil {
+		t.Errorf("Unexpected unknown lines %q.", desc.UnknownLines)
+	}
+
+	// Malformed keys, signatures, and objects are left empty and only
+	// rejected by strict parsing.
+	for _, line := range []string{"master-key-ed25519 AAAA", "ntor-onion-key-crosscert 2", "router-sig-ed25519 !!",
+		"identity-ed25519\n" + strings.TrimSuffix(encode("ED25519 CERT", []byte("short")), "\n"),
+		"onion-key-crosscert\n-----BEGIN CROSSCERT-----\n!!\n-----END CROSSCERT-----"} {
+		raw := "router foo 1.2.3.4 9001 0 0\n" + line + "\n"
+		_, getDescriptor, err := ParseRawDescriptor(raw)
+		if err != nil {
+			t.Errorf("Malformed line %q was rejected outside of strict mode: %v", line, err)
+			continue
+		}
+		desc := getDescriptor()
+		if desc.MasterKeyEd25519 != nil || desc.NTorOnionKeyCrosscertSign != 0 || desc.RouterSigEd25519 != nil ||
+			desc.IdentityEd25519 != nil || desc.OnionKeyCrosscert != nil {
+			t.Errorf("Malformed line %q was not ignored.", line)
+		}
+		if err := strictlyParseRawDescriptor(raw); err == nil {
+			t.Errorf("Malformed line %q was accepted in strict mode.", line)
+		}
+	}
+}
+
+// strictlyParseRawDescriptor parses the given raw router descriptor in strict
+// mode and returns the resulting error.
+func strictlyParseRawDescriptor(rawDescriptor string) error {
+
+	document := "@type server-descriptor 1.0\n" + rawDescriptor +
+		"router-signature\n-----BEGIN SIGNATURE-----\nAAAA\n-----END SIGNATURE-----\n"
+	_, err := ParseDescriptors(strings.NewReader(document), WithStrict())
+
+	return err
+}
+
+// Test that descriptor digests match the digests of router statuses.
+func TestDescriptorDigest(t *testing.T) {
+
+	_, getDescriptor, err := ParseRawDescriptor("router foo 1.2.3.4 9001 0 0\nreject *:*\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc := getDescriptor(); desc.Digest() != "" || desc.DigestSHA256() != "" {
+		t.Error("Unsigned descriptor has digest.")
+	}
+
+	for _, fileName := range []string{serverDescriptorFile, consensusFile} {
+		if _, err := os.Stat(fileName); os.IsNotExist(err) {
+			t.Skipf("skipping because of missing %s", fileName)
+		}
+	}
+	descs, err := ParseDescriptorFile(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := 0
+	for fingerprint, getDescriptor := range descs.RouterDescriptors {
+		desc := getDescriptor()
+		if len(desc.Digest()) != 40 || len(desc.DigestSHA256()) != 43 {
+			t.Fatalf("Unexpected digests %q and %q.", desc.Digest(), desc.DigestSHA256())
+		}
+		if status, found := consensus.Get(fingerprint); found && status.Digest == desc.Digest() {
+			matches++
+		}
+	}
+	if matches == 0 {
+		t.Error("No descriptor digest matches a router status digest.")
+	}
+}
+
+// Test the method VerifySignature().
+func TestDescriptorVerifySignature(t *testing.T) {
+
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+	fd, err := os.Open(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	scanner.Split(extractDescriptor)
+	if !scanner.Scan() {
+		t.Fatal("Failed to extract descriptor.")
+	}
+	raw := scanner.Text()
+
+	_, getDescriptor, err := ParseRawDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := getDescriptor()
+	if err := desc.VerifySignature(); err != nil {
+		t.Error(err)
+	}
+	if !strings.HasPrefix(desc.SigningKey, "-----BEGIN RSA PUBLIC KEY-----") || desc.NTorOnionKey == "" {
+		t.Error("Missing descriptor keys.")
+	}
+
+	// Modifications of the signed portion invalidate the signature.
+	tampered := strings.Replace(raw, "\nuptime ", "\nuptime 1", 1)
+	_, getDescriptor, _ = ParseRawDescriptor(tampered)
+	if err := getDescriptor().VerifySignature(); err == nil {
+		t.Error("Tampered descriptor has valid signature.")
+	}
+
+	// The signing key must match the fingerprint.
+	desc.Fingerprint = "0000000000000000000000000000000000000000"
+	if err := desc.VerifySignature(); err == nil {
+		t.Error("Signing key of other relay was accepted.")
+	}
+
+	_, getDescriptor, _ = ParseRawDescriptor("router foo 1.2.3.4 9001 0 0\n")
+	if err := getDescriptor().VerifySignature(); err == nil {
+		t.Error("Unsigned descriptor has valid signature.")
+	}
+}
+
+// Test the function ParseDescriptorsContext().
+func TestParseDescriptorsContext(t *testing.T) {
+
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+
+	fd, err := os.Open(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	descs, err := ParseDescriptorsContext(context.Background(), fd, WithLazy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if descs.Length() != numServerDescriptors {
+		t.Errorf("Expected %d descriptors but got %d.", numServerDescriptors, descs.Length())
+	}
+
+	if _, err := fd.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := ParseDescriptorsContext(ctx, fd); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded but got %v.", err)
+	}
+}
+
+// Test that ParseRawDescriptor() parses "or-address" lines.
+func TestDescriptorORAddresses(t *testing.T) {
+
+	raw := "router foo 1.2.3.4 9001 0 0\nor-address [2001:db8::1]:9001\nor-address\n"
+	_, getDescriptor, err := ParseRawDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := getDescriptor()
+	if len(desc.ORAddresses) != 1 || desc.ORAddresses[0].String() != "[2001:db8::1]:9001" {
+		t.Errorf("Unexpected addresses %v.", desc.ORAddresses)
+	}
+}
+
+// Test that ParseRawDescriptor() keeps the version of "platform" lines.
+func TestDescriptorPlatform(t *testing.T) {
+
+	_, getDescriptor, err := ParseRawDescriptor("router foo 1.2.3.4 9001 0 0\nplatform Tor 0.2.4.24 on Linux\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := getDescriptor()
+	if desc.TorVersion != "Tor 0.2.4.24" {
+		t.Errorf("Expected Tor version \"Tor 0.2.4.24\" but got %q.", desc.TorVersion)
+	}
+	if desc.OperatingSystem != "Linux" {
+		t.Errorf("Expected operating system \"Linux\" but got %q.", desc.OperatingSystem)
+	}
+}
@@ -0,0 +1,164 @@
+// Provides a bounded cache of router descriptors that are loaded by digest.
+
+package zoossh
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultDescriptorCacheSize is the number of router descriptors that DescCache
+// holds.
+const DefaultDescriptorCacheSize = 10000
+
+// DescCache is the descriptor cache that LoadDescriptorFromDigest uses.
+var DescCache = NewDescriptorCache(DefaultDescriptorCacheSize)
+
+type cachedDescriptor struct {
+	digest     string
+	descriptor *RouterDescriptor
+}
+
+// DescriptorCache maps descriptor digests to router descriptors.  Once the
+// cache is full, adding a descriptor evicts the least recently used one.  A
+// DescriptorCache is safe for concurrent use.
+type DescriptorCache struct {
+	mu sync.Mutex
+
+	// The maximum number of descriptors.  The cache is unbounded if it is
+	// smaller than one.
+	capacity int
+
+	// The cached descriptors, most recently used first, and an index into
+	// the list by digest.
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// NewDescriptorCache returns a new and empty descriptor cache that holds up to
+// the given number of descriptors.  The cache is unbounded if capacity is
+// smaller than one.
+func NewDescriptorCache(capacity int) *DescriptorCache {
+
+	return &DescriptorCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns the descriptor with the given digest and marks it as recently
+// used.
+func (c *DescriptorCache) Get(digest string) (*RouterDescriptor, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[digest]
+	if !exists {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+
+	return elem.Value.(*cachedDescriptor).descriptor, true
+}
+
+// Add adds the given descriptor under the given digest, evicting the least
+// recently used descriptor if the cache is full.
+func (c *DescriptorCache) Add(digest string, descriptor *RouterDescriptor) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[digest]; exists {
+		elem.Value.(*cachedDescriptor).descriptor = descriptor
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[digest] = c.lru.PushFront(&cachedDescriptor{digest, descriptor})
+	if c.capacity > 0 && c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedDescriptor).digest)
+	}
+}
+
+// Remove removes the descriptor with the given digest.
+func (c *DescriptorCache) Remove(digest string) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[digest]; exists {
+		c.lru.Remove(elem)
+		delete(c.entries, digest)
+	}
+}
+
+// Len returns the number of cached descriptors.
+func (c *DescriptorCache) Len() int {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// LoadFromDigest works like LoadDescriptorFromDigest but uses the given cache.
+func (c *DescriptorCache) LoadFromDigest(descriptorDir, digest string, date time.Time) (*RouterDescriptor, error) {
+
+	// Check if we already have the descriptor in our local cache.
+	if desc, exists := c.Get(digest); exists {
+		return desc, nil
+	}
+	if len(digest) < 2 {
+		return nil, fmt.Errorf("malformed digest %q", digest)
+	}
+
+	topDir := fmt.Sprintf("server-descriptors-%s", date.Format("2006-01"))
+	prevTopDir := fmt.Sprintf("server-descriptors-%s", date.AddDate(0, -1, 0).Format("2006-01"))
+	fileName := filepath.Join(descriptorDir, topDir, digest[0:1], digest[1:2], digest)
+
+	// If we cannot find the descriptor file, go one month back in time.
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		fileName = filepath.Join(descriptorDir, prevTopDir, digest[0:1], digest[1:2], digest)
+		if _, err := os.Stat(fileName); os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not find digest file %s in %s", digest, descriptorDir)
+		}
+	}
+
+	descs, err := ParseDescriptorFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if descs.Length() != 1 {
+		return nil, fmt.Errorf("more than one descriptor in digest file %s.  Bug?", fileName)
+	}
+
+	var d *RouterDescriptor
+	for _, getDesc := range descs.RouterDescriptors {
+		d = getDesc()
+		break
+	}
+	c.Add(digest, d)
+	return d, nil
+}
+
+// LoadDescriptorFromDigest takes as input the descriptor directory, a
+// descriptor's digest, and the date the digest was created.  It then attempts
+// to parse and return the descriptor referenced by the digest.  The descriptor
+// directory expects to contain CollecTor server descriptor archives such as:
+// server-descriptors-2015-03/
+// server-descriptors-2015-04/
+// ...
+// Loaded descriptors are kept in DescCache.
+func LoadDescriptorFromDigest(descriptorDir, digest string, date time.Time) (*RouterDescriptor, error) {
+
+	return DescCache.LoadFromDigest(descriptorDir, digest, date)
+}
@@ -0,0 +1,93 @@
+// Tests functions from "descriptorcache.go".
+
+package zoossh
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test the eviction of least recently used descriptors.
+func TestDescriptorCacheEviction(t *testing.T) {
+
+	cache := NewDescriptorCache(2)
+	a, b, c := NewRouterDescriptor(), NewRouterDescriptor(), NewRouterDescriptor()
+
+	cache.Add("a", a)
+	cache.Add("b", b)
+	if desc, ok := cache.Get("a"); !ok || desc != a {
+		t.Fatal("Descriptor \"a\" is missing.")
+	}
+
+	// "b" is now the least recently used descriptor.
+	cache.Add("c", c)
+	if cache.Len() != 2 {
+		t.Errorf("Expected two descriptors but got %d.", cache.Len())
+	}
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Least recently used descriptor was not evicted.")
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Error("Recently used descriptor was evicted.")
+	}
+
+	cache.Remove("a")
+	if _, ok := cache.Get("a"); ok || cache.Len() != 1 {
+		t.Error("Removed descriptor is still cached.")
+	}
+
+	// Independent caches don't share descriptors.
+	if _, ok := NewDescriptorCache(0).Get("c"); ok {
+		t.Error("New cache is not empty.")
+	}
+}
+
+// Test the concurrent use of a descriptor cache.  Run with -race.
+func TestDescriptorCacheConcurrency(t *testing.T) {
+
+	cache := NewDescriptorCache(10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				digest := fmt.Sprintf("%d-%d", i, j%20)
+				if _, ok := cache.Get(digest); !ok {
+					cache.Add(digest, NewRouterDescriptor())
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if cache.Len() != 10 {
+		t.Errorf("Expected a full cache of 10 descriptors but got %d.", cache.Len())
+	}
+}
+
+// Test the method LoadFromDigest().
+func TestDescriptorCacheLoadFromDigest(t *testing.T) {
+
+	if _, err := os.Stat(serverDescriptorDir); err != nil {
+		t.Skipf("Cannot access test data: %s", err)
+	}
+
+	const digest = "7aef3ff4d6a3b20c03ebefef94e6dfca4d9b663a"
+	cache := NewDescriptorCache(1)
+	date := time.Date(2014, 12, 8, 0, 0, 0, 0, time.UTC)
+	desc, err := cache.LoadFromDigest(serverDescriptorDir, digest, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, ok := cache.Get(digest); !ok || cached != desc {
+		t.Error("Loaded descriptor was not cached.")
+	}
+
+	if _, err := cache.LoadFromDigest(serverDescriptorDir, "x", date); err == nil {
+		t.Error("Malformed digest was accepted.")
+	}
+}
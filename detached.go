@@ -0,0 +1,223 @@
+// Parses detached signature documents as exchanged by directory authorities.
+
+package zoossh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var detachedSignatureAnnotations = map[Annotation]bool{
+	Annotation{"detached-signature-3", "1", "0"}: true,
+}
+
+// DirectorySignature is a directory authority's signature of a network status
+// document as found on "directory-signature" lines, see dir-spec.txt, Section
+// 3.4.1.
+type DirectorySignature struct {
+	// The digest algorithm, which is "sha1" unless stated otherwise.
+	Algorithm string
+
+	// The fingerprint of the authority's identity key.
+	Identity Fingerprint
+
+	// The hex-encoded digest of the authority's signing key.
+	SigningKeyDigest string
+
+	// The PEM-encoded signature.
+	Signature string
+}
+
+// DetachedSignatures holds a detached signature document, which authorities
+// exchange after computing a consensus, as defined in dir-spec.txt, Section
+// 3.10.
+type DetachedSignatures struct {
+	// The hex-encoded SHA-1 digest of the "ns" flavoured consensus.
+	ConsensusDigest string
+
+	ValidAfter time.Time
+	FreshUntil time.Time
+	ValidUntil time.Time
+
+	// Maps a consensus flavour to a map from digest algorithm to the
+	// hex-encoded digest of the consensus of that flavour.
+	AdditionalDigests map[string]map[string]string
+
+	// Maps a consensus flavour to the signatures of the consensus of that
+	// flavour.
+	AdditionalSignatures map[string][]*DirectorySignature
+
+	// The signatures of the "ns" flavoured consensus.
+	Signatures []*DirectorySignature
+}
+
+// parseDirectorySignature parses the given words of a "directory-signature"
+// line, without the keyword.
+func parseDirectorySignature(words []string) (*DirectorySignature, error) {
+
+	sig := &DirectorySignature{Algorithm: "sha1"}
+
+	switch len(words) {
+	case 2:
+	case 3:
+		sig.Algorithm, words = words[0], words[1:]
+	default:
+		return nil, fmt.Errorf("malformed signature line with %d arguments", len(words))
+	}
+	sig.Identity = SanitiseFingerprint(Fingerprint(words[0]))
+	sig.SigningKeyDigest = strings.ToUpper(words[1])
+
+	return sig, nil
+}
+
+// ParseDetachedSignatures parses a detached signature document.  The document
+// may or may not start with a type annotation.
+func ParseDetachedSignatures(r io.Reader) (*DetachedSignatures, error) {
+
+	br := bufio.NewReader(r)
+	if first, _ := br.Peek(1); len(first) == 1 && first[0] == '@' {
+		annotation, rest, err := readAnnotation(br)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := detachedSignatureAnnotations[*annotation]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnexpectedAnnotation, annotation)
+		}
+		br = bufio.NewReader(rest)
+	}
+
+	ds := &DetachedSignatures{
+		AdditionalDigests:    make(map[string]map[string]string),
+		AdditionalSignatures: make(map[string][]*DirectorySignature),
+	}
+
+	// The signature that the next PEM object belongs to.
+	var current *DirectorySignature
+	var pem []string
+
+	scanner := bufio.NewScanner(br)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if pem != nil {
+			pem = append(pem, line)
+			if strings.HasPrefix(line, "-----END") {
+				current.Signature = strings.Join(pem, "\n")
+				current, pem = nil, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "-----BEGIN") {
+			if current == nil {
+				return nil, errors.New("signature object without signature line")
+			}
+			pem = []string{line}
+			continue
+		}
+
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		var err error
+		switch words[0] {
+		case "consensus-digest":
+			if len(words) != 2 {
+				return nil, fmt.Errorf("malformed line %q", line)
+			}
+			ds.ConsensusDigest = strings.ToUpper(words[1])
+		case "valid-after", "fresh-until", "valid-until":
+			t, err := time.Parse(publishedTimeLayout, strings.Join(words[1:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("malformed line %q", line)
+			}
+			switch words[0] {
+			case "valid-after":
+				ds.ValidAfter = t
+			case "fresh-until":
+				ds.FreshUntil = t
+			case "valid-until":
+				ds.ValidUntil = t
+			}
+		case "additional-digest":
+			if len(words) != 4 {
+				return nil, fmt.Errorf("malformed line %q", line)
+			}
+			if ds.AdditionalDigests[words[1]] == nil {
+				ds.AdditionalDigests[words[1]] = make(map[string]string)
+			}
+			ds.AdditionalDigests[words[1]][words[2]] = strings.ToUpper(words[3])
+		case "additional-signature":
+			if len(words) != 5 {
+				return nil, fmt.Errorf("malformed line %q", line)
+			}
+			current, err = parseDirectorySignature(words[2:])
+			if err != nil {
+				return nil, err
+			}
+			ds.AdditionalSignatures[words[1]] = append(ds.AdditionalSignatures[words[1]], current)
+		case "directory-signature":
+			current, err = parseDirectorySignature(words[1:])
+			if err != nil {
+				return nil, err
+			}
+			ds.Signatures = append(ds.Signatures, current)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if pem != nil {
+		return nil, errors.New("unterminated signature object")
+	}
+	if ds.ConsensusDigest == "" {
+		return nil, errors.New("missing \"consensus-digest\" line")
+	}
+
+	return ds, nil
+}
+
+// ParseDetachedSignaturesFile is a wrapper around ParseDetachedSignatures
+// that parses the given file.
+func ParseDetachedSignaturesFile(fileName string) (*DetachedSignatures, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return ParseDetachedSignatures(fd)
+}
+
+// Matches returns true if the given consensus has the same validity period as
+// the consensus that the detached signatures belong to.
+func (ds *DetachedSignatures) Matches(c *Consensus) bool {
+
+	return ds.ValidAfter.Equal(c.ValidAfter) &&
+		ds.FreshUntil.Equal(c.FreshUntil) &&
+		ds.ValidUntil.Equal(c.ValidUntil)
+}
+
+// Signers returns the identity fingerprints of all authorities that signed
+// the consensus of the given flavour.
+func (ds *DetachedSignatures) Signers(flavour string) []Fingerprint {
+
+	sigs := ds.Signatures
+	if flavour != FlavourNS {
+		sigs = ds.AdditionalSignatures[flavour]
+	}
+
+	fprs := make([]Fingerprint, 0, len(sigs))
+	for _, sig := range sigs {
+		fprs = append(fprs, sig.Identity)
+	}
+
+	return fprs
+}
@@ -0,0 +1,72 @@
+// Tests functions from "detached.go".
+
+package zoossh
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDetachedSignatures = `@type detached-signature-3 1.0
+consensus-digest 4d0e6a6d3a0ab8b4c1a7e2d1c8e6f0c1e8f1c2a3
+valid-after 2021-03-05 01:00:00
+fresh-until 2021-03-05 02:00:00
+valid-until 2021-03-05 04:00:00
+additional-digest microdesc sha256 8B1AE7F3B51E2E9A9B7D0D1E2F1A5B6C7D8E9F0A1B2C3D4E5F60718293A4B5C6
+additional-signature microdesc sha256 0232AF901C31A04EE9848595AF9BB7620D4C5B2E 9F2AD7B6CB02C8D17C1B8E77A8B5A3AA2CB6A3F2
+-----BEGIN SIGNATURE-----
+Zm9vYmFy
+-----END SIGNATURE-----
+directory-signature 0232AF901C31A04EE9848595AF9BB7620D4C5B2E 9F2AD7B6CB02C8D17C1B8E77A8B5A3AA2CB6A3F2
+-----BEGIN SIGNATURE-----
+YmF6cXV4
+-----END SIGNATURE-----
+directory-signature sha256 14C131DFC5C6F93646BE72FA1401C02A8DF2E8B4 D42C2DB5E2E2E5A1A0B1F9C8E4D3E2F1A0B9C8D7
+-----BEGIN SIGNATURE-----
+cXV1eA==
+-----END SIGNATURE-----
+`
+
+func TestParseDetachedSignatures(t *testing.T) {
+
+	ds, err := ParseDetachedSignatures(strings.NewReader(testDetachedSignatures))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ds.ConsensusDigest != "4D0E6A6D3A0AB8B4C1A7E2D1C8E6F0C1E8F1C2A3" {
+		t.Errorf("Unexpected consensus digest %q.", ds.ConsensusDigest)
+	}
+	if len(ds.Signatures) != 2 {
+		t.Fatalf("Expected 2 signatures but got %d.", len(ds.Signatures))
+	}
+	if sig := ds.Signatures[1]; sig.Algorithm != "sha256" || !strings.Contains(sig.Signature, "cXV1eA==") {
+		t.Errorf("Unexpected signature %+v.", sig)
+	}
+	if ds.Signatures[0].Algorithm != "sha1" {
+		t.Errorf("Expected default algorithm \"sha1\" but got %q.", ds.Signatures[0].Algorithm)
+	}
+	if _, ok := ds.AdditionalDigests["microdesc"]["sha256"]; !ok {
+		t.Error("Expected microdesc digest.")
+	}
+	if signers := ds.Signers("microdesc"); len(signers) != 1 || signers[0] != "0232AF901C31A04EE9848595AF9BB7620D4C5B2E" {
+		t.Errorf("Unexpected microdesc signers %v.", signers)
+	}
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ds.Matches(vote) {
+		t.Error("Expected detached signatures to match vote's validity period.")
+	}
+
+	_, err = ParseDetachedSignatures(strings.NewReader("@type server-descriptor 1.0\n"))
+	if err == nil {
+		t.Error("Expected error for wrong annotation.")
+	}
+	_, err = ParseDetachedSignatures(strings.NewReader(strings.Split(testDetachedSignatures, "-----END")[0]))
+	if err == nil {
+		t.Error("Expected error for unterminated signature.")
+	}
+}
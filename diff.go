@@ -0,0 +1,125 @@
+// Provides the differences between two consensuses.
+
+package zoossh
+
+import (
+	"sort"
+)
+
+// StatusChange describes how the router status of a relay that is listed in
+// two consensuses changed.
+type StatusChange struct {
+	Old *RouterStatus
+	New *RouterStatus
+
+	// The names of the flags that the relay gained and lost, in the order
+	// of RouterFlags.String.
+	FlagsAdded   []string
+	FlagsRemoved []string
+
+	// True if the IPv4 or IPv6 address, or one of the ports changed.
+	AddressChanged bool
+
+	// True if the bandwidth weight or its measured status changed.
+	BandwidthChanged bool
+
+	NicknameChanged   bool
+	VersionChanged    bool
+	ExitPolicyChanged bool
+}
+
+// FlagsChanged returns true if the relay gained or lost flags.
+func (sc *StatusChange) FlagsChanged() bool {
+
+	return len(sc.FlagsAdded) > 0 || len(sc.FlagsRemoved) > 0
+}
+
+// ConsensusDiff holds the differences between an old and a new consensus.
+// All slices are sorted by fingerprint.
+type ConsensusDiff struct {
+	// The router statuses of relays that only the new consensus lists.
+	Added []*RouterStatus
+
+	// The router statuses of relays that only the old consensus lists.
+	Removed []*RouterStatus
+
+	// The relays whose router status changed.
+	Changed []*StatusChange
+}
+
+// compareStatuses returns the changes between the given router statuses of a
+// relay, or nil if none of the compared fields changed.
+func compareStatuses(old, new *RouterStatus) *StatusChange {
+
+	sc := &StatusChange{Old: old, New: new}
+
+	oldFlags, newFlags := flagSet(old.Flags), flagSet(new.Flags)
+	for _, name := range new.Flags.flagNames() {
+		if !oldFlags[name] {
+			sc.FlagsAdded = append(sc.FlagsAdded, name)
+		}
+	}
+	for _, name := range old.Flags.flagNames() {
+		if !newFlags[name] {
+			sc.FlagsRemoved = append(sc.FlagsRemoved, name)
+		}
+	}
+
+	oa, na := &old.Address, &new.Address
+	sc.AddressChanged = !oa.IPv4Address.Equal(na.IPv4Address) ||
+		!oa.IPv6Address.Equal(na.IPv6Address) ||
+		oa.IPv4ORPort != na.IPv4ORPort ||
+		oa.IPv4DirPort != na.IPv4DirPort ||
+		oa.IPv6ORPort != na.IPv6ORPort
+	sc.BandwidthChanged = old.Bandwidth != new.Bandwidth ||
+		old.Measured != new.Measured ||
+		old.Unmeasured != new.Unmeasured
+	sc.NicknameChanged = old.Nickname != new.Nickname
+	sc.VersionChanged = old.TorVersion != new.TorVersion
+	sc.ExitPolicyChanged = old.Accept != new.Accept || old.PortList != new.PortList
+
+	if !sc.FlagsChanged() && !sc.AddressChanged && !sc.BandwidthChanged &&
+		!sc.NicknameChanged && !sc.VersionChanged && !sc.ExitPolicyChanged {
+		return nil
+	}
+
+	return sc
+}
+
+// Diff compares the consensus to the given newer consensus and returns the
+// relays that were added, removed, and whose router status changed.  Changes
+// of the descriptor digest and publication time alone are not reported
+// because relays publish new descriptors regularly.
+func (c *Consensus) Diff(other *Consensus) *ConsensusDiff {
+
+	diff := &ConsensusDiff{}
+
+	for fingerprint, getStatus := range other.RouterStatuses {
+		getOld, exists := c.RouterStatuses[fingerprint]
+		if !exists {
+			diff.Added = append(diff.Added, getStatus())
+			continue
+		}
+		if change := compareStatuses(getOld(), getStatus()); change != nil {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for fingerprint, getStatus := range c.RouterStatuses {
+		if _, exists := other.RouterStatuses[fingerprint]; !exists {
+			diff.Removed = append(diff.Removed, getStatus())
+		}
+	}
+
+	byFingerprint := func(statuses []*RouterStatus) {
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].Fingerprint < statuses[j].Fingerprint
+		})
+	}
+	byFingerprint(diff.Added)
+	byFingerprint(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].New.Fingerprint < diff.Changed[j].New.Fingerprint
+	})
+
+	return diff
+}
@@ -0,0 +1,72 @@
+// Tests functions from "diff.go".
+
+package zoossh
+
+import (
+	"net"
+	"testing"
+)
+
+// Test the method Diff().
+func TestConsensusDiff(t *testing.T) {
+
+	old, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := old.Diff(newer); len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+		t.Fatal("Identical consensuses differ.", diff)
+	}
+
+	const seele = "000A10D43011EA4928A35F610405F92B4433B4DC"
+	const karlstad = "9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"
+	const added = "1111111111111111111111111111111111111111"
+
+	newer.Remove(seele)
+	newer.Set(added, &RouterStatus{Fingerprint: added, Nickname: "newcomer"})
+	status, _ := newer.Get(karlstad)
+	status.Flags.Exit = false
+	status.Flags.BadExit = true
+	status.Bandwidth++
+	status.Address.IPv4Address = net.ParseIP("192.0.2.1")
+	status.Digest = "changed"
+
+	diff := old.Diff(newer)
+	if len(diff.Added) != 1 || diff.Added[0].Fingerprint != added {
+		t.Error("Unexpected added relays.", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Fingerprint != seele {
+		t.Error("Unexpected removed relays.", diff.Removed)
+	}
+	if len(diff.Changed) != 1 {
+		t.Fatalf("Expected one changed relay but got %d.", len(diff.Changed))
+	}
+
+	change := diff.Changed[0]
+	if change.New.Fingerprint != karlstad || change.Old.Flags.BadExit {
+		t.Error("Unexpected change.", change.New)
+	}
+	if len(change.FlagsAdded) != 1 || change.FlagsAdded[0] != "BadExit" ||
+		len(change.FlagsRemoved) != 1 || change.FlagsRemoved[0] != "Exit" {
+		t.Error("Unexpected flag changes.", change.FlagsAdded, change.FlagsRemoved)
+	}
+	if !change.AddressChanged || !change.BandwidthChanged {
+		t.Error("Address or bandwidth change was not detected.")
+	}
+	if change.NicknameChanged || change.VersionChanged || change.ExitPolicyChanged {
+		t.Error("Unchanged fields were reported as changed.")
+	}
+
+	// A new descriptor alone is no change.
+	status.Flags.Exit, status.Flags.BadExit = true, false
+	status.Bandwidth--
+	status.Address = change.Old.Address
+	if diff := old.Diff(newer); len(diff.Changed) != 0 {
+		t.Error("New descriptor was reported as change.")
+	}
+}
@@ -0,0 +1,404 @@
+// Provides an object set that keeps its objects on disk.
+
+package zoossh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	diskStoreKindStatus     = "status"
+	diskStoreKindDescriptor = "descriptor"
+)
+
+// errTruncatedRecord is returned by readDiskRecord if the input ends within a
+// record.
+var errTruncatedRecord = errors.New("truncated record")
+
+// diskStoreKey identifies the records of a DiskStore.  A relay's router status
+// and router descriptor are kept side by side.
+type diskStoreKey struct {
+	kind        string
+	fingerprint Fingerprint
+}
+
+// diskStoreKeyOf returns the key of the given object, or false if the object
+// cannot be stored.
+func diskStoreKeyOf(obj Object) (diskStoreKey, bool) {
+
+	key := diskStoreKey{fingerprint: SanitiseFingerprint(obj.GetFingerprint())}
+	switch obj.(type) {
+	case *RouterStatus:
+		key.kind = diskStoreKindStatus
+	case *RouterDescriptor:
+		key.kind = diskStoreKindDescriptor
+	default:
+		return key, false
+	}
+
+	return key, true
+}
+
+// DiskStore is an object set whose router statuses and router descriptors
+// live in an append-only file on disk.  Only an index from kind of object and
+// fingerprint to file offset is kept in memory, so a DiskStore can hold
+// working sets that are larger than RAM, e.g., all descriptors ever
+// published.  Objects are decoded whenever they are requested.
+//
+// The file is a sequence of records, each consisting of a four-byte, big
+// endian length followed by a MessagePack map that carries the kind of object
+// and its fields.  Adding an object whose kind and fingerprint are already
+// present appends a new record that supersedes the old one.
+type DiskStore struct {
+	mu    sync.RWMutex
+	fd    *os.File
+	size  int64
+	index map[diskStoreKey]int64
+
+	// The first error that Merge encountered.
+	err error
+}
+
+// OpenDiskStore opens the given store file, creating it if necessary, and
+// builds the in-memory index from its records.  A partial last record, e.g.,
+// left behind by a crash while writing, is cut off.
+func OpenDiskStore(fileName string) (*DiskStore, error) {
+
+	fd, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &DiskStore{fd: fd, index: make(map[diskStoreKey]int64)}
+	if err := ds.buildIndex(); err != nil {
+		fd.Close()
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// buildIndex reads all records in the store file and remembers the offset of
+// the latest record of every kind of object and fingerprint.
+func (ds *DiskStore) buildIndex() error {
+
+	r := bufio.NewReader(io.NewSectionReader(ds.fd, 0, 1<<62))
+	var offset int64
+
+	for {
+		obj, length, err := readDiskRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err == errTruncatedRecord {
+			if err := ds.fd.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("corrupt record at offset %d: %s", offset, err)
+		}
+		key, _ := diskStoreKeyOf(obj)
+		ds.index[key] = offset
+		offset += length
+	}
+	ds.size = offset
+
+	return nil
+}
+
+// readDiskRecord reads a single record from r.  It returns the decoded object
+// and the number of bytes the record takes up.  If r holds no more records,
+// io.EOF is returned, and if it ends within a record, errTruncatedRecord.
+func readDiskRecord(r io.Reader) (Object, int64, error) {
+
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errTruncatedRecord
+		}
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+
+	body, err := readBounded(r, int64(length))
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errTruncatedRecord
+		}
+		return nil, 0, err
+	}
+
+	mr := &msgpackReader{r: bufio.NewReader(bytes.NewReader(body))}
+	v, err := mr.readValue()
+	if err != nil {
+		return nil, 0, fmt.Errorf("malformed record: %s", err)
+	}
+	top, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, 0, errors.New("record is not a map")
+	}
+	m, _ := top["obj"].(map[string]interface{})
+
+	var obj Object
+	switch kind := msgpackFields(top).string("kind"); kind {
+	case diskStoreKindStatus:
+		obj = msgpackFields(m).routerStatus()
+	case diskStoreKindDescriptor:
+		obj = msgpackFields(m).routerDescriptor()
+	default:
+		return nil, 0, fmt.Errorf("unsupported object kind %q", kind)
+	}
+
+	return obj, int64(len(header)) + int64(length), nil
+}
+
+// Put adds the given router status or router descriptor to the store.  If the
+// store already holds an object of the same kind with the same fingerprint,
+// it is replaced.
+func (ds *DiskStore) Put(obj Object) error {
+
+	key, record, err := encodeDiskRecord(obj)
+	if err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.appendLocked(key, record)
+}
+
+// encodeDiskRecord encodes the given router status or router descriptor as a
+// record and returns the record along with the object's key.
+func encodeDiskRecord(obj Object) (diskStoreKey, []byte, error) {
+
+	key, ok := diskStoreKeyOf(obj)
+	if !ok {
+		return key, nil, fmt.Errorf("cannot store %T", obj)
+	}
+
+	var buf bytes.Buffer
+	mw := &msgpackWriter{w: bufio.NewWriter(&buf)}
+
+	mw.writeMapHeader(2)
+	mw.writeString("kind")
+	switch o := obj.(type) {
+	case *RouterStatus:
+		mw.writeString(diskStoreKindStatus)
+		mw.writeString("obj")
+		mw.writeFields(o.msgpackFields())
+	case *RouterDescriptor:
+		mw.writeString(diskStoreKindDescriptor)
+		mw.writeString("obj")
+		mw.writeFields(o.msgpackFields())
+	}
+	if mw.err == nil {
+		mw.err = mw.w.Flush()
+	}
+	if mw.err != nil {
+		return key, nil, mw.err
+	}
+
+	record := make([]byte, 4+buf.Len())
+	binary.BigEndian.PutUint32(record, uint32(buf.Len()))
+	copy(record[4:], buf.Bytes())
+
+	return key, record, nil
+}
+
+// appendLocked appends the given record to the store file and points the
+// index at it.  The caller must hold the write lock.
+func (ds *DiskStore) appendLocked(key diskStoreKey, record []byte) error {
+
+	if _, err := ds.fd.WriteAt(record, ds.size); err != nil {
+		return err
+	}
+	ds.index[key] = ds.size
+	ds.size += int64(len(record))
+
+	return nil
+}
+
+// readAt decodes the record at the given offset.
+func (ds *DiskStore) readAt(offset int64) (Object, error) {
+
+	obj, _, err := readDiskRecord(io.NewSectionReader(ds.fd, offset, 1<<62))
+	return obj, err
+}
+
+// Length implements the ObjectSet interface.  It returns the number of
+// objects in the store, counting a relay's router status and router
+// descriptor separately.
+func (ds *DiskStore) Length() int {
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return len(ds.index)
+}
+
+// Iterate implements the ObjectSet interface.  Using a channel, it iterates
+// over all objects in the store that pass the given filter.  Objects that
+// cannot be read from disk are skipped.
+func (ds *DiskStore) Iterate(filter *ObjectFilter) <-chan Object {
+
+	ds.mu.RLock()
+	offsets := make([]int64, 0, len(ds.index))
+	for _, offset := range ds.index {
+		offsets = append(offsets, offset)
+	}
+	ds.mu.RUnlock()
+
+	ch := make(chan Object)
+
+	go func() {
+		for _, offset := range offsets {
+			obj, err := ds.readAt(offset)
+			if err != nil {
+				continue
+			}
+			if filter == nil || filter.IsEmpty() {
+				ch <- obj
+				continue
+			}
+			switch o := obj.(type) {
+			case *RouterStatus:
+				if filter.MatchesRouterStatus(o) {
+					ch <- o
+				}
+			case *RouterDescriptor:
+				if filter.MatchesRouterDescriptor(o) {
+					ch <- o
+				}
+			}
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// get returns the object of the given kind that is identified by the given
+// fingerprint.
+func (ds *DiskStore) get(kind string, fingerprint Fingerprint) (Object, bool) {
+
+	ds.mu.RLock()
+	offset, exists := ds.index[diskStoreKey{kind, SanitiseFingerprint(fingerprint)}]
+	ds.mu.RUnlock()
+	if !exists {
+		return nil, false
+	}
+
+	obj, err := ds.readAt(offset)
+	if err != nil {
+		return nil, false
+	}
+
+	return obj, true
+}
+
+// GetRouterStatus returns the router status identified by the given
+// fingerprint.  If the router status is not present in the store or cannot be
+// read, false is returned, otherwise true.
+func (ds *DiskStore) GetRouterStatus(fingerprint Fingerprint) (*RouterStatus, bool) {
+
+	obj, found := ds.get(diskStoreKindStatus, fingerprint)
+	if !found {
+		return nil, false
+	}
+
+	return obj.(*RouterStatus), true
+}
+
+// GetRouterDescriptor returns the router descriptor identified by the given
+// fingerprint.  If the router descriptor is not present in the store or
+// cannot be read, false is returned, otherwise true.
+func (ds *DiskStore) GetRouterDescriptor(fingerprint Fingerprint) (*RouterDescriptor, bool) {
+
+	obj, found := ds.get(diskStoreKindDescriptor, fingerprint)
+	if !found {
+		return nil, false
+	}
+
+	return obj.(*RouterDescriptor), true
+}
+
+// GetObject implements the ObjectSet interface.  It returns the object
+// identified by the given fingerprint.  If the store holds both a router
+// status and a router descriptor for the fingerprint, the router status is
+// returned.  If the object is not present in the store or cannot be read,
+// false is returned, otherwise true.
+func (ds *DiskStore) GetObject(fingerprint Fingerprint) (Object, bool) {
+
+	if obj, found := ds.get(diskStoreKindStatus, fingerprint); found {
+		return obj, true
+	}
+
+	return ds.get(diskStoreKindDescriptor, fingerprint)
+}
+
+// Contains implements the ObjectSet interface.  It returns true if an object
+// with the given fingerprint is part of the store.  Unlike GetObject, it does
+// not read from disk.
+func (ds *DiskStore) Contains(fingerprint Fingerprint) bool {
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	fingerprint = SanitiseFingerprint(fingerprint)
+	for _, kind := range []string{diskStoreKindStatus, diskStoreKindDescriptor} {
+		if _, exists := ds.index[diskStoreKey{kind, fingerprint}]; exists {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Merge implements the ObjectSet interface.  It adds all objects of the given
+// set whose kind and fingerprint are not yet present in the store.  As Merge
+// cannot return an error, the first error is kept and can be retrieved using
+// Err.
+func (ds *DiskStore) Merge(objs ObjectSet) {
+
+	for obj := range objs.Iterate(nil) {
+		key, record, err := encodeDiskRecord(obj)
+
+		// Checking for the key and appending the record must happen
+		// under the same lock, so concurrent merges don't both add it.
+		ds.mu.Lock()
+		if err == nil {
+			if _, exists := ds.index[key]; !exists {
+				err = ds.appendLocked(key, record)
+			}
+		}
+		if err != nil && ds.err == nil {
+			ds.err = err
+		}
+		ds.mu.Unlock()
+	}
+}
+
+// Err returns the first error that Merge encountered, if any.
+func (ds *DiskStore) Err() error {
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return ds.err
+}
+
+// Close closes the store file.
+func (ds *DiskStore) Close() error {
+
+	return ds.fd.Close()
+}
@@ -0,0 +1,231 @@
+// Tests functions from "diskstore.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDiskStore(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "zoossh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "store")
+
+	ds, err := OpenDiskStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.Merge(vote)
+	if ds.Err() != nil {
+		t.Fatal(ds.Err())
+	}
+	if ds.Length() != vote.Length() {
+		t.Errorf("Expected %d objects in store but got %d.", vote.Length(), ds.Length())
+	}
+
+	desc := NewRouterDescriptor()
+	desc.Fingerprint = "D586D18309DED4CD6D57C18FDB97EFA96D330566"
+	desc.Nickname = "moria1"
+	if err := ds.Put(desc); err != nil {
+		t.Fatal(err)
+	}
+	desc.Nickname = "moria2"
+	if err := ds.Put(desc); err != nil {
+		t.Fatal(err)
+	}
+	ds.Close()
+
+	// Reopen the store to make sure that the index is rebuilt correctly.
+	ds, err = OpenDiskStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	if ds.Length() != vote.Length()+1 {
+		t.Errorf("Expected %d objects in store but got %d.", vote.Length()+1, ds.Length())
+	}
+	obj, found := ds.GetObject(desc.Fingerprint)
+	if !found {
+		t.Fatal("Failed to retrieve descriptor from store.")
+	}
+	if nickname := obj.(*RouterDescriptor).Nickname; nickname != "moria2" {
+		t.Errorf("Expected latest descriptor but got %s.", nickname)
+	}
+
+	for obj := range vote.Iterate(nil) {
+		stored, found := ds.GetObject(obj.GetFingerprint())
+		if !found {
+			t.Fatalf("Router status %s missing from store.", obj.GetFingerprint())
+		}
+		if stored.String() != obj.String() {
+			t.Errorf("Stored router status %q differs from %q.", stored, obj)
+		}
+	}
+
+	filter := NewObjectFilter()
+	filter.AddNickname("seele")
+	n := 0
+	for range ds.Iterate(filter) {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Expected filter to match one object but got %d.", n)
+	}
+
+	// A router status and a router descriptor of the same relay are kept side
+	// by side, and fingerprints are sanitised.
+	seele := NewRouterDescriptor()
+	seele.Fingerprint = "000a10d43011ea4928a35f610405f92b4433b4dc"
+	seele.Nickname = "seele"
+	if err := ds.Put(seele); err != nil {
+		t.Fatal(err)
+	}
+	if ds.Length() != vote.Length()+2 {
+		t.Errorf("Expected %d objects in store but got %d.", vote.Length()+2, ds.Length())
+	}
+	if _, found := ds.GetRouterDescriptor("000A10D43011EA4928A35F610405F92B4433B4DC"); !found {
+		t.Error("Failed to retrieve descriptor by sanitised fingerprint.")
+	}
+	if _, found := ds.GetRouterStatus(seele.Fingerprint); !found {
+		t.Error("Descriptor replaced router status of the same relay.")
+	}
+	if obj, found := ds.GetObject(seele.Fingerprint); !found || obj.(*RouterStatus).Nickname != "seele" {
+		t.Error("Failed to retrieve router status by unsanitised fingerprint.")
+	}
+	ds.Merge(vote)
+	if ds.Err() != nil || ds.Length() != vote.Length()+2 {
+		t.Error("Merging known router statuses changed the store.")
+	}
+}
+
+func TestDiskStoreConcurrentMerge(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "zoossh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	once, err := OpenDiskStore(filepath.Join(dir, "once"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer once.Close()
+	once.Merge(vote)
+
+	ds, err := OpenDiskStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	// Concurrent merges of the same set must append every record once.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ds.Merge(vote)
+		}()
+	}
+	wg.Wait()
+
+	if ds.Err() != nil {
+		t.Fatal(ds.Err())
+	}
+	if ds.size != once.size {
+		t.Errorf("Expected a store of %d bytes but got %d.", once.size, ds.size)
+	}
+}
+
+func TestOpenCorruptDiskStore(t *testing.T) {
+
+	fd, err := ioutil.TempFile("", "zoossh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	// A complete record whose body is not a MessagePack map.
+	fd.Write([]byte{0, 0, 0, 1, 1})
+	fd.Close()
+
+	if _, err := OpenDiskStore(fd.Name()); err == nil {
+		t.Error("Corrupt store did not raise an error.")
+	}
+}
+
+func TestReadOversizedDiskRecord(t *testing.T) {
+
+	// A record whose header claims 4 GiB but whose body ends right away.
+	record := []byte{0xff, 0xff, 0xff, 0xff, 0x80}
+	if _, _, err := readDiskRecord(bytes.NewReader(record)); err != errTruncatedRecord {
+		t.Errorf("Expected errTruncatedRecord but got %v.", err)
+	}
+}
+
+func TestOpenTruncatedDiskStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "zoossh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "store")
+
+	ds, err := OpenDiskStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := NewRouterDescriptor()
+	desc.Fingerprint = "D586D18309DED4CD6D57C18FDB97EFA96D330566"
+	if err := ds.Put(desc); err != nil {
+		t.Fatal(err)
+	}
+	ds.Close()
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := info.Size()
+
+	// Simulate a crash while writing the second record.
+	fd, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Write([]byte{0, 0, 0, 9, 1})
+	fd.Close()
+
+	ds, err = OpenDiskStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	if ds.Length() != 1 || !ds.Contains(desc.Fingerprint) {
+		t.Error("Unexpected objects in truncated store.")
+	}
+	if info, err := os.Stat(fileName); err != nil || info.Size() != size {
+		t.Error("Partial record was not cut off.")
+	}
+}
@@ -0,0 +1,103 @@
+// Provides path diversity metrics for consensuses.
+
+package zoossh
+
+import (
+	"net"
+	"sort"
+)
+
+// Locator maps an IP address to a location such as a country code or an
+// autonomous system number.  zoossh ships no GeoIP or ASN database, so callers
+// provide their own lookup.  An empty string means that the location is
+// unknown.
+type Locator func(net.IP) string
+
+// selectionWeights returns the probability of every location to be picked if
+// a relay of the given consensus is selected proportionally to its consensus
+// weight.  Relays whose location is unknown are ignored.
+func selectionWeights(c *Consensus, locate Locator) map[string]float64 {
+
+	weights := make(map[string]float64)
+	var total float64
+
+	for _, getStatus := range c.RouterStatuses {
+		status := getStatus()
+		location := locate(status.Address.IPv4Address)
+		if location == "" {
+			continue
+		}
+		weights[location] += float64(status.Bandwidth)
+		total += float64(status.Bandwidth)
+	}
+
+	if total == 0 {
+		return map[string]float64{}
+	}
+	for location := range weights {
+		weights[location] /= total
+	}
+
+	return weights
+}
+
+// SameLocationProbability returns the probability that a client picks a guard
+// and an exit relay in the same location, e.g., the same country or AS, as
+// determined by the given locator.  Guards and exits are picked independently
+// and proportionally to their consensus weight.  Bandwidth weights and
+// family restrictions are not taken into account.
+func SameLocationProbability(c *Consensus, locate Locator) float64 {
+
+	guards := selectionWeights(c.Guards(), locate)
+	exits := selectionWeights(c.Exits(), locate)
+
+	var p float64
+	for location, pGuard := range guards {
+		p += pGuard * exits[location]
+	}
+
+	return p
+}
+
+// Gini returns the Gini coefficient of the given values.  It is 0 if all
+// values are equal and approaches 1 as a single value dominates.  Gini returns
+// 0 for an empty slice or if all values are 0.
+func Gini(values []float64) float64 {
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum, weightedSum float64
+	for i, v := range sorted {
+		sum += v
+		weightedSum += float64(i+1) * v
+	}
+	if sum == 0 {
+		return 0
+	}
+
+	n := float64(len(sorted))
+	return 2*weightedSum/(n*sum) - (n+1)/n
+}
+
+// WeightGini groups the router statuses of the given consensus by the key
+// that the given function returns, e.g., an operator or an AS, and returns the
+// Gini coefficient of the groups' total consensus weight.  Statuses whose key
+// is the empty string are ignored.
+func WeightGini(c *Consensus, key func(*RouterStatus) string) float64 {
+
+	weights := make(map[string]float64)
+	for _, getStatus := range c.RouterStatuses {
+		status := getStatus()
+		if k := key(status); k != "" {
+			weights[k] += float64(status.Bandwidth)
+		}
+	}
+
+	values := make([]float64, 0, len(weights))
+	for _, weight := range weights {
+		values = append(values, weight)
+	}
+
+	return Gini(values)
+}
@@ -0,0 +1,66 @@
+// Tests functions from "diversity.go".
+
+package zoossh
+
+import (
+	"math"
+	"net"
+	"testing"
+)
+
+func TestSameLocationProbability(t *testing.T) {
+
+	c := NewConsensus()
+	add := func(fpr Fingerprint, addr string, bandwidth uint64, guard, exit bool) {
+		status := &RouterStatus{Fingerprint: fpr, Bandwidth: bandwidth}
+		status.Address.IPv4Address = net.ParseIP(addr)
+		status.Flags.Guard = guard
+		status.Flags.Exit = exit
+		c.Set(fpr, status)
+	}
+	add("A", "1.0.0.1", 30, true, false)
+	add("B", "2.0.0.1", 10, true, false)
+	add("C", "1.0.0.2", 50, false, true)
+	add("D", "3.0.0.1", 50, false, true)
+
+	// Use the first octet as location.
+	locate := func(ip net.IP) string {
+		return string(ip.To4()[:1])
+	}
+
+	// Guard in location 1 with 0.75 and exit in location 1 with 0.5.
+	if p := SameLocationProbability(c, locate); math.Abs(p-0.375) > 1e-9 {
+		t.Errorf("Expected probability of 0.375 but got %f.", p)
+	}
+
+	unknown := func(net.IP) string { return "" }
+	if p := SameLocationProbability(c, unknown); p != 0 {
+		t.Errorf("Expected probability of 0 but got %f.", p)
+	}
+}
+
+func TestGini(t *testing.T) {
+
+	if g := Gini([]float64{5, 5, 5, 5}); math.Abs(g) > 1e-9 {
+		t.Errorf("Expected Gini coefficient of 0 but got %f.", g)
+	}
+	if g := Gini([]float64{0, 0, 0, 10}); math.Abs(g-0.75) > 1e-9 {
+		t.Errorf("Expected Gini coefficient of 0.75 but got %f.", g)
+	}
+	if g := Gini(nil); g != 0 {
+		t.Errorf("Expected Gini coefficient of 0 but got %f.", g)
+	}
+}
+
+func TestWeightGini(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := WeightGini(vote, func(s *RouterStatus) string { return s.Nickname })
+	if g <= 0 || g >= 1 {
+		t.Errorf("Unexpected Gini coefficient %f.", g)
+	}
+}
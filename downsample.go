@@ -0,0 +1,166 @@
+// Provides helpers to thin out long series of consensuses.
+
+package zoossh
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// The layout of the time prefix of CollecTor's consensus file names,
+	// e.g., "2017-04-15-00-00-00-consensus".
+	consensusFileTimeLayout = "2006-01-02-15-04-05"
+)
+
+// SampleStrategy determines which consensus represents a period when
+// downsampling.
+type SampleStrategy int
+
+const (
+	// SampleFirst picks the earliest consensus of a period.
+	SampleFirst SampleStrategy = iota
+
+	// SampleMedian picks the consensus in the middle of a period.  For an
+	// even number of consensuses, the earlier of the two middle ones is
+	// picked.
+	SampleMedian
+)
+
+// Common downsampling periods.  Weeks start on Mondays.
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+// pick returns the index of the element that represents a period with n
+// elements.
+func (strategy SampleStrategy) pick(n int) int {
+
+	if strategy == SampleMedian {
+		return (n - 1) / 2
+	}
+
+	return 0
+}
+
+// utcDay returns midnight UTC of the day that the given time falls into.
+func utcDay(t time.Time) time.Time {
+
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// checkChronological returns an error if a consensus valid after the given
+// time arrives after one valid after last, which is a series' previous
+// valid-after time.  Otherwise, it advances last to the given time.
+func checkChronological(validAfter time.Time, last *time.Time) error {
+
+	if validAfter.Before(*last) {
+		return fmt.Errorf("consensus valid after %s arrived after consensus valid after %s", validAfter, *last)
+	}
+	*last = validAfter
+
+	return nil
+}
+
+// drain discards the remaining consensuses of the given channel in the
+// background, so that a sender is not blocked forever when we stop reading
+// early, e.g., because of an error.
+func drain(in <-chan *Consensus) {
+
+	go func() {
+		for range in {
+		}
+	}()
+}
+
+// ConsensusFileTime returns the valid-after time that is encoded in the given
+// CollecTor consensus file name, e.g., "2017-04-15-00-00-00-consensus".
+func ConsensusFileTime(fileName string) (time.Time, error) {
+
+	base := filepath.Base(fileName)
+	if len(base) < len(consensusFileTimeLayout) {
+		return time.Time{}, fmt.Errorf("file name %q lacks a timestamp", fileName)
+	}
+
+	return time.Parse(consensusFileTimeLayout, base[:len(consensusFileTimeLayout)])
+}
+
+// DownsampleFiles reduces the given consensus file names to one file per
+// period, e.g., Day or Week, using the given strategy.  Times are taken from
+// the CollecTor file names, so files can be thinned out before they are
+// parsed.  The returned file names are in chronological order.
+func DownsampleFiles(fileNames []string, period time.Duration, strategy SampleStrategy) ([]string, error) {
+
+	type timedFile struct {
+		name string
+		t    time.Time
+	}
+
+	files := make([]timedFile, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		t, err := ConsensusFileTime(fileName)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, timedFile{fileName, t})
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].t.Before(files[j].t) })
+
+	var sampled []string
+	for i := 0; i < len(files); {
+		bucket := files[i].t.Truncate(period)
+		j := i
+		for j < len(files) && files[j].t.Truncate(period).Equal(bucket) {
+			j++
+		}
+		sampled = append(sampled, files[i+strategy.pick(j-i)].name)
+		i = j
+	}
+
+	return sampled, nil
+}
+
+// Downsample reduces the given chronological stream of consensuses to one
+// consensus per period, e.g., Day or Week, using the given strategy.  Periods
+// are determined by the consensuses' valid-after time.  SampleFirst forwards
+// consensuses without buffering; SampleMedian buffers at most one period's
+// worth of consensuses.  The returned channel is closed once the input
+// channel is closed.
+func Downsample(in <-chan *Consensus, period time.Duration, strategy SampleStrategy) <-chan *Consensus {
+
+	out := make(chan *Consensus)
+
+	go func() {
+		defer close(out)
+
+		var bucket []*Consensus
+		var current time.Time
+
+		flush := func() {
+			if len(bucket) > 0 {
+				out <- bucket[strategy.pick(len(bucket))]
+			}
+			bucket = nil
+		}
+
+		for c := range in {
+			start := c.ValidAfter.Truncate(period)
+			if len(bucket) > 0 && start.Equal(current) {
+				if strategy == SampleMedian {
+					bucket = append(bucket, c)
+				}
+				continue
+			}
+			flush()
+			current = start
+			bucket = append(bucket, c)
+		}
+		flush()
+	}()
+
+	return out
+}
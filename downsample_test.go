@@ -0,0 +1,83 @@
+// Tests functions from "downsample.go".
+
+package zoossh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConsensusFileTime(t *testing.T) {
+
+	tm, err := ConsensusFileTime("consensuses-2017-04/15/2017-04-15-13-00-00-consensus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tm.Equal(time.Date(2017, time.April, 15, 13, 0, 0, 0, time.UTC)) {
+		t.Error("Unexpected consensus file time.", tm)
+	}
+
+	if _, err := ConsensusFileTime("consensus"); err == nil {
+		t.Error("File name without timestamp did not raise an error.")
+	}
+}
+
+func TestDownsampleFiles(t *testing.T) {
+
+	fileNames := []string{
+		"2017-04-16-01-00-00-consensus",
+		"2017-04-15-00-00-00-consensus",
+		"2017-04-15-01-00-00-consensus",
+		"2017-04-15-02-00-00-consensus",
+		"2017-04-16-00-00-00-consensus",
+	}
+
+	sampled, err := DownsampleFiles(fileNames, Day, SampleFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sampled) != 2 || sampled[0] != fileNames[1] || sampled[1] != fileNames[4] {
+		t.Error("Unexpected first-per-day files.", sampled)
+	}
+
+	sampled, err = DownsampleFiles(fileNames, Day, SampleMedian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sampled) != 2 || sampled[0] != fileNames[2] || sampled[1] != fileNames[4] {
+		t.Error("Unexpected median-per-day files.", sampled)
+	}
+
+	if _, err := DownsampleFiles([]string{"foo"}, Day, SampleFirst); err == nil {
+		t.Error("Invalid file name did not raise an error.")
+	}
+}
+
+func TestDownsample(t *testing.T) {
+
+	start := time.Date(2017, time.April, 10, 0, 0, 0, 0, time.UTC)
+	in := make(chan *Consensus)
+	go func() {
+		// Three days worth of hourly consensuses.
+		for i := 0; i < 72; i++ {
+			c := NewConsensus()
+			c.ValidAfter = start.Add(time.Duration(i) * time.Hour)
+			in <- c
+		}
+		close(in)
+	}()
+
+	var sampled []*Consensus
+	for c := range Downsample(in, Day, SampleMedian) {
+		sampled = append(sampled, c)
+	}
+	if len(sampled) != 3 {
+		t.Fatalf("Expected 3 consensuses but got %d.", len(sampled))
+	}
+	for i, c := range sampled {
+		expected := start.Add(time.Duration(i)*Day + 11*time.Hour)
+		if !c.ValidAfter.Equal(expected) {
+			t.Errorf("Expected consensus from %s but got %s.", expected, c.ValidAfter)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Parses Ed25519 certificates as defined in cert-spec.txt.
+
+package zoossh
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Certificate types of Ed25519 certificates, see cert-spec.txt, Appendix A.1.
+const (
+	CertTypeSigningKey        = 0x04
+	CertTypeLinkKey           = 0x05
+	CertTypeAuthKey           = 0x06
+	CertTypeHSDescSigningKey  = 0x08
+	CertTypeHSIntroAuthKey    = 0x09
+	CertTypeNTorOnionKeyCross = 0x0B
+	CertTypeHSIntroEncKey     = 0x0C
+)
+
+// The extension that carries the key that signed a certificate.
+const certExtSignedWithKey = 0x04
+
+// Ed25519Certificate is a certificate as defined in cert-spec.txt, Section
+// 2.1, which certifies a key using an Ed25519 signature.
+type Ed25519Certificate struct {
+	// The certificate type, e.g., CertTypeSigningKey.
+	Type byte
+
+	// The time after which the certificate is no longer valid.
+	Expires time.Time
+
+	// The type and value of the certified key.
+	KeyType      byte
+	CertifiedKey []byte
+
+	// The key that signed the certificate, if the certificate carries it in
+	// its "signed-with-ed25519-key" extension.
+	SigningKey ed25519.PublicKey
+
+	Signature []byte
+
+	// The signed portion of the certificate.
+	signed []byte
+}
+
+// ParseEd25519Certificate parses the given binary Ed25519 certificate.
+func ParseEd25519Certificate(raw []byte) (*Ed25519Certificate, error) {
+
+	// Version, type, expiration, key type, key, and number of extensions.
+	const headerLen = 1 + 1 + 4 + 1 + 32 + 1
+
+	if len(raw) < headerLen+ed25519.SignatureSize {
+		return nil, errors.New("certificate is too short")
+	}
+	if raw[0] != 1 {
+		return nil, fmt.Errorf("unsupported certificate version %d", raw[0])
+	}
+
+	cert := &Ed25519Certificate{
+		Type:         raw[1],
+		Expires:      time.Unix(int64(binary.BigEndian.Uint32(raw[2:6]))*3600, 0).UTC(),
+		KeyType:      raw[6],
+		CertifiedKey: raw[7:39],
+	}
+
+	pos := headerLen
+	for i := 0; i < int(raw[39]); i++ {
+		if len(raw) < pos+4 {
+			return nil, errors.New("truncated certificate extension")
+		}
+		length := int(binary.BigEndian.Uint16(raw[pos : pos+2]))
+		extType, extFlags := raw[pos+2], raw[pos+3]
+		pos += 4
+		if len(raw) < pos+length {
+			return nil, errors.New("truncated certificate extension")
+		}
+		data := raw[pos : pos+length]
+		pos += length
+
+		switch {
+		case extType == certExtSignedWithKey:
+			if length != ed25519.PublicKeySize {
+				return nil, errors.New("malformed signing key extension")
+			}
+			cert.SigningKey = ed25519.PublicKey(data)
+		case extFlags&1 != 0:
+			// Unknown extensions that affect validation render the
+			// certificate invalid.
+			return nil, fmt.Errorf("unknown certificate extension %d affects validation", extType)
+		}
+	}
+
+	if len(raw) != pos+ed25519.SignatureSize {
+		return nil, errors.New("malformed certificate signature")
+	}
+	cert.signed = raw[:pos]
+	cert.Signature = raw[pos:]
+
+	return cert, nil
+}
+
+// raw returns the certificate in its binary encoding.
+func (cert *Ed25519Certificate) raw() []byte {
+
+	return append(append([]byte{}, cert.signed...), cert.Signature...)
+}
+
+// parseEd25519CertificatePEM parses the given PEM-encoded "ED25519 CERT"
+// object.
+func parseEd25519CertificatePEM(object string) (*Ed25519Certificate, error) {
+
+	block, _ := pem.Decode([]byte(object))
+	if block == nil || block.Type != "ED25519 CERT" {
+		return nil, errors.New("malformed Ed25519 certificate object")
+	}
+
+	return ParseEd25519Certificate(block.Bytes)
+}
+
+// Verify checks the certificate's signature using the given key or, if the
+// key is nil, the key of the certificate's "signed-with-ed25519-key"
+// extension.  Expiration is not checked.
+func (cert *Ed25519Certificate) Verify(key ed25519.PublicKey) error {
+
+	if key == nil {
+		key = cert.SigningKey
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return errors.New("no key to verify certificate with")
+	}
+	if !ed25519.Verify(key, cert.signed, cert.Signature) {
+		return errors.New("invalid certificate signature")
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Tests functions from "ed25519cert.go".
+
+package zoossh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// testEd25519Certificate returns a certificate of the given type that
+// certifies the given key and is signed by the given signing key.  The
+// signing key is included in an extension.
+func testEd25519Certificate(certType byte, certified ed25519.PublicKey, signer ed25519.PrivateKey, extra ...byte) []byte {
+
+	cert := []byte{1, certType, 0, 0, 0, 0, 1}
+	binary.BigEndian.PutUint32(cert[2:6], 500000)
+	cert = append(cert, certified...)
+
+	ext := []byte{0, 32, certExtSignedWithKey, 0}
+	ext = append(ext, signer.Public().(ed25519.PublicKey)...)
+	if len(extra) > 0 {
+		cert = append(cert, 2)
+		cert = append(cert, ext...)
+		cert = append(cert, extra...)
+	} else {
+		cert = append(cert, 1)
+		cert = append(cert, ext...)
+	}
+
+	return append(cert, ed25519.Sign(signer, cert)...)
+}
+
+func TestParseEd25519Certificate(t *testing.T) {
+
+	certified, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, signer, _ := ed25519.GenerateKey(rand.Reader)
+
+	raw := testEd25519Certificate(CertTypeSigningKey, certified, signer)
+	cert, err := ParseEd25519Certificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Type != CertTypeSigningKey || cert.KeyType != 1 || string(cert.CertifiedKey) != string(certified) {
+		t.Error("Unexpected certificate fields.", cert)
+	}
+	if cert.Expires != time.Unix(500000*3600, 0).UTC() {
+		t.Errorf("Unexpected expiration time %s.", cert.Expires)
+	}
+	if !cert.SigningKey.Equal(signer.Public()) {
+		t.Error("Unexpected signing key.")
+	}
+	if err := cert.Verify(nil); err != nil {
+		t.Error(err)
+	}
+	if err := cert.Verify(certified); err == nil {
+		t.Error("Certificate verified with wrong key.")
+	}
+
+	raw[10] ^= 1
+	if cert, _ := ParseEd25519Certificate(raw); cert.Verify(nil) == nil {
+		t.Error("Tampered certificate verified.")
+	}
+
+	// Unknown extensions are only fatal if they affect validation.
+	ignorable := testEd25519Certificate(CertTypeSigningKey, certified, signer, 0, 1, 0x42, 0, 7)
+	if _, err := ParseEd25519Certificate(ignorable); err != nil {
+		t.Error(err)
+	}
+	critical := testEd25519Certificate(CertTypeSigningKey, certified, signer, 0, 1, 0x42, 1, 7)
+	if _, err := ParseEd25519Certificate(critical); err == nil {
+		t.Error("Expected error for unknown critical extension.")
+	}
+
+	if _, err := ParseEd25519Certificate(raw[:50]); err == nil {
+		t.Error("Expected error for truncated certificate.")
+	}
+}
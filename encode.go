@@ -0,0 +1,491 @@
+// Serialises parsed documents back to their dir-spec.txt text format.
+
+package zoossh
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// consensusHeaderKeywords holds the keywords of a consensus' header in the
+// order of dir-spec.txt, Section 3.4.1, as far as they are taken from the
+// consensus' MetaInfo.  "package" lines follow "server-versions".
+var consensusHeaderKeywords = []string{
+	"voting-delay",
+	"client-versions",
+	"server-versions",
+	"package",
+	"known-flags",
+	"recommended-client-protocols",
+	"recommended-relay-protocols",
+	"required-client-protocols",
+	"required-relay-protocols",
+	"params",
+	"shared-rand-previous-value",
+	"shared-rand-current-value",
+}
+
+// serverDescriptorAnnotation is the type annotation that precedes written
+// router descriptors.
+var serverDescriptorAnnotation = Annotation{"server-descriptor", "1", "0"}
+
+// writtenHeaderKeywords holds the keywords of header lines that are written
+// from the consensus' fields rather than from its MetaInfo.
+var writtenHeaderKeywords = map[string]bool{
+	"network-status-version": true,
+	"vote-status":            true,
+	"consensus-method":       true,
+	"valid-after":            true,
+	"fresh-until":            true,
+	"valid-until":            true,
+}
+
+// countingWriter is an io.Writer that counts the bytes written to it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// hexToBase64 turns the given hex-encoded digest into an unpadded
+// base64-encoded digest as used in router status entries.
+func hexToBase64(digest string) (string, error) {
+
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawStdEncoding.EncodeToString(raw), nil
+}
+
+// sortedFlagNames returns the names of the given flags in lexical order, as
+// dir-spec.txt requires of "known-flags" and "s" lines.
+func sortedFlagNames(flags RouterFlags) []string {
+
+	names := flags.flagNames()
+	sort.Strings(names)
+
+	return names
+}
+
+// knownFlags returns the value of a "known-flags" line that lists the flags of
+// all router statuses in the consensus.
+func (c *Consensus) knownFlags() string {
+
+	seen := make(map[string]bool)
+	for _, getStatus := range c.RouterStatuses {
+		for _, name := range getStatus().Flags.flagNames() {
+			seen[name] = true
+		}
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, " ")
+}
+
+// writeHeader writes the consensus' header.
+func (c *Consensus) writeHeader(w *bufio.Writer) {
+
+	if c.Flavour == "" || c.Flavour == FlavourNS {
+		fmt.Fprintln(w, "network-status-version 3")
+	} else {
+		fmt.Fprintln(w, "network-status-version 3", c.Flavour)
+	}
+	fmt.Fprintln(w, "vote-status consensus")
+	if c.ConsensusMethod != 0 {
+		fmt.Fprintln(w, "consensus-method", c.ConsensusMethod)
+	}
+	fmt.Fprintln(w, "valid-after", c.ValidAfter.UTC().Format(publishedTimeLayout))
+	fmt.Fprintln(w, "fresh-until", c.FreshUntil.UTC().Format(publishedTimeLayout))
+	fmt.Fprintln(w, "valid-until", c.ValidUntil.UTC().Format(publishedTimeLayout))
+
+	for _, keyword := range consensusHeaderKeywords {
+		switch keyword {
+		case "package":
+			for _, pkg := range c.Packages {
+				line := []string{"package", pkg.Name, pkg.Version, pkg.URL}
+				var algorithms []string
+				for algorithm := range pkg.Digests {
+					algorithms = append(algorithms, algorithm)
+				}
+				sort.Strings(algorithms)
+				for _, algorithm := range algorithms {
+					line = append(line, algorithm+"="+pkg.Digests[algorithm])
+				}
+				fmt.Fprintln(w, strings.Join(line, " "))
+			}
+		case "known-flags":
+			if value, ok := c.MetaInfo[keyword]; ok {
+				fmt.Fprintln(w, keyword, string(value))
+			} else {
+				fmt.Fprintln(w, keyword, c.knownFlags())
+			}
+		case "params":
+			if len(c.Params) == 0 {
+				continue
+			}
+			var names []string
+			for name := range c.Params {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			line := []string{"params"}
+			for _, name := range names {
+				line = append(line, name+"="+strconv.Itoa(c.Params[name]))
+			}
+			fmt.Fprintln(w, strings.Join(line, " "))
+		default:
+			if value, ok := c.MetaInfo[keyword]; ok {
+				fmt.Fprintln(w, strings.TrimSpace(keyword+" "+string(value)))
+			}
+		}
+	}
+
+	// Header lines that we don't know of follow the ones we know of.
+	known := make(map[string]bool)
+	for _, keyword := range consensusHeaderKeywords {
+		known[keyword] = true
+	}
+	var unknown []string
+	for keyword := range c.MetaInfo {
+		if !known[keyword] && !writtenHeaderKeywords[keyword] {
+			unknown = append(unknown, keyword)
+		}
+	}
+	sort.Strings(unknown)
+	for _, keyword := range unknown {
+		fmt.Fprintln(w, strings.TrimSpace(keyword+" "+string(c.MetaInfo[keyword])))
+	}
+}
+
+// writeStatus writes the given router status entry of a consensus of the
+// given flavour.
+func writeStatus(w *bufio.Writer, s *RouterStatus, flavour string) error {
+
+	identity, err := hexToBase64(string(s.Fingerprint))
+	if err != nil {
+		return fmt.Errorf("malformed fingerprint %q", s.Fingerprint)
+	}
+	r := []string{"r", s.Nickname, identity}
+	if flavour != FlavourMicrodesc {
+		digest, err := hexToBase64(s.Digest)
+		if err != nil {
+			return fmt.Errorf("malformed digest %q of %s", s.Digest, s.Fingerprint)
+		}
+		r = append(r, digest)
+	}
+	address := "0.0.0.0"
+	if s.Address.IPv4Address != nil {
+		address = s.Address.IPv4Address.String()
+	}
+	r = append(r, s.Publication.UTC().Format(publishedTimeLayout), address,
+		strconv.Itoa(int(s.Address.IPv4ORPort)), strconv.Itoa(int(s.Address.IPv4DirPort)))
+	fmt.Fprintln(w, strings.Join(r, " "))
+
+	if s.Address.IPv6Address != nil {
+		fmt.Fprintln(w, "a", net.JoinHostPort(s.Address.IPv6Address.String(), strconv.Itoa(int(s.Address.IPv6ORPort))))
+	}
+	if flavour == FlavourMicrodesc && s.MicrodescDigest != "" {
+		fmt.Fprintln(w, "m", s.MicrodescDigest)
+	}
+	fmt.Fprintln(w, strings.TrimSpace("s "+strings.Join(sortedFlagNames(s.Flags), " ")))
+	if s.TorVersion != "" {
+		fmt.Fprintln(w, "v Tor", s.TorVersion)
+	}
+
+	weight := []string{"w", "Bandwidth=" + strconv.FormatUint(s.Bandwidth, 10)}
+	if s.Measured != 0 {
+		weight = append(weight, "Measured="+strconv.FormatUint(s.Measured, 10))
+	}
+	if s.Unmeasured {
+		weight = append(weight, "Unmeasured=1")
+	}
+	fmt.Fprintln(w, strings.Join(weight, " "))
+
+	if flavour != FlavourMicrodesc && s.PortList != "" {
+		if s.Accept {
+			fmt.Fprintln(w, "p accept", s.PortList)
+		} else {
+			fmt.Fprintln(w, "p reject", s.PortList)
+		}
+	}
+	for _, line := range s.UnknownLines {
+		fmt.Fprintln(w, line)
+	}
+
+	return nil
+}
+
+// writeFooter writes the consensus' footer.
+func (c *Consensus) writeFooter(w *bufio.Writer) {
+
+	fmt.Fprintln(w, "directory-footer")
+
+	if c.BandwidthWeights != nil {
+		weights := c.BandwidthWeights.weights()
+		var names []string
+		for name := range weights {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		line := []string{"bandwidth-weights"}
+		for _, name := range names {
+			line = append(line, name+"="+strconv.Itoa(*weights[name]))
+		}
+		fmt.Fprintln(w, strings.Join(line, " "))
+	}
+
+	for _, sig := range c.Signatures {
+		line := []string{"directory-signature"}
+		if sig.Algorithm != "" && sig.Algorithm != "sha1" {
+			line = append(line, sig.Algorithm)
+		}
+		line = append(line, string(sig.Identity), sig.SigningKeyDigest)
+		fmt.Fprintln(w, strings.Join(line, " "))
+		fmt.Fprintln(w, strings.TrimSpace(sig.Signature))
+	}
+}
+
+// WriteTo implements the io.WriterTo interface.  It writes the consensus as a
+// network status document in the format of dir-spec.txt, Section 3.4.1,
+// without type annotation.  Router statuses are written in the order of their
+// fingerprints, as dir-spec.txt requires.  The header is written from the
+// consensus' fields and its MetaInfo, so it reflects changes to either.
+//
+// The result is not byte-for-byte identical to the parsed document: lines
+// that the parser ignores, e.g., "pr" and "id" lines of router statuses, are
+// not written.  Signatures are copied, so they no longer verify once router
+// statuses were added or removed.  Votes cannot be written because their
+// authority key certificates are not kept.
+func (c *Consensus) WriteTo(w io.Writer) (int64, error) {
+
+	if string(c.MetaInfo["vote-status"]) == "vote" {
+		return 0, errors.New("cannot write votes")
+	}
+
+	var fingerprints []string
+	for fingerprint := range c.RouterStatuses {
+		fingerprints = append(fingerprints, string(fingerprint))
+	}
+	sort.Strings(fingerprints)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	c.writeHeader(bw)
+	if c.AuthorityFingerprint != "" {
+		fmt.Fprintln(bw, "fingerprint", c.AuthorityFingerprint)
+	}
+	for _, source := range c.DirSources {
+		fmt.Fprintln(bw, "dir-source", source.Nickname, source.Identity, source.Hostname,
+			source.Address, source.DirPort, source.ORPort)
+		if source.Contact != "" {
+			fmt.Fprintln(bw, "contact", source.Contact)
+		}
+		if source.VoteDigest != "" {
+			fmt.Fprintln(bw, "vote-digest", source.VoteDigest)
+		}
+	}
+	for _, fingerprint := range fingerprints {
+		if err := writeStatus(bw, c.RouterStatuses[Fingerprint(fingerprint)](), c.Flavour); err != nil {
+			return cw.n, err
+		}
+	}
+	c.writeFooter(bw)
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// pemObject returns the given bytes as PEM object of the given type, without
+// trailing newline.
+func pemObject(blockType string, raw []byte) string {
+
+	block := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: raw})
+	return strings.TrimSuffix(string(block), "\n")
+}
+
+// ed25519CertificateObject returns the given certificate as "ED25519 CERT"
+// object.
+func ed25519CertificateObject(cert *Ed25519Certificate) string {
+
+	return pemObject("ED25519 CERT", cert.raw())
+}
+
+// familyMember returns the given member of a "family" line as it appears in
+// the line.  The parser strips the "$" of fingerprints.
+func familyMember(member Fingerprint) string {
+
+	if len(member) >= 40 && hexFingerprintRegexp.MatchString(strings.ToUpper(string(member[:40]))) {
+		return "$" + string(member)
+	}
+	return string(member)
+}
+
+// Encode returns the router descriptor as document in the format of
+// dir-spec.txt, Section 2.1.1, without type annotation.  Lines are written in
+// the order in which tor writes them and PEM objects are written as they were
+// parsed.  Unknown lines are written before the signatures.
+//
+// Lines that the parser ignores, e.g., "proto" and "extra-info-digest", are
+// lost, so the signatures of the result only verify if the parsed descriptor
+// lacked such lines.
+func (rd *RouterDescriptor) Encode() string {
+
+	var b strings.Builder
+
+	line := func(words ...string) {
+		b.WriteString(strings.Join(words, " "))
+		b.WriteByte('\n')
+	}
+	port := func(port uint16) string {
+		return strconv.FormatUint(uint64(port), 10)
+	}
+	number := func(n uint64) string {
+		return strconv.FormatUint(n, 10)
+	}
+
+	address := ""
+	if rd.Address != nil {
+		address = rd.Address.String()
+	}
+	line("router", rd.Nickname, address, port(rd.ORPort), port(rd.SOCKSPort), port(rd.DirPort))
+	if rd.IdentityEd25519 != nil {
+		line("identity-ed25519")
+		line(ed25519CertificateObject(rd.IdentityEd25519))
+	}
+	if rd.MasterKeyEd25519 != nil {
+		line("master-key-ed25519", base64.RawStdEncoding.EncodeToString(rd.MasterKeyEd25519))
+	}
+	for _, endpoint := range rd.ORAddresses {
+		line("or-address", net.JoinHostPort(endpoint.IP.String(), port(endpoint.Port)))
+	}
+	if rd.TorVersion != "" {
+		words := []string{"platform", rd.TorVersion}
+		if rd.OperatingSystem != "" {
+			words = append(words, "on", rd.OperatingSystem)
+		}
+		line(words...)
+	}
+	if !rd.Published.IsZero() {
+		line("published", rd.Published.UTC().Format(publishedTimeLayout))
+	}
+	if rd.Fingerprint != "" {
+		words := []string{"fingerprint"}
+		for i := 0; i < len(rd.Fingerprint); i += 4 {
+			end := i + 4
+			if end > len(rd.Fingerprint) {
+				end = len(rd.Fingerprint)
+			}
+			words = append(words, string(rd.Fingerprint[i:end]))
+		}
+		line(words...)
+	}
+	line("uptime", number(rd.Uptime))
+	line("bandwidth", number(rd.BandwidthAvg), number(rd.BandwidthBurst), number(rd.BandwidthObs))
+	if rd.OnionKey != "" {
+		line("onion-key")
+		line(rd.OnionKey)
+	}
+	if rd.SigningKey != "" {
+		line("signing-key")
+		line(rd.SigningKey)
+	}
+	if rd.OnionKeyCrosscert != nil {
+		line("onion-key-crosscert")
+		line(pemObject("CROSSCERT", rd.OnionKeyCrosscert))
+	}
+	if rd.NTorOnionKeyCrosscert != nil {
+		line("ntor-onion-key-crosscert", strconv.Itoa(rd.NTorOnionKeyCrosscertSign))
+		line(ed25519CertificateObject(rd.NTorOnionKeyCrosscert))
+	}
+	if len(rd.Family) > 0 {
+		var members []string
+		for member := range rd.Family {
+			members = append(members, familyMember(member))
+		}
+		sort.Strings(members)
+		line(append([]string{"family"}, members...)...)
+	}
+	if rd.Hibernating {
+		line("hibernating", "1")
+	}
+	if rd.HiddenServiceDir {
+		line("hidden-service-dir")
+	}
+	if rd.Contact != "" {
+		line("contact", rd.Contact)
+	}
+	if rd.BridgeDistributionRequest != "" {
+		line("bridge-distribution-request", rd.BridgeDistributionRequest)
+	}
+	if rd.NTorOnionKey != "" {
+		line("ntor-onion-key", rd.NTorOnionKey)
+	}
+	b.WriteString(rd.RawExitPolicy)
+	if rd.PortList6 != "" {
+		policy := "reject"
+		if rd.Accept6 {
+			policy = "accept"
+		}
+		line("ipv6-policy", policy, rd.PortList6)
+	}
+	for _, unknown := range rd.UnknownLines {
+		line(unknown)
+	}
+	if rd.RouterSigEd25519 != nil {
+		line("router-sig-ed25519", base64.RawStdEncoding.EncodeToString(rd.RouterSigEd25519))
+	}
+	if rd.RouterSignature != nil {
+		line("router-signature")
+		line(pemObject("SIGNATURE", rd.RouterSignature))
+	}
+
+	return b.String()
+}
+
+// WriteTo implements the io.WriterTo interface.  It writes the descriptors,
+// as returned by RouterDescriptor.Encode, in the order of their fingerprints.
+// As in CollecTor's descriptor files, every descriptor is preceded by a
+// "@type server-descriptor 1.0" annotation, so that the result can be parsed
+// by ParseDescriptors.
+func (rds *RouterDescriptors) WriteTo(w io.Writer) (int64, error) {
+
+	var fingerprints []string
+	for fingerprint := range rds.RouterDescriptors {
+		fingerprints = append(fingerprints, string(fingerprint))
+	}
+	sort.Strings(fingerprints)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, fingerprint := range fingerprints {
+		fmt.Fprintln(bw, serverDescriptorAnnotation.String())
+		if _, err := bw.WriteString(rds.RouterDescriptors[Fingerprint(fingerprint)]().Encode()); err != nil {
+			return cw.n, err
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
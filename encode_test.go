@@ -0,0 +1,252 @@
+// Tests functions from "encode.go".
+
+package zoossh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// withoutIgnoredLines returns the given annotated document without its type
+// annotation and without the router status lines that the parser ignores.
+func withoutIgnoredLines(document string) string {
+
+	var lines []string
+	for _, line := range strings.Split(document, "\n")[1:] {
+		if keyword := strings.SplitN(line, " ", 2)[0]; !ignoredStatusKeywords[keyword] {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Test the method WriteTo() of consensuses.
+func TestConsensusWriteTo(t *testing.T) {
+
+	for _, fileName := range []string{consensusFile, sharedRandConsensusFile} {
+		raw, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			t.Skipf("Cannot read test data: %s", err)
+		}
+		consensus, err := ParseRawConsensus(string(raw), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		n, err := consensus.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("Expected %d written bytes but got %d.", buf.Len(), n)
+		}
+		if buf.String() != withoutIgnoredLines(string(raw)) {
+			t.Errorf("Written consensus differs from %s.", fileName)
+		}
+	}
+}
+
+// Test that filtered consensuses can be written and parsed again.
+func TestFilteredConsensusWriteTo(t *testing.T) {
+
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Skipf("Cannot parse test data: %s", err)
+	}
+	exits := consensus.Exits()
+
+	var buf bytes.Buffer
+	if _, err := exits.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseRawUnsafeConsensus(buf.String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Length() != exits.Length() || len(exits.Diff(parsed).Changed) != 0 {
+		t.Error("Parsed consensus differs from written consensus.")
+	}
+	if !parsed.ValidAfter.Equal(consensus.ValidAfter) || *parsed.BandwidthWeights != *consensus.BandwidthWeights {
+		t.Error("Parsed consensus has different meta information.")
+	}
+}
+
+// Test the method WriteTo() of microdesc-flavoured consensuses and votes.
+func TestMicrodescConsensusWriteTo(t *testing.T) {
+
+	raw := `network-status-version 3 microdesc
+vote-status consensus
+valid-after 2021-03-05 01:00:00
+fresh-until 2021-03-05 02:00:00
+valid-until 2021-03-05 04:00:00
+known-flags Fast Running Stable Valid
+dir-source moria1 D586D18309DED4CD6D57C18FDB97EFA96D330566 128.31.0.34 128.31.0.34 9131 9101
+r seele AAoQ1DAR6kkoo19hBAX5K0QztNw 2021-03-04 12:27:05 73.15.150.172 9001 0
+a [2001:db8::1]:9001
+m 0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I
+s Fast Running Stable Valid
+v Tor 0.4.5.6
+w Bandwidth=18
+directory-footer
+directory-signature sha256 0232AF901C31A04EE9848595AF9BB7620D4C5B2E 9F2AD7B6CB02C8D17C1B8E77A8B5A3AA2CB6A3F2
+-----BEGIN SIGNATURE-----
+-----END SIGNATURE-----
+`
+	consensus, err := ParseRawUnsafeConsensus(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := consensus.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != raw {
+		t.Errorf("Unexpected microdesc consensus:\n%s", buf.String())
+	}
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vote.WriteTo(&buf); err == nil {
+		t.Error("Expected error when writing vote.")
+	}
+}
+
+// withoutIgnoredDescriptorLines returns the given raw descriptor without the
+// lines that the descriptor parser ignores and without "opt" prefixes.
+func withoutIgnoredDescriptorLines(raw string) string {
+
+	var lines []string
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimPrefix(line, "opt ")
+		if keyword := strings.SplitN(line, " ", 2)[0]; !ignoredDescriptorKeywords[keyword] {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Test the method Encode() of router descriptors.
+func TestRouterDescriptorEncode(t *testing.T) {
+
+	fd, err := os.Open(serverDescriptorFile)
+	if err != nil {
+		t.Skipf("Cannot open test data: %s", err)
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(nil, 1<<20)
+	scanner.Split(extractDescriptor)
+	for scanner.Scan() {
+		raw := strings.TrimPrefix(scanner.Text(), "@type server-descriptor 1.0\n")
+		_, getDescriptor, err := ParseRawDescriptor(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := withoutIgnoredDescriptorLines(raw)
+		if encoded := getDescriptor().Encode(); encoded != expected {
+			t.Fatalf("Encoded descriptor\n%s\ndiffers from\n%s", encoded, expected)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test that Encode() preserves Ed25519 keys and signatures, so that the
+// digest of a descriptor without ignored lines is unchanged.
+func TestRouterDescriptorEncodeEd25519(t *testing.T) {
+
+	_, master, _ := ed25519.GenerateKey(rand.Reader)
+	signing, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, ntor, _ := ed25519.GenerateKey(rand.Reader)
+	masterKey := master.Public().(ed25519.PublicKey)
+
+	raw := "router foo 192.0.2.1 9001 0 9030\n" +
+		"identity-ed25519\n" + pemObject("ED25519 CERT", testEd25519Certificate(CertTypeSigningKey, signing, master)) + "\n" +
+		"master-key-ed25519 " + base64.RawStdEncoding.EncodeToString(masterKey) + "\n" +
+		"or-address [2001:db8::1]:9001\n" +
+		"platform Tor 0.4.5.6 on Linux\n" +
+		"published 2021-03-04 12:00:00\n" +
+		"fingerprint 000A 10D4 3011 EA49 28A3 5F61 0405 F92B 4433 B4DC\n" +
+		"uptime 3600\n" +
+		"bandwidth 1000 2000 1500\n" +
+		"onion-key-crosscert\n" + pemObject("CROSSCERT", []byte("crosscert")) + "\n" +
+		"ntor-onion-key-crosscert 0\n" + pemObject("ED25519 CERT", testEd25519Certificate(CertTypeNTorOnionKeyCross, masterKey, ntor)) + "\n" +
+		"family $9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645 Karlstad0\n" +
+		"contact foo <foo@example.com>\n" +
+		"bridge-distribution-request any\n" +
+		"ntor-onion-key 8tAylcNZrA23N3iBPMsHGB8AYz9iHwqgaS6qAx3qVxA=\n" +
+		"accept *:80\n" +
+		"reject6 [2001:db8::]/32:*\n" +
+		"reject *:*\n" +
+		"ipv6-policy accept 80,443\n" +
+		"future-keyword 1 2 3\n" +
+		"router-sig-ed25519 " + base64.RawStdEncoding.EncodeToString(make([]byte, ed25519.SignatureSize)) + "\n" +
+		"router-signature\n" + pemObject("SIGNATURE", []byte("signature")) + "\n"
+
+	_, getDescriptor, err := ParseRawDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := getDescriptor()
+	encoded := desc.Encode()
+	if encoded != raw {
+		t.Fatalf("Encoded descriptor\n%s\ndiffers from\n%s", encoded, raw)
+	}
+
+	_, getDescriptor, err = ParseRawDescriptor(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getDescriptor().Digest() != desc.Digest() {
+		t.Error("Encoding changed the descriptor digest.")
+	}
+}
+
+// Test the method WriteTo() of router descriptors.
+func TestRouterDescriptorsWriteTo(t *testing.T) {
+
+	descs, err := ParseDescriptorFile(serverDescriptorFile)
+	if err != nil {
+		t.Skipf("Cannot parse test data: %s", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := descs.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected %d written bytes but got %d.", buf.Len(), n)
+	}
+
+	written, err := ParseDescriptors(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.Length() != descs.Length() {
+		t.Fatalf("Expected %d descriptors but got %d.", descs.Length(), written.Length())
+	}
+	for fingerprint, getDescriptor := range descs.RouterDescriptors {
+		desc, found := written.Get(fingerprint)
+		if !found {
+			t.Fatalf("Descriptor %s is missing.", fingerprint)
+		}
+		if desc.Encode() != getDescriptor().Encode() {
+			t.Errorf("Descriptor %s changed.", fingerprint)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Provides export of relay endpoints for firewall rules.
+
+package zoossh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Endpoint is an IP address and TCP port on which a relay listens.
+type Endpoint struct {
+	IP   net.IP
+	Port uint16
+}
+
+// String implements the Stringer interface.  IPv6 addresses are enclosed in
+// brackets, e.g., "[2001:db8::1]:9001".
+func (e Endpoint) String() string {
+
+	return net.JoinHostPort(e.IP.String(), strconv.Itoa(int(e.Port)))
+}
+
+// parseEndpoint parses an address and port as found on "or-address" lines,
+// e.g., "1.2.3.4:9001" or "[2001:db8::1]:9001".
+func parseEndpoint(s string) (Endpoint, error) {
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return Endpoint{}, fmt.Errorf("malformed IP address %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("malformed port %q", port)
+	}
+
+	return Endpoint{ip, uint16(p)}, nil
+}
+
+// EndpointFormat determines how WriteEndpoints formats endpoints.
+type EndpointFormat int
+
+const (
+	// EndpointPlain writes one "address:port" per line.
+	EndpointPlain EndpointFormat = iota
+
+	// EndpointIPSet writes "add" commands for "ipset restore".  IPv4 and
+	// IPv6 endpoints go into sets of type hash:ip,port whose names are the
+	// given set name followed by "-v4" and "-v6".
+	EndpointIPSet
+
+	// EndpointNftables writes "add element" commands for "nft -f".  The set
+	// name consists of family, table, and set, e.g., "inet filter tor", and
+	// IPv4 and IPv6 endpoints go into sets whose names are followed by "-v4"
+	// and "-v6".  The sets must be of type "ipv4_addr . inet_service" and
+	// "ipv6_addr . inet_service".
+	EndpointNftables
+
+	// EndpointCIDR writes one "cidr,port" per line, e.g.,
+	// "1.2.3.4/32,9001", as accepted by many cloud security groups.
+	EndpointCIDR
+)
+
+// hasFlags returns true if the given flags include all given flag names.
+func hasFlags(flags RouterFlags, names []string) bool {
+
+	set := flagSet(flags)
+	for _, name := range names {
+		if !set[name] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Endpoints returns the OR and directory endpoints of all relays in the given
+// consensus that have all the given flags, e.g., "Guard".  If descriptors are
+// given, the relays' additional "or-address" endpoints are included.  The
+// returned endpoints are unique and sorted with IPv4 endpoints first.
+func Endpoints(c *Consensus, rds *RouterDescriptors, flags ...string) []Endpoint {
+
+	seen := make(map[string]bool)
+	var endpoints []Endpoint
+
+	add := func(ip net.IP, port uint16) {
+		if ip == nil || port == 0 {
+			return
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		e := Endpoint{ip, port}
+		if !seen[e.String()] {
+			seen[e.String()] = true
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	for fpr, getStatus := range c.RouterStatuses {
+		status := getStatus()
+		if !hasFlags(status.Flags, flags) {
+			continue
+		}
+		add(status.Address.IPv4Address, status.Address.IPv4ORPort)
+		add(status.Address.IPv4Address, status.Address.IPv4DirPort)
+		add(status.Address.IPv6Address, status.Address.IPv6ORPort)
+
+		if rds == nil {
+			continue
+		}
+		if desc, found := rds.Get(fpr); found {
+			for _, e := range desc.ORAddresses {
+				add(e.IP, e.Port)
+			}
+		}
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if len(a.IP) != len(b.IP) {
+			return len(a.IP) < len(b.IP)
+		}
+		if cmp := strings.Compare(string(a.IP), string(b.IP)); cmp != 0 {
+			return cmp < 0
+		}
+		return a.Port < b.Port
+	})
+
+	return endpoints
+}
+
+// WriteEndpoints writes the given endpoints to w in the given format.  The
+// set name is only used by EndpointIPSet and EndpointNftables.
+func WriteEndpoints(w io.Writer, endpoints []Endpoint, format EndpointFormat, setName string) error {
+
+	// IPv4 and IPv6 endpoints go into separate sets.
+	families := []struct {
+		suffix    string
+		endpoints []Endpoint
+	}{{"-v4", nil}, {"-v6", nil}}
+	for _, e := range endpoints {
+		if e.IP.To4() != nil {
+			families[0].endpoints = append(families[0].endpoints, e)
+		} else {
+			families[1].endpoints = append(families[1].endpoints, e)
+		}
+	}
+
+	var err error
+	switch format {
+	case EndpointPlain:
+		for _, e := range endpoints {
+			if _, err = fmt.Fprintln(w, e); err != nil {
+				return err
+			}
+		}
+
+	case EndpointCIDR:
+		for _, e := range endpoints {
+			bits := 128
+			if e.IP.To4() != nil {
+				bits = 32
+			}
+			if _, err = fmt.Fprintf(w, "%s/%d,%d\n", e.IP, bits, e.Port); err != nil {
+				return err
+			}
+		}
+
+	case EndpointIPSet:
+		for _, family := range families {
+			for _, e := range family.endpoints {
+				if _, err = fmt.Fprintf(w, "add %s%s %s,tcp:%d\n", setName, family.suffix, e.IP, e.Port); err != nil {
+					return err
+				}
+			}
+		}
+
+	case EndpointNftables:
+		for _, family := range families {
+			if len(family.endpoints) == 0 {
+				continue
+			}
+			elements := make([]string, len(family.endpoints))
+			for i, e := range family.endpoints {
+				elements[i] = fmt.Sprintf("%s . %d", e.IP, e.Port)
+			}
+			_, err = fmt.Fprintf(w, "add element %s%s { %s }\n", setName, family.suffix, strings.Join(elements, ", "))
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("unsupported endpoint format %d", format)
+	}
+
+	return nil
+}
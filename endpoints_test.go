@@ -0,0 +1,90 @@
+// Tests functions from "endpoints.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+
+	e, err := parseEndpoint("[2001:db8::1]:9001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.IP.Equal(net.ParseIP("2001:db8::1")) || e.Port != 9001 || e.String() != "[2001:db8::1]:9001" {
+		t.Errorf("Unexpected endpoint %s.", e)
+	}
+
+	for _, s := range []string{"1.2.3.4", "foo:9001", "1.2.3.4:99999"} {
+		if _, err := parseEndpoint(s); err == nil {
+			t.Errorf("Expected error for %q.", s)
+		}
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+
+	fpr := Fingerprint("0000000000000000000000000000000000000001")
+	c := NewConsensus()
+	c.Set(fpr, &RouterStatus{
+		Fingerprint: fpr,
+		Flags:       RouterFlags{Guard: true, Running: true},
+		Address: RouterAddress{
+			IPv4Address: net.ParseIP("1.2.3.4"),
+			IPv4ORPort:  9001,
+			IPv4DirPort: 9030,
+			IPv6Address: net.ParseIP("2001:db8::1"),
+			IPv6ORPort:  9001,
+		},
+	})
+	other := Fingerprint("0000000000000000000000000000000000000002")
+	c.Set(other, &RouterStatus{
+		Fingerprint: other,
+		Address:     RouterAddress{IPv4Address: net.ParseIP("5.6.7.8"), IPv4ORPort: 443},
+	})
+
+	rds := NewRouterDescriptors()
+	desc := NewRouterDescriptor()
+	desc.Fingerprint = fpr
+	desc.ORAddresses = []Endpoint{{net.ParseIP("2001:db8::2"), 443}, {net.ParseIP("2001:db8::1"), 9001}}
+	rds.Set(fpr, desc)
+
+	endpoints := Endpoints(c, rds, "Guard")
+	if len(endpoints) != 4 {
+		t.Fatalf("Expected 4 endpoints but got %v.", endpoints)
+	}
+	if endpoints[0].String() != "1.2.3.4:9001" || endpoints[3].String() != "[2001:db8::2]:443" {
+		t.Errorf("Unexpected endpoint order %v.", endpoints)
+	}
+	if n := len(Endpoints(c, nil)); n != 4 {
+		t.Errorf("Expected 4 endpoints without flag restriction but got %d.", n)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEndpoints(&buf, endpoints[:3], EndpointIPSet, "tor"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "add tor-v4 1.2.3.4,tcp:9001\nadd tor-v4 1.2.3.4,tcp:9030\nadd tor-v6 2001:db8::1,tcp:9001\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected ipset output %q.", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteEndpoints(&buf, endpoints[:2], EndpointNftables, "inet filter tor"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "add element inet filter tor-v4 { 1.2.3.4 . 9001, 1.2.3.4 . 9030 }\n" {
+		t.Errorf("Unexpected nftables output %q.", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteEndpoints(&buf, endpoints[2:3], EndpointCIDR, ""); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "2001:db8::1/128,9001\n" {
+		t.Errorf("Unexpected CIDR output %q.", buf.String())
+	}
+}
@@ -0,0 +1,140 @@
+// Provides the errors that parsing functions return.
+
+package zoossh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUnexpectedAnnotation is returned when a document's type annotation
+	// does not belong to the document type that is being parsed.
+	ErrUnexpectedAnnotation = errors.New("unexpected file annotation")
+
+	// ErrNoEntry is returned when a document lacks the line that starts its
+	// entries, e.g., the "r" line of router statuses.
+	ErrNoEntry = errors.New("cannot find beginning of entry")
+
+	// ErrNoFingerprint is returned when an entry lacks its relay's
+	// fingerprint.
+	ErrNoFingerprint = errors.New("could not extract fingerprint")
+
+	// ErrMalformedField matches every ParseError that concerns a single
+	// malformed field.
+	ErrMalformedField = errors.New("malformed field")
+)
+
+// ParseError describes where parsing a document failed.  Use errors.As to
+// obtain it and errors.Is to compare its cause with the sentinel errors.
+type ParseError struct {
+	// The name of the document, e.g., its file name, if known.
+	File string
+
+	// The fingerprint of the entry that failed to parse, if known.
+	Entry Fingerprint
+
+	// The line at which parsing failed, starting at 1, or 0 if unknown.
+	// When returned by functions that parse a single raw entry, the line
+	// is relative to the entry.
+	Line int
+
+	// The keyword of the offending line, e.g., "r", and the name and value
+	// of the malformed field, e.g., "ORPort".  Empty unless a single field
+	// is malformed.
+	Keyword string
+	Field   string
+	Value   string
+
+	// The underlying cause.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+
+	var b strings.Builder
+
+	switch {
+	case e.File != "" && e.Line > 0:
+		fmt.Fprintf(&b, "%s:%d: ", e.File, e.Line)
+	case e.File != "":
+		fmt.Fprintf(&b, "%s: ", e.File)
+	case e.Line > 0:
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Entry != "" {
+		fmt.Fprintf(&b, "entry %s: ", e.Entry)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, "malformed %s %q in %q line: ", e.Field, e.Value, e.Keyword)
+	}
+	b.WriteString(e.Err.Error())
+
+	return b.String()
+}
+
+// Unwrap returns the underlying cause.
+func (e *ParseError) Unwrap() error {
+
+	return e.Err
+}
+
+// Is makes errors.Is match ErrMalformedField if the error concerns a single
+// malformed field.
+func (e *ParseError) Is(target error) bool {
+
+	return target == ErrMalformedField && e.Field != ""
+}
+
+// fieldError returns a ParseError for the malformed field of the given line.
+func fieldError(keyword, field, value string, err error) *ParseError {
+
+	return &ParseError{Keyword: keyword, Field: field, Value: value, Err: err}
+}
+
+// atLine sets the line of the given error, turning it into a ParseError if
+// necessary.  Nil errors remain nil.
+func atLine(err error, line int) error {
+
+	if err == nil {
+		return nil
+	}
+
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		located := *perr
+		located.Line = line
+		return &located
+	}
+
+	return &ParseError{Line: line, Err: err}
+}
+
+// locateError places the given error of an entry that starts at the given
+// line within the named document.  Line numbers relative to the entry become
+// line numbers relative to the document.
+func locateError(err error, source string, entry Fingerprint, firstLine int) error {
+
+	located := &ParseError{Err: err}
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		*located = *perr
+	}
+
+	if source != "" {
+		located.File = source
+	}
+	if located.Entry == "" {
+		located.Entry = entry
+	}
+	if firstLine > 0 {
+		if located.Line > 0 {
+			located.Line += firstLine - 1
+		} else {
+			located.Line = firstLine
+		}
+	}
+
+	return located
+}
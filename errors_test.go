@@ -0,0 +1,76 @@
+// Tests functions from "errors.go".
+
+package zoossh
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Test the type ParseError.
+func TestParseError(t *testing.T) {
+
+	_, _, err := ParseRawStatus("r seele AAoQ1DAR6kkoo19hBAX5K0QztNw bdrzhG0Kk/8DUsnSdmzj7DjFQjY 2021-03-04 12:27:05 73.15.150.172 9001 0\n" +
+		"s Running\nm 28,x sha256=0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I")
+	if !errors.Is(err, ErrMalformedField) {
+		t.Fatalf("Expected ErrMalformedField but got %v.", err)
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Expected ParseError but got %T.", err)
+	}
+	if perr.Line != 3 || perr.Keyword != "m" || perr.Field != "consensus method" || perr.Value != "x" {
+		t.Errorf("Unexpected error location %+v.", perr)
+	}
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Error("Expected the cause to be a *strconv.NumError.")
+	}
+
+	// Errors of files name the file and the line within the file.
+	broken := strings.Replace(testVote, "193.11.166.194 9000 80", "193.11.166.194 9000", 1)
+	fileName := writeTestFile(t, broken)
+	for _, parse := range []func(string) (*Consensus, error){ParseConsensusFile, StrictlyParseConsensusFile} {
+		_, err = parse(fileName)
+		if !errors.As(err, &perr) {
+			t.Fatalf("Expected ParseError but got %v.", err)
+		}
+		if perr.File != fileName || perr.Line != lineOf(broken, "193.11.166.194 9000") {
+			t.Errorf("Unexpected error location %s:%d.", perr.File, perr.Line)
+		}
+	}
+	if perr.Entry != "9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645" {
+		t.Errorf("Unexpected entry %s.", perr.Entry)
+	}
+
+	// Errors without field are not ErrMalformedField.
+	err = &ParseError{Line: 1, Err: ErrNoFingerprint}
+	if errors.Is(err, ErrMalformedField) || !errors.Is(err, ErrNoFingerprint) {
+		t.Error("Unexpected errors.Is result.")
+	}
+	if err.Error() != "line 1: could not extract fingerprint" {
+		t.Errorf("Unexpected error string %q.", err)
+	}
+}
+
+// Test the sentinel errors.
+func TestSentinelErrors(t *testing.T) {
+
+	if _, err := ParseRawConsensus("@type bridge-extra-info 1.3\n", false); !errors.Is(err, ErrUnexpectedAnnotation) {
+		t.Errorf("Expected ErrUnexpectedAnnotation but got %v.", err)
+	}
+	if _, _, err := LazyParseRawStatus("s Running\n"); !errors.Is(err, ErrNoFingerprint) {
+		t.Errorf("Expected ErrNoFingerprint but got %v.", err)
+	}
+	if _, _, err := LazyParseRawDescriptor("platform Tor 0.4.5.6\n"); !errors.Is(err, ErrNoFingerprint) {
+		t.Errorf("Expected ErrNoFingerprint but got %v.", err)
+	}
+	if _, _, err := extractDescriptor([]byte("platform Tor 0.4.5.6\n"), true); !errors.Is(err, ErrNoEntry) {
+		t.Errorf("Expected ErrNoEntry but got %v.", err)
+	}
+	if _, _, err := extractStatusEntry([]byte("s Running\n"), true); !errors.Is(err, ErrNoEntry) {
+		t.Errorf("Expected ErrNoEntry but got %v.", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Provides candidate lists for exit relay scanners such as exitmap.
+
+package zoossh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+)
+
+// ExitCandidate is an exit relay that a scanner can use to reach a
+// destination port.
+type ExitCandidate struct {
+	Fingerprint Fingerprint
+	Address     net.IP
+
+	// The relay's port policy summary, e.g., "accept 80,443".
+	PortPolicy string
+}
+
+// ExitCandidates returns the relays of the given consensus that allow exiting
+// to the given port and do not have the BadExit flag, ordered by fingerprint.
+// If descriptors are given, a relay's full exit policy takes precedence over
+// the port policy summary of its router status.
+func ExitCandidates(c *Consensus, rds *RouterDescriptors, port uint16) []*ExitCandidate {
+
+	var candidates []*ExitCandidate
+
+	for fpr, getStatus := range c.RouterStatuses {
+		status := getStatus()
+		if status.Flags.BadExit {
+			continue
+		}
+
+		accepts := status.AcceptsPort(port)
+		addr := status.Address.IPv4Address
+		if rds != nil {
+			if desc, found := rds.Get(fpr); found {
+				accepts = desc.AcceptsPort(port)
+				if desc.Address != nil {
+					addr = desc.Address
+				}
+			}
+		}
+		if !accepts {
+			continue
+		}
+
+		policy := "reject " + status.PortList
+		if status.Accept {
+			policy = "accept " + status.PortList
+		}
+		candidates = append(candidates, &ExitCandidate{
+			Fingerprint: status.Fingerprint,
+			Address:     addr,
+			PortPolicy:  policy,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Fingerprint < candidates[j].Fingerprint
+	})
+
+	return candidates
+}
+
+// WriteExitCandidates writes the given candidates to w, one per line, as
+// space-separated fingerprint, address, and port policy summary.
+func WriteExitCandidates(w io.Writer, candidates []*ExitCandidate) error {
+
+	for _, candidate := range candidates {
+		_, err := fmt.Fprintf(w, "%s %s %s\n", candidate.Fingerprint, candidate.Address, candidate.PortPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
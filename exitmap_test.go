@@ -0,0 +1,56 @@
+// Tests functions from "exitmap.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExitCandidates(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	karlstad := Fingerprint("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+
+	candidates := ExitCandidates(vote, nil, 443)
+	if len(candidates) != 1 || candidates[0].Fingerprint != karlstad {
+		t.Fatalf("Unexpected candidates %v.", candidates)
+	}
+	if candidates[0].PortPolicy != "accept 80,443" {
+		t.Errorf("Unexpected port policy %q.", candidates[0].PortPolicy)
+	}
+	if candidates := ExitCandidates(vote, nil, 22); len(candidates) != 0 {
+		t.Errorf("Expected no candidates for port 22 but got %d.", len(candidates))
+	}
+
+	var buf bytes.Buffer
+	if err := WriteExitCandidates(&buf, candidates); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(karlstad)+" "+candidates[0].Address.String()+" accept 80,443\n" {
+		t.Errorf("Unexpected candidate list %q.", buf.String())
+	}
+
+	// The descriptor's full exit policy takes precedence.
+	rds := NewRouterDescriptors()
+	desc := NewRouterDescriptor()
+	desc.Fingerprint = karlstad
+	for _, line := range []string{"reject *:443", "accept *:*"} {
+		words := strings.Fields(line)
+		desc.addExitRule(words[0], words[1])
+	}
+	rds.Set(karlstad, desc)
+	if candidates := ExitCandidates(vote, rds, 443); len(candidates) != 0 {
+		t.Errorf("Expected descriptor policy to reject port 443.")
+	}
+
+	status, _ := vote.Get(karlstad)
+	status.Flags.BadExit = true
+	if candidates := ExitCandidates(vote, nil, 443); len(candidates) != 0 {
+		t.Errorf("Expected BadExit relay to be excluded.")
+	}
+}
@@ -0,0 +1,334 @@
+// Parses and evaluates exit policies of router descriptors and port policy
+// summaries of router statuses.
+
+package zoossh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// parsePortSpec parses the given port spec of an exit pattern, i.e., "*", a
+// single port, or a port range such as "1000-2000".
+func parsePortSpec(spec string) (low, high uint16, err error) {
+
+	if spec == "*" {
+		return 1, 65535, nil
+	}
+
+	bounds := strings.SplitN(spec, "-", 2)
+	l, err := strconv.ParseUint(bounds[0], 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed port spec %q", spec)
+	}
+	h := l
+	if len(bounds) == 2 {
+		if h, err = strconv.ParseUint(bounds[1], 10, 16); err != nil {
+			return 0, 0, fmt.Errorf("malformed port spec %q", spec)
+		}
+	}
+	if l > h {
+		return 0, 0, fmt.Errorf("malformed port spec %q", spec)
+	}
+
+	return uint16(l), uint16(h), nil
+}
+
+// parseAddressSpec parses the given address spec of an exit pattern, e.g.,
+// "*", "*4", "10.0.0.0/8", "10.0.0.0/255.0.0.0", or "[2001:db8::]/32".  It
+// returns nil for "*", which matches all addresses.
+func parseAddressSpec(spec string) (*net.IPNet, error) {
+
+	switch spec {
+	case "*":
+		return nil, nil
+	case "*4":
+		return &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}, nil
+	case "*6":
+		return &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}, nil
+	}
+
+	addr, mask := spec, ""
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		addr, mask = spec[:i], spec[i+1:]
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("malformed address spec %q", spec)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil && !strings.Contains(addr, ":") {
+		ip, bits = ip4, 32
+	}
+
+	network := &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	if mask != "" {
+		if n, err := strconv.Atoi(mask); err == nil && n >= 0 && n <= bits {
+			network.Mask = net.CIDRMask(n, bits)
+		} else if m := net.ParseIP(mask).To4(); m != nil && bits == 32 {
+			network.Mask = net.IPMask(m)
+		} else {
+			return nil, fmt.Errorf("malformed address spec %q", spec)
+		}
+	}
+	network.IP = network.IP.Mask(network.Mask)
+
+	return network, nil
+}
+
+// ParseExitPattern parses the given exit pattern, e.g., "10.0.0.0/8:80-443",
+// as found on "accept" and "reject" lines of router descriptors.
+func ParseExitPattern(pattern string) (*ExitPattern, error) {
+
+	i := strings.LastIndex(pattern, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("malformed exit pattern %q", pattern)
+	}
+
+	p := &ExitPattern{AddressSpec: pattern[:i], PortSpec: pattern[i+1:]}
+
+	var err error
+	if p.Network, err = parseAddressSpec(p.AddressSpec); err != nil {
+		return nil, err
+	}
+	if p.PortLow, p.PortHigh, err = parsePortSpec(p.PortSpec); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// parseExitPattern6 parses the given exit pattern of an "accept6" or
+// "reject6" line, which only covers IPv6 addresses.
+func parseExitPattern6(pattern string) (*ExitPattern, error) {
+
+	p, err := ParseExitPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if p.Network == nil {
+		p.Network, _ = parseAddressSpec("*6")
+	} else if len(p.Network.IP) == net.IPv4len {
+		return nil, fmt.Errorf("IPv4 address in IPv6 exit pattern %q", pattern)
+	}
+
+	return p, nil
+}
+
+// Matches returns true if the exit pattern covers the given address and
+// port.
+func (p *ExitPattern) Matches(ip net.IP, port uint16) bool {
+
+	if port < p.PortLow || port > p.PortHigh {
+		return false
+	}
+
+	return p.Network == nil || p.Network.Contains(ip)
+}
+
+// ExitRule is a single "accept" or "reject" line of an exit policy.
+type ExitRule struct {
+	Accept  bool
+	Pattern *ExitPattern
+}
+
+// ExitPolicy is a router's exit policy, i.e., an ordered list of rules as
+// defined in dir-spec.txt, Section 2.1.3.
+type ExitPolicy struct {
+	Rules []ExitRule
+}
+
+// ParseExitPolicy parses the given exit policy, i.e., "accept", "reject",
+// "accept6", and "reject6" lines as found in RouterDescriptor.RawExitPolicy.
+// Empty lines are ignored.
+func ParseExitPolicy(rawPolicy string) (*ExitPolicy, error) {
+
+	policy := &ExitPolicy{}
+
+	for _, line := range strings.Split(rawPolicy, "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) != 2 {
+			return nil, fmt.Errorf("malformed exit policy line %q", line)
+		}
+
+		var pattern *ExitPattern
+		var err error
+		switch words[0] {
+		case "accept", "reject":
+			pattern, err = ParseExitPattern(words[1])
+		case "accept6", "reject6":
+			pattern, err = parseExitPattern6(words[1])
+		default:
+			return nil, fmt.Errorf("malformed exit policy line %q", line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, ExitRule{strings.HasPrefix(words[0], "accept"), pattern})
+	}
+
+	return policy, nil
+}
+
+// CanExitTo returns true if the exit policy allows exiting to the given
+// address and port.  Like tor, it evaluates the rules in order and the first
+// rule that matches decides.  If no rule matches, the address is accepted as
+// per dir-spec.txt.
+func (policy *ExitPolicy) CanExitTo(ip net.IP, port uint16) bool {
+
+	for _, rule := range policy.Rules {
+		if rule.Pattern.Matches(ip, port) {
+			return rule.Accept
+		}
+	}
+
+	return true
+}
+
+// adjacentIP returns the address that follows the given one if delta is 1,
+// or precedes it if delta is -1.  Addresses wrap around at the ends of the
+// address space.
+func adjacentIP(ip net.IP, delta int) net.IP {
+
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i] += byte(delta)
+		if (delta > 0 && next[i] != 0) || (delta < 0 && next[i] != 0xff) {
+			break
+		}
+	}
+
+	return next
+}
+
+// lastIP returns the last address of the given network.
+func lastIP(network *net.IPNet) net.IP {
+
+	last := make(net.IP, len(network.IP))
+	for i := range last {
+		last[i] = network.IP[i] | ^network.Mask[i]
+	}
+
+	return last
+}
+
+// acceptsPortOn returns true if the exit policy allows exiting to the given
+// port on at least one address of the given length, i.e., net.IPv4len or
+// net.IPv6len.  The addresses that a policy accepts form ranges whose bounds
+// are the bounds of the address space or lie next to the bounds of a rule's
+// network, so it suffices to evaluate the policy for these addresses.
+func (policy *ExitPolicy) acceptsPortOn(port uint16, ipLen int) bool {
+
+	space := &net.IPNet{IP: make(net.IP, ipLen), Mask: net.CIDRMask(0, 8*ipLen)}
+	candidates := []net.IP{space.IP, lastIP(space)}
+
+	for _, rule := range policy.Rules {
+		network := rule.Pattern.Network
+		if network == nil || len(network.IP) != ipLen ||
+			port < rule.Pattern.PortLow || port > rule.Pattern.PortHigh {
+			continue
+		}
+		first, last := network.IP, lastIP(network)
+		candidates = append(candidates, first, last, adjacentIP(first, -1), adjacentIP(last, 1))
+	}
+
+	for _, ip := range candidates {
+		if policy.CanExitTo(ip, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AcceptsPort returns true if the exit policy allows exiting to the given
+// port on at least one address.
+func (policy *ExitPolicy) AcceptsPort(port uint16) bool {
+
+	return policy.acceptsPortOn(port, net.IPv4len) || policy.acceptsPortOn(port, net.IPv6len)
+}
+
+// portListContains returns true if the given port is part of the given
+// comma-separated list of ports and port ranges, e.g., "22,80,1000-2000".
+func portListContains(portList string, port uint16) bool {
+
+	for _, item := range strings.Split(portList, ",") {
+		low, high, err := parsePortSpec(strings.TrimSpace(item))
+		if err == nil && port >= low && port <= high {
+			return true
+		}
+	}
+
+	return false
+}
+
+// summaryAcceptsPort returns true if the port policy summary that consists of
+// the given policy type and port list allows exiting to the given port.  An
+// empty port list accepts no ports.
+func summaryAcceptsPort(accept bool, portList string, port uint16) bool {
+
+	if portList == "" {
+		return false
+	}
+
+	return portListContains(portList, port) == accept
+}
+
+// AcceptsPort returns true if the status' port policy summary, i.e., its "p"
+// line, allows exiting to the given port on most addresses.  Statuses without
+// "p" line accept no ports.
+func (s *RouterStatus) AcceptsPort(port uint16) bool {
+
+	return summaryAcceptsPort(s.Accept, s.PortList, port)
+}
+
+// AcceptsPort returns true if the microdescriptor's port policy summary,
+// i.e., its "p" line, allows exiting to the given port on most addresses.
+// Microdescriptors without "p" line accept no ports.
+func (md *Microdescriptor) AcceptsPort(port uint16) bool {
+
+	return summaryAcceptsPort(md.Accept, md.PortList, port)
+}
+
+// AcceptsIPv6Port returns true if the descriptor's IPv6 port policy summary,
+// i.e., its "ipv6-policy" line, allows exiting to the given port.
+// Descriptors without "ipv6-policy" line don't exit to IPv6 addresses.
+func (rd *RouterDescriptor) AcceptsIPv6Port(port uint16) bool {
+
+	return summaryAcceptsPort(rd.Accept6, rd.PortList6, port)
+}
+
+// AcceptsPort returns true if the descriptor allows exiting to the given port
+// on at least one address.  For IPv6 addresses, the "ipv6-policy" line takes
+// precedence over the exit policy if the descriptor has one.
+func (rd *RouterDescriptor) AcceptsPort(port uint16) bool {
+
+	if rd.ExitPolicy.acceptsPortOn(port, net.IPv4len) {
+		return true
+	}
+	if rd.PortList6 != "" {
+		return rd.AcceptsIPv6Port(port)
+	}
+
+	return rd.ExitPolicy.acceptsPortOn(port, net.IPv6len)
+}
+
+// CanExitTo returns true if the descriptor's exit policy allows exiting to
+// the given address and port.  For IPv6 addresses, the "ipv6-policy" line
+// takes precedence over the exit policy if the descriptor has one.
+func (rd *RouterDescriptor) CanExitTo(ip net.IP, port uint16) bool {
+
+	if ip.To4() == nil && rd.PortList6 != "" {
+		return rd.AcceptsIPv6Port(port)
+	}
+
+	return rd.ExitPolicy.CanExitTo(ip, port)
+}
@@ -0,0 +1,275 @@
+// Tests functions from "exitpolicy.go".
+
+package zoossh
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Test the function ParseExitPattern().
+func TestParseExitPattern(t *testing.T) {
+
+	tests := []struct {
+		pattern  string
+		network  string
+		low      uint16
+		high     uint16
+		included []string
+		excluded []string
+	}{
+		{"*:*", "", 1, 65535, []string{"1.2.3.4", "2001:db8::1"}, nil},
+		{"*4:80", "0.0.0.0/0", 80, 80, []string{"1.2.3.4"}, []string{"2001:db8::1"}},
+		{"*6:80", "::/0", 80, 80, []string{"2001:db8::1"}, []string{"1.2.3.4"}},
+		{"10.0.0.0/8:1000-2000", "10.0.0.0/8", 1000, 2000, []string{"10.1.2.3"}, []string{"11.0.0.1"}},
+		{"192.168.1.7/255.255.0.0:*", "192.168.0.0/16", 1, 65535, []string{"192.168.2.1"}, []string{"192.169.0.1"}},
+		{"128.31.0.34:443", "128.31.0.34/32", 443, 443, []string{"128.31.0.34"}, []string{"128.31.0.35"}},
+		{"[2001:db8::]/32:25", "2001:db8::/32", 25, 25, []string{"2001:db8:1::1"}, []string{"2001:db9::1"}},
+	}
+
+	for _, test := range tests {
+		p, err := ParseExitPattern(test.pattern)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %s", test.pattern, err)
+			continue
+		}
+		network := ""
+		if p.Network != nil {
+			network = p.Network.String()
+		}
+		if network != test.network || p.PortLow != test.low || p.PortHigh != test.high {
+			t.Errorf("Unexpected pattern %s %d-%d for %q.", network, p.PortLow, p.PortHigh, test.pattern)
+		}
+		for _, addr := range test.included {
+			if !p.Matches(net.ParseIP(addr), test.low) {
+				t.Errorf("Expected %q to match %s.", test.pattern, addr)
+			}
+		}
+		for _, addr := range test.excluded {
+			if p.Matches(net.ParseIP(addr), test.low) {
+				t.Errorf("Expected %q not to match %s.", test.pattern, addr)
+			}
+		}
+		if test.high < 65535 && p.Matches(net.ParseIP(test.included[0]), test.high+1) {
+			t.Errorf("Expected %q not to match port %d.", test.pattern, test.high+1)
+		}
+	}
+
+	for _, pattern := range []string{"*", "foo:80", "1.2.3.4:x", "1.2.3.4:443-80", "1.2.3.4/33:80", "1.2.3.4:70000"} {
+		if _, err := ParseExitPattern(pattern); err == nil {
+			t.Errorf("Malformed exit pattern %q was accepted.", pattern)
+		}
+	}
+}
+
+// Test that ParseRawDescriptor() populates exit patterns.
+func TestDescriptorExitPatterns(t *testing.T) {
+
+	raw := `router foo 1.2.3.4 9001 0 0
+fingerprint F8E9 F7D3 0ED7 F541 FD24 8945 FAA2 B593 AD5E 584D
+reject 0.0.0.0/8:*
+accept *:80
+accept *:443
+reject *:*
+`
+	_, getDescriptor, err := ParseRawDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := getDescriptor()
+	if len(desc.Accept) != 2 || len(desc.Reject) != 2 {
+		t.Fatalf("Expected 2 accept and 2 reject patterns but got %d and %d.", len(desc.Accept), len(desc.Reject))
+	}
+	if desc.Accept[1].PortLow != 443 || desc.Reject[0].Network.String() != "0.0.0.0/8" {
+		t.Error("Unexpected exit patterns.", desc.Accept[1], desc.Reject[0])
+	}
+
+	// Malformed exit patterns are only rejected by strict parsing.
+	_, getDescriptor, err = ParseRawDescriptor(raw + "accept foo:80\n")
+	if err != nil {
+		t.Fatal("Malformed exit pattern was rejected outside of strict mode:", err)
+	}
+	if desc := getDescriptor(); len(desc.Accept) != 2 || !strings.HasSuffix(desc.RawExitPolicy, "accept foo:80\n") {
+		t.Error("Unexpected exit policy.", desc.Accept, desc.RawExitPolicy)
+	}
+	for _, line := range []string{"accept foo:80", "accept6 1.2.3.4:80"} {
+		strict := "@type server-descriptor 1.0\n" + raw + line + "\n" +
+			"router-signature\n-----BEGIN SIGNATURE-----\nAAAA\n-----END SIGNATURE-----\n"
+		if _, err := ParseDescriptors(strings.NewReader(strict), WithStrict()); !errors.Is(err, ErrMalformedField) {
+			t.Errorf("Expected ErrMalformedField for %q in strict mode but got %v.", line, err)
+		}
+	}
+}
+
+// Test the method CanExitTo().
+func TestExitPolicyCanExitTo(t *testing.T) {
+
+	policy, err := ParseExitPolicy("reject 0.0.0.0/8:*\nreject 10.0.0.0/8:*\naccept *:80\naccept 1.2.3.4:22\nreject *:*\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr     string
+		port     uint16
+		expected bool
+	}{
+		{"8.8.8.8", 80, true},
+		{"10.1.1.1", 80, false},
+		{"8.8.8.8", 22, false},
+		{"1.2.3.4", 22, true},
+		{"8.8.8.8", 443, false},
+	}
+	for _, test := range tests {
+		if policy.CanExitTo(net.ParseIP(test.addr), test.port) != test.expected {
+			t.Errorf("Expected CanExitTo(%s, %d) to be %t.", test.addr, test.port, test.expected)
+		}
+	}
+
+	// The first matching rule decides, and unmatched addresses are accepted.
+	policy, _ = ParseExitPolicy("accept *:443\nreject *:443\nreject 1.1.1.1:*")
+	if !policy.CanExitTo(net.ParseIP("1.1.1.1"), 443) || !policy.CanExitTo(net.ParseIP("2.2.2.2"), 80) {
+		t.Error("Unexpected evaluation order.")
+	}
+
+	for _, raw := range []string{"accept", "allow *:80", "accept *:80 *:443", "reject foo"} {
+		if _, err := ParseExitPolicy(raw); err == nil {
+			t.Errorf("Malformed exit policy %q was accepted.", raw)
+		}
+	}
+
+	// Descriptors carry their rules in order.
+	_, getDescriptor, err := ParseRawDescriptor("router foo 1.2.3.4 9001 0 0\nreject *:25\naccept *:*\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := getDescriptor()
+	if len(desc.ExitPolicy.Rules) != 2 || desc.ExitPolicy.CanExitTo(net.ParseIP("8.8.8.8"), 25) ||
+		!desc.ExitPolicy.CanExitTo(net.ParseIP("8.8.8.8"), 80) {
+		t.Error("Unexpected descriptor exit policy.", desc.ExitPolicy)
+	}
+	if c := desc.Copy(); len(c.ExitPolicy.Rules) != 2 || c.ExitPolicy.Rules[0].Pattern == desc.ExitPolicy.Rules[0].Pattern {
+		t.Error("Exit policy was not copied.")
+	}
+}
+
+// Test the method AcceptsPort().
+func TestAcceptsPort(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seele, _ := vote.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	karlstad, _ := vote.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+
+	if seele.AcceptsPort(80) || !karlstad.AcceptsPort(443) || karlstad.AcceptsPort(22) {
+		t.Error("Unexpected port policy evaluation.")
+	}
+
+	status := &RouterStatus{Accept: false, PortList: "25,119,135-139,445"}
+	for port, expected := range map[uint16]bool{25: false, 137: false, 80: true, 65535: true} {
+		if status.AcceptsPort(port) != expected {
+			t.Errorf("Expected %t for port %d.", expected, port)
+		}
+	}
+	if (&RouterStatus{}).AcceptsPort(80) {
+		t.Error("Status without port policy accepts port.")
+	}
+
+	md := &Microdescriptor{Accept: true, PortList: "80,443"}
+	if !md.AcceptsPort(443) || md.AcceptsPort(22) || (&Microdescriptor{}).AcceptsPort(80) {
+		t.Error("Unexpected microdescriptor port policy evaluation.")
+	}
+}
+
+// Test the method AcceptsPort() of exit policies and descriptors.
+func TestExitPolicyAcceptsPort(t *testing.T) {
+
+	policy, err := ParseExitPolicy("reject 10.0.0.0/8:*\nreject *:25\naccept 1.2.3.4:22\naccept *:80-443\nreject *:*\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for port, expected := range map[uint16]bool{25: false, 22: true, 80: true, 443: true, 8080: false} {
+		if policy.AcceptsPort(port) != expected {
+			t.Errorf("Expected %t for port %d.", expected, port)
+		}
+	}
+
+	// Rejecting both halves of the IPv4 address space leaves no address.
+	policy, _ = ParseExitPolicy("reject 0.0.0.0/1:25\nreject 128.0.0.0/1:25\naccept 8.8.8.0/24:25\nreject *:*\n")
+	if policy.AcceptsPort(25) {
+		t.Error("Policy that rejects all addresses accepts port.")
+	}
+	policy, _ = ParseExitPolicy("reject 0.0.0.0/1:25\naccept *4:25\nreject *:*\n")
+	if !policy.AcceptsPort(25) {
+		t.Error("Policy that accepts the upper half of the address space rejects port.")
+	}
+
+	desc := NewRouterDescriptor()
+	desc.ExitPolicy = *policy
+	desc.Accept6, desc.PortList6 = true, "22"
+	if !desc.AcceptsPort(25) || !desc.AcceptsPort(22) || desc.AcceptsPort(80) {
+		t.Error("Unexpected descriptor port evaluation.")
+	}
+}
+
+// Test IPv6 exit policies of descriptors.
+func TestDescriptorIPv6Policy(t *testing.T) {
+
+	raw := `router foo 1.2.3.4 9001 0 0
+reject6 [2001:db8::]/32:*
+accept6 *:22
+ipv6-policy accept 80,443
+reject *:*
+`
+	_, getDescriptor, err := ParseRawDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := getDescriptor()
+	if !desc.Accept6 || desc.PortList6 != "80,443" {
+		t.Error("Unexpected IPv6 policy.", desc.Accept6, desc.PortList6)
+	}
+	if !desc.AcceptsIPv6Port(443) || desc.AcceptsIPv6Port(22) {
+		t.Error("Unexpected IPv6 port policy evaluation.")
+	}
+	if len(desc.ExitPolicy.Rules) != 3 || len(desc.Accept) != 1 || len(desc.Reject) != 2 {
+		t.Fatal("Unexpected exit policy.", desc.ExitPolicy)
+	}
+
+	// The "accept6" and "reject6" rules only cover IPv6 addresses.
+	policy := desc.ExitPolicy
+	if !policy.CanExitTo(net.ParseIP("2001:db9::1"), 22) || policy.CanExitTo(net.ParseIP("2001:db8::1"), 22) ||
+		policy.CanExitTo(net.ParseIP("8.8.8.8"), 22) {
+		t.Error("Unexpected IPv6 exit policy evaluation.")
+	}
+
+	// The summary takes precedence for IPv6 destinations.
+	if !desc.CanExitTo(net.ParseIP("2001:db8::1"), 80) || desc.CanExitTo(net.ParseIP("2001:db9::1"), 22) ||
+		desc.CanExitTo(net.ParseIP("8.8.8.8"), 80) {
+		t.Error("Unexpected descriptor exit evaluation.")
+	}
+
+	// Malformed "ipv6-policy" lines are only rejected by strict parsing.
+	for _, line := range []string{"ipv6-policy allow 80", "ipv6-policy accept"} {
+		raw := "router foo 1.2.3.4 9001 0 0\n" + line + "\n"
+		_, getDescriptor, err := ParseRawDescriptor(raw)
+		if err != nil {
+			t.Errorf("Malformed line %q was rejected outside of strict mode: %v", line, err)
+			continue
+		}
+		if desc := getDescriptor(); desc.Accept6 || desc.PortList6 != "" {
+			t.Errorf("Malformed line %q was not ignored.", line)
+		}
+		if err := strictlyParseRawDescriptor(raw); err == nil {
+			t.Errorf("Malformed line %q was accepted in strict mode.", line)
+		}
+	}
+	if p, err := ParseExitPolicy("accept6 *:80\nreject *:*"); err != nil || p.CanExitTo(net.ParseIP("8.8.8.8"), 80) ||
+		!p.CanExitTo(net.ParseIP("2001:db8::1"), 80) {
+		t.Error("Unexpected IPv6 rule of parsed exit policy.")
+	}
+}
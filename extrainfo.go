@@ -0,0 +1,363 @@
+// Parses files containing sanitized bridge extra-info descriptors.
+
+package zoossh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var bridgeExtraInfoAnnotations = map[Annotation]bool{
+	// The file format we currently (try to) support.
+	Annotation{"bridge-extra-info", "1", "3"}: true,
+}
+
+type GetBridgeExtraInfo func() *BridgeExtraInfo
+
+// A sanitized bridge extra-info descriptor as archived by CollecTor.  See
+// dir-spec.txt, Section 2.1.2, for the unsanitized format.
+type BridgeExtraInfo struct {
+
+	// The single fields of an "extra-info" line.  The fingerprint is the
+	// hashed fingerprint of the bridge.
+	Nickname    string
+	Fingerprint Fingerprint
+
+	// The single fields of a "published" line.
+	Published time.Time
+
+	// The names of the pluggable transports of "transport" lines, e.g.,
+	// "obfs4" or "snowflake".  Sanitized descriptors lack the transports'
+	// addresses and arguments.
+	Transports []string
+
+	// The end and length of the measurement interval of the
+	// "bridge-stats-end" line.
+	BridgeStatsEnd      time.Time
+	BridgeStatsInterval time.Duration
+
+	// Unique client IP addresses by country code, IP version, and transport
+	// of the "bridge-ips", "bridge-ip-versions", and "bridge-ip-transports"
+	// lines.  Bridges round these numbers up to multiples of 8.
+	BridgeIPs          map[string]uint64
+	BridgeIPVersions   map[string]uint64
+	BridgeIPTransports map[string]uint64
+
+	// Unique directory request IP addresses by country code of the
+	// "dirreq-v3-ips" line.
+	DirreqV3IPs map[string]uint64
+
+	// The digests of the "router-digest" and "router-digest-sha256" lines,
+	// which refer to the extra-info descriptor itself.
+	RouterDigest       string
+	RouterDigestSHA256 string
+}
+
+type BridgeExtraInfos struct {
+
+	// A map from hashed bridge fingerprint to a function which returns the
+	// extra-info descriptor.
+	BridgeExtraInfos map[Fingerprint]GetBridgeExtraInfo
+}
+
+// String implements the String as well as the Object interface.  It returns
+// the extra-info descriptor's string representation.
+func (ei *BridgeExtraInfo) String() string {
+
+	return fmt.Sprintf("%s,%s,%s,%s",
+		ei.Fingerprint,
+		ei.Nickname,
+		ei.Published.Format(publishedTimeLayout),
+		strings.Join(ei.Transports, " "))
+}
+
+// GetFingerprint implements the Object interface.  It returns the bridge's
+// hashed fingerprint.
+func (ei *BridgeExtraInfo) GetFingerprint() Fingerprint {
+
+	return ei.Fingerprint
+}
+
+// NewBridgeExtraInfos serves as a constructor and returns a pointer to a
+// freshly allocated and empty BridgeExtraInfos struct.
+func NewBridgeExtraInfos() *BridgeExtraInfos {
+
+	return &BridgeExtraInfos{BridgeExtraInfos: make(map[Fingerprint]GetBridgeExtraInfo)}
+}
+
+// NewBridgeExtraInfo serves as a constructor and returns a pointer to a
+// freshly allocated and empty BridgeExtraInfo struct.
+func NewBridgeExtraInfo() *BridgeExtraInfo {
+
+	return &BridgeExtraInfo{
+		BridgeIPs:          make(map[string]uint64),
+		BridgeIPVersions:   make(map[string]uint64),
+		BridgeIPTransports: make(map[string]uint64),
+		DirreqV3IPs:        make(map[string]uint64),
+	}
+}
+
+// Get returns the extra-info descriptor for the given hashed fingerprint and
+// a boolean value indicating if the descriptor could be found.
+func (eis *BridgeExtraInfos) Get(fingerprint Fingerprint) (*BridgeExtraInfo, bool) {
+
+	getExtraInfo, exists := eis.BridgeExtraInfos[SanitiseFingerprint(fingerprint)]
+	if !exists {
+		return nil, exists
+	}
+
+	return getExtraInfo(), exists
+}
+
+// Set adds a new fingerprint mapping to a function returning the extra-info
+// descriptor.
+func (eis *BridgeExtraInfos) Set(fingerprint Fingerprint, ei *BridgeExtraInfo) {
+
+	eis.BridgeExtraInfos[SanitiseFingerprint(fingerprint)] = func() *BridgeExtraInfo { return ei }
+}
+
+// Length implements the ObjectSet interface.  It returns the number of
+// extra-info descriptors.
+func (eis *BridgeExtraInfos) Length() int {
+
+	return len(eis.BridgeExtraInfos)
+}
+
+// Iterate implements the ObjectSet interface.  Using a channel, it iterates
+// over and returns all extra-info descriptors.  The given object filter can be
+// used to filter descriptors by fingerprint or nickname.
+func (eis *BridgeExtraInfos) Iterate(filter *ObjectFilter) <-chan Object {
+
+	ch := make(chan Object)
+
+	go func() {
+		for _, getExtraInfo := range eis.BridgeExtraInfos {
+			ei := getExtraInfo()
+			if filter == nil || filter.IsEmpty() ||
+				(!filter.hasRequirements() && (filter.HasFingerprint(ei.Fingerprint) || filter.MatchesNickname(ei.Nickname))) {
+				ch <- ei
+			}
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// GetObject implements the ObjectSet interface.  It returns the object
+// identified by the given hashed fingerprint and a boolean value indicating
+// if the object could be found.
+func (eis *BridgeExtraInfos) GetObject(fingerprint Fingerprint) (Object, bool) {
+
+	return eis.Get(fingerprint)
+}
+
+// Contains implements the ObjectSet interface.  It returns true if the
+// object set contains the given hashed fingerprint.
+func (eis *BridgeExtraInfos) Contains(fingerprint Fingerprint) bool {
+
+	_, exists := eis.BridgeExtraInfos[SanitiseFingerprint(fingerprint)]
+	return exists
+}
+
+// Merge implements the ObjectSet interface.  Extra-info descriptors of the
+// given set replace older descriptors of the same bridge.
+func (eis *BridgeExtraInfos) Merge(objs ObjectSet) {
+
+	for obj := range objs.Iterate(nil) {
+		ei, ok := obj.(*BridgeExtraInfo)
+		if !ok {
+			continue
+		}
+		existing, exists := eis.Get(ei.Fingerprint)
+		if !exists || existing.Published.Before(ei.Published) {
+			eis.Set(ei.Fingerprint, ei)
+		}
+	}
+}
+
+// parseCounts parses comma-separated key-value pairs with numeric values,
+// e.g., "us=8,ru=16" of a "bridge-ips" line.
+func parseCounts(s string) (map[string]uint64, error) {
+
+	counts := make(map[string]uint64)
+	if s == "" {
+		return counts, nil
+	}
+
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.LastIndex(kv, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("malformed count %q", kv)
+		}
+		count, err := strconv.ParseUint(kv[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed count %q", kv)
+		}
+		counts[kv[:i]] = count
+	}
+
+	return counts, nil
+}
+
+// parseStatsEnd parses the time and interval of a statistics line such as
+// "bridge-stats-end 2016-06-30 14:41:18 (86400 s)".
+func parseStatsEnd(words []string) (time.Time, time.Duration, error) {
+
+	if len(words) < 5 {
+		return time.Time{}, 0, fmt.Errorf("malformed line %q", strings.Join(words, " "))
+	}
+
+	end, err := time.Parse(publishedTimeLayout, strings.Join(words[1:3], " "))
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	seconds, err := strconv.ParseUint(strings.TrimPrefix(words[3], "("), 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("malformed interval in line %q", strings.Join(words, " "))
+	}
+
+	return end, time.Duration(seconds) * time.Second, nil
+}
+
+// ParseRawBridgeExtraInfo parses a raw sanitized bridge extra-info descriptor
+// (in string format) and returns the bridge's hashed fingerprint, a function
+// returning the descriptor, and an error if the descriptor could not be
+// parsed.
+func ParseRawBridgeExtraInfo(rawExtraInfo string) (Fingerprint, GetBridgeExtraInfo, error) {
+
+	var err error
+	ei := NewBridgeExtraInfo()
+
+	for _, line := range strings.Split(rawExtraInfo, "\n") {
+
+		words := strings.Split(line, " ")
+		value := ""
+		if len(words) > 1 {
+			value = words[1]
+		}
+
+		switch words[0] {
+
+		case "extra-info":
+			if len(words) != 3 {
+				return "", nil, fmt.Errorf("malformed line %q", line)
+			}
+			ei.Nickname = words[1]
+			ei.Fingerprint = SanitiseFingerprint(Fingerprint(words[2]))
+
+		case "published":
+			ei.Published, err = time.Parse(publishedTimeLayout, strings.Join(words[1:], " "))
+
+		case "transport":
+			if value != "" {
+				ei.Transports = append(ei.Transports, value)
+			}
+
+		case "bridge-stats-end":
+			ei.BridgeStatsEnd, ei.BridgeStatsInterval, err = parseStatsEnd(words)
+
+		case "bridge-ips":
+			ei.BridgeIPs, err = parseCounts(value)
+
+		case "bridge-ip-versions":
+			ei.BridgeIPVersions, err = parseCounts(value)
+
+		case "bridge-ip-transports":
+			ei.BridgeIPTransports, err = parseCounts(value)
+
+		case "dirreq-v3-ips":
+			ei.DirreqV3IPs, err = parseCounts(value)
+
+		case "router-digest":
+			ei.RouterDigest = value
+
+		case "router-digest-sha256":
+			ei.RouterDigestSHA256 = value
+		}
+
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if ei.Fingerprint == "" {
+		return "", nil, fmt.Errorf("missing \"extra-info\" line")
+	}
+
+	return ei.Fingerprint, func() *BridgeExtraInfo { return ei }, nil
+}
+
+// extractBridgeExtraInfo is a bufio.SplitFunc that extracts individual
+// extra-info descriptors, each of which starts with an "extra-info" line.
+func extractBridgeExtraInfo(data []byte, atEOF bool) (advance int, token []byte, err error) {
+
+	return splitAtKeyword(data, atEOF, "extra-info")
+}
+
+// parseBridgeExtraInfoUnchecked parses sanitized bridge extra-info
+// descriptors.  The input should be without a type annotation; i.e., the type
+// annotation should already have been read and checked to be the correct
+// type.
+func parseBridgeExtraInfoUnchecked(r io.Reader, opts parseOptions) (*BridgeExtraInfos, error) {
+
+	eis := NewBridgeExtraInfos()
+
+	// We will read raw extra-info descriptors from this channel.
+	queue := make(chan QueueUnit)
+	go DissectFile(r, extractBridgeExtraInfo, queue)
+
+	for unit := range queue {
+		if unit.Err != nil {
+			return nil, unit.Err
+		}
+		if opts.prefilter != nil && !opts.prefilter(unit.Blurb) {
+			continue
+		}
+
+		fingerprint, getExtraInfo, err := ParseRawBridgeExtraInfo(unit.Blurb)
+		if err != nil {
+			return nil, err
+		}
+		eis.BridgeExtraInfos[fingerprint] = getExtraInfo
+	}
+
+	return eis, nil
+}
+
+// parseBridgeExtraInfo is a wrapper around parseBridgeExtraInfoUnchecked that
+// first reads and checks the type annotation to make sure it belongs to
+// bridgeExtraInfoAnnotations.
+func parseBridgeExtraInfo(r io.Reader, opts parseOptions) (*BridgeExtraInfos, error) {
+
+	_, r, err := readAndCheckAnnotation(r, bridgeExtraInfoAnnotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseBridgeExtraInfoUnchecked(r, opts)
+}
+
+// ParseRawBridgeExtraInfos parses raw sanitized bridge extra-info descriptors
+// (in string format), which must start with a type annotation.
+func ParseRawBridgeExtraInfos(rawExtraInfos string) (*BridgeExtraInfos, error) {
+
+	return parseBridgeExtraInfo(strings.NewReader(rawExtraInfos), parseOptions{})
+}
+
+// ParseBridgeExtraInfoFile parses the given file and returns a pointer to
+// BridgeExtraInfos containing the sanitized bridge extra-info descriptors.
+func ParseBridgeExtraInfoFile(fileName string) (*BridgeExtraInfos, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseBridgeExtraInfo(fd, parseOptions{})
+}
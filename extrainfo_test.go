@@ -0,0 +1,85 @@
+// Tests functions from "extrainfo.go".
+
+package zoossh
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBridgeExtraInfo = `@type bridge-extra-info 1.3
+extra-info MeekGoogle 88F745840F47CE0C6A4FE61D827950B06F9E4534
+master-key-ed25519 Y9pvwYdZ0bJ4WKmH9bbMz0gLPcX7fbj3uGNIgeTvDCs
+published 2016-06-30 21:43:52
+write-history 2016-06-30 18:40:48 (14400 s) 3274752,2672640
+geoip-db-digest 6346E26E2BC96F8511588CE2695E9B0339A75D32
+dirreq-stats-end 2016-06-30 14:40:48 (86400 s)
+dirreq-v3-ips us=16,ru=8
+transport obfs4
+transport snowflake
+bridge-stats-end 2016-06-30 14:41:18 (86400 s)
+bridge-ips ca=8,us=8,??=16
+bridge-ip-versions v4=24,v6=0
+bridge-ip-transports <OR>=8,obfs4=16
+router-digest-sha256 2Hw8RXEn8Di8UNJvDn1C5ICfy3B0PpMOu9ueTN3mWeo
+router-digest 00B3A2F8E6BDC7F3B32D7A4A4CE3D0E1AD1A27C5
+extra-info Unnamed 0011BD2485AD45D984EC4159C88FC066E5E3300E
+published 2016-06-30 11:12:35
+router-digest 0BFD97F25E6A53B5D23AB2E14DEE3BA7AC2A78A9
+`
+
+func TestParseBridgeExtraInfos(t *testing.T) {
+
+	eis, err := ParseRawBridgeExtraInfos(testBridgeExtraInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eis.Length() != 2 {
+		t.Fatalf("Expected 2 extra-info descriptors but got %d.", eis.Length())
+	}
+
+	ei, found := eis.Get("88f745840f47ce0c6a4fe61d827950b06f9e4534")
+	if !found {
+		t.Fatal("Failed to find extra-info descriptor.")
+	}
+	if ei.Nickname != "MeekGoogle" || ei.Published != time.Date(2016, 6, 30, 21, 43, 52, 0, time.UTC) {
+		t.Error("Unexpected extra-info line or publication time.", ei)
+	}
+	if strings.Join(ei.Transports, ",") != "obfs4,snowflake" {
+		t.Errorf("Unexpected transports %v.", ei.Transports)
+	}
+	if ei.BridgeStatsInterval != Day || ei.BridgeStatsEnd != time.Date(2016, 6, 30, 14, 41, 18, 0, time.UTC) {
+		t.Error("Unexpected bridge statistics interval.")
+	}
+	if ei.BridgeIPs["us"] != 8 || ei.BridgeIPs["??"] != 16 || len(ei.BridgeIPs) != 3 {
+		t.Errorf("Unexpected bridge IPs %v.", ei.BridgeIPs)
+	}
+	if ei.BridgeIPVersions["v4"] != 24 || ei.BridgeIPTransports["obfs4"] != 16 || ei.BridgeIPTransports["<OR>"] != 8 {
+		t.Error("Unexpected bridge IP versions or transports.")
+	}
+	if ei.DirreqV3IPs["us"] != 16 || ei.RouterDigest != "00B3A2F8E6BDC7F3B32D7A4A4CE3D0E1AD1A27C5" {
+		t.Error("Unexpected directory request IPs or router digest.")
+	}
+
+	ei, _ = eis.Get("0011BD2485AD45D984EC4159C88FC066E5E3300E")
+	if ei.Nickname != "Unnamed" || len(ei.Transports) != 0 || len(ei.BridgeIPs) != 0 {
+		t.Error("Unexpected extra-info descriptor without statistics.", ei)
+	}
+
+	objs, err := ParseUnknown(strings.NewReader(testBridgeExtraInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objs.(*BridgeExtraInfos); !ok {
+		t.Errorf("Expected bridge extra-info descriptors but got %T.", objs)
+	}
+}
+
+func TestParseMalformedBridgeExtraInfo(t *testing.T) {
+
+	malformed := strings.Replace(testBridgeExtraInfo, "bridge-ips ca=8", "bridge-ips ca", 1)
+	if _, err := ParseRawBridgeExtraInfos(malformed); err == nil {
+		t.Error("Expected error for malformed bridge-ips line.")
+	}
+}
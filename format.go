@@ -0,0 +1,111 @@
+// Provides template-based pretty printing of objects.
+
+package zoossh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+)
+
+// Parsing templates is expensive compared to executing them, so we keep
+// every layout we have seen around.
+var templateCache sync.Map
+
+// Column describes a single column of a table written by WriteTable.  The
+// layout is a text/template that is executed with the object as its data,
+// e.g., "{{.Nickname}}".
+type Column struct {
+	Header string
+	Layout string
+}
+
+// getTemplate returns the parsed template for the given layout.
+func getTemplate(layout string) (*template.Template, error) {
+
+	if tmpl, ok := templateCache.Load(layout); ok {
+		return tmpl.(*template.Template), nil
+	}
+
+	tmpl, err := template.New("object").Option("missingkey=error").Parse(layout)
+	if err != nil {
+		return nil, err
+	}
+	templateCache.Store(layout, tmpl)
+
+	return tmpl, nil
+}
+
+// RenderObject renders the given object using the given text/template layout.
+// The object's exported fields and methods are available by name, e.g.,
+// "{{.Nickname}} {{.Fingerprint}}".
+func RenderObject(obj Object, layout string) (string, error) {
+
+	tmpl, err := getTemplate(layout)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, obj); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// Render renders the router status using the given text/template layout.
+func (s *RouterStatus) Render(layout string) (string, error) {
+
+	return RenderObject(s, layout)
+}
+
+// Render renders the router descriptor using the given text/template layout.
+func (rd *RouterDescriptor) Render(layout string) (string, error) {
+
+	return RenderObject(rd, layout)
+}
+
+// WriteTable writes all objects of the given object set that pass the given
+// filter to w as a human-readable table with the given columns.  Rows are
+// sorted by fingerprint.
+func WriteTable(w io.Writer, objs ObjectSet, filter *ObjectFilter, columns []Column) error {
+
+	var objects []Object
+	for obj := range objs.Iterate(filter) {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].GetFingerprint() < objects[j].GetFingerprint()
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	for i, column := range columns {
+		if i > 0 {
+			fmt.Fprint(tw, "\t")
+		}
+		fmt.Fprint(tw, column.Header)
+	}
+	fmt.Fprintln(tw)
+
+	for _, obj := range objects {
+		for i, column := range columns {
+			cell, err := RenderObject(obj, column.Layout)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, cell)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,73 @@
+// Tests functions from "format.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Test the function Render().
+func TestRender(t *testing.T) {
+
+	_, getStatus, err := ParseRawStatus(`r Karlstad0 m5TNC3uAV+ryG6fwI7ehyMqc5kU f1g9KQhgS0r6+H/7dzAJOpi6lG8 2014-12-08 06:57:54 193.11.166.194 9000 80
+s Fast Guard HSDir Running Stable V2Dir Valid
+v Tor 0.2.4.23
+w Bandwidth=2670
+p reject 1-65535`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := getStatus()
+
+	s, err := status.Render("{{.Nickname}} {{.Address.IPv4ORPort}} {{.Publication.Year}} {{.Flags}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "Karlstad0 9000 2014 Fast|Guard|HSDir|Stable|Running|Valid|V2Dir" {
+		t.Errorf("Unexpected rendering: %q", s)
+	}
+
+	if _, err := status.Render("{{.NoSuchField}}"); err == nil {
+		t.Error("Rendering unknown field did not raise an error.")
+	}
+	if _, err := status.Render("{{"); err == nil {
+		t.Error("Rendering malformed layout did not raise an error.")
+	}
+
+	desc := NewRouterDescriptor()
+	desc.Nickname = "foo"
+	if s, err := desc.Render("{{.Nickname}}"); err != nil || s != "foo" {
+		t.Errorf("Unexpected descriptor rendering: %q", s)
+	}
+}
+
+// Test the function WriteTable().
+func TestWriteTable(t *testing.T) {
+
+	consensus := NewConsensus()
+	consensus.Set("BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB",
+		&RouterStatus{Fingerprint: "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB", Nickname: "second", Bandwidth: 20})
+	consensus.Set("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+		&RouterStatus{Fingerprint: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", Nickname: "first-relay", Bandwidth: 10})
+
+	var buf bytes.Buffer
+	err := WriteTable(&buf, consensus, nil, []Column{
+		{"NICKNAME", "{{.Nickname}}"},
+		{"BANDWIDTH", "{{.Bandwidth}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"NICKNAME     BANDWIDTH",
+		"first-relay  10",
+		"second       20",
+		"",
+	}, "\n")
+	if buf.String() != expected {
+		t.Errorf("Unexpected table:\n%s", buf.String())
+	}
+}
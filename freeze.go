@@ -0,0 +1,160 @@
+// Provides immutable views of object sets.
+
+package zoossh
+
+import (
+	"net"
+)
+
+// copyIP returns a copy of the given IP address.
+func copyIP(ip net.IP) net.IP {
+
+	if ip == nil {
+		return nil
+	}
+
+	return append(net.IP(nil), ip...)
+}
+
+// Copy returns a deep copy of the router status.
+func (s *RouterStatus) Copy() *RouterStatus {
+
+	c := *s
+	c.Address.IPv4Address = copyIP(s.Address.IPv4Address)
+	c.Address.IPv6Address = copyIP(s.Address.IPv6Address)
+
+	if s.MicrodescDigests != nil {
+		c.MicrodescDigests = make(map[int]string, len(s.MicrodescDigests))
+		for method, digest := range s.MicrodescDigests {
+			c.MicrodescDigests[method] = digest
+		}
+	}
+	if s.UnknownLines != nil {
+		c.UnknownLines = append([]string(nil), s.UnknownLines...)
+	}
+
+	return &c
+}
+
+// Copy returns a deep copy of the router descriptor.
+func (rd *RouterDescriptor) Copy() *RouterDescriptor {
+
+	c := *rd
+	c.Address = copyIP(rd.Address)
+
+	if rd.ORAddresses != nil {
+		c.ORAddresses = make([]Endpoint, len(rd.ORAddresses))
+		for i, endpoint := range rd.ORAddresses {
+			c.ORAddresses[i] = Endpoint{copyIP(endpoint.IP), endpoint.Port}
+		}
+	}
+
+	c.Family = make(map[Fingerprint]bool, len(rd.Family))
+	for fpr, v := range rd.Family {
+		c.Family[fpr] = v
+	}
+
+	copyPatterns := func(patterns []*ExitPattern) []*ExitPattern {
+		if patterns == nil {
+			return nil
+		}
+		copied := make([]*ExitPattern, len(patterns))
+		for i, pattern := range patterns {
+			copied[i] = copyExitPattern(pattern)
+		}
+		return copied
+	}
+	c.Accept = copyPatterns(rd.Accept)
+	c.Reject = copyPatterns(rd.Reject)
+
+	if rd.ExitPolicy.Rules != nil {
+		c.ExitPolicy.Rules = make([]ExitRule, len(rd.ExitPolicy.Rules))
+		for i, rule := range rd.ExitPolicy.Rules {
+			c.ExitPolicy.Rules[i] = ExitRule{rule.Accept, copyExitPattern(rule.Pattern)}
+		}
+	}
+
+	if rd.UnknownLines != nil {
+		c.UnknownLines = append([]string(nil), rd.UnknownLines...)
+	}
+
+	return &c
+}
+
+// copyExitPattern returns a copy of the given exit pattern.
+func copyExitPattern(pattern *ExitPattern) *ExitPattern {
+
+	p := *pattern
+	if pattern.Network != nil {
+		p.Network = &net.IPNet{IP: copyIP(pattern.Network.IP), Mask: append(net.IPMask(nil), pattern.Network.Mask...)}
+	}
+
+	return &p
+}
+
+// Freeze makes the consensus immutable.  Afterwards, Set, Remove, RemoveIf,
+// Merge, and AttachDescriptors panic, and Get, Iterate, and all other
+// accessors return copies of router statuses, so callers cannot modify
+// statuses that others share.  Frozen consensuses are safe for concurrent use
+// by readers.  Note that the RouterStatuses map itself must not be modified
+// directly.
+func (c *Consensus) Freeze() {
+
+	if c.frozen {
+		return
+	}
+
+	for fingerprint, getStatus := range c.RouterStatuses {
+		getStatus := getStatus
+		c.RouterStatuses[fingerprint] = func() *RouterStatus {
+			return getStatus().Copy()
+		}
+	}
+	c.frozen = true
+}
+
+// IsFrozen returns true if the consensus was frozen.
+func (c *Consensus) IsFrozen() bool {
+
+	return c.frozen
+}
+
+func (c *Consensus) mustNotBeFrozen() {
+
+	if c.frozen {
+		panic("zoossh: modification of frozen consensus")
+	}
+}
+
+// Freeze makes the router descriptors immutable.  Afterwards, Set and Merge
+// panic, and Get, Iterate, and all other accessors return copies of router
+// descriptors, so callers cannot modify descriptors that others share.
+// Frozen sets are safe for concurrent use by readers.  Note that the
+// RouterDescriptors map itself must not be modified directly.
+func (rds *RouterDescriptors) Freeze() {
+
+	if rds.frozen {
+		return
+	}
+
+	for fingerprint, getDescriptor := range rds.RouterDescriptors {
+		getDescriptor := getDescriptor
+		rds.RouterDescriptors[fingerprint] = func() *RouterDescriptor {
+			return getDescriptor().Copy()
+		}
+	}
+	rds.frozen = true
+}
+
+// IsFrozen returns true if the router descriptors were frozen.
+func (rds *RouterDescriptors) IsFrozen() bool {
+
+	return rds.frozen
+}
+
+func (rds *RouterDescriptors) mustNotBeFrozen() {
+
+	if rds.frozen {
+		panic("zoossh: modification of frozen router descriptors")
+	}
+}
@@ -0,0 +1,73 @@
+// Tests functions from "freeze.go".
+
+package zoossh
+
+import (
+	"testing"
+)
+
+// mustPanic fails the test if the given function does not panic.
+func mustPanic(t *testing.T, what string, f func()) {
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s did not panic.", what)
+		}
+	}()
+	f()
+}
+
+func TestFreezeConsensus(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpr := Fingerprint("000A10D43011EA4928A35F610405F92B4433B4DC")
+
+	vote.Freeze()
+	if !vote.IsFrozen() {
+		t.Fatal("Consensus is not frozen.")
+	}
+
+	status, _ := vote.Get(fpr)
+	status.Nickname = "mallory"
+	status.Address.IPv4Address[0] = 1
+	status, _ = vote.Get(fpr)
+	if status.Nickname != "seele" || status.Address.IPv4Address.String() != "73.15.150.172" {
+		t.Error("Modification of returned status leaked into frozen consensus.")
+	}
+
+	for obj := range vote.Exits().Iterate(nil) {
+		obj.(*RouterStatus).Nickname = "mallory"
+	}
+	if status, _ := vote.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"); status.Nickname != "Karlstad0" {
+		t.Error("Modification of iterated status leaked into frozen consensus.")
+	}
+
+	mustPanic(t, "Set", func() { vote.Set(fpr, &RouterStatus{}) })
+	mustPanic(t, "Merge", func() { vote.Merge(NewConsensus()) })
+	mustPanic(t, "AttachDescriptors", func() { vote.AttachDescriptors(NewRouterDescriptors()) })
+}
+
+func TestFreezeDescriptors(t *testing.T) {
+
+	desc := NewRouterDescriptor()
+	desc.Nickname = "foo"
+	desc.Family["AAAA"] = true
+	desc.Accept = []*ExitPattern{{AddressSpec: "*", PortSpec: "80"}}
+
+	descs := NewRouterDescriptors()
+	descs.Set("BBBB", desc)
+	descs.Freeze()
+
+	copied, _ := descs.Get("BBBB")
+	copied.Family["CCCC"] = true
+	copied.Accept[0].PortSpec = "443"
+	if len(desc.Family) != 1 || desc.Accept[0].PortSpec != "80" {
+		t.Error("Modification of returned descriptor leaked into frozen set.")
+	}
+
+	mustPanic(t, "Set", func() { descs.Set("BBBB", desc) })
+	mustPanic(t, "Merge", func() { descs.Merge(NewRouterDescriptors()) })
+}
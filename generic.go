@@ -3,10 +3,13 @@
 package zoossh
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"regexp"
 )
 
 // Fingerprint represents a relay's fingerprint as 40 hex digits.
@@ -24,15 +27,37 @@ type ObjectSet interface {
 	Length() int
 	Iterate(*ObjectFilter) <-chan Object
 	GetObject(Fingerprint) (Object, bool)
+	Contains(Fingerprint) bool
 	Merge(ObjectSet)
 }
 
 // ObjectFilter holds sets that consist of objects that should pass object set
-// filtering.
+// filtering.  An object passes if it matches any of the fingerprints, IP
+// addresses, nicknames, and nickname patterns, and if it meets all
+// requirements, i.e., required flags, version constraints, and exit ports.  If
+// the filter holds no fingerprints, IP addresses, nicknames, or nickname
+// patterns, only the requirements matter.
 type ObjectFilter struct {
-	Fingerprints map[Fingerprint]struct{}
-	IPAddrs      map[string]struct{}
-	Nicknames    map[string]struct{}
+	Fingerprints     map[Fingerprint]struct{}
+	IPAddrs          map[string]struct{}
+	Nicknames        map[string]struct{}
+	NicknamePatterns []*regexp.Regexp
+
+	// Flags holds the flags that an object must have.  Objects that have no
+	// flags, e.g., router descriptors, cannot pass a filter that requires
+	// flags.
+	Flags RouterFlags
+
+	// VersionConstraints holds the constraints that an object's Tor version
+	// must meet.  Objects without a Tor version cannot pass a filter with
+	// version constraints.
+	VersionConstraints []VersionConstraint
+
+	// ExitPorts holds the ports that an object's exit policy must allow
+	// exiting to.  Router statuses and microdescriptors are checked against
+	// their port policy summary, router descriptors against their exit
+	// policy.
+	ExitPorts []uint16
 }
 
 // HasFingerprint returns true if the given fingerprint is present in the
@@ -56,6 +81,44 @@ func (filter *ObjectFilter) HasNickname(nickname string) bool {
 	return exists
 }
 
+// MatchesNickname returns true if the given nickname is present in the
+// object filter or matches one of its nickname patterns.
+func (filter *ObjectFilter) MatchesNickname(nickname string) bool {
+
+	if filter.HasNickname(nickname) {
+		return true
+	}
+
+	for _, pattern := range filter.NicknamePatterns {
+		if pattern.MatchString(nickname) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasVersion returns true if the given Tor version, e.g., "0.4.5.6" or "Tor
+// 0.4.5.6", meets all version constraints of the object filter.
+func (filter *ObjectFilter) HasVersion(version string) bool {
+
+	if len(filter.VersionConstraints) == 0 {
+		return true
+	}
+
+	v, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, constraint := range filter.VersionConstraints {
+		if !constraint.Matches(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // AddFingerprint adds the given fingerprint to the object filter.
 func (filter *ObjectFilter) AddFingerprint(fpr Fingerprint) {
 	filter.Fingerprints[fpr] = struct{}{}
@@ -71,21 +134,130 @@ func (filter *ObjectFilter) AddNickname(nickname string) {
 	filter.Nicknames[nickname] = struct{}{}
 }
 
+// AddNicknamePattern adds the given regular expression to the object filter.
+// Nicknames match if the expression matches any part of them, so patterns
+// that should match entire nicknames must be anchored, e.g., "^Unnamed[0-9]+$".
+func (filter *ObjectFilter) AddNicknamePattern(pattern string) error {
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	filter.NicknamePatterns = append(filter.NicknamePatterns, re)
+
+	return nil
+}
+
+// AddVersionConstraint adds the given version constraint, e.g., "< 0.4.7", to
+// the object filter.  See ParseVersionConstraint for the syntax.
+func (filter *ObjectFilter) AddVersionConstraint(constraint string) error {
+
+	c, err := ParseVersionConstraint(constraint)
+	if err != nil {
+		return err
+	}
+	filter.VersionConstraints = append(filter.VersionConstraints, c)
+
+	return nil
+}
+
+// AddExitPort adds the given port to the ports that objects must allow
+// exiting to, e.g., 25 only lets relays pass that exit to SMTP servers.
+func (filter *ObjectFilter) AddExitPort(port uint16) {
+
+	filter.ExitPorts = append(filter.ExitPorts, port)
+}
+
+// exitsTo returns true if the given function accepts all exit ports that the
+// object filter requires.
+func (filter *ObjectFilter) exitsTo(acceptsPort func(uint16) bool) bool {
+
+	for _, port := range filter.ExitPorts {
+		if !acceptsPort(port) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequireFlags adds the given flags to the flags that objects must have to
+// pass the object filter, e.g., RouterFlags{Exit: true, Running: true} only
+// lets running exit relays pass.
+func (filter *ObjectFilter) RequireFlags(flags RouterFlags) {
+
+	required := flagFields(&filter.Flags)
+	for i, set := range flagFields(&flags) {
+		if *set {
+			*required[i] = true
+		}
+	}
+}
+
+// HasFlags returns true if the given flags include all flags that the object
+// filter requires.
+func (filter *ObjectFilter) HasFlags(flags RouterFlags) bool {
+
+	given := flagFields(&flags)
+	for i, required := range flagFields(&filter.Flags) {
+		if *required && !*given[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requiresFlags returns true if the object filter requires at least one flag.
+func (filter *ObjectFilter) requiresFlags() bool {
+
+	return filter.Flags != RouterFlags{}
+}
+
+// hasRequirements returns true if the object filter holds criteria that all
+// objects must meet, i.e., required flags, version constraints, or exit
+// ports.
+func (filter *ObjectFilter) hasRequirements() bool {
+
+	return filter.requiresFlags() ||
+		len(filter.VersionConstraints) != 0 ||
+		len(filter.ExitPorts) != 0
+}
+
+// hasIdentities returns true if the object filter holds fingerprints, IP
+// addresses, nicknames, or nickname patterns.
+func (filter *ObjectFilter) hasIdentities() bool {
+
+	return len(filter.Fingerprints) != 0 ||
+		len(filter.IPAddrs) != 0 ||
+		len(filter.Nicknames) != 0 ||
+		len(filter.NicknamePatterns) != 0
+}
+
+// hasOnlyFingerprints returns true if fingerprints are the object filter's
+// only criteria, so objects can be looked up rather than matched.
+func (filter *ObjectFilter) hasOnlyFingerprints() bool {
+
+	return len(filter.Fingerprints) != 0 &&
+		len(filter.IPAddrs) == 0 &&
+		len(filter.Nicknames) == 0 &&
+		len(filter.NicknamePatterns) == 0 &&
+		!filter.hasRequirements()
+}
+
 // IsEmpty returns true if the object filter is empty.
 func (filter *ObjectFilter) IsEmpty() bool {
 
-	return len(filter.Fingerprints) == 0 &&
-		len(filter.IPAddrs) == 0 &&
-		len(filter.Nicknames) == 0
+	return !filter.hasIdentities() && !filter.hasRequirements()
 }
 
 // NewObjectFilter returns a newly allocated object filter instance.
 func NewObjectFilter() *ObjectFilter {
 
 	return &ObjectFilter{
-		make(map[Fingerprint]struct{}),
-		make(map[string]struct{}),
-		make(map[string]struct{}),
+		Fingerprints: make(map[Fingerprint]struct{}),
+		IPAddrs:      make(map[string]struct{}),
+		Nicknames:    make(map[string]struct{}),
 	}
 }
 
@@ -93,34 +265,78 @@ func NewObjectFilter() *ObjectFilter {
 // annotation.  The input should not have an annotation of its own (it should
 // already have been read).  Returns an error if the annotation is of an unknown
 // type.  Otherwise, returns the output of the chosen parser.
-func parseWithAnnotation(r io.Reader, annotation *Annotation) (ObjectSet, error) {
+func parseWithAnnotation(r io.Reader, annotation *Annotation, opts parseOptions) (ObjectSet, error) {
 
 	// Use the annotation to find the right parser.
+	opts.annotation = annotation
 	if _, ok := descriptorAnnotations[*annotation]; ok {
-		return parseDescriptorUnchecked(r, false)
+		return parseDescriptorUnchecked(r, opts)
 	}
 
 	if _, ok := consensusAnnotations[*annotation]; ok {
-		return parseConsensusUnchecked(r, false, true)
+		opts.strict = !opts.tolerant
+		return parseConsensusUnchecked(r, opts)
+	}
+
+	if _, ok := voteAnnotations[*annotation]; ok {
+		opts.strict = !opts.tolerant
+		return parseConsensusUnchecked(r, opts)
 	}
 
 	if _, ok := bridgeNetworkStatusAnnotations[*annotation]; ok {
-		return parseConsensusUnchecked(r, false, false)
+		return parseConsensusUnchecked(r, opts)
+	}
+
+	if _, ok := microdescriptorAnnotations[*annotation]; ok {
+		return parseMicrodescriptorUnchecked(r, opts)
+	}
+
+	if _, ok := bridgeExtraInfoAnnotations[*annotation]; ok {
+		return parseBridgeExtraInfoUnchecked(r, opts)
 	}
 
 	return nil, fmt.Errorf("could not find suitable parser")
 }
 
+// parseWithoutAnnotation determines the document type by looking at the
+// first keyword of the given input, which lacks a type annotation.
+// Network status documents are parsed leniently because we cannot tell a
+// consensus from a vote or a bridge network status beforehand.  The
+// consensus flavour is determined from the "network-status-version" line.
+func parseWithoutAnnotation(br *bufio.Reader, opts parseOptions) (ObjectSet, error) {
+
+	first, _ := br.Peek(len("network-status-version"))
+
+	switch {
+	case bytes.HasPrefix(first, []byte("network-status-version")):
+		return parseConsensusUnchecked(br, opts)
+	case bytes.HasPrefix(first, []byte("router ")):
+		return parseDescriptorUnchecked(br, opts)
+	case bytes.HasPrefix(first, []byte("onion-key")), bytes.HasPrefix(first, []byte("ntor-onion-key")):
+		return parseMicrodescriptorUnchecked(br, opts)
+	case bytes.HasPrefix(first, []byte("extra-info ")):
+		return parseBridgeExtraInfoUnchecked(br, opts)
+	}
+
+	return nil, fmt.Errorf("could not determine document type")
+}
+
 // ParseUnknown first reads a type annotation and passes it along with the rest
-// of the input to parseWithAnnotation.
+// of the input to parseWithAnnotation.  If the input lacks a type annotation,
+// the document type is determined from its first keyword.
 func ParseUnknown(r io.Reader) (ObjectSet, error) {
 
-	annotation, r, err := readAnnotation(r)
+	br := bufio.NewReader(r)
+	if first, _ := br.Peek(1); len(first) == 1 && first[0] != '@' {
+		return parseWithoutAnnotation(br, parseOptions{})
+	}
+
+	header, r, err := readAnnotationHeader(br)
 	if err != nil {
 		return nil, err
 	}
 
-	return parseWithAnnotation(r, annotation)
+	return parseWithAnnotation(r, header.annotation, parseOptions{metadata: header.annotationMetadata()})
 }
 
 // ParseUnknownFile attempts to parse a file whose content we don't know.  We
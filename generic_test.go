@@ -5,6 +5,7 @@ package zoossh
 import (
 	"net"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -31,6 +32,87 @@ func TestParseUnknownFile(t *testing.T) {
 	}
 }
 
+// Test the function ParseUnknown() on documents without type annotation.
+func TestParseUnknownWithoutAnnotation(t *testing.T) {
+
+	microdescConsensus := `network-status-version 3 microdesc
+vote-status consensus
+valid-after 2021-03-05 01:00:00
+fresh-until 2021-03-05 02:00:00
+valid-until 2021-03-05 04:00:00
+dir-source moria1 D586D18309DED4CD6D57C18FDB97EFA96D330566 128.31.0.34 128.31.0.34 9131 9101
+r seele AAoQ1DAR6kkoo19hBAX5K0QztNw 2021-03-04 12:27:05 73.15.150.172 9001 0
+m 0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I
+s Fast Running Stable Valid
+w Bandwidth=18
+directory-footer
+`
+
+	objs, err := ParseUnknown(strings.NewReader(microdescConsensus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	consensus, ok := objs.(*Consensus)
+	if !ok {
+		t.Fatalf("Expected consensus but got %T.", objs)
+	}
+	if consensus.Flavour != FlavourMicrodesc {
+		t.Errorf("Expected flavour %q but got %q.", FlavourMicrodesc, consensus.Flavour)
+	}
+	status, found := consensus.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if !found {
+		t.Fatal("Failed to find router status in microdesc consensus.")
+	}
+	if status.Nickname != "seele" || status.Address.IPv4ORPort != 9001 ||
+		status.Address.IPv4Address.String() != "73.15.150.172" || status.Digest != "" {
+		t.Error("Unexpected microdesc router status.", status)
+	}
+
+	// Strip the annotation off our test vote, which is of flavour "ns".
+	vote := testVote[strings.Index(testVote, "\n")+1:]
+	objs, err = ParseUnknown(strings.NewReader(vote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus := objs.(*Consensus); consensus.Flavour != FlavourNS || consensus.Length() != 2 {
+		t.Error("Failed to parse vote without annotation.")
+	}
+
+	if _, err := ParseUnknown(strings.NewReader("foo\n")); err == nil {
+		t.Error("Unknown document type did not raise an error.")
+	}
+}
+
+// Test that ParseUnknown() exposes annotations other than the type annotation.
+func TestParseUnknownAnnotationMetadata(t *testing.T) {
+
+	raw := "@source 128.31.0.34\n@downloaded-at 2021-03-05 01:00:00\n" + testVote
+	objs, err := ParseUnknown(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := objs.(*Consensus).AnnotationMetadata
+	if metadata["source"] != "128.31.0.34" || metadata["downloaded-at"] != "2021-03-05 01:00:00" {
+		t.Error("Unexpected annotation metadata.", metadata)
+	}
+
+	objs, err = ParseUnknown(strings.NewReader(testVote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata := objs.(*Consensus).AnnotationMetadata; metadata != nil {
+		t.Error("Unexpected annotation metadata.", metadata)
+	}
+
+	consensus, err := ParseConsensus(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.AnnotationMetadata["source"] != "128.31.0.34" {
+		t.Error("Unexpected annotation metadata.", consensus.AnnotationMetadata)
+	}
+}
+
 func TestInterfaces(t *testing.T) {
 
 	testFingerprint := Fingerprint("9695DFC35FFEB861329B9F1AB04C46397020CE31")
@@ -126,6 +208,142 @@ func TestIsEmpty(t *testing.T) {
 	}
 }
 
+// Test the methods RequireFlags() and HasFlags() and filtering by flags.
+func TestFlagFiltering(t *testing.T) {
+
+	filter := NewObjectFilter()
+	filter.RequireFlags(RouterFlags{Exit: true})
+	filter.RequireFlags(RouterFlags{Running: true})
+	if filter.IsEmpty() {
+		t.Error("Filter with required flags apparently empty.")
+	}
+	if !filter.HasFlags(RouterFlags{Exit: true, Running: true, Valid: true}) ||
+		filter.HasFlags(RouterFlags{Exit: true}) {
+		t.Error("Unexpected result of checking required flags.")
+	}
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nicknames []string
+	for obj := range vote.Iterate(filter) {
+		nicknames = append(nicknames, obj.(*RouterStatus).Nickname)
+	}
+	if len(nicknames) != 1 || nicknames[0] != "Karlstad0" {
+		t.Errorf("Expected only Karlstad0 to pass the filter but got %v.", nicknames)
+	}
+
+	// Flags are required in addition to matching a nickname.
+	filter.AddNickname("seele")
+	if vote.Filter(filter).Length() != 0 {
+		t.Error("Router status without required flags passed the filter.")
+	}
+	filter.AddNickname("Karlstad0")
+	if vote.Filter(filter).Length() != 1 {
+		t.Error("Router status with required flags failed to pass the filter.")
+	}
+
+	if filter.MatchesRouterDescriptor(&RouterDescriptor{Nickname: "Karlstad0"}) {
+		t.Error("Router descriptor passed a filter that requires flags.")
+	}
+}
+
+// Test filtering by nickname patterns and version constraints.
+func TestPatternAndVersionFiltering(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := NewObjectFilter()
+	if err := filter.AddNicknamePattern("^Karlstad[0-9]+$"); err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.AddNicknamePattern("("); err == nil {
+		t.Error("Malformed nickname pattern was accepted.")
+	}
+	if filter.IsEmpty() || !filter.MatchesNickname("Karlstad12") || filter.MatchesNickname("Karlstad") {
+		t.Error("Unexpected result of matching nickname patterns.")
+	}
+	filtered := vote.Filter(filter)
+	if _, found := filtered.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"); !found || filtered.Length() != 1 {
+		t.Error("Bad filtering by nickname pattern.")
+	}
+
+	filter = NewObjectFilter()
+	if err := filter.AddVersionConstraint("< 0.4.5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.AddVersionConstraint("<= 0.4"); err == nil {
+		t.Error("Malformed version constraint was accepted.")
+	}
+	filtered = vote.Filter(filter)
+	if _, found := filtered.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"); !found || filtered.Length() != 1 {
+		t.Error("Bad filtering by version constraint.")
+	}
+
+	// Version constraints are required in addition to matching a nickname.
+	filter.AddNickname("seele")
+	if vote.Filter(filter).Length() != 0 {
+		t.Error("Router status with wrong version passed the filter.")
+	}
+
+	if !filter.HasVersion("Tor 0.4.4.7") || filter.HasVersion("0.4.5.6") || filter.HasVersion("") {
+		t.Error("Unexpected result of checking version constraints.")
+	}
+	desc := &RouterDescriptor{Nickname: "seele", TorVersion: "Tor 0.2.4.24"}
+	if !filter.MatchesRouterDescriptor(desc) {
+		t.Error("Router descriptor with matching version failed to pass the filter.")
+	}
+}
+
+// Test the method AddExitPort() and filtering by exit ports.
+func TestExitPortFiltering(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := NewObjectFilter()
+	filter.AddExitPort(443)
+	if filter.IsEmpty() {
+		t.Error("Filter with exit port apparently empty.")
+	}
+	filtered := vote.Filter(filter)
+	if _, found := filtered.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"); !found || filtered.Length() != 1 {
+		t.Error("Bad filtering by exit port.")
+	}
+	filter.AddExitPort(25)
+	if vote.Filter(filter).Length() != 0 {
+		t.Error("Router status that doesn't exit to all ports passed the filter.")
+	}
+
+	filter = NewObjectFilter()
+	filter.AddExitPort(25)
+	policy, _ := ParseExitPolicy("reject 10.0.0.0/8:*\naccept *:25\nreject *:*\n")
+	desc := &RouterDescriptor{ExitPolicy: *policy}
+	if !filter.MatchesRouterDescriptor(desc) {
+		t.Error("Router descriptor that exits to port 25 failed to pass the filter.")
+	}
+	policy, _ = ParseExitPolicy("reject *:25\naccept *:*\n")
+	desc.ExitPolicy = *policy
+	if filter.MatchesRouterDescriptor(desc) {
+		t.Error("Router descriptor that rejects port 25 passed the filter.")
+	}
+
+	md := &Microdescriptor{Accept: true, PortList: "1-24,26-65535"}
+	if filter.MatchesMicrodescriptor(md) {
+		t.Error("Microdescriptor that rejects port 25 passed the filter.")
+	}
+	md.Accept, md.PortList = false, "80,443"
+	if !filter.MatchesMicrodescriptor(md) {
+		t.Error("Microdescriptor that exits to port 25 failed to pass the filter.")
+	}
+}
+
 func TestFilterGetterSetter(t *testing.T) {
 
 	filter := NewObjectFilter()
@@ -0,0 +1,87 @@
+// Provides order-independent content hashes of object sets.
+
+package zoossh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// entryDigest returns the SHA-256 digest of the canonical JSON encoding of the
+// given entry.
+func entryDigest(entry interface{}) ([]byte, error) {
+
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(encoded)
+
+	return digest[:], nil
+}
+
+// combineDigests hashes the given digests after sorting them, so the result
+// does not depend on their order.
+func combineDigests(digests [][]byte) string {
+
+	sort.Slice(digests, func(i, j int) bool { return bytes.Compare(digests[i], digests[j]) < 0 })
+
+	h := sha256.New()
+	for _, digest := range digests {
+		h.Write(digest)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ContentHash returns a hex-encoded SHA-256 hash over the consensus' metadata
+// and router statuses.  The hash is independent of the order of router
+// statuses in the source document and of how the consensus was parsed, so two
+// consensuses with the same hash contain the same data.  Source offsets are
+// not part of the hash.
+func (c *Consensus) ContentHash() (string, error) {
+
+	meta, err := entryDigest(c.MetaInfo)
+	if err != nil {
+		return "", err
+	}
+	digests := [][]byte{meta}
+
+	for _, getStatus := range c.RouterStatuses {
+		status := *getStatus()
+		status.SourceOffset, status.SourceLength = 0, 0
+
+		digest, err := entryDigest(status)
+		if err != nil {
+			return "", err
+		}
+		digests = append(digests, digest)
+	}
+
+	return combineDigests(digests), nil
+}
+
+// ContentHash returns a hex-encoded SHA-256 hash over the router descriptors.
+// The hash is independent of the order of descriptors in the source document
+// and of how they were parsed, so two sets with the same hash contain the
+// same data.  Source offsets are not part of the hash.
+func (rds *RouterDescriptors) ContentHash() (string, error) {
+
+	var digests [][]byte
+
+	for _, getDescriptor := range rds.RouterDescriptors {
+		desc := *getDescriptor()
+		desc.SourceOffset, desc.SourceLength = 0, 0
+
+		digest, err := entryDigest(desc)
+		if err != nil {
+			return "", err
+		}
+		digests = append(digests, digest)
+	}
+
+	return combineDigests(digests), nil
+}
@@ -0,0 +1,71 @@
+// Tests functions from "hash.go".
+
+package zoossh
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConsensusContentHash(t *testing.T) {
+
+	eager, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := ParseRawConsensus(testVote, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withOffsets, err := parseConsensus(strings.NewReader(testVote), parseOptions{offsets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := eager.ContentHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Consensus{lazy, withOffsets} {
+		if other, _ := c.ContentHash(); other != hash {
+			t.Errorf("Expected hash %s but got %s.", hash, other)
+		}
+	}
+
+	status, _ := eager.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+	status.Bandwidth++
+	eager.Set(status.Fingerprint, status)
+	if other, _ := eager.ContentHash(); other == hash {
+		t.Error("Modified consensus has the same hash.")
+	}
+}
+
+func TestRouterDescriptorsContentHash(t *testing.T) {
+
+	// Only run this test if the descriptor file is there.
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+
+	eager, err := ParseDescriptorFile(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := LazilyParseDescriptorFile(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := eager.ContentHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := lazy.ContentHash(); other != hash {
+		t.Errorf("Expected hash %s but got %s.", hash, other)
+	}
+
+	if other, _ := NewRouterDescriptors().ContentHash(); other == hash {
+		t.Error("Empty descriptor set has the same hash.")
+	}
+}
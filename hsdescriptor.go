@@ -0,0 +1,286 @@
+// Parses files containing version 2 hidden service descriptors.
+
+package zoossh
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var hiddenServiceDescriptorAnnotations = map[Annotation]bool{
+	// The file format we currently (try to) support.
+	Annotation{"hidden-service-descriptor", "1", "0"}: true,
+}
+
+// IntroductionPoint is a single introduction point of a hidden service as
+// defined in rend-spec-v2.txt, Section 1.3.
+type IntroductionPoint struct {
+	// The base32-encoded hash of the introduction point's identity key.
+	Identifier string
+
+	Address net.IP
+	Port    uint16
+
+	// The PEM-encoded keys of the "onion-key" and "service-key" lines.
+	OnionKey   string
+	ServiceKey string
+}
+
+// HiddenServiceDescriptor is a version 2 hidden service descriptor as defined
+// in rend-spec-v2.txt, Section 1.3.
+type HiddenServiceDescriptor struct {
+	// The base32-encoded descriptor ID of the "rendezvous-service-descriptor"
+	// line.
+	DescriptorID string
+
+	// The single fields of a "version" line.
+	Version int
+
+	// The PEM-encoded key of the "permanent-key" line.
+	PermanentKey string
+
+	// The base32-encoded value of the "secret-id-part" line.
+	SecretIDPart string
+
+	// The single fields of a "publication-time" line.
+	Published time.Time
+
+	// The single fields of a "protocol-versions" line.
+	ProtocolVersions []int
+
+	// The introduction points.  If the service uses client authorization,
+	// introduction points are encrypted, so the field is nil and
+	// EncryptedIntroductionPoints holds the raw ciphertext.
+	IntroductionPoints          []*IntroductionPoint
+	EncryptedIntroductionPoints []byte
+
+	// The PEM-encoded object of the "signature" line.
+	Signature string
+}
+
+// OnionAddress returns the hidden service's onion address, without the
+// ".onion" suffix, which is derived from the service's permanent key.
+func (hsd *HiddenServiceDescriptor) OnionAddress() (string, error) {
+
+	block, _ := pem.Decode([]byte(hsd.PermanentKey))
+	if block == nil {
+		return "", fmt.Errorf("malformed permanent key")
+	}
+	digest := sha1.Sum(block.Bytes)
+
+	return strings.ToLower(base32.StdEncoding.EncodeToString(digest[:10])), nil
+}
+
+// readPEMObjects calls the given function for every keyword line of the given
+// document along with the PEM object that follows the line, if any.
+func readPEMObjects(raw string, f func(words []string, object string) error) error {
+
+	lines := strings.Split(raw, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if line == "" {
+			continue
+		}
+		words := strings.Split(line, " ")
+
+		var object []string
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "-----BEGIN") {
+			for i++; i < len(lines); i++ {
+				object = append(object, lines[i])
+				if strings.HasPrefix(lines[i], "-----END") {
+					break
+				}
+			}
+			if !strings.HasPrefix(object[len(object)-1], "-----END") {
+				return fmt.Errorf("unterminated object after %q", line)
+			}
+		}
+
+		if err := f(words, strings.Join(object, "\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseIntroductionPoints parses the decoded "introduction-points" document.
+func parseIntroductionPoints(raw string) ([]*IntroductionPoint, error) {
+
+	var points []*IntroductionPoint
+	var point *IntroductionPoint
+
+	err := readPEMObjects(raw, func(words []string, object string) error {
+
+		if words[0] == "introduction-point" {
+			if len(words) != 2 {
+				return fmt.Errorf("malformed introduction point %q", strings.Join(words, " "))
+			}
+			point = &IntroductionPoint{Identifier: words[1]}
+			points = append(points, point)
+			return nil
+		}
+		if point == nil {
+			return fmt.Errorf("%q outside of introduction point", words[0])
+		}
+
+		switch words[0] {
+		case "ip-address":
+			if len(words) != 2 || net.ParseIP(words[1]) == nil {
+				return fmt.Errorf("malformed address %q", strings.Join(words, " "))
+			}
+			point.Address = net.ParseIP(words[1])
+		case "onion-port":
+			if len(words) != 2 {
+				return fmt.Errorf("malformed port %q", strings.Join(words, " "))
+			}
+			point.Port = StringToPort(words[1])
+		case "onion-key":
+			point.OnionKey = object
+		case "service-key":
+			point.ServiceKey = object
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// ParseRawHiddenServiceDescriptor parses a raw version 2 hidden service
+// descriptor (in string format).  Unencrypted introduction points are parsed
+// as well.
+func ParseRawHiddenServiceDescriptor(rawDescriptor string) (*HiddenServiceDescriptor, error) {
+
+	hsd := &HiddenServiceDescriptor{}
+
+	err := readPEMObjects(rawDescriptor, func(words []string, object string) error {
+
+		var err error
+		value := ""
+		if len(words) > 1 {
+			value = words[1]
+		}
+
+		switch words[0] {
+		case "rendezvous-service-descriptor":
+			hsd.DescriptorID = value
+
+		case "version":
+			hsd.Version, err = strconv.Atoi(value)
+
+		case "permanent-key":
+			hsd.PermanentKey = object
+
+		case "secret-id-part":
+			hsd.SecretIDPart = value
+
+		case "publication-time":
+			hsd.Published, err = time.Parse(publishedTimeLayout, strings.Join(words[1:], " "))
+
+		case "protocol-versions":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("malformed protocol version %q", v)
+				}
+				hsd.ProtocolVersions = append(hsd.ProtocolVersions, n)
+			}
+
+		case "introduction-points":
+			block, _ := pem.Decode([]byte(object))
+			if block == nil {
+				return fmt.Errorf("malformed introduction points")
+			}
+			// Without client authorization, the message holds the plain
+			// introduction points document.
+			if strings.HasPrefix(string(block.Bytes), "introduction-point ") {
+				hsd.IntroductionPoints, err = parseIntroductionPoints(string(block.Bytes))
+			} else {
+				hsd.EncryptedIntroductionPoints = block.Bytes
+			}
+
+		case "signature":
+			hsd.Signature = object
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if hsd.DescriptorID == "" {
+		return nil, fmt.Errorf("missing \"rendezvous-service-descriptor\" line")
+	}
+
+	return hsd, nil
+}
+
+// extractHiddenServiceDescriptor is a bufio.SplitFunc that extracts individual
+// hidden service descriptors, each of which starts with a
+// "rendezvous-service-descriptor" line.
+func extractHiddenServiceDescriptor(data []byte, atEOF bool) (advance int, token []byte, err error) {
+
+	return splitAtKeyword(data, atEOF, "rendezvous-service-descriptor")
+}
+
+// ParseHiddenServiceDescriptors parses version 2 hidden service descriptors.
+// The type annotation is optional.
+func ParseHiddenServiceDescriptors(r io.Reader) ([]*HiddenServiceDescriptor, error) {
+
+	br := bufio.NewReader(r)
+	if first, _ := br.Peek(1); len(first) == 1 && first[0] == '@' {
+		annotation, rest, err := readAnnotation(br)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := hiddenServiceDescriptorAnnotations[*annotation]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnexpectedAnnotation, annotation)
+		}
+		br = bufio.NewReader(rest)
+	}
+
+	var descriptors []*HiddenServiceDescriptor
+
+	queue := make(chan QueueUnit)
+	go DissectFile(br, extractHiddenServiceDescriptor, queue)
+
+	for unit := range queue {
+		if unit.Err != nil {
+			return nil, unit.Err
+		}
+		hsd, err := ParseRawHiddenServiceDescriptor(unit.Blurb)
+		if err != nil {
+			return nil, err
+		}
+		descriptors = append(descriptors, hsd)
+	}
+
+	return descriptors, nil
+}
+
+// ParseHiddenServiceDescriptorFile is a wrapper around
+// ParseHiddenServiceDescriptors that parses the named file.
+func ParseHiddenServiceDescriptorFile(fileName string) ([]*HiddenServiceDescriptor, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return ParseHiddenServiceDescriptors(fd)
+}
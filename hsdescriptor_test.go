@@ -0,0 +1,119 @@
+// Tests functions from "hsdescriptor.go".
+
+package zoossh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIntroductionPoints = `introduction-point tnj7dxgbzmlmgp2gg7ugfvmbnnkuvmx3
+ip-address 1.2.3.4
+onion-port 9001
+onion-key
+-----BEGIN RSA PUBLIC KEY-----
+MIGJAoGBAL
+-----END RSA PUBLIC KEY-----
+service-key
+-----BEGIN RSA PUBLIC KEY-----
+MIGJAoGBAM
+-----END RSA PUBLIC KEY-----
+introduction-point 6e6dpsk5rjvcvsy7ydkeyqscgp3xjmgr
+ip-address 2001:db8::1
+onion-port 443
+`
+
+// testHiddenServiceDescriptor returns a descriptor with the given permanent
+// key and introduction points message.
+func testHiddenServiceDescriptor(permanentKey, introductionPoints string) string {
+
+	return `rendezvous-service-descriptor y3olqqblqw2gbh6phimfuiroechjjafa
+version 2
+permanent-key
+` + permanentKey + `secret-id-part e24kgecavwsznj7gpbktqsiwgvngsf4e
+publication-time 2015-02-23 20:00:00
+protocol-versions 2,3
+introduction-points
+` + introductionPoints + `signature
+-----BEGIN SIGNATURE-----
+dwIAm3e3eHHkO1PpMV0FsCH2
+-----END SIGNATURE-----
+`
+}
+
+func TestParseHiddenServiceDescriptors(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	permanentKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}))
+	plain := string(pem.EncodeToMemory(&pem.Block{Type: "MESSAGE", Bytes: []byte(testIntroductionPoints)}))
+	encrypted := string(pem.EncodeToMemory(&pem.Block{Type: "MESSAGE", Bytes: []byte{1, 2, 3, 4}}))
+
+	raw := "@type hidden-service-descriptor 1.0\n" +
+		testHiddenServiceDescriptor(permanentKey, plain) +
+		testHiddenServiceDescriptor(permanentKey, encrypted)
+
+	descriptors, err := ParseHiddenServiceDescriptors(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descriptors) != 2 {
+		t.Fatalf("Expected 2 descriptors but got %d.", len(descriptors))
+	}
+
+	hsd := descriptors[0]
+	if hsd.DescriptorID != "y3olqqblqw2gbh6phimfuiroechjjafa" || hsd.Version != 2 || hsd.SecretIDPart != "e24kgecavwsznj7gpbktqsiwgvngsf4e" {
+		t.Error("Unexpected descriptor fields.", hsd)
+	}
+	if hsd.Published != time.Date(2015, 2, 23, 20, 0, 0, 0, time.UTC) || len(hsd.ProtocolVersions) != 2 || hsd.ProtocolVersions[1] != 3 {
+		t.Error("Unexpected publication time or protocol versions.", hsd)
+	}
+	if !strings.HasPrefix(hsd.Signature, "-----BEGIN SIGNATURE-----") {
+		t.Error("Unexpected signature.", hsd.Signature)
+	}
+
+	if len(hsd.IntroductionPoints) != 2 {
+		t.Fatalf("Expected 2 introduction points but got %d.", len(hsd.IntroductionPoints))
+	}
+	point := hsd.IntroductionPoints[0]
+	if point.Identifier != "tnj7dxgbzmlmgp2gg7ugfvmbnnkuvmx3" || point.Address.String() != "1.2.3.4" || point.Port != 9001 {
+		t.Error("Unexpected introduction point.", point)
+	}
+	if !strings.Contains(point.OnionKey, "MIGJAoGBAL") || !strings.Contains(point.ServiceKey, "MIGJAoGBAM") {
+		t.Error("Unexpected introduction point keys.", point)
+	}
+	if hsd.IntroductionPoints[1].Address.String() != "2001:db8::1" {
+		t.Error("Unexpected IPv6 introduction point.", hsd.IntroductionPoints[1])
+	}
+
+	if descriptors[1].IntroductionPoints != nil || len(descriptors[1].EncryptedIntroductionPoints) != 4 {
+		t.Error("Expected encrypted introduction points.")
+	}
+
+	address, err := hsd.OnionAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(address) != 16 || strings.ToLower(address) != address {
+		t.Errorf("Unexpected onion address %q.", address)
+	}
+
+	// The annotation is optional but must match if present.
+	if _, err := ParseHiddenServiceDescriptors(strings.NewReader(raw[strings.Index(raw, "\n")+1:])); err != nil {
+		t.Error(err)
+	}
+	if _, err := ParseHiddenServiceDescriptors(strings.NewReader("@type microdescriptor 1.0\n")); err == nil {
+		t.Error("Expected error for unexpected annotation.")
+	}
+	unterminated := strings.TrimSuffix(testHiddenServiceDescriptor(permanentKey, plain), "-----END SIGNATURE-----\n")
+	if _, err := ParseRawHiddenServiceDescriptor(unterminated); err == nil {
+		t.Error("Expected error for unterminated signature.")
+	}
+}
@@ -0,0 +1,560 @@
+// Provides JSON encoding and decoding of zoossh's types.
+
+package zoossh
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MarshalJSON implements the json.Marshaler interface.  A fingerprint is
+// encoded as a string of 40 upper-case hex digits.
+func (fpr Fingerprint) MarshalJSON() ([]byte, error) {
+
+	return json.Marshal(string(SanitiseFingerprint(fpr)))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.  It accepts a
+// string of 40 hex digits in any case.
+func (fpr *Fingerprint) UnmarshalJSON(data []byte) error {
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	sanitised := SanitiseFingerprint(Fingerprint(s))
+	if sanitised != "" && !hexFingerprintRegexp.MatchString(string(sanitised)) {
+		return fmt.Errorf("invalid fingerprint: %q", s)
+	}
+	*fpr = sanitised
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.  Router flags are
+// encoded as an array of the names of all set flags, e.g., ["Fast","Guard"].
+func (flags RouterFlags) MarshalJSON() ([]byte, error) {
+
+	return json.Marshal(flags.flagNames())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.  Like the parser,
+// it ignores unknown flag names.
+func (flags *RouterFlags) UnmarshalJSON(data []byte) error {
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*flags = *parseRouterFlags(names)
+
+	return nil
+}
+
+// routerAddressJSON determines the JSON representation of RouterAddress.
+type routerAddressJSON struct {
+	IPv4Address net.IP `json:"ipv4_address,omitempty"`
+	IPv4ORPort  uint16 `json:"ipv4_or_port"`
+	IPv4DirPort uint16 `json:"ipv4_dir_port"`
+	IPv6Address net.IP `json:"ipv6_address,omitempty"`
+	IPv6ORPort  uint16 `json:"ipv6_or_port,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.  A router address is
+// encoded as an object whose IPv6 members are omitted if the router has no
+// IPv6 address.
+func (address RouterAddress) MarshalJSON() ([]byte, error) {
+
+	return json.Marshal(routerAddressJSON(address))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (address *RouterAddress) UnmarshalJSON(data []byte) error {
+
+	var a routerAddressJSON
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+	*address = RouterAddress(a)
+
+	return nil
+}
+
+// jsonTime returns a pointer to the given time, or nil for the zero time, so
+// that unset times are omitted.  Times are encoded as RFC 3339 strings.
+func jsonTime(t time.Time) *time.Time {
+
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+
+	return &t
+}
+
+// fromJSONTime is the inverse of jsonTime.
+func fromJSONTime(t *time.Time) time.Time {
+
+	if t == nil {
+		return time.Time{}
+	}
+
+	return t.UTC()
+}
+
+// routerStatusJSON determines the JSON representation of RouterStatus.
+type routerStatusJSON struct {
+	Fingerprint      Fingerprint    `json:"fingerprint"`
+	Nickname         string         `json:"nickname"`
+	Digest           string         `json:"digest,omitempty"`
+	Published        *time.Time     `json:"published,omitempty"`
+	Address          RouterAddress  `json:"address"`
+	Flags            RouterFlags    `json:"flags"`
+	TorVersion       string         `json:"tor_version,omitempty"`
+	Bandwidth        uint64         `json:"bandwidth"`
+	Measured         uint64         `json:"measured,omitempty"`
+	Unmeasured       bool           `json:"unmeasured,omitempty"`
+	Accept           bool           `json:"accept"`
+	PortList         string         `json:"port_list,omitempty"`
+	MicrodescDigest  string         `json:"microdesc_digest,omitempty"`
+	MicrodescDigests map[int]string `json:"microdesc_digests,omitempty"`
+	UnknownLines     []string       `json:"unknown_lines,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.  A router status is
+// encoded as an object with snake_case members, e.g., "tor_version".  Unset
+// optional fields are omitted and the publication time is an RFC 3339 string.
+func (s *RouterStatus) MarshalJSON() ([]byte, error) {
+
+	return json.Marshal(routerStatusJSON{
+		Fingerprint:      s.Fingerprint,
+		Nickname:         s.Nickname,
+		Digest:           s.Digest,
+		Published:        jsonTime(s.Publication),
+		Address:          s.Address,
+		Flags:            s.Flags,
+		TorVersion:       s.TorVersion,
+		Bandwidth:        s.Bandwidth,
+		Measured:         s.Measured,
+		Unmeasured:       s.Unmeasured,
+		Accept:           s.Accept,
+		PortList:         s.PortList,
+		MicrodescDigest:  s.MicrodescDigest,
+		MicrodescDigests: s.MicrodescDigests,
+		UnknownLines:     s.UnknownLines,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *RouterStatus) UnmarshalJSON(data []byte) error {
+
+	var j routerStatusJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*s = RouterStatus{
+		Fingerprint:      j.Fingerprint,
+		Nickname:         j.Nickname,
+		Digest:           j.Digest,
+		Publication:      fromJSONTime(j.Published),
+		Address:          j.Address,
+		Flags:            j.Flags,
+		TorVersion:       j.TorVersion,
+		Bandwidth:        j.Bandwidth,
+		Measured:         j.Measured,
+		Unmeasured:       j.Unmeasured,
+		Accept:           j.Accept,
+		PortList:         j.PortList,
+		MicrodescDigest:  j.MicrodescDigest,
+		MicrodescDigests: j.MicrodescDigests,
+		UnknownLines:     j.UnknownLines,
+	}
+
+	return nil
+}
+
+// routerDescriptorJSON determines the JSON representation of
+// RouterDescriptor.
+type routerDescriptorJSON struct {
+	Fingerprint               Fingerprint `json:"fingerprint"`
+	Nickname                  string      `json:"nickname"`
+	Address                   net.IP      `json:"address,omitempty"`
+	ORPort                    uint16      `json:"or_port"`
+	SOCKSPort                 uint16      `json:"socks_port,omitempty"`
+	DirPort                   uint16      `json:"dir_port"`
+	ORAddresses               []string    `json:"or_addresses,omitempty"`
+	Published                 *time.Time  `json:"published,omitempty"`
+	Uptime                    uint64      `json:"uptime"`
+	BandwidthAvg              uint64      `json:"bandwidth_avg"`
+	BandwidthBurst            uint64      `json:"bandwidth_burst"`
+	BandwidthObs              uint64      `json:"bandwidth_observed"`
+	OperatingSystem           string      `json:"operating_system,omitempty"`
+	TorVersion                string      `json:"tor_version,omitempty"`
+	Contact                   string      `json:"contact,omitempty"`
+	Family                    []string    `json:"family,omitempty"`
+	Hibernating               bool        `json:"hibernating,omitempty"`
+	HiddenServiceDir          bool        `json:"hidden_service_dir,omitempty"`
+	BridgeDistributionRequest string      `json:"bridge_distribution_request,omitempty"`
+	OnionKey                  string      `json:"onion_key,omitempty"`
+	NTorOnionKey              string      `json:"ntor_onion_key,omitempty"`
+	SigningKey                string      `json:"signing_key,omitempty"`
+	IdentityEd25519           []byte      `json:"identity_ed25519,omitempty"`
+	MasterKeyEd25519          []byte      `json:"master_key_ed25519,omitempty"`
+	OnionKeyCrosscert         []byte      `json:"onion_key_crosscert,omitempty"`
+	NTorOnionKeyCrosscert     []byte      `json:"ntor_onion_key_crosscert,omitempty"`
+	NTorOnionKeyCrosscertSign int         `json:"ntor_onion_key_crosscert_sign,omitempty"`
+	ExitPolicy                []string    `json:"exit_policy"`
+	IPv6Policy                string      `json:"ipv6_policy,omitempty"`
+	UnknownLines              []string    `json:"unknown_lines,omitempty"`
+	RouterSigEd25519          []byte      `json:"router_sig_ed25519,omitempty"`
+	RouterSignature           []byte      `json:"router_signature,omitempty"`
+	Digest                    string      `json:"digest,omitempty"`
+	DigestSHA256              string      `json:"digest_sha256,omitempty"`
+	DownloadedAt              *time.Time  `json:"downloaded_at,omitempty"`
+	Source                    string      `json:"source,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.  A router descriptor
+// is encoded as an object with snake_case members.  Keys are PEM-encoded as in
+// the descriptor, binary certificates and signatures are base64-encoded, and
+// the exit policy is a list of lines, e.g., ["accept *:80","reject *:*"].
+func (rd *RouterDescriptor) MarshalJSON() ([]byte, error) {
+
+	j := routerDescriptorJSON{
+		Fingerprint:               rd.Fingerprint,
+		Nickname:                  rd.Nickname,
+		Address:                   rd.Address,
+		ORPort:                    rd.ORPort,
+		SOCKSPort:                 rd.SOCKSPort,
+		DirPort:                   rd.DirPort,
+		Published:                 jsonTime(rd.Published),
+		Uptime:                    rd.Uptime,
+		BandwidthAvg:              rd.BandwidthAvg,
+		BandwidthBurst:            rd.BandwidthBurst,
+		BandwidthObs:              rd.BandwidthObs,
+		OperatingSystem:           rd.OperatingSystem,
+		TorVersion:                rd.TorVersion,
+		Contact:                   rd.Contact,
+		Hibernating:               rd.Hibernating,
+		HiddenServiceDir:          rd.HiddenServiceDir,
+		BridgeDistributionRequest: rd.BridgeDistributionRequest,
+		OnionKey:                  rd.OnionKey,
+		NTorOnionKey:              rd.NTorOnionKey,
+		SigningKey:                rd.SigningKey,
+		MasterKeyEd25519:          rd.MasterKeyEd25519,
+		OnionKeyCrosscert:         rd.OnionKeyCrosscert,
+		NTorOnionKeyCrosscertSign: rd.NTorOnionKeyCrosscertSign,
+		ExitPolicy:                []string{},
+		UnknownLines:              rd.UnknownLines,
+		RouterSigEd25519:          rd.RouterSigEd25519,
+		RouterSignature:           rd.RouterSignature,
+		Digest:                    rd.Digest(),
+		DigestSHA256:              rd.DigestSHA256(),
+		DownloadedAt:              jsonTime(rd.DownloadedAt),
+		Source:                    rd.Source,
+	}
+
+	for _, endpoint := range rd.ORAddresses {
+		j.ORAddresses = append(j.ORAddresses, endpoint.String())
+	}
+	for member := range rd.Family {
+		j.Family = append(j.Family, string(member))
+	}
+	sort.Strings(j.Family)
+	if rd.IdentityEd25519 != nil {
+		j.IdentityEd25519 = rd.IdentityEd25519.raw()
+	}
+	if rd.NTorOnionKeyCrosscert != nil {
+		j.NTorOnionKeyCrosscert = rd.NTorOnionKeyCrosscert.raw()
+	}
+	if policy := strings.TrimSpace(rd.RawExitPolicy); policy != "" {
+		j.ExitPolicy = strings.Split(policy, "\n")
+	}
+	if rd.PortList6 != "" {
+		if rd.Accept6 {
+			j.IPv6Policy = "accept " + rd.PortList6
+		} else {
+			j.IPv6Policy = "reject " + rd.PortList6
+		}
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.  Certificates and
+// exit policy lines are parsed as by ParseRawDescriptor.
+func (rd *RouterDescriptor) UnmarshalJSON(data []byte) error {
+
+	var j routerDescriptorJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	desc := NewRouterDescriptor()
+	desc.Fingerprint = j.Fingerprint
+	desc.Nickname = j.Nickname
+	desc.Address = j.Address
+	desc.ORPort = j.ORPort
+	desc.SOCKSPort = j.SOCKSPort
+	desc.DirPort = j.DirPort
+	desc.Published = fromJSONTime(j.Published)
+	desc.Uptime = j.Uptime
+	desc.BandwidthAvg = j.BandwidthAvg
+	desc.BandwidthBurst = j.BandwidthBurst
+	desc.BandwidthObs = j.BandwidthObs
+	desc.OperatingSystem = j.OperatingSystem
+	desc.TorVersion = j.TorVersion
+	desc.Contact = j.Contact
+	desc.Hibernating = j.Hibernating
+	desc.HiddenServiceDir = j.HiddenServiceDir
+	desc.BridgeDistributionRequest = j.BridgeDistributionRequest
+	desc.OnionKey = j.OnionKey
+	desc.NTorOnionKey = j.NTorOnionKey
+	desc.SigningKey = j.SigningKey
+	desc.OnionKeyCrosscert = j.OnionKeyCrosscert
+	desc.NTorOnionKeyCrosscertSign = j.NTorOnionKeyCrosscertSign
+	desc.UnknownLines = j.UnknownLines
+	desc.RouterSigEd25519 = j.RouterSigEd25519
+	desc.RouterSignature = j.RouterSignature
+	desc.DownloadedAt = fromJSONTime(j.DownloadedAt)
+	desc.Source = j.Source
+
+	for _, address := range j.ORAddresses {
+		endpoint, err := parseEndpoint(address)
+		if err != nil {
+			return err
+		}
+		desc.ORAddresses = append(desc.ORAddresses, endpoint)
+	}
+	for _, member := range j.Family {
+		desc.Family[Fingerprint(member)] = true
+	}
+	if j.MasterKeyEd25519 != nil {
+		if len(j.MasterKeyEd25519) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid Ed25519 master key of %d bytes", len(j.MasterKeyEd25519))
+		}
+		desc.MasterKeyEd25519 = ed25519.PublicKey(j.MasterKeyEd25519)
+	}
+
+	var err error
+	if j.IdentityEd25519 != nil {
+		if desc.IdentityEd25519, err = ParseEd25519Certificate(j.IdentityEd25519); err != nil {
+			return fmt.Errorf("malformed identity certificate: %s", err)
+		}
+	}
+	if j.NTorOnionKeyCrosscert != nil {
+		if desc.NTorOnionKeyCrosscert, err = ParseEd25519Certificate(j.NTorOnionKeyCrosscert); err != nil {
+			return fmt.Errorf("malformed ntor onion key cross-certificate: %s", err)
+		}
+	}
+
+	for _, line := range j.ExitPolicy {
+		words := strings.Split(line, " ")
+		if len(words) != 2 {
+			return fmt.Errorf("malformed exit policy line %q", line)
+		}
+		if _, err := parseExitRule(words[0], words[1]); err != nil {
+			return err
+		}
+		desc.addExitRule(words[0], words[1])
+	}
+	if j.IPv6Policy != "" {
+		words := strings.Split(j.IPv6Policy, " ")
+		if len(words) != 2 || (words[0] != "accept" && words[0] != "reject") {
+			return fmt.Errorf("malformed IPv6 exit policy %q", j.IPv6Policy)
+		}
+		desc.Accept6 = words[0] == "accept"
+		desc.PortList6 = words[1]
+	}
+
+	if j.Digest != "" {
+		if desc.digestSHA1, err = hex.DecodeString(j.Digest); err != nil {
+			return fmt.Errorf("malformed digest %q", j.Digest)
+		}
+	}
+	if j.DigestSHA256 != "" {
+		if desc.digestSHA256, err = base64.RawStdEncoding.DecodeString(j.DigestSHA256); err != nil {
+			return fmt.Errorf("malformed digest %q", j.DigestSHA256)
+		}
+	}
+
+	*rd = *desc
+
+	return nil
+}
+
+// packageJSON determines the JSON representation of Package.
+type packageJSON struct {
+	Name    string            `json:"name"`
+	Version string            `json:"version"`
+	URL     string            `json:"url"`
+	Digests map[string]string `json:"digests,omitempty"`
+}
+
+// dirSourceJSON determines the JSON representation of DirSource.
+type dirSourceJSON struct {
+	Nickname   string      `json:"nickname"`
+	Identity   Fingerprint `json:"identity"`
+	Hostname   string      `json:"hostname"`
+	Address    net.IP      `json:"address"`
+	DirPort    uint16      `json:"dir_port"`
+	ORPort     uint16      `json:"or_port"`
+	Contact    string      `json:"contact,omitempty"`
+	VoteDigest string      `json:"vote_digest,omitempty"`
+}
+
+// directorySignatureJSON determines the JSON representation of
+// DirectorySignature.
+type directorySignatureJSON struct {
+	Algorithm        string      `json:"algorithm,omitempty"`
+	Identity         Fingerprint `json:"identity"`
+	SigningKeyDigest string      `json:"signing_key_digest"`
+	Signature        string      `json:"signature"`
+}
+
+// consensusJSON determines the JSON representation of Consensus.
+type consensusJSON struct {
+	Flavour              string                   `json:"flavour,omitempty"`
+	ConsensusMethod      int                      `json:"consensus_method,omitempty"`
+	ValidAfter           *time.Time               `json:"valid_after,omitempty"`
+	FreshUntil           *time.Time               `json:"fresh_until,omitempty"`
+	ValidUntil           *time.Time               `json:"valid_until,omitempty"`
+	ClientVersions       []string                 `json:"client_versions,omitempty"`
+	ServerVersions       []string                 `json:"server_versions,omitempty"`
+	Packages             []packageJSON            `json:"packages,omitempty"`
+	Params               map[string]int           `json:"params,omitempty"`
+	SharedRandPrevious   []byte                   `json:"shared_rand_previous,omitempty"`
+	SharedRandCurrent    []byte                   `json:"shared_rand_current,omitempty"`
+	DirSources           []dirSourceJSON          `json:"dir_sources,omitempty"`
+	AuthorityFingerprint Fingerprint              `json:"authority_fingerprint,omitempty"`
+	Signatures           []directorySignatureJSON `json:"signatures,omitempty"`
+	BandwidthWeights     *BandwidthWeights        `json:"bandwidth_weights,omitempty"`
+	RouterStatuses       []*RouterStatus          `json:"router_statuses"`
+}
+
+// versionStrings returns the string representations of the given versions.
+func versionStrings(versions []Version) []string {
+
+	var s []string
+	for _, v := range versions {
+		s = append(s, v.String())
+	}
+
+	return s
+}
+
+// parseVersions is the inverse of versionStrings.
+func parseVersions(s []string) ([]Version, error) {
+
+	var versions []Version
+	for _, v := range s {
+		version, err := ParseVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.  A consensus is encoded
+// as an object holding its header and footer fields and its router statuses
+// as "router_statuses" array, sorted by fingerprint.  The MetaInfo and the
+// fields that are specific to votes are not encoded.
+func (c *Consensus) MarshalJSON() ([]byte, error) {
+
+	j := consensusJSON{
+		Flavour:              c.Flavour,
+		ConsensusMethod:      c.ConsensusMethod,
+		ValidAfter:           jsonTime(c.ValidAfter),
+		FreshUntil:           jsonTime(c.FreshUntil),
+		ValidUntil:           jsonTime(c.ValidUntil),
+		ClientVersions:       versionStrings(c.ClientVersions),
+		ServerVersions:       versionStrings(c.ServerVersions),
+		Params:               c.Params,
+		SharedRandPrevious:   c.SharedRandPrevious,
+		SharedRandCurrent:    c.SharedRandCurrent,
+		AuthorityFingerprint: c.AuthorityFingerprint,
+		BandwidthWeights:     c.BandwidthWeights,
+		RouterStatuses:       []*RouterStatus{},
+	}
+	for _, pkg := range c.Packages {
+		j.Packages = append(j.Packages, packageJSON(pkg))
+	}
+	for _, source := range c.DirSources {
+		j.DirSources = append(j.DirSources, dirSourceJSON(source))
+	}
+	for _, sig := range c.Signatures {
+		j.Signatures = append(j.Signatures, directorySignatureJSON(sig))
+	}
+
+	for _, getStatus := range c.RouterStatuses {
+		j.RouterStatuses = append(j.RouterStatuses, getStatus())
+	}
+	sort.Slice(j.RouterStatuses, func(i, k int) bool {
+		return j.RouterStatuses[i].Fingerprint < j.RouterStatuses[k].Fingerprint
+	})
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (c *Consensus) UnmarshalJSON(data []byte) error {
+
+	var j consensusJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	consensus := NewConsensus()
+	consensus.Flavour = j.Flavour
+	consensus.ConsensusMethod = j.ConsensusMethod
+	consensus.ValidAfter = fromJSONTime(j.ValidAfter)
+	consensus.FreshUntil = fromJSONTime(j.FreshUntil)
+	consensus.ValidUntil = fromJSONTime(j.ValidUntil)
+	consensus.Params = j.Params
+	consensus.SharedRandPrevious = j.SharedRandPrevious
+	consensus.SharedRandCurrent = j.SharedRandCurrent
+	consensus.AuthorityFingerprint = j.AuthorityFingerprint
+	consensus.BandwidthWeights = j.BandwidthWeights
+
+	var err error
+	if consensus.ClientVersions, err = parseVersions(j.ClientVersions); err != nil {
+		return err
+	}
+	if consensus.ServerVersions, err = parseVersions(j.ServerVersions); err != nil {
+		return err
+	}
+	for _, pkg := range j.Packages {
+		consensus.Packages = append(consensus.Packages, Package(pkg))
+	}
+	for _, source := range j.DirSources {
+		consensus.DirSources = append(consensus.DirSources, DirSource(source))
+	}
+	for _, sig := range j.Signatures {
+		consensus.Signatures = append(consensus.Signatures, DirectorySignature(sig))
+	}
+
+	for _, status := range j.RouterStatuses {
+		if status == nil || status.Fingerprint == "" {
+			return errors.New("router status lacks fingerprint")
+		}
+		consensus.Set(status.Fingerprint, status)
+	}
+	consensus.detectPublicationTimes()
+
+	*c = *consensus
+
+	return nil
+}
@@ -0,0 +1,233 @@
+// Tests functions from "json.go".
+
+package zoossh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFingerprintJSON(t *testing.T) {
+
+	data, err := json.Marshal(Fingerprint("9695dfc35ffeb861329b9f1ab04c46397020ce31"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"9695DFC35FFEB861329B9F1AB04C46397020CE31"` {
+		t.Errorf("Unexpected fingerprint encoding: %s", data)
+	}
+
+	var fpr Fingerprint
+	if err := json.Unmarshal([]byte(`"9695dfc35ffeb861329b9f1ab04c46397020ce31"`), &fpr); err != nil {
+		t.Fatal(err)
+	}
+	if fpr != "9695DFC35FFEB861329B9F1AB04C46397020CE31" {
+		t.Error("Unexpected decoded fingerprint.", fpr)
+	}
+
+	if err := json.Unmarshal([]byte(`"foo"`), &fpr); err == nil {
+		t.Error("Invalid fingerprint did not raise an error.")
+	}
+}
+
+func TestRouterFlagsJSON(t *testing.T) {
+
+	flags := RouterFlags{Exit: true, Fast: true, Running: true}
+	data, err := json.Marshal(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["Exit","Fast","Running"]` {
+		t.Errorf("Unexpected flags encoding: %s", data)
+	}
+
+	data, err = json.Marshal(RouterFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[]` {
+		t.Errorf("Unexpected empty flags encoding: %s", data)
+	}
+
+	var decoded RouterFlags
+	if err := json.Unmarshal([]byte(`["Exit","Fast","Running","NoSuchFlag"]`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != flags {
+		t.Error("Unexpected decoded flags.", decoded)
+	}
+}
+
+func TestRouterAddressJSON(t *testing.T) {
+
+	address := RouterAddress{
+		IPv4Address: net.ParseIP("193.11.166.194").To4(),
+		IPv4ORPort:  9000,
+		IPv4DirPort: 80,
+	}
+
+	data, err := json.Marshal(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"ipv4_address":"193.11.166.194","ipv4_or_port":9000,"ipv4_dir_port":80}` {
+		t.Errorf("Unexpected address encoding: %s", data)
+	}
+
+	address.IPv6Address = net.ParseIP("2002:470:6e:80d::2")
+	address.IPv6ORPort = 22
+	data, err = json.Marshal(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded RouterAddress
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.IPv4Address.Equal(address.IPv4Address) || !decoded.IPv6Address.Equal(address.IPv6Address) ||
+		decoded.IPv4ORPort != 9000 || decoded.IPv4DirPort != 80 || decoded.IPv6ORPort != 22 {
+		t.Errorf("Decoded address %v differs from original %v.", decoded, address)
+	}
+}
+
+func TestRouterStatusJSON(t *testing.T) {
+
+	status := &RouterStatus{
+		Nickname:    "Karlstad0",
+		Fingerprint: "9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645",
+		Publication: time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC),
+		Address:     RouterAddress{IPv4Address: net.ParseIP("193.11.166.194").To4(), IPv4ORPort: 9000},
+		Flags:       RouterFlags{Exit: true, Running: true},
+		TorVersion:  "0.4.4.7",
+		Bandwidth:   2670,
+		Accept:      true,
+		PortList:    "80,443",
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"fingerprint":"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645","nickname":"Karlstad0",` +
+		`"published":"2021-03-04T12:00:00Z",` +
+		`"address":{"ipv4_address":"193.11.166.194","ipv4_or_port":9000,"ipv4_dir_port":0},` +
+		`"flags":["Exit","Running"],"tor_version":"0.4.4.7","bandwidth":2670,"accept":true,"port_list":"80,443"}`
+	if string(data) != expected {
+		t.Errorf("Unexpected status encoding: %s", data)
+	}
+
+	var decoded RouterStatus
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Fingerprint != status.Fingerprint || !decoded.Publication.Equal(status.Publication) ||
+		decoded.Flags != status.Flags || decoded.PortList != status.PortList ||
+		!decoded.Address.IPv4Address.Equal(status.Address.IPv4Address) {
+		t.Errorf("Decoded status %v differs from original %v.", decoded, status)
+	}
+
+	if err := json.Unmarshal([]byte(`{"fingerprint":"foo"}`), &decoded); err == nil {
+		t.Error("Invalid fingerprint did not raise an error.")
+	}
+}
+
+func TestRouterDescriptorJSON(t *testing.T) {
+
+	descs, err := ParseDescriptorFile(serverDescriptorFile)
+	if err != nil {
+		t.Skipf("Cannot parse test data: %s", err)
+	}
+
+	for _, getDescriptor := range descs.RouterDescriptors {
+		desc := getDescriptor()
+		data, err := json.Marshal(desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded RouterDescriptor
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Encode() != desc.Encode() {
+			t.Fatalf("Decoded descriptor\n%s\ndiffers from original\n%s", decoded.Encode(), desc.Encode())
+		}
+		if decoded.Digest() != desc.Digest() || decoded.DigestSHA256() != desc.DigestSHA256() {
+			t.Errorf("Digests of descriptor %s changed.", desc.Fingerprint)
+		}
+		if len(decoded.ExitPolicy.Rules) != len(desc.ExitPolicy.Rules) {
+			t.Errorf("Exit policy of descriptor %s changed.", desc.Fingerprint)
+		}
+	}
+
+	_, master, _ := ed25519.GenerateKey(rand.Reader)
+	signing, _, _ := ed25519.GenerateKey(rand.Reader)
+	cert, err := ParseEd25519Certificate(testEd25519Certificate(CertTypeSigningKey, signing, master))
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := NewRouterDescriptor()
+	desc.IdentityEd25519 = cert
+	data, err := json.Marshal(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded RouterDescriptor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.IdentityEd25519 == nil || decoded.IdentityEd25519.Verify(nil) != nil {
+		t.Error("Identity certificate did not survive encoding.")
+	}
+
+	if err := json.Unmarshal([]byte(`{"exit_policy":["accept foo"]}`), &decoded); err == nil {
+		t.Error("Malformed exit policy did not raise an error.")
+	}
+}
+
+func TestConsensusJSON(t *testing.T) {
+
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Skipf("Cannot parse test data: %s", err)
+	}
+
+	data, err := json.Marshal(consensus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"valid_after":"`+consensus.ValidAfter.Format(time.RFC3339)+`"`) {
+		t.Error("Encoded consensus lacks RFC 3339 validity time.")
+	}
+
+	var decoded Consensus
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Length() != consensus.Length() || !decoded.ValidUntil.Equal(consensus.ValidUntil) ||
+		len(decoded.DirSources) != len(consensus.DirSources) || len(decoded.Signatures) != len(consensus.Signatures) {
+		t.Error("Decoded consensus differs from original.")
+	}
+	if decoded.HasRealPublicationTimes != consensus.HasRealPublicationTimes {
+		t.Error("Unexpected publication time detection.")
+	}
+
+	// Encoding the decoded consensus must yield the same document.
+	again, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Error("Re-encoded consensus differs from original encoding.")
+	}
+
+	if err := json.Unmarshal([]byte(`{"router_statuses":[{"nickname":"foo"}]}`), &decoded); err == nil {
+		t.Error("Router status without fingerprint did not raise an error.")
+	}
+}
@@ -0,0 +1,198 @@
+// Parses directory authority key certificates.
+
+package zoossh
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var keyCertificateAnnotations = map[Annotation]bool{
+	// The file format we currently (try to) support.
+	Annotation{"dir-key-certificate-3", "1", "0"}: true,
+}
+
+// KeyCertificate is a directory authority's key certificate as defined in
+// dir-spec.txt, Section 3.1.  It certifies the medium-term signing key, which
+// signs network status documents, using the authority's long-term identity
+// key.
+type KeyCertificate struct {
+	// The single fields of a "fingerprint" line, i.e., the digest of the
+	// authority's identity key.
+	Identity Fingerprint
+
+	// The single fields of the "dir-key-published" and "dir-key-expires"
+	// lines.
+	Published time.Time
+	Expires   time.Time
+
+	IdentityKey *rsa.PublicKey
+	SigningKey  *rsa.PublicKey
+
+	// The hex-encoded digest of the signing key, as used by
+	// "directory-signature" lines.
+	SigningKeyDigest string
+
+	// The decoded signature of the "dir-key-certification" object.
+	Certification []byte
+
+	// The SHA-1 digest over the signed portion of the certificate.
+	digest []byte
+}
+
+// parseRSAPublicKey parses the given PEM-encoded RSA public key and returns
+// the key along with the hex-encoded SHA-1 digest of its DER encoding.
+func parseRSAPublicKey(object string) (*rsa.PublicKey, string, error) {
+
+	block, _ := pem.Decode([]byte(object))
+	if block == nil || block.Type != "RSA PUBLIC KEY" {
+		return nil, "", errors.New("malformed RSA public key object")
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, "", err
+	}
+	digest := sha1.Sum(block.Bytes)
+
+	return key, strings.ToUpper(hex.EncodeToString(digest[:])), nil
+}
+
+// ParseRawKeyCertificate parses a raw key certificate (in string format).
+func ParseRawKeyCertificate(rawCertificate string) (*KeyCertificate, error) {
+
+	cert := &KeyCertificate{}
+
+	// The certification covers everything up to and including the
+	// "dir-key-certification" line.
+	const certification = "\ndir-key-certification\n"
+	if i := strings.Index(rawCertificate, certification); i >= 0 {
+		digest := sha1.Sum([]byte(rawCertificate[:i+len(certification)]))
+		cert.digest = digest[:]
+	} else {
+		return nil, errors.New("missing \"dir-key-certification\" line")
+	}
+
+	var identityDigest string
+	err := readPEMObjects(rawCertificate, func(words []string, object string) error {
+
+		var err error
+		value := strings.Join(words[1:], " ")
+
+		switch words[0] {
+		case "dir-key-certificate-version":
+			if value != "3" {
+				return fmt.Errorf("unsupported key certificate version %q", value)
+			}
+		case "fingerprint":
+			cert.Identity = SanitiseFingerprint(Fingerprint(value))
+		case "dir-key-published":
+			cert.Published, err = time.Parse(publishedTimeLayout, value)
+		case "dir-key-expires":
+			cert.Expires, err = time.Parse(publishedTimeLayout, value)
+		case "dir-identity-key":
+			cert.IdentityKey, identityDigest, err = parseRSAPublicKey(object)
+		case "dir-signing-key":
+			cert.SigningKey, cert.SigningKeyDigest, err = parseRSAPublicKey(object)
+		case "dir-key-certification":
+			block, _ := pem.Decode([]byte(object))
+			if block == nil {
+				return errors.New("malformed \"dir-key-certification\" object")
+			}
+			cert.Certification = block.Bytes
+		}
+
+		if err != nil {
+			return fmt.Errorf("malformed %q line: %s", words[0], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cert.IdentityKey == nil || cert.SigningKey == nil {
+		return nil, errors.New("key certificate lacks identity or signing key")
+	}
+	if Fingerprint(identityDigest) != cert.Identity {
+		return nil, fmt.Errorf("identity key does not match fingerprint %s", cert.Identity)
+	}
+
+	return cert, nil
+}
+
+// Verify checks the certificate's certification, i.e., that the authority's
+// identity key signed the certificate.  Expiration is not checked.
+func (cert *KeyCertificate) Verify() error {
+
+	if err := rsa.VerifyPKCS1v15(cert.IdentityKey, crypto.Hash(0), cert.digest, cert.Certification); err != nil {
+		return errors.New("invalid key certification")
+	}
+
+	return nil
+}
+
+// extractKeyCertificate is a bufio.SplitFunc that extracts individual key
+// certificates.
+func extractKeyCertificate(data []byte, atEOF bool) (advance int, token []byte, err error) {
+
+	return splitAtKeyword(data, atEOF, "dir-key-certificate-version")
+}
+
+// ParseKeyCertificates parses directory authority key certificates.  The type
+// annotation is optional.
+func ParseKeyCertificates(r io.Reader) ([]*KeyCertificate, error) {
+
+	br := bufio.NewReader(r)
+	if first, _ := br.Peek(1); len(first) == 1 && first[0] == '@' {
+		annotation, rest, err := readAnnotation(br)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := keyCertificateAnnotations[*annotation]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnexpectedAnnotation, annotation)
+		}
+		br = bufio.NewReader(rest)
+	}
+
+	var certs []*KeyCertificate
+
+	queue := make(chan QueueUnit)
+	go DissectFile(br, extractKeyCertificate, queue)
+
+	for unit := range queue {
+		if unit.Err != nil {
+			return nil, unit.Err
+		}
+		cert, err := ParseRawKeyCertificate(unit.Blurb)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// ParseKeyCertificateFile is a wrapper around ParseKeyCertificates that parses
+// the named file.
+func ParseKeyCertificateFile(fileName string) ([]*KeyCertificate, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return ParseKeyCertificates(fd)
+}
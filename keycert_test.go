@@ -0,0 +1,117 @@
+// Tests functions from "keycert.go".
+
+package zoossh
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRSAKeyPEM returns the PEM-encoded public key of the given key along
+// with the upper-case hex-encoded digest of its DER encoding.
+func testRSAKeyPEM(key *rsa.PrivateKey) (string, string) {
+
+	der := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	digest := sha1.Sum(der)
+	object := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: der})
+
+	return strings.TrimSpace(string(object)), strings.ToUpper(hex.EncodeToString(digest[:]))
+}
+
+// testKeyCertificate returns a key certificate of the given signing key that
+// is certified by the given identity key.
+func testKeyCertificate(t *testing.T, identity, signing *rsa.PrivateKey, published, expires time.Time) string {
+
+	identityPEM, fingerprint := testRSAKeyPEM(identity)
+	signingPEM, _ := testRSAKeyPEM(signing)
+
+	signed := fmt.Sprintf("dir-key-certificate-version 3\n"+
+		"fingerprint %s\n"+
+		"dir-key-published %s\n"+
+		"dir-key-expires %s\n"+
+		"dir-identity-key\n%s\n"+
+		"dir-signing-key\n%s\n"+
+		"dir-key-certification\n",
+		fingerprint, published.Format(publishedTimeLayout), expires.Format(publishedTimeLayout),
+		identityPEM, signingPEM)
+
+	digest := sha1.Sum([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, identity, crypto.Hash(0), digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + string(pem.EncodeToMemory(&pem.Block{Type: "SIGNATURE", Bytes: sig}))
+}
+
+// testRSAKey generates a small RSA key to keep tests fast.
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// Test the function ParseKeyCertificates().
+func TestParseKeyCertificates(t *testing.T) {
+
+	identity, signing := testRSAKey(t), testRSAKey(t)
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := published.AddDate(1, 0, 0)
+	raw := testKeyCertificate(t, identity, signing, published, expires)
+
+	certs, err := ParseKeyCertificates(strings.NewReader("@type dir-key-certificate-3 1.0\n" + raw + raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("Expected two key certificates but got %d.", len(certs))
+	}
+
+	_, err = ParseKeyCertificates(strings.NewReader("@type dir-key-certificate-3 2.0\n" + raw))
+	if !errors.Is(err, ErrUnexpectedAnnotation) {
+		t.Errorf("Expected ErrUnexpectedAnnotation but got %v.", err)
+	}
+
+	cert := certs[0]
+	_, fingerprint := testRSAKeyPEM(identity)
+	_, signingDigest := testRSAKeyPEM(signing)
+	if cert.Identity != Fingerprint(fingerprint) || cert.SigningKeyDigest != signingDigest {
+		t.Error("Unexpected key digests.", cert.Identity, cert.SigningKeyDigest)
+	}
+	if !cert.Published.Equal(published) || !cert.Expires.Equal(expires) {
+		t.Error("Unexpected validity period.", cert.Published, cert.Expires)
+	}
+	if err := cert.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	// The fingerprint must match the identity key.
+	mismatch := strings.Replace(raw, fingerprint, strings.Repeat("0", 40), 1)
+	if _, err := ParseRawKeyCertificate(mismatch); err == nil {
+		t.Error("Mismatching identity key was accepted.")
+	}
+
+	certified := strings.Index(raw, "dir-key-certification")
+	tampered := strings.Replace(raw[:certified], "2022-01-01", "2032-01-01", 1) + raw[certified:]
+	cert, err = ParseRawKeyCertificate(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Verify(); err == nil {
+		t.Error("Tampered key certificate verified.")
+	}
+}
@@ -0,0 +1,507 @@
+// Parses files containing microdescriptors.
+
+package zoossh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var microdescriptorAnnotations = map[Annotation]bool{
+	// The file format we currently (try to) support.
+	Annotation{"microdescriptor", "1", "0"}: true,
+}
+
+type GetMicrodescriptor func() *Microdescriptor
+
+// A microdescriptor as defined in dir-spec.txt, Section 3.3.
+type Microdescriptor struct {
+
+	// The base64-encoded SHA-256 digest over the microdescriptor, without
+	// trailing "=" characters.  Microdesc-flavoured consensuses refer to
+	// microdescriptors using this digest.
+	Digest string
+
+	// The "onion-key" and "ntor-onion-key" lines.  Recent microdescriptors
+	// lack the former.
+	OnionKey     string
+	NTorOnionKey string
+
+	// The addresses of "a" lines.
+	ORAddresses []Endpoint
+
+	// The single fields of a "family" line.  Members are either
+	// fingerprints or nicknames.
+	Family map[Fingerprint]bool
+
+	// The single fields of a "p" and "p6" line.
+	Accept    bool
+	PortList  string
+	Accept6   bool
+	PortList6 string
+
+	// The identities of "id" lines.  The RSA identity is given as
+	// fingerprint and the Ed25519 identity in base64.
+	Identity        Fingerprint
+	Ed25519Identity string
+}
+
+type Microdescriptors struct {
+
+	// A map from microdescriptor digest to a function which returns the
+	// microdescriptor.
+	Microdescriptors map[string]GetMicrodescriptor
+
+	// The document's annotations other than the type annotation, e.g.,
+	// "@source", keyed by their keyword without the leading "@".  Nil if the
+	// document had none.
+	AnnotationMetadata map[string]string
+}
+
+// MicrodescriptorColumns names the comma-separated columns that
+// Microdescriptor.String returns, in order.  New columns are only ever
+// appended, so consumers can rely on the position of existing columns.
+var MicrodescriptorColumns = []string{
+	"digest",
+	"identity",
+	"ntor_onion_key",
+	"policy",
+}
+
+// String implements the String as well as the Object interface.  It returns
+// the microdescriptor's string representation whose columns are described by
+// MicrodescriptorColumns.
+func (md *Microdescriptor) String() string {
+
+	policy := ""
+	if md.PortList != "" {
+		policy = "reject " + md.PortList
+		if md.Accept {
+			policy = "accept " + md.PortList
+		}
+	}
+
+	return fmt.Sprintf("%s,%s,%s,%s", md.Digest, md.Identity, md.NTorOnionKey, policy)
+}
+
+// Header returns the comma-separated names of the columns that String
+// returns.
+func (md *Microdescriptor) Header() string {
+
+	return strings.Join(MicrodescriptorColumns, ",")
+}
+
+// GetFingerprint implements the Object interface.  It returns the relay
+// fingerprint of the microdescriptor's "id rsa1024" line, which may be empty.
+func (md *Microdescriptor) GetFingerprint() Fingerprint {
+
+	return md.Identity
+}
+
+// NewMicrodescriptors serves as a constructor and returns a pointer to a
+// freshly allocated and empty Microdescriptors struct.
+func NewMicrodescriptors() *Microdescriptors {
+
+	return &Microdescriptors{Microdescriptors: make(map[string]GetMicrodescriptor)}
+}
+
+// NewMicrodescriptor serves as a constructor and returns a pointer to a
+// freshly allocated and empty Microdescriptor struct.
+func NewMicrodescriptor() *Microdescriptor {
+
+	return &Microdescriptor{Family: make(map[Fingerprint]bool)}
+}
+
+// Get returns the microdescriptor for the given digest and a boolean value
+// indicating if the microdescriptor could be found.
+func (mds *Microdescriptors) Get(digest string) (*Microdescriptor, bool) {
+
+	getMicrodescriptor, exists := mds.Microdescriptors[strings.TrimRight(digest, "=")]
+	if !exists {
+		return nil, exists
+	}
+
+	return getMicrodescriptor(), exists
+}
+
+// Set adds a new digest mapping to a function returning the microdescriptor.
+func (mds *Microdescriptors) Set(digest string, md *Microdescriptor) {
+
+	mds.Microdescriptors[strings.TrimRight(digest, "=")] = func() *Microdescriptor { return md }
+}
+
+// Length implements the ObjectSet interface.  It returns the number of
+// microdescriptors.
+func (mds *Microdescriptors) Length() int {
+
+	return len(mds.Microdescriptors)
+}
+
+// Iterate implements the ObjectSet interface.  Using a channel, it iterates
+// over and returns all microdescriptors.  The given object filter can be used
+// to filter microdescriptors, e.g., by fingerprint.
+func (mds *Microdescriptors) Iterate(filter *ObjectFilter) <-chan Object {
+
+	ch := make(chan Object)
+
+	go func() {
+		for _, getMicrodescriptor := range mds.Microdescriptors {
+			md := getMicrodescriptor()
+			if filter == nil || filter.IsEmpty() || filter.MatchesMicrodescriptor(md) {
+				ch <- md
+			}
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// GetObject implements the ObjectSet interface.  It returns the
+// microdescriptor whose "id rsa1024" line carries the given fingerprint.
+// Microdescriptors are indexed by digest, so this takes linear time.
+func (mds *Microdescriptors) GetObject(fingerprint Fingerprint) (Object, bool) {
+
+	fingerprint = SanitiseFingerprint(fingerprint)
+	for _, getMicrodescriptor := range mds.Microdescriptors {
+		if md := getMicrodescriptor(); md.Identity == fingerprint {
+			return md, true
+		}
+	}
+
+	return nil, false
+}
+
+// Contains implements the ObjectSet interface.  It returns true if a
+// microdescriptor carries the given fingerprint.
+func (mds *Microdescriptors) Contains(fingerprint Fingerprint) bool {
+
+	_, found := mds.GetObject(fingerprint)
+	return found
+}
+
+// Merge implements the ObjectSet interface.  It adds all microdescriptors of
+// the given set whose digest is not yet present.
+func (mds *Microdescriptors) Merge(objs ObjectSet) {
+
+	for obj := range objs.Iterate(nil) {
+		md, ok := obj.(*Microdescriptor)
+		if !ok {
+			continue
+		}
+		if _, exists := mds.Microdescriptors[md.Digest]; !exists {
+			mds.Set(md.Digest, md)
+		}
+	}
+}
+
+// MatchesMicrodescriptor returns true if fields of the given microdescriptor
+// are present in the object filter, i.e., its fingerprint or one of its
+// addresses, and if the microdescriptor allows exiting to the filter's exit
+// ports.  Microdescriptors have neither flags nor a Tor version, so they never
+// match a filter that requires flags or versions.
+func (filter *ObjectFilter) MatchesMicrodescriptor(md *Microdescriptor) bool {
+
+	if filter.requiresFlags() || len(filter.VersionConstraints) != 0 || !filter.exitsTo(md.AcceptsPort) {
+		return false
+	}
+
+	if !filter.hasIdentities() {
+		return true
+	}
+
+	if filter.HasFingerprint(md.Identity) {
+		return true
+	}
+
+	for _, endpoint := range md.ORAddresses {
+		if filter.HasIPAddr(endpoint.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MicrodescriptorDigest returns the base64-encoded SHA-256 digest over the
+// given raw microdescriptor, without trailing "=" characters.
+func MicrodescriptorDigest(rawMicrodescriptor string) string {
+
+	digest := sha256.Sum256([]byte(rawMicrodescriptor))
+	return base64.RawStdEncoding.EncodeToString(digest[:])
+}
+
+// LazyParseRawMicrodescriptor lazily parses a raw microdescriptor (in string
+// format) and returns the microdescriptor's digest, a function returning the
+// microdescriptor, and an error if the microdescriptor could not be parsed.
+// Parsing is delayed until the microdescriptor is accessed; only its digest
+// is computed right away.
+func LazyParseRawMicrodescriptor(rawMicrodescriptor string) (string, GetMicrodescriptor, error) {
+
+	// Delay parsing of the microdescriptor until this function is executed.
+	getMicrodescriptor := func() *Microdescriptor {
+		_, f, _ := ParseRawMicrodescriptor(rawMicrodescriptor)
+		return f()
+	}
+
+	return MicrodescriptorDigest(rawMicrodescriptor), getMicrodescriptor, nil
+}
+
+// ParseRawMicrodescriptor parses a raw microdescriptor (in string format) and
+// returns the microdescriptor's digest, a function returning the
+// microdescriptor, and an error if the microdescriptor could not be parsed.
+// In contrast to LazyParseRawMicrodescriptor, parsing is *not* delayed.
+func ParseRawMicrodescriptor(rawMicrodescriptor string) (string, GetMicrodescriptor, error) {
+
+	md := NewMicrodescriptor()
+	md.Digest = MicrodescriptorDigest(rawMicrodescriptor)
+
+	lines := strings.Split(rawMicrodescriptor, "\n")
+
+	// The key that the next PEM block belongs to.
+	var key *string
+	var block []string
+
+	for _, line := range lines {
+
+		if key != nil {
+			block = append(block, line)
+			if strings.HasPrefix(line, "-----END") {
+				*key = strings.Join(block, "\n")
+				key, block = nil, nil
+			}
+			continue
+		}
+
+		words := strings.Split(line, " ")
+
+		switch words[0] {
+
+		case "onion-key":
+			key = &md.OnionKey
+
+		case "ntor-onion-key":
+			if len(words) > 1 {
+				md.NTorOnionKey = words[1]
+			}
+
+		case "a":
+			if len(words) > 1 {
+				if endpoint, err := parseEndpoint(words[1]); err == nil {
+					md.ORAddresses = append(md.ORAddresses, endpoint)
+				}
+			}
+
+		case "family":
+			for _, word := range words[1:] {
+				if strings.HasPrefix(word, "$") {
+					word = string(SanitiseFingerprint(Fingerprint(strings.Trim(word, "$"))))
+				}
+				md.Family[Fingerprint(word)] = true
+			}
+
+		case "p":
+			if len(words) > 2 {
+				md.Accept = words[1] == "accept"
+				md.PortList = strings.Join(words[2:], " ")
+			}
+
+		case "p6":
+			if len(words) > 2 {
+				md.Accept6 = words[1] == "accept"
+				md.PortList6 = strings.Join(words[2:], " ")
+			}
+
+		case "id":
+			if len(words) < 3 {
+				continue
+			}
+			switch words[1] {
+			case "rsa1024":
+				fingerprint, err := Base64ToString(words[2])
+				if err != nil {
+					return "", nil, err
+				}
+				md.Identity = SanitiseFingerprint(Fingerprint(fingerprint))
+			case "ed25519":
+				md.Ed25519Identity = words[2]
+			}
+		}
+	}
+
+	if key != nil {
+		return "", nil, fmt.Errorf("unterminated key in microdescriptor %s", md.Digest)
+	}
+
+	return md.Digest, func() *Microdescriptor { return md }, nil
+}
+
+// extractMicrodescriptor is a bufio.SplitFunc that extracts individual
+// microdescriptors.  A microdescriptor starts with an "onion-key" line or, if
+// it lacks one, with its "ntor-onion-key" line.  Annotations such as
+// "@last-listed", which tor adds in its cache, are skipped.
+func extractMicrodescriptor(data []byte, atEOF bool) (advance int, token []byte, err error) {
+
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	isStart := func(line []byte) bool {
+		return bytes.HasPrefix(line, []byte("onion-key")) || bytes.HasPrefix(line, []byte("ntor-onion-key"))
+	}
+
+	// Skip everything up to the first line that starts a microdescriptor.
+	start := 0
+	for !isStart(data[start:]) {
+		i := bytes.IndexByte(data[start:], '\n')
+		if i < 0 {
+			if atEOF {
+				return len(data), nil, nil
+			}
+			// Request more data.
+			return start, nil, nil
+		}
+		start += i + 1
+	}
+
+	hasOnionKey := bytes.HasPrefix(data[start:], []byte("onion-key"))
+	hasNTorOnionKey := !hasOnionKey
+
+	// Find the line that starts the next microdescriptor.
+	pos := start + bytes.IndexByte(data[start:], '\n') + 1
+	for pos > start {
+		i := bytes.IndexByte(data[pos:], '\n')
+		if i < 0 {
+			break
+		}
+		line := data[pos : pos+i]
+		if bytes.HasPrefix(line, []byte("@")) || bytes.HasPrefix(line, []byte("onion-key")) {
+			return pos, data[start:pos], nil
+		}
+		if bytes.HasPrefix(line, []byte("ntor-onion-key")) {
+			if hasNTorOnionKey || !hasOnionKey {
+				return pos, data[start:pos], nil
+			}
+			hasNTorOnionKey = true
+		}
+		pos += i + 1
+	}
+
+	if atEOF {
+		return len(data), data[start:], nil
+	}
+	// Request more data.
+	return start, nil, nil
+}
+
+// parseMicrodescriptorUnchecked parses microdescriptors.  The input should be
+// without a type annotation; i.e., the type annotation should already have
+// been read and checked to be the correct type.  If the lazy option is set,
+// parsing of the microdescriptors is delayed until they are accessed.
+func parseMicrodescriptorUnchecked(r io.Reader, opts parseOptions) (*Microdescriptors, error) {
+
+	var mds = NewMicrodescriptors()
+	mds.AnnotationMetadata = opts.metadata
+	var microdescriptorParser func(string) (string, GetMicrodescriptor, error)
+
+	if opts.lazy {
+		microdescriptorParser = LazyParseRawMicrodescriptor
+	} else {
+		microdescriptorParser = ParseRawMicrodescriptor
+	}
+	if opts.lazy && opts.budget != nil {
+		microdescriptorParser = opts.budget.wrapMicrodescriptorParser(microdescriptorParser)
+	}
+
+	// We will read raw microdescriptors from this channel.  Cancelling the
+	// context stops the dissecting goroutine if we return early.
+	ctx, cancel := context.WithCancel(opts.context())
+	defer cancel()
+	queue := make(chan QueueUnit)
+	go DissectFileContext(ctx, r, extractMicrodescriptor, queue)
+
+	// Parse incoming microdescriptors until the channel is closed by the
+	// remote end.
+	for unit := range queue {
+		if unit.Err != nil {
+			return nil, unit.Err
+		}
+		if opts.prefilter != nil && !opts.prefilter(unit.Blurb) {
+			continue
+		}
+
+		digest, getMicrodescriptor, err := microdescriptorParser(unit.Blurb)
+		if err != nil {
+			return nil, err
+		}
+		mds.Microdescriptors[digest] = getMicrodescriptor
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return mds, nil
+}
+
+// parseMicrodescriptor is a wrapper around parseMicrodescriptorUnchecked that
+// first reads and checks the type annotation to make sure it belongs to
+// microdescriptorAnnotations.
+func parseMicrodescriptor(r io.Reader, opts parseOptions) (*Microdescriptors, error) {
+
+	header, r, err := readAndCheckAnnotation(r, microdescriptorAnnotations)
+	if err != nil {
+		return nil, err
+	}
+	opts.metadata = header.annotationMetadata()
+
+	return parseMicrodescriptorUnchecked(r, opts)
+}
+
+// parseMicrodescriptorFile is a wrapper around parseMicrodescriptor that
+// opens the named file for parsing.
+func parseMicrodescriptorFile(fileName string, opts parseOptions) (*Microdescriptors, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return parseMicrodescriptor(fd, opts)
+}
+
+// ParseRawMicrodescriptors parses raw microdescriptors (in string format),
+// which must start with a type annotation.
+func ParseRawMicrodescriptors(rawMicrodescriptors string, lazy bool) (*Microdescriptors, error) {
+
+	return parseMicrodescriptor(strings.NewReader(rawMicrodescriptors), parseOptions{lazy: lazy})
+}
+
+// ParseMicrodescriptorsContext works like ParseMicrodescriptors but stops
+// parsing with the context's error once the given context is done.
+func ParseMicrodescriptorsContext(ctx context.Context, r io.Reader, options ...Option) (*Microdescriptors, error) {
+
+	return ParseMicrodescriptors(r, append(options[:len(options):len(options)], WithContext(ctx))...)
+}
+
+// LazilyParseMicrodescriptorFile parses the given file and returns a pointer
+// to Microdescriptors containing the microdescriptors.  Parsing of single
+// microdescriptors is delayed until they are accessed.
+func LazilyParseMicrodescriptorFile(fileName string) (*Microdescriptors, error) {
+
+	return parseMicrodescriptorFile(fileName, parseOptions{lazy: true})
+}
+
+// ParseMicrodescriptorFile parses the given file and returns a pointer to
+// Microdescriptors containing the microdescriptors.  In contrast to
+// LazilyParseMicrodescriptorFile, parsing is *not* delayed.
+func ParseMicrodescriptorFile(fileName string) (*Microdescriptors, error) {
+
+	return parseMicrodescriptorFile(fileName, parseOptions{})
+}
@@ -0,0 +1,137 @@
+// Tests functions from "microdescriptor.go".
+
+package zoossh
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+const testMicrodescriptor1 = `onion-key
+-----BEGIN RSA PUBLIC KEY-----
+MIGJAoGBAL+3UeGGF7xExy3z58T3Xu9uWabYpmub5bATZ+yLia9crsLrLEIaAsJ9
+oa3XMbC1bOL0FBJj6WhrFJvwDw49yGKze5b9n8e4SRsZANLzkUr9vLmhXLnnkfvs
+rBu1PNDpBaQjQ2AviEwwWcJjf4imUtlsv94M5F/NEO1E1LyU/rDPAgMBAAE=
+-----END RSA PUBLIC KEY-----
+ntor-onion-key 8tAylcNZrA23N3iBPMsHGB8AYz9iHwqgaS6qAx3qVxA=
+a [2001:db8::1]:9001
+family $f8e9f7d30ed7f541fd248945faa2b593ad5e584d leenuts
+p accept 80,443
+p6 accept 443
+id rsa1024 AAoQ1DAR6kkoo19hBAX5K0QztNw
+id ed25519 qjVtFsJOXfmmFuCSfXWObhCkLfz5zvOR7d3nBm5ajGc
+`
+
+// A microdescriptor without "onion-key" line.
+const testMicrodescriptor2 = `ntor-onion-key bBgCmZdAtT3Vf5wD8wF4hTgZ9pLrsSkeWeyWdI8M6Vk=
+p reject 1-65535
+id rsa1024 m5TNC3uAV+ryG6fwI7ehyMqc5kU
+`
+
+func TestParseRawMicrodescriptor(t *testing.T) {
+
+	digest, getMicrodescriptor, err := ParseRawMicrodescriptor(testMicrodescriptor1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := getMicrodescriptor()
+
+	if digest != MicrodescriptorDigest(testMicrodescriptor1) || md.Digest != digest || strings.HasSuffix(digest, "=") {
+		t.Errorf("Unexpected digest %q.", digest)
+	}
+	if md.Identity != "000A10D43011EA4928A35F610405F92B4433B4DC" {
+		t.Errorf("Unexpected identity %q.", md.Identity)
+	}
+	if md.Ed25519Identity != "qjVtFsJOXfmmFuCSfXWObhCkLfz5zvOR7d3nBm5ajGc" {
+		t.Errorf("Unexpected Ed25519 identity %q.", md.Ed25519Identity)
+	}
+	if !strings.HasPrefix(md.OnionKey, "-----BEGIN RSA PUBLIC KEY-----") || !strings.HasSuffix(md.OnionKey, "-----END RSA PUBLIC KEY-----") {
+		t.Errorf("Unexpected onion key %q.", md.OnionKey)
+	}
+	if md.NTorOnionKey != "8tAylcNZrA23N3iBPMsHGB8AYz9iHwqgaS6qAx3qVxA=" {
+		t.Errorf("Unexpected ntor onion key %q.", md.NTorOnionKey)
+	}
+	if len(md.ORAddresses) != 1 || md.ORAddresses[0].String() != "[2001:db8::1]:9001" {
+		t.Errorf("Unexpected addresses %v.", md.ORAddresses)
+	}
+	if !md.Family["F8E9F7D30ED7F541FD248945FAA2B593AD5E584D"] || !md.Family["leenuts"] {
+		t.Errorf("Unexpected family %v.", md.Family)
+	}
+	if !md.Accept || md.PortList != "80,443" || !md.Accept6 || md.PortList6 != "443" {
+		t.Errorf("Unexpected policies %+v.", md)
+	}
+
+	if _, _, err := ParseRawMicrodescriptor("onion-key\n-----BEGIN RSA PUBLIC KEY-----\n"); err == nil {
+		t.Error("Unterminated onion key did not raise an error.")
+	}
+}
+
+func TestExtractMicrodescriptor(t *testing.T) {
+
+	raw := "@last-listed 2021-03-05 01:00:00\n" + testMicrodescriptor1 +
+		testMicrodescriptor2 + testMicrodescriptor2
+
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	scanner.Split(extractMicrodescriptor)
+
+	var entries []string
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 microdescriptors but got %d.", len(entries))
+	}
+	if entries[0] != testMicrodescriptor1 || entries[1] != testMicrodescriptor2 || entries[2] != testMicrodescriptor2 {
+		t.Errorf("Unexpected microdescriptors %q.", entries)
+	}
+}
+
+func TestParseRawMicrodescriptors(t *testing.T) {
+
+	raw := "@type microdescriptor 1.0\n" + testMicrodescriptor1 + testMicrodescriptor2
+
+	for _, lazy := range []bool{false, true} {
+		mds, err := ParseRawMicrodescriptors(raw, lazy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mds.Length() != 2 {
+			t.Fatalf("Expected 2 microdescriptors but got %d.", mds.Length())
+		}
+
+		md, found := mds.Get(MicrodescriptorDigest(testMicrodescriptor2))
+		if !found {
+			t.Fatal("Failed to look up microdescriptor by digest.")
+		}
+		if md.Identity != "9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645" || md.OnionKey != "" {
+			t.Errorf("Unexpected microdescriptor %+v.", md)
+		}
+
+		if !mds.Contains("000a10d43011ea4928a35f610405f92b4433b4dc") {
+			t.Error("Failed to look up microdescriptor by fingerprint.")
+		}
+
+		filter := NewObjectFilter()
+		filter.AddFingerprint("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+		n := 0
+		for range mds.Iterate(filter) {
+			n++
+		}
+		if n != 1 {
+			t.Errorf("Expected 1 filtered microdescriptor but got %d.", n)
+		}
+	}
+
+	objs, err := ParseUnknown(strings.NewReader(testMicrodescriptor2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objs.(*Microdescriptors); !ok || objs.Length() != 1 {
+		t.Errorf("Unexpected object set %T.", objs)
+	}
+}
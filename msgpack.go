@@ -0,0 +1,631 @@
+// Provides a compact MessagePack encoding of object sets.
+
+package zoossh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// MsgpackSchemaVersion is the version of the schema that EncodeMsgpack
+// writes.  Readers ignore map keys they don't know, so new fields can be added
+// without bumping the version.  The version is only bumped if the meaning of
+// existing fields changes.
+const MsgpackSchemaVersion = 1
+
+const (
+	msgpackKindConsensus   = "consensus"
+	msgpackKindDescriptors = "descriptors"
+)
+
+// msgpackWriter writes MessagePack values.  The first error sticks, so callers
+// only have to check for errors once they are done.
+type msgpackWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (mw *msgpackWriter) write(b ...byte) {
+
+	if mw.err == nil {
+		_, mw.err = mw.w.Write(b)
+	}
+}
+
+// writeHeader writes a type byte followed by the given length in the
+// smallest of the three given type bytes that can hold it.
+func (mw *msgpackWriter) writeHeader(n int, t8, t16, t32 byte) {
+
+	switch {
+	case t8 != 0 && n <= math.MaxUint8:
+		mw.write(t8, byte(n))
+	case n <= math.MaxUint16:
+		mw.write(t16, byte(n>>8), byte(n))
+	default:
+		mw.write(t32, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func (mw *msgpackWriter) writeNil() {
+
+	mw.write(0xc0)
+}
+
+func (mw *msgpackWriter) writeBool(b bool) {
+
+	if b {
+		mw.write(0xc3)
+	} else {
+		mw.write(0xc2)
+	}
+}
+
+func (mw *msgpackWriter) writeUint(u uint64) {
+
+	switch {
+	case u < 128:
+		mw.write(byte(u))
+	case u <= math.MaxUint8:
+		mw.write(0xcc, byte(u))
+	case u <= math.MaxUint16:
+		mw.write(0xcd, byte(u>>8), byte(u))
+	case u <= math.MaxUint32:
+		mw.write(0xce, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+	default:
+		b := make([]byte, 9)
+		b[0] = 0xcf
+		binary.BigEndian.PutUint64(b[1:], u)
+		mw.write(b...)
+	}
+}
+
+func (mw *msgpackWriter) writeString(s string) {
+
+	if len(s) < 32 {
+		mw.write(0xa0 | byte(len(s)))
+	} else {
+		mw.writeHeader(len(s), 0xd9, 0xda, 0xdb)
+	}
+	mw.write([]byte(s)...)
+}
+
+func (mw *msgpackWriter) writeBytes(b []byte) {
+
+	if b == nil {
+		mw.writeNil()
+		return
+	}
+	mw.writeHeader(len(b), 0xc4, 0xc5, 0xc6)
+	mw.write(b...)
+}
+
+func (mw *msgpackWriter) writeArrayHeader(n int) {
+
+	if n < 16 {
+		mw.write(0x90 | byte(n))
+	} else {
+		mw.writeHeader(n, 0, 0xdc, 0xdd)
+	}
+}
+
+func (mw *msgpackWriter) writeMapHeader(n int) {
+
+	if n < 16 {
+		mw.write(0x80 | byte(n))
+	} else {
+		mw.writeHeader(n, 0, 0xde, 0xdf)
+	}
+}
+
+func (mw *msgpackWriter) writeStrings(ss []string) {
+
+	mw.writeArrayHeader(len(ss))
+	for _, s := range ss {
+		mw.writeString(s)
+	}
+}
+
+// writeTime writes the given time as seconds since the epoch, or as nil for
+// the zero time.
+func (mw *msgpackWriter) writeTime(t time.Time) {
+
+	if t.IsZero() {
+		mw.writeNil()
+		return
+	}
+	mw.writeUint(uint64(t.Unix()))
+}
+
+// writeIP writes the given address in its compact binary form.
+func (mw *msgpackWriter) writeIP(ip net.IP) {
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	mw.writeBytes(ip)
+}
+
+// writeFields writes the given key-value pairs as a map.
+func (mw *msgpackWriter) writeFields(fields []keyValue) {
+
+	mw.writeMapHeader(len(fields))
+	for _, field := range fields {
+		mw.writeString(field.key)
+		switch v := field.value.(type) {
+		case string:
+			mw.writeString(v)
+		case bool:
+			mw.writeBool(v)
+		case uint16:
+			mw.writeUint(uint64(v))
+		case uint64:
+			mw.writeUint(v)
+		case []string:
+			mw.writeStrings(v)
+		case time.Time:
+			mw.writeTime(v)
+		case net.IP:
+			mw.writeIP(v)
+		default:
+			mw.err = fmt.Errorf("cannot encode %T as MessagePack", v)
+		}
+	}
+}
+
+func (s *RouterStatus) msgpackFields() []keyValue {
+
+	return []keyValue{
+		{"fpr", string(s.Fingerprint)},
+		{"nick", s.Nickname},
+		{"digest", s.Digest},
+		{"pub", s.Publication},
+		{"ip4", s.Address.IPv4Address},
+		{"or4", s.Address.IPv4ORPort},
+		{"dir4", s.Address.IPv4DirPort},
+		{"ip6", s.Address.IPv6Address},
+		{"or6", s.Address.IPv6ORPort},
+		{"flags", s.Flags.flagNames()},
+		{"ver", s.TorVersion},
+		{"bw", s.Bandwidth},
+		{"meas", s.Measured},
+		{"unmeas", s.Unmeasured},
+		{"acc", s.Accept},
+		{"ports", s.PortList},
+	}
+}
+
+func (rd *RouterDescriptor) msgpackFields() []keyValue {
+
+	var family []string
+	for fpr := range rd.Family {
+		family = append(family, string(fpr))
+	}
+
+	return []keyValue{
+		{"fpr", string(rd.Fingerprint)},
+		{"nick", rd.Nickname},
+		{"addr", rd.Address},
+		{"or", rd.ORPort},
+		{"socks", rd.SOCKSPort},
+		{"dir", rd.DirPort},
+		{"bwavg", rd.BandwidthAvg},
+		{"bwburst", rd.BandwidthBurst},
+		{"bwobs", rd.BandwidthObs},
+		{"os", rd.OperatingSystem},
+		{"ver", rd.TorVersion},
+		{"pub", rd.Published},
+		{"uptime", rd.Uptime},
+		{"hib", rd.Hibernating},
+		{"family", family},
+		{"contact", rd.Contact},
+		{"hsdir", rd.HiddenServiceDir},
+		{"bdr", rd.BridgeDistributionRequest},
+		{"onion", rd.OnionKey},
+		{"ntor", rd.NTorOnionKey},
+		{"signing", rd.SigningKey},
+		{"policy", rd.RawExitPolicy},
+		{"acc6", rd.Accept6},
+		{"ports6", rd.PortList6},
+	}
+}
+
+// EncodeMsgpack writes the given consensus or router descriptors to w using
+// a compact MessagePack encoding.  The encoding is a map that carries the
+// schema version, the kind of object set, and its entries.  Consensus meta
+// information other than the validity period is not encoded.
+func EncodeMsgpack(w io.Writer, objs ObjectSet) error {
+
+	mw := &msgpackWriter{w: bufio.NewWriter(w)}
+
+	switch set := objs.(type) {
+	case *Consensus:
+		mw.writeMapHeader(6)
+		mw.writeString("v")
+		mw.writeUint(MsgpackSchemaVersion)
+		mw.writeString("kind")
+		mw.writeString(msgpackKindConsensus)
+		mw.writeString("valid_after")
+		mw.writeTime(set.ValidAfter)
+		mw.writeString("fresh_until")
+		mw.writeTime(set.FreshUntil)
+		mw.writeString("valid_until")
+		mw.writeTime(set.ValidUntil)
+		mw.writeString("entries")
+		mw.writeArrayHeader(set.Length())
+		for _, getStatus := range set.RouterStatuses {
+			mw.writeFields(getStatus().msgpackFields())
+		}
+	case *RouterDescriptors:
+		mw.writeMapHeader(3)
+		mw.writeString("v")
+		mw.writeUint(MsgpackSchemaVersion)
+		mw.writeString("kind")
+		mw.writeString(msgpackKindDescriptors)
+		mw.writeString("entries")
+		mw.writeArrayHeader(set.Length())
+		for _, getDescriptor := range set.RouterDescriptors {
+			mw.writeFields(getDescriptor().msgpackFields())
+		}
+	default:
+		return fmt.Errorf("cannot encode %T as MessagePack", objs)
+	}
+
+	if mw.err != nil {
+		return mw.err
+	}
+
+	return mw.w.Flush()
+}
+
+// msgpackReader reads MessagePack values into generic Go values: nil, bool,
+// uint64, int64, float64, string, []byte, []interface{}, and
+// map[string]interface{}.
+type msgpackReader struct {
+	r *bufio.Reader
+}
+
+func (mr *msgpackReader) readN(n uint64) ([]byte, error) {
+
+	if n > math.MaxInt32 {
+		return nil, errors.New("MessagePack value too large")
+	}
+	return readBounded(mr.r, int64(n))
+}
+
+// boundedReadSize is the largest number of bytes that readBounded allocates
+// before it has seen the data.
+const boundedReadSize = 64 * 1024
+
+// readBounded reads exactly n bytes from r, like io.ReadFull.  Large reads
+// are done in chunks, so that a bogus length prefix cannot make us allocate
+// much more memory than r actually holds.
+func readBounded(r io.Reader, n int64) ([]byte, error) {
+
+	if n <= boundedReadSize {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, n); err != nil {
+		if err == io.EOF && buf.Len() > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (mr *msgpackReader) readUint(size int) (uint64, error) {
+
+	b, err := mr.readN(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (mr *msgpackReader) readValue() (interface{}, error) {
+
+	t, err := mr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t <= 0x7f:
+		return uint64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xe0 == 0xa0:
+		b, err := mr.readN(uint64(t & 0x1f))
+		return string(b), err
+	case t&0xf0 == 0x90:
+		return mr.readArray(uint64(t & 0x0f))
+	case t&0xf0 == 0x80:
+		return mr.readMap(uint64(t & 0x0f))
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return mr.readUint(1 << (t - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (t - 0xd0)
+		u, err := mr.readUint(size)
+		// Sign-extend the value.
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, err
+	case 0xca:
+		u, err := mr.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := mr.readUint(8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		var size int
+		switch t {
+		case 0xd9, 0xc4:
+			size = 1
+		case 0xda, 0xc5:
+			size = 2
+		default:
+			size = 4
+		}
+		n, err := mr.readUint(size)
+		if err != nil {
+			return nil, err
+		}
+		b, err := mr.readN(n)
+		if t >= 0xd9 {
+			return string(b), err
+		}
+		return b, err
+	case 0xdc, 0xdd:
+		n, err := mr.readUint(2 << (t - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return mr.readArray(n)
+	case 0xde, 0xdf:
+		n, err := mr.readUint(2 << (t - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return mr.readMap(n)
+	}
+
+	return nil, fmt.Errorf("unsupported MessagePack type 0x%02x", t)
+}
+
+func (mr *msgpackReader) readArray(n uint64) ([]interface{}, error) {
+
+	var values []interface{}
+	for i := uint64(0); i < n; i++ {
+		v, err := mr.readValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+func (mr *msgpackReader) readMap(n uint64) (map[string]interface{}, error) {
+
+	m := make(map[string]interface{})
+	for i := uint64(0); i < n; i++ {
+		k, err := mr.readValue()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected MessagePack map key %v", k)
+		}
+		if m[key], err = mr.readValue(); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// msgpackFields provides typed access to a decoded MessagePack map.  Missing
+// keys and values of unexpected types result in zero values.
+type msgpackFields map[string]interface{}
+
+func (m msgpackFields) string(key string) string {
+
+	s, _ := m[key].(string)
+	return s
+}
+
+func (m msgpackFields) bool(key string) bool {
+
+	b, _ := m[key].(bool)
+	return b
+}
+
+func (m msgpackFields) uint64(key string) uint64 {
+
+	switch v := m[key].(type) {
+	case uint64:
+		return v
+	case int64:
+		if v >= 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
+
+func (m msgpackFields) uint16(key string) uint16 {
+
+	return uint16(m.uint64(key))
+}
+
+func (m msgpackFields) time(key string) time.Time {
+
+	if m[key] == nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(m.uint64(key)), 0).UTC()
+}
+
+func (m msgpackFields) ip(key string) net.IP {
+
+	b, _ := m[key].([]byte)
+	if b == nil {
+		return nil
+	}
+	return net.IP(b)
+}
+
+func (m msgpackFields) strings(key string) []string {
+
+	values, _ := m[key].([]interface{})
+	var ss []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+// routerStatus turns the decoded fields into a router status.
+func (f msgpackFields) routerStatus() *RouterStatus {
+
+	return &RouterStatus{
+		Fingerprint: Fingerprint(f.string("fpr")),
+		Nickname:    f.string("nick"),
+		Digest:      f.string("digest"),
+		Publication: f.time("pub"),
+		Address: RouterAddress{
+			IPv4Address: f.ip("ip4"),
+			IPv4ORPort:  f.uint16("or4"),
+			IPv4DirPort: f.uint16("dir4"),
+			IPv6Address: f.ip("ip6"),
+			IPv6ORPort:  f.uint16("or6"),
+		},
+		Flags:      *parseRouterFlags(f.strings("flags")),
+		TorVersion: f.string("ver"),
+		Bandwidth:  f.uint64("bw"),
+		Measured:   f.uint64("meas"),
+		Unmeasured: f.bool("unmeas"),
+		Accept:     f.bool("acc"),
+		PortList:   f.string("ports"),
+	}
+}
+
+// routerDescriptor turns the decoded fields into a router descriptor.
+func (f msgpackFields) routerDescriptor() *RouterDescriptor {
+
+	desc := NewRouterDescriptor()
+	desc.Fingerprint = Fingerprint(f.string("fpr"))
+	desc.Nickname = f.string("nick")
+	desc.Address = f.ip("addr")
+	desc.ORPort = f.uint16("or")
+	desc.SOCKSPort = f.uint16("socks")
+	desc.DirPort = f.uint16("dir")
+	desc.BandwidthAvg = f.uint64("bwavg")
+	desc.BandwidthBurst = f.uint64("bwburst")
+	desc.BandwidthObs = f.uint64("bwobs")
+	desc.OperatingSystem = f.string("os")
+	desc.TorVersion = f.string("ver")
+	desc.Published = f.time("pub")
+	desc.Uptime = f.uint64("uptime")
+	desc.Hibernating = f.bool("hib")
+	for _, fpr := range f.strings("family") {
+		desc.Family[Fingerprint(fpr)] = true
+	}
+	desc.Contact = f.string("contact")
+	desc.HiddenServiceDir = f.bool("hsdir")
+	desc.BridgeDistributionRequest = f.string("bdr")
+	desc.OnionKey = f.string("onion")
+	desc.NTorOnionKey = f.string("ntor")
+	desc.SigningKey = f.string("signing")
+	// Rebuild the structured exit policy from its raw lines, like
+	// UnmarshalJSON does.
+	for _, line := range strings.Split(f.string("policy"), "\n") {
+		if words := strings.Split(line, " "); len(words) == 2 {
+			desc.addExitRule(words[0], words[1])
+		}
+	}
+	desc.Accept6 = f.bool("acc6")
+	desc.PortList6 = f.string("ports6")
+
+	return desc
+}
+
+// DecodeMsgpack reads an object set that was written by EncodeMsgpack.  It
+// returns a *Consensus or *RouterDescriptors, depending on what was encoded.
+// An error is returned if the encoding uses a newer schema version than this
+// version of zoossh understands.
+func DecodeMsgpack(r io.Reader) (ObjectSet, error) {
+
+	mr := &msgpackReader{r: bufio.NewReader(r)}
+	v, err := mr.readValue()
+	if err != nil {
+		return nil, err
+	}
+	top, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("MessagePack encoding is not a map")
+	}
+	header := msgpackFields(top)
+
+	if version := header.uint64("v"); version == 0 || version > MsgpackSchemaVersion {
+		return nil, fmt.Errorf("unsupported MessagePack schema version %d", version)
+	}
+
+	entries, _ := top["entries"].([]interface{})
+
+	switch kind := header.string("kind"); kind {
+	case msgpackKindConsensus:
+		consensus := NewConsensus()
+		consensus.ValidAfter = header.time("valid_after")
+		consensus.FreshUntil = header.time("fresh_until")
+		consensus.ValidUntil = header.time("valid_until")
+		for _, entry := range entries {
+			m, _ := entry.(map[string]interface{})
+			status := msgpackFields(m).routerStatus()
+			consensus.Set(status.Fingerprint, status)
+		}
+		return consensus, nil
+
+	case msgpackKindDescriptors:
+		descs := NewRouterDescriptors()
+		for _, entry := range entries {
+			m, _ := entry.(map[string]interface{})
+			desc := msgpackFields(m).routerDescriptor()
+			descs.Set(desc.Fingerprint, desc)
+		}
+		return descs, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported MessagePack object set kind %q", kind)
+	}
+}
@@ -0,0 +1,142 @@
+// Tests functions from "msgpack.go".
+
+package zoossh
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMsgpackConsensusRoundTrip(t *testing.T) {
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeMsgpack(&buf, consensus); err != nil {
+		t.Fatal(err)
+	}
+
+	objs, err := DecodeMsgpack(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, ok := objs.(*Consensus)
+	if !ok {
+		t.Fatalf("Decoded %T instead of *Consensus.", objs)
+	}
+
+	if decoded.Length() != consensus.Length() {
+		t.Fatalf("Decoded %d statuses instead of %d.", decoded.Length(), consensus.Length())
+	}
+	if !decoded.ValidAfter.Equal(consensus.ValidAfter) {
+		t.Error("Validity period did not survive round trip.")
+	}
+	for fpr, getStatus := range consensus.RouterStatuses {
+		status, found := decoded.Get(fpr)
+		if !found {
+			t.Fatalf("Status %s missing after round trip.", fpr)
+		}
+		orig := getStatus()
+		if status.String() != orig.String() || status.Bandwidth != orig.Bandwidth ||
+			status.Digest != orig.Digest || status.PortList != orig.PortList {
+			t.Fatalf("Status %s changed during round trip: %s vs %s", fpr, status, orig)
+		}
+	}
+}
+
+func TestMsgpackDescriptorsRoundTrip(t *testing.T) {
+
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+
+	descs, err := ParseDescriptorFile(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeMsgpack(&buf, descs); err != nil {
+		t.Fatal(err)
+	}
+
+	objs, err := DecodeMsgpack(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := objs.(*RouterDescriptors)
+
+	for fpr, getDesc := range descs.RouterDescriptors {
+		desc, found := decoded.Get(fpr)
+		if !found {
+			t.Fatalf("Descriptor %s missing after round trip.", fpr)
+		}
+		orig := getDesc()
+		if desc.String() != orig.String() || desc.RawExitPolicy != orig.RawExitPolicy ||
+			len(desc.Family) != len(orig.Family) || desc.BandwidthObs != orig.BandwidthObs {
+			t.Fatalf("Descriptor %s changed during round trip.", fpr)
+		}
+		if len(desc.ExitPolicy.Rules) != len(orig.ExitPolicy.Rules) || desc.RawAccept != orig.RawAccept ||
+			desc.RawReject != orig.RawReject || desc.Accept6 != orig.Accept6 || desc.PortList6 != orig.PortList6 {
+			t.Fatalf("Exit policy of descriptor %s changed during round trip.", fpr)
+		}
+	}
+
+	// The exit policy of a relay that rejects everything must survive.
+	desc, found := decoded.Get("7FD498BF50860E2F6D2DDAC5BE440597E8B384DB")
+	if !found {
+		t.Fatal("Reject-all descriptor missing after round trip.")
+	}
+	if desc.AcceptsPort(80) {
+		t.Error("Reject-all descriptor accepts port 80 after round trip.")
+	}
+	filter := NewObjectFilter()
+	filter.AddExitPort(80)
+	if filter.MatchesRouterDescriptor(desc) {
+		t.Error("Reject-all descriptor passes exit port filter after round trip.")
+	}
+}
+
+func TestMsgpackSchemaVersion(t *testing.T) {
+
+	var buf bytes.Buffer
+	mw := &msgpackWriter{w: bufio.NewWriter(&buf)}
+	mw.writeMapHeader(2)
+	mw.writeString("v")
+	mw.writeUint(MsgpackSchemaVersion + 1)
+	mw.writeString("kind")
+	mw.writeString(msgpackKindConsensus)
+	mw.w.Flush()
+
+	if _, err := DecodeMsgpack(&buf); err == nil {
+		t.Error("Newer schema version did not raise an error.")
+	}
+}
+
+func TestMsgpackOversizedLength(t *testing.T) {
+
+	// A string that claims to be almost 2 GiB long but ends right away.
+	for _, input := range [][]byte{{0xdb, 0x7f, 0xff, 0xff, 0xff}, {0xdb, 0x7f, 0xff, 0xff, 0xff, 'a'}} {
+		if _, err := DecodeMsgpack(bytes.NewReader(input)); err == nil {
+			t.Errorf("Truncated input %x did not raise an error.", input)
+		}
+	}
+
+	b, err := readBounded(bytes.NewReader(make([]byte, 3*boundedReadSize)), 2*boundedReadSize)
+	if err != nil || len(b) != 2*boundedReadSize {
+		t.Errorf("Expected %d bytes but got %d (%v).", 2*boundedReadSize, len(b), err)
+	}
+	if _, err := readBounded(bytes.NewReader(make([]byte, boundedReadSize)), 2*boundedReadSize); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF but got %v.", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Parses Onionoo details documents.
+
+package zoossh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// onionooRelay holds the members of an Onionoo relay details object that map
+// to router status fields.
+type onionooRelay struct {
+	Nickname          string              `json:"nickname"`
+	Fingerprint       string              `json:"fingerprint"`
+	ORAddresses       []string            `json:"or_addresses"`
+	DirAddress        string              `json:"dir_address"`
+	LastRestarted     string              `json:"last_restarted"`
+	Running           bool                `json:"running"`
+	Flags             []string            `json:"flags"`
+	ConsensusWeight   uint64              `json:"consensus_weight"`
+	Version           string              `json:"version"`
+	ExitPolicySummary map[string][]string `json:"exit_policy_summary"`
+}
+
+// onionooDetails holds the members of an Onionoo details document that we
+// are interested in.
+type onionooDetails struct {
+	RelaysPublished string         `json:"relays_published"`
+	Relays          []onionooRelay `json:"relays"`
+}
+
+// routerStatus turns the Onionoo relay details object into a router status.
+func (relay *onionooRelay) routerStatus() (*RouterStatus, error) {
+
+	status := &RouterStatus{
+		Nickname:    relay.Nickname,
+		Fingerprint: SanitiseFingerprint(Fingerprint(relay.Fingerprint)),
+		Flags:       *parseRouterFlags(relay.Flags),
+		TorVersion:  relay.Version,
+		Bandwidth:   relay.ConsensusWeight,
+	}
+	if !hexFingerprintRegexp.MatchString(string(status.Fingerprint)) {
+		return nil, fmt.Errorf("invalid fingerprint: %q", relay.Fingerprint)
+	}
+
+	// Onionoo lists the primary address first, followed by the addresses of
+	// "a" lines.  We keep the first IPv4 and the first IPv6 address.
+	for _, address := range relay.ORAddresses {
+		endpoint, err := parseEndpoint(address)
+		if err != nil {
+			return nil, err
+		}
+		if endpoint.IP.To4() != nil && status.Address.IPv4Address == nil {
+			status.Address.IPv4Address = endpoint.IP
+			status.Address.IPv4ORPort = endpoint.Port
+		} else if endpoint.IP.To4() == nil && status.Address.IPv6Address == nil {
+			status.Address.IPv6Address = endpoint.IP
+			status.Address.IPv6ORPort = endpoint.Port
+		}
+	}
+	if relay.DirAddress != "" {
+		endpoint, err := parseEndpoint(relay.DirAddress)
+		if err != nil {
+			return nil, err
+		}
+		status.Address.IPv4DirPort = endpoint.Port
+	}
+
+	// The exit policy summary has either an "accept" or a "reject" member.
+	if ports, ok := relay.ExitPolicySummary["accept"]; ok {
+		status.Accept = true
+		status.PortList = strings.Join(ports, ",")
+	} else if ports, ok := relay.ExitPolicySummary["reject"]; ok {
+		status.PortList = strings.Join(ports, ",")
+	}
+
+	return status, nil
+}
+
+// ParseOnionooDetails parses an Onionoo details document and returns its
+// relays as consensus, so that it can be compared with parsed consensuses
+// using the usual set operations.  Only relays that are running, i.e., that
+// are part of the latest consensus, are included.  The consensus' ValidAfter
+// time is set to the document's "relays_published" time.  Onionoo lacks the
+// descriptor digest and publication time of router statuses, so these fields
+// are left empty.
+func ParseOnionooDetails(r io.Reader) (*Consensus, error) {
+
+	var details onionooDetails
+	if err := json.NewDecoder(r).Decode(&details); err != nil {
+		return nil, err
+	}
+
+	consensus := NewConsensus()
+	if details.RelaysPublished != "" {
+		published, err := time.Parse(publishedTimeLayout, details.RelaysPublished)
+		if err != nil {
+			return nil, err
+		}
+		consensus.ValidAfter = published
+	}
+
+	for i := range details.Relays {
+		relay := &details.Relays[i]
+		if !relay.Running {
+			continue
+		}
+		status, err := relay.routerStatus()
+		if err != nil {
+			return nil, fmt.Errorf("relay %q: %s", relay.Fingerprint, err)
+		}
+		consensus.Set(status.Fingerprint, status)
+	}
+
+	return consensus, nil
+}
+
+// ParseOnionooDetailsFile is a wrapper around ParseOnionooDetails that parses
+// the named file.
+func ParseOnionooDetailsFile(fileName string) (*Consensus, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return ParseOnionooDetails(fd)
+}
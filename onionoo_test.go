@@ -0,0 +1,84 @@
+// Tests functions from "onionoo.go".
+
+package zoossh
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testOnionooDetails = `{"version":"8.0",
+"relays_published":"2021-03-04 12:00:00",
+"relays":[
+{"nickname":"seele","fingerprint":"000A10D43011EA4928A35F610405F92B4433B4DC",
+ "or_addresses":["73.15.150.172:9001","[2001:db8::1]:9001"],"running":true,
+ "flags":["Fast","Running","Stable","Valid"],"consensus_weight":20,
+ "version":"0.4.5.6","exit_policy_summary":{"reject":["1-65535"]}},
+{"nickname":"Karlstad0","fingerprint":"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645",
+ "or_addresses":["193.11.166.194:9000"],"dir_address":"193.11.166.194:9030",
+ "running":true,"flags":["Exit","Fast","Guard","HSDir","Running","Stable","V2Dir","Valid"],
+ "consensus_weight":2670,"version":"0.4.4.7",
+ "exit_policy_summary":{"accept":["80","443"]}},
+{"nickname":"gone","fingerprint":"1111111111111111111111111111111111111111",
+ "or_addresses":["192.0.2.1:443"],"running":false,"flags":["Valid"]}
+]}`
+
+// Test the function ParseOnionooDetails().
+func TestParseOnionooDetails(t *testing.T) {
+
+	consensus, err := ParseOnionooDetails(strings.NewReader(testOnionooDetails))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if consensus.Length() != 2 {
+		t.Fatalf("Expected two running relays but got %d.", consensus.Length())
+	}
+	if !consensus.ValidAfter.Equal(time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)) {
+		t.Error("Unexpected publication time.", consensus.ValidAfter)
+	}
+
+	seele, ok := consensus.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if !ok {
+		t.Fatal("Relay \"seele\" is missing.")
+	}
+	if seele.Nickname != "seele" || seele.Bandwidth != 20 || seele.TorVersion != "0.4.5.6" {
+		t.Error("Unexpected router status.", seele)
+	}
+	if seele.Address.IPv4Address.String() != "73.15.150.172" || seele.Address.IPv4ORPort != 9001 {
+		t.Error("Unexpected IPv4 address.", seele.Address)
+	}
+	if seele.Address.IPv6Address.String() != "2001:db8::1" || seele.Address.IPv6ORPort != 9001 {
+		t.Error("Unexpected IPv6 address.", seele.Address)
+	}
+	if seele.Accept || seele.PortList != "1-65535" {
+		t.Error("Unexpected exit policy.", seele.PortList)
+	}
+
+	karlstad, _ := consensus.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+	if !karlstad.Flags.Exit || !karlstad.Flags.Guard || karlstad.Flags.BadExit {
+		t.Error("Unexpected flags.", karlstad.Flags)
+	}
+	if karlstad.Address.IPv4DirPort != 9030 {
+		t.Error("Unexpected directory port.", karlstad.Address.IPv4DirPort)
+	}
+	if !karlstad.Accept || karlstad.PortList != "80,443" {
+		t.Error("Unexpected exit policy.", karlstad.PortList)
+	}
+
+	// The Onionoo relays should match the relays of the vote.
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.Intersect(vote).Length() != vote.Length() {
+		t.Error("Onionoo relays don't match vote relays.")
+	}
+
+	// Malformed fingerprints must be rejected.
+	broken := strings.Replace(testOnionooDetails, "000A10D4", "XYZ", 1)
+	if _, err := ParseOnionooDetails(strings.NewReader(broken)); err == nil {
+		t.Error("Malformed fingerprint was accepted.")
+	}
+}
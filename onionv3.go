@@ -0,0 +1,137 @@
+// Parses version 3 onion service descriptors.
+
+package zoossh
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The prefix of the signed portion of version 3 onion service descriptors.
+const onionServiceDescriptorSigPrefix = "Tor onion service descriptor sig v3"
+
+// OnionServiceDescriptor is the plaintext outer layer of a version 3 onion
+// service descriptor as defined in rend-spec-v3.txt, Section 2.4.
+//
+// The inner layers are kept as ciphertext: decrypting them requires SHAKE-256,
+// which Go's standard library lacks.
+type OnionServiceDescriptor struct {
+	// The single fields of a "hs-descriptor" line.
+	Version int
+
+	// The single fields of a "descriptor-lifetime" line.
+	Lifetime time.Duration
+
+	// The certificate of the "descriptor-signing-key-cert" line.  It
+	// certifies the descriptor signing key and is signed by the service's
+	// blinded key.
+	SigningKeyCert *Ed25519Certificate
+
+	// The single fields of a "revision-counter" line.
+	RevisionCounter uint64
+
+	// The ciphertext of the "superencrypted" object.
+	Superencrypted []byte
+
+	// The signature of the "signature" line.
+	Signature []byte
+
+	// The signed portion of the descriptor.
+	signed string
+}
+
+// BlindedKey returns the service's blinded public key for the descriptor's
+// time period, which signed the descriptor signing key certificate.
+func (osd *OnionServiceDescriptor) BlindedKey() ed25519.PublicKey {
+
+	return osd.SigningKeyCert.SigningKey
+}
+
+// VerifySignature checks the descriptor signing key certificate against the
+// blinded key and the descriptor's signature against the descriptor signing
+// key.
+func (osd *OnionServiceDescriptor) VerifySignature() error {
+
+	if err := osd.SigningKeyCert.Verify(nil); err != nil {
+		return err
+	}
+
+	key := ed25519.PublicKey(osd.SigningKeyCert.CertifiedKey)
+	if !ed25519.Verify(key, []byte(onionServiceDescriptorSigPrefix+osd.signed), osd.Signature) {
+		return errors.New("invalid descriptor signature")
+	}
+
+	return nil
+}
+
+// ParseRawOnionServiceDescriptor parses the outer layer of a raw version 3
+// onion service descriptor (in string format).
+func ParseRawOnionServiceDescriptor(rawDescriptor string) (*OnionServiceDescriptor, error) {
+
+	osd := &OnionServiceDescriptor{}
+
+	// The signature covers everything up to the "signature" line.
+	if i := strings.Index(rawDescriptor, "\nsignature "); i >= 0 {
+		osd.signed = rawDescriptor[:i+1]
+	} else {
+		return nil, errors.New("missing \"signature\" line")
+	}
+
+	err := readPEMObjects(rawDescriptor, func(words []string, object string) error {
+
+		var err error
+		value := ""
+		if len(words) > 1 {
+			value = words[1]
+		}
+
+		switch words[0] {
+		case "hs-descriptor":
+			osd.Version, err = strconv.Atoi(value)
+
+		case "descriptor-lifetime":
+			var minutes uint64
+			minutes, err = strconv.ParseUint(value, 10, 32)
+			osd.Lifetime = time.Duration(minutes) * time.Minute
+
+		case "descriptor-signing-key-cert":
+			osd.SigningKeyCert, err = parseEd25519CertificatePEM(object)
+
+		case "revision-counter":
+			osd.RevisionCounter, err = strconv.ParseUint(value, 10, 64)
+
+		case "superencrypted":
+			block, _ := pem.Decode([]byte(object))
+			if block == nil {
+				return errors.New("malformed superencrypted object")
+			}
+			osd.Superencrypted = block.Bytes
+
+		case "signature":
+			osd.Signature, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+		}
+
+		if err != nil {
+			return fmt.Errorf("malformed %q line: %s", words[0], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if osd.Version != 3 {
+		return nil, fmt.Errorf("unsupported onion service descriptor version %d", osd.Version)
+	}
+	if osd.SigningKeyCert == nil {
+		return nil, errors.New("missing \"descriptor-signing-key-cert\" line")
+	}
+
+	return osd, nil
+}
@@ -0,0 +1,76 @@
+// Tests functions from "onionv3.go".
+
+package zoossh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testOnionServiceDescriptor returns a descriptor that is signed by a fresh
+// descriptor signing key, which in turn is certified by the given blinded
+// key.
+func testOnionServiceDescriptor(blinded ed25519.PrivateKey) string {
+
+	signingPub, signing, _ := ed25519.GenerateKey(rand.Reader)
+	cert := testEd25519Certificate(CertTypeHSDescSigningKey, signingPub, blinded)
+
+	body := "hs-descriptor 3\n" +
+		"descriptor-lifetime 180\n" +
+		"descriptor-signing-key-cert\n" +
+		string(pem.EncodeToMemory(&pem.Block{Type: "ED25519 CERT", Bytes: cert})) +
+		"revision-counter 42\n" +
+		"superencrypted\n" +
+		string(pem.EncodeToMemory(&pem.Block{Type: "MESSAGE", Bytes: []byte{1, 2, 3}}))
+
+	sig := ed25519.Sign(signing, []byte(onionServiceDescriptorSigPrefix+body))
+
+	return body + "signature " + base64.RawStdEncoding.EncodeToString(sig) + "\n"
+}
+
+func TestParseRawOnionServiceDescriptor(t *testing.T) {
+
+	blindedPub, blinded, _ := ed25519.GenerateKey(rand.Reader)
+	raw := testOnionServiceDescriptor(blinded)
+
+	osd, err := ParseRawOnionServiceDescriptor(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if osd.Version != 3 || osd.Lifetime != 3*time.Hour || osd.RevisionCounter != 42 {
+		t.Error("Unexpected descriptor fields.", osd)
+	}
+	if len(osd.Superencrypted) != 3 || osd.SigningKeyCert.Type != CertTypeHSDescSigningKey {
+		t.Error("Unexpected superencrypted layer or certificate.")
+	}
+	if !osd.BlindedKey().Equal(blindedPub) {
+		t.Error("Unexpected blinded key.")
+	}
+	if err := osd.VerifySignature(); err != nil {
+		t.Error(err)
+	}
+
+	tampered, err := ParseRawOnionServiceDescriptor(strings.Replace(raw, "revision-counter 42", "revision-counter 43", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tampered.VerifySignature() == nil {
+		t.Error("Tampered descriptor verified.")
+	}
+
+	for _, malformed := range []string{
+		strings.Replace(raw, "hs-descriptor 3", "hs-descriptor 2", 1),
+		strings.Replace(raw, "\nsignature ", "\nsig ", 1),
+		strings.Replace(raw, "descriptor-lifetime 180", "descriptor-lifetime x", 1),
+	} {
+		if _, err := ParseRawOnionServiceDescriptor(malformed); err == nil {
+			t.Errorf("Expected error for %q.", malformed)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Provides functional options for parsing documents.
+
+package zoossh
+
+import (
+	"context"
+	"io"
+)
+
+// Option configures how ParseConsensus, ParseDescriptors, and
+// ParseMicrodescriptors parse a document.
+type Option func(*parseOptions)
+
+// WithLazy delays parsing of single entries until they are accessed.  That
+// pays off when you won't access most entries.
+func WithLazy() Option {
+
+	return func(opts *parseOptions) {
+		opts.lazy = true
+	}
+}
+
+// WithStrict rejects truncated documents and entries with malformed fields
+// instead of ignoring the malformed fields.  See StrictlyParseConsensusFile
+// and StrictlyParseDescriptorFile for what is checked.
+func WithStrict() Option {
+
+	return func(opts *parseOptions) {
+		opts.validate = true
+		opts.strict = true
+		opts.tolerant = false
+	}
+}
+
+// WithTolerant accepts documents that are not well-formed, e.g., truncated
+// consensuses, which are otherwise rejected because their type annotation
+// calls for strict parsing.  Malformed fields are ignored.  WithTolerant
+// overrides an earlier WithStrict and vice versa.
+func WithTolerant() Option {
+
+	return func(opts *parseOptions) {
+		opts.validate = false
+		opts.strict = false
+		opts.tolerant = true
+	}
+}
+
+// WithAnnotationCheck determines if the document's type annotation is read
+// and checked, which is the default.  Documents without type annotation
+// require WithAnnotationCheck(false).
+func WithAnnotationCheck(check bool) Option {
+
+	return func(opts *parseOptions) {
+		opts.unchecked = !check
+	}
+}
+
+// WithWorkers parses entries using the given number of goroutines.
+func WithWorkers(n int) Option {
+
+	return func(opts *parseOptions) {
+		opts.workers = n
+	}
+}
+
+// WithOffsets records the byte offset and length of every entry within the
+// document in the entry's SourceOffset and SourceLength fields.
+func WithOffsets() Option {
+
+	return func(opts *parseOptions) {
+		opts.offsets = true
+	}
+}
+
+// WithContext stops parsing with the context's error once the given context
+// is done.
+func WithContext(ctx context.Context) Option {
+
+	return func(opts *parseOptions) {
+		opts.ctx = ctx
+	}
+}
+
+// WithSource names the document, e.g., after its file, in parsing errors.
+func WithSource(name string) Option {
+
+	return func(opts *parseOptions) {
+		opts.source = name
+	}
+}
+
+// WithPool shares router statuses with other consensuses that were parsed
+// using the same pool.  It is ignored along with WithOffsets.
+func WithPool(pool *StatusPool) Option {
+
+	return func(opts *parseOptions) {
+		opts.pool = pool
+	}
+}
+
+// WithBudget retains the parsed form of lazily parsed entries within the
+// given memory budget.
+func WithBudget(budget *MemoryBudget) Option {
+
+	return func(opts *parseOptions) {
+		opts.budget = budget
+	}
+}
+
+// WithStats records timing statistics of the parsing run in the given
+// statistics, except for the total time.
+func WithStats(stats *ParseStats) Option {
+
+	return func(opts *parseOptions) {
+		opts.stats = stats
+	}
+}
+
+// newParseOptions applies the given options to the default options.
+func newParseOptions(options []Option) parseOptions {
+
+	var opts parseOptions
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return opts
+}
+
+// ParseConsensus parses the network status document, e.g., a consensus, a
+// vote, or a bridge network status, read from r as configured by the given
+// options.  By default, the document must start with a type annotation and
+// router statuses are parsed right away.
+func ParseConsensus(r io.Reader, options ...Option) (*Consensus, error) {
+
+	opts := newParseOptions(options)
+	if opts.unchecked {
+		return parseConsensusUnchecked(r, opts)
+	}
+
+	return parseConsensus(r, opts)
+}
+
+// ParseDescriptors parses the server or bridge descriptors read from r as
+// configured by the given options.  By default, the document must start with
+// a type annotation and descriptors are parsed right away.
+func ParseDescriptors(r io.Reader, options ...Option) (*RouterDescriptors, error) {
+
+	opts := newParseOptions(options)
+	if opts.unchecked {
+		return parseDescriptorUnchecked(r, opts)
+	}
+
+	return parseDescriptor(r, opts)
+}
+
+// ParseMicrodescriptors parses the microdescriptors read from r as configured
+// by the given options.  By default, the document must start with a type
+// annotation and microdescriptors are parsed right away.  WithStrict,
+// WithWorkers, WithOffsets, WithPool, and WithStats do not apply to
+// microdescriptors.
+func ParseMicrodescriptors(r io.Reader, options ...Option) (*Microdescriptors, error) {
+
+	opts := newParseOptions(options)
+	if opts.unchecked {
+		return parseMicrodescriptorUnchecked(r, opts)
+	}
+
+	return parseMicrodescriptor(r, opts)
+}
@@ -0,0 +1,117 @@
+// Tests functions from "options.go".
+
+package zoossh
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Test the function ParseConsensus().
+func TestParseConsensus(t *testing.T) {
+
+	vote, err := ParseConsensus(strings.NewReader(testVote))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.Length() != 2 {
+		t.Errorf("Expected two router statuses but got %d.", vote.Length())
+	}
+
+	// Documents without annotation require the annotation check to be
+	// disabled.
+	unannotated := testVote[strings.Index(testVote, "\n")+1:]
+	if _, err := ParseConsensus(strings.NewReader(unannotated)); err == nil {
+		t.Error("Document without annotation was accepted.")
+	}
+	vote, err = ParseConsensus(strings.NewReader(unannotated), WithAnnotationCheck(false), WithLazy(), WithWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, ok := vote.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"); !ok || status.Nickname != "Karlstad0" {
+		t.Error("Router status \"Karlstad0\" is missing.")
+	}
+
+	// Malformed fields are only rejected when parsing strictly.
+	broken := strings.Replace(testVote, "193.11.166.194 9000 80", "193.11.166.194 90000 80", 1)
+	if _, err := ParseConsensus(strings.NewReader(broken)); err != nil {
+		t.Error(err)
+	}
+	_, err = ParseConsensus(strings.NewReader(broken), WithStrict(), WithSource("vote"))
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.File != "vote" || perr.Field != "ORPort" {
+		t.Errorf("Expected ParseError for ORPort but got %v.", err)
+	}
+
+	// Annotated consensuses are parsed strictly unless parsing tolerantly.
+	truncated := testVote[:strings.Index(testVote, "r Karlstad0 ")]
+	if _, err := ParseConsensus(strings.NewReader(truncated)); err == nil {
+		t.Error("Truncated consensus was accepted.")
+	}
+	vote, err = ParseConsensus(strings.NewReader(truncated), WithTolerant())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.Length() != 1 {
+		t.Errorf("Expected one router status in truncated consensus but got %d.", vote.Length())
+	}
+	if _, err := ParseConsensus(strings.NewReader(truncated), WithTolerant(), WithStrict()); err == nil {
+		t.Error("Truncated consensus was accepted despite WithStrict.")
+	}
+
+	vote, err = ParseConsensus(strings.NewReader(testVote), WithOffsets())
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ := vote.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if !strings.HasPrefix(testVote[status.SourceOffset:], "r seele ") {
+		t.Errorf("Unexpected offset %d.", status.SourceOffset)
+	}
+
+	// Positions are recorded when parsing, not on every access.
+	status.SourceOffset = 0
+	if status, _ = vote.Get("000A10D43011EA4928A35F610405F92B4433B4DC"); status.SourceOffset != 0 {
+		t.Error("Router status was modified on access.")
+	}
+
+	vote, err = ParseConsensus(strings.NewReader(testVote), WithOffsets(), WithLazy(), WithBudget(NewMemoryBudget(1<<20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		status, _ = vote.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+		if !strings.HasPrefix(testVote[status.SourceOffset:], "r seele ") {
+			t.Errorf("Unexpected offset %d of lazily parsed status.", status.SourceOffset)
+		}
+	}
+
+	stats := &ParseStats{}
+	if _, err := ParseConsensus(strings.NewReader(testVote), WithStats(stats)); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 {
+		t.Errorf("Expected statistics of two entries but got %d.", stats.Entries)
+	}
+}
+
+// Test the function ParseMicrodescriptors().
+func TestParseMicrodescriptors(t *testing.T) {
+
+	raw := testMicrodescriptor1 + testMicrodescriptor2
+	mds, err := ParseMicrodescriptors(strings.NewReader(raw), WithAnnotationCheck(false), WithLazy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mds.Length() != 2 {
+		t.Errorf("Expected two microdescriptors but got %d.", mds.Length())
+	}
+
+	mds, err = ParseMicrodescriptors(strings.NewReader("@type microdescriptor 1.0\n" + raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mds.Length() != 2 {
+		t.Errorf("Expected two microdescriptors but got %d.", mds.Length())
+	}
+}
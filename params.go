@@ -0,0 +1,92 @@
+// Provides tracking of consensus parameters across series of consensuses.
+
+package zoossh
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ParamChange records that a consensus parameter changed, e.g., that
+// "cbtquantile" went from "80" to "70".
+type ParamChange struct {
+	// The valid-after time of the first consensus with the new value.
+	ValidAfter time.Time
+
+	Param string
+
+	// The old and new value.  The old value is empty if the parameter was
+	// added and the new value is empty if it was removed.
+	Old string
+	New string
+}
+
+// String implements the Stringer interface for pretty printing.
+func (pc ParamChange) String() string {
+
+	t := pc.ValidAfter.UTC().Format(publishedTimeLayout)
+	switch {
+	case pc.Old == "":
+		return fmt.Sprintf("%s: %s added with value %s", t, pc.Param, pc.New)
+	case pc.New == "":
+		return fmt.Sprintf("%s: %s removed, was %s", t, pc.Param, pc.Old)
+	}
+
+	return fmt.Sprintf("%s: %s changed from %s to %s", t, pc.Param, pc.Old, pc.New)
+}
+
+// consensusParams returns the consensus' parameters with their values as
+// strings.
+func consensusParams(c *Consensus) map[string]string {
+
+	params := make(map[string]string, len(c.Params))
+	for key, value := range c.Params {
+		params[key] = strconv.Itoa(value)
+	}
+
+	return params
+}
+
+// ParamHistory walks the given chronological series of consensuses and
+// returns a change log of their "params" lines.  The parameters of the first
+// consensus serve as baseline and are not reported as changes.  Changes of
+// the same consensus are ordered by parameter name.
+func ParamHistory(in <-chan *Consensus) ([]ParamChange, error) {
+
+	var changes []ParamChange
+	var prev map[string]string
+	var last time.Time
+
+	for c := range in {
+		if err := checkChronological(c.ValidAfter, &last); err != nil {
+			drain(in)
+			return nil, err
+		}
+
+		cur := consensusParams(c)
+		if prev == nil {
+			prev = cur
+			continue
+		}
+
+		var changed []ParamChange
+		for key, value := range cur {
+			if prev[key] != value {
+				changed = append(changed, ParamChange{c.ValidAfter, key, prev[key], value})
+			}
+		}
+		for key, value := range prev {
+			if _, exists := cur[key]; !exists {
+				changed = append(changed, ParamChange{c.ValidAfter, key, value, ""})
+			}
+		}
+		sort.Slice(changed, func(i, j int) bool { return changed[i].Param < changed[j].Param })
+
+		changes = append(changes, changed...)
+		prev = cur
+	}
+
+	return changes, nil
+}
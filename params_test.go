@@ -0,0 +1,65 @@
+// Tests functions from "params.go".
+
+package zoossh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParamHistory(t *testing.T) {
+
+	start := time.Date(2017, time.April, 15, 0, 0, 0, 0, time.UTC)
+	params := []string{
+		"cbtquantile=80 DoSCircuitCreationEnabled=0",
+		"cbtquantile=80 DoSCircuitCreationEnabled=0",
+		"cbtquantile=70 DoSCircuitCreationEnabled=1 bwweightscale=10000",
+		"cbtquantile=70",
+	}
+
+	var consensuses []*Consensus
+	for i, p := range params {
+		c := NewConsensus()
+		c.ValidAfter = start.Add(time.Duration(i) * time.Hour)
+		var err error
+		if c.Params, err = parseParams([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+		consensuses = append(consensuses, c)
+	}
+
+	in := make(chan *Consensus)
+	go func() {
+		for _, c := range consensuses {
+			in <- c
+		}
+		close(in)
+	}()
+
+	changes, err := ParamHistory(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ParamChange{
+		{start.Add(2 * time.Hour), "DoSCircuitCreationEnabled", "0", "1"},
+		{start.Add(2 * time.Hour), "bwweightscale", "", "10000"},
+		{start.Add(2 * time.Hour), "cbtquantile", "80", "70"},
+		{start.Add(3 * time.Hour), "DoSCircuitCreationEnabled", "1", ""},
+		{start.Add(3 * time.Hour), "bwweightscale", "10000", ""},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes but got %v.", len(expected), changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected change %s but got %s.", expected[i], changes[i])
+		}
+	}
+
+	unordered, done := unorderedSeries(start)
+	if _, err := ParamHistory(unordered); err == nil {
+		t.Error("Out-of-order consensuses did not raise an error.")
+	}
+	expectDrained(t, done)
+}
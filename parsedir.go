@@ -0,0 +1,90 @@
+// Parses all files of a directory tree.
+
+package zoossh
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// ParseDirectory walks the directory tree rooted at dir, e.g., an extracted
+// CollecTor tarball, parses every regular file as in ParseUnknownFile, and
+// calls fn for each of them with the file's path.  Files are parsed by the
+// given number of goroutines, or by runtime.NumCPU() goroutines if workers is
+// below one, so fn is called in no particular order.  It is never called
+// concurrently, though.
+func ParseDirectory(dir string, workers int, fn FileFunc) error {
+
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	// Cancelling the context stops walking and parsing once fn returns an
+	// error.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	paths := make(chan string)
+	walkErr := make(chan error, 1)
+	go func() {
+		defer close(paths)
+		walkErr <- filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	type parsedFile struct {
+		path string
+		set  ObjectSet
+		err  error
+	}
+	files := make(chan parsedFile)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				set, err := ParseUnknownFile(path)
+				select {
+				case files <- parsedFile{path, set, err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(files)
+	}()
+
+	for file := range files {
+		if err := fn(file.path, file.set, file.err); err != nil {
+			cancel()
+			for range files {
+			}
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return <-walkErr
+}
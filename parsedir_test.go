@@ -0,0 +1,75 @@
+// Tests functions from "parsedir.go".
+
+package zoossh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test the function ParseDirectory().
+func TestParseDirectory(t *testing.T) {
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"vote":              testVote,
+		"micro/2021/03/md1": "@type microdescriptor 1.0\n" + testMicrodescriptor1,
+		"micro/2021/03/md2": testMicrodescriptor2,
+		"README":            "nothing to see here\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lengths := make(map[string]int)
+	err := ParseDirectory(dir, 2, func(path string, set ObjectSet, err error) error {
+		name, _ := filepath.Rel(dir, path)
+		if err != nil {
+			lengths[name] = -1
+		} else {
+			lengths[name] = set.Length()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{
+		"vote": 2,
+		filepath.Join("micro", "2021", "03", "md1"): 1,
+		filepath.Join("micro", "2021", "03", "md2"): 1,
+		"README": -1,
+	}
+	if len(lengths) != len(expected) {
+		t.Fatalf("Expected %d files but got %v.", len(expected), lengths)
+	}
+	for name, length := range expected {
+		if lengths[name] != length {
+			t.Errorf("Expected %d entries in %s but got %d.", length, name, lengths[name])
+		}
+	}
+
+	// Callbacks can stop parsing.
+	count := 0
+	err = ParseDirectory(dir, 0, func(string, ObjectSet, error) error {
+		count++
+		return ErrStop
+	})
+	if err != nil || count != 1 {
+		t.Errorf("Expected to stop after one file but got %d files and %v.", count, err)
+	}
+
+	if err := ParseDirectory(filepath.Join(dir, "missing"), 1, func(string, ObjectSet, error) error {
+		return nil
+	}); err == nil {
+		t.Error("Expected error for missing directory.")
+	}
+}
@@ -0,0 +1,105 @@
+// Provides deduplicated storage of router statuses across consensuses.
+
+package zoossh
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"sync"
+)
+
+type pooledStatus struct {
+	fingerprint Fingerprint
+	getStatus   GetStatus
+}
+
+// StatusPool stores router statuses that are shared across consensuses.  Most
+// router statuses don't change from one hourly consensus to the next, so
+// consensuses that are parsed using the same pool store each distinct router
+// status only once, which greatly reduces memory usage when loading long
+// consensus series.  Statuses are identified by the SHA-256 digest of their
+// raw text.
+//
+// As router statuses are shared, callers must not modify them.  Freezing the
+// resulting consensuses enforces that.  A StatusPool is safe for concurrent
+// use.
+type StatusPool struct {
+	mu       sync.Mutex
+	statuses map[[sha256.Size]byte]pooledStatus
+
+	// The number of router statuses that were added to the pool, including
+	// duplicates.
+	total int
+}
+
+// NewStatusPool returns a new and empty status pool.
+func NewStatusPool() *StatusPool {
+
+	return &StatusPool{statuses: make(map[[sha256.Size]byte]pooledStatus)}
+}
+
+// intern returns the pooled router status that has the given raw text, or
+// parses it using the given parser and adds it to the pool.  Parsing happens
+// without holding the lock, so that parsing workers don't wait for each
+// other.
+func (p *StatusPool) intern(rawStatus string, parser func(string) (Fingerprint, GetStatus, error)) (Fingerprint, GetStatus, error) {
+
+	digest := sha256.Sum256([]byte(rawStatus))
+
+	p.mu.Lock()
+	p.total++
+	pooled, exists := p.statuses[digest]
+	p.mu.Unlock()
+	if exists {
+		return pooled.fingerprint, pooled.getStatus, nil
+	}
+
+	fingerprint, getStatus, err := parser(rawStatus)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Another worker may have added the same status in the meantime, in
+	// which case we use its copy.
+	if pooled, exists := p.statuses[digest]; exists {
+		return pooled.fingerprint, pooled.getStatus, nil
+	}
+	p.statuses[digest] = pooledStatus{fingerprint, getStatus}
+
+	return fingerprint, getStatus, nil
+}
+
+// Stats returns the number of distinct router statuses in the pool and the
+// total number of router statuses that were added to it.
+func (p *StatusPool) Stats() (distinct, total int) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.statuses), p.total
+}
+
+// ParseConsensus parses the given annotated consensus, delaying the parsing of
+// router statuses if lazy is set.  Router statuses are shared with all other
+// consensuses that were parsed using the pool.
+func (p *StatusPool) ParseConsensus(r io.Reader, lazy bool) (*Consensus, error) {
+
+	return parseConsensus(r, parseOptions{lazy: lazy, pool: p})
+}
+
+// ParseConsensusFile is a wrapper around ParseConsensus that parses the named
+// file.
+func (p *StatusPool) ParseConsensusFile(fileName string, lazy bool) (*Consensus, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return p.ParseConsensus(fd, lazy)
+}
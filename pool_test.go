@@ -0,0 +1,93 @@
+// Tests functions from "pool.go".
+
+package zoossh
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStatusPool(t *testing.T) {
+
+	pool := NewStatusPool()
+
+	first, err := pool.ParseConsensus(strings.NewReader(testVote), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next hour's vote, in which only seele's weight changed.
+	next := strings.Replace(testVote, "valid-after 2021-03-05 01:00:00", "valid-after 2021-03-05 02:00:00", 1)
+	next = strings.Replace(next, "w Bandwidth=18 Measured=20", "w Bandwidth=19 Measured=21", 1)
+	second, err := pool.ParseConsensus(strings.NewReader(next), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if distinct, total := pool.Stats(); distinct != 3 || total != 4 {
+		t.Errorf("Expected 3 distinct out of 4 statuses but got %d out of %d.", distinct, total)
+	}
+
+	fpr := Fingerprint("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+	a, _ := first.Get(fpr)
+	b, _ := second.Get(fpr)
+	if a != b {
+		t.Error("Identical router statuses are not shared.")
+	}
+
+	fpr = Fingerprint("000A10D43011EA4928A35F610405F92B4433B4DC")
+	a, _ = first.Get(fpr)
+	b, _ = second.Get(fpr)
+	if a == b || a.Bandwidth != 18 || b.Bandwidth != 19 {
+		t.Error("Different router statuses were merged.")
+	}
+}
+
+func BenchmarkStatusPool(b *testing.B) {
+
+	// Only run this benchmark if the consensus file is there.
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		b.Skipf("skipping because of missing %s", consensusFile)
+	}
+
+	pool := NewStatusPool()
+	for i := 0; i < b.N; i++ {
+		if _, err := pool.ParseConsensusFile(consensusFile, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStatusPoolConcurrentIntern(t *testing.T) {
+
+	raw := "r seele AAoQ1DAR6kkoo19hBAX5K0QztNw bdrzhG0Kk/8DUsnSdmzj7DjFQjY 2021-03-04 12:27:05 73.15.150.172 9001 0\n"
+	pool := NewStatusPool()
+
+	// All workers must end up with the same pooled status.
+	statuses := make([]*RouterStatus, 8)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, getStatus, err := pool.intern(raw, ParseRawStatus)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses[i] = getStatus()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, status := range statuses {
+		if status != statuses[0] {
+			t.Fatal("Workers got different copies of the same status.")
+		}
+	}
+	if distinct, total := pool.Stats(); distinct != 1 || total != len(statuses) {
+		t.Errorf("Expected 1 distinct and %d total statuses but got %d and %d.", len(statuses), distinct, total)
+	}
+}
@@ -0,0 +1,122 @@
+// Parses CollecTor's bridge pool assignment files.
+
+package zoossh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var bridgePoolAssignmentAnnotations = map[Annotation]bool{
+	// The file format we currently (try to) support.
+	Annotation{"bridge-pool-assignment", "1", "0"}: true,
+}
+
+// BridgeAssignment is the distributor assignment of a single bridge, e.g.,
+// "https ring=3 flag=stable".
+type BridgeAssignment struct {
+	// The hashed fingerprint of the bridge.
+	Fingerprint Fingerprint
+
+	// The distributor, e.g., "https", "email", "moat", or "unallocated".
+	Distributor string
+
+	// Distributor-specific parameters such as "ring" or "port".
+	Params map[string]string
+}
+
+// BridgePoolAssignment is the set of assignments that BridgeDB made at a
+// single point in time.
+type BridgePoolAssignment struct {
+	// The time of the "bridge-pool-assignment" line.
+	Published time.Time
+
+	// A map from hashed bridge fingerprint to the bridge's assignment.
+	Assignments map[Fingerprint]*BridgeAssignment
+}
+
+// Distributors returns the number of bridges per distributor.
+func (bpa *BridgePoolAssignment) Distributors() map[string]int {
+
+	counts := make(map[string]int)
+	for _, assignment := range bpa.Assignments {
+		counts[assignment.Distributor]++
+	}
+
+	return counts
+}
+
+// ParseBridgePoolAssignment parses a bridge pool assignment document.  The
+// type annotation is optional.
+func ParseBridgePoolAssignment(r io.Reader) (*BridgePoolAssignment, error) {
+
+	br := bufio.NewReader(r)
+	if first, _ := br.Peek(1); len(first) == 1 && first[0] == '@' {
+		annotation, rest, err := readAnnotation(br)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := bridgePoolAssignmentAnnotations[*annotation]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnexpectedAnnotation, annotation)
+		}
+		br = bufio.NewReader(rest)
+	}
+
+	bpa := &BridgePoolAssignment{Assignments: make(map[Fingerprint]*BridgeAssignment)}
+
+	scanner := bufio.NewScanner(br)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+
+		if words[0] == "bridge-pool-assignment" {
+			if len(words) != 3 {
+				return nil, fmt.Errorf("malformed line %q", scanner.Text())
+			}
+			published, err := time.Parse(publishedTimeLayout, strings.Join(words[1:], " "))
+			if err != nil {
+				return nil, err
+			}
+			bpa.Published = published
+			continue
+		}
+
+		if len(words) < 2 || len(words[0]) != 40 {
+			return nil, fmt.Errorf("malformed assignment %q", scanner.Text())
+		}
+		fingerprint := SanitiseFingerprint(Fingerprint(words[0]))
+		bpa.Assignments[fingerprint] = &BridgeAssignment{
+			Fingerprint: fingerprint,
+			Distributor: words[1],
+			Params:      parseKeyValues(words[2:]),
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if bpa.Published.IsZero() {
+		return nil, fmt.Errorf("missing \"bridge-pool-assignment\" line")
+	}
+
+	return bpa, nil
+}
+
+// ParseBridgePoolAssignmentFile is a wrapper around ParseBridgePoolAssignment
+// that parses the named file.
+func ParseBridgePoolAssignmentFile(fileName string) (*BridgePoolAssignment, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return ParseBridgePoolAssignment(fd)
+}
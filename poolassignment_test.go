@@ -0,0 +1,69 @@
+// Tests functions from "poolassignment.go".
+
+package zoossh
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBridgePoolAssignment = `@type bridge-pool-assignment 1.0
+bridge-pool-assignment 2016-06-30 14:42:21
+00b834117566035736fc6bd4ece950eace8e057a unallocated
+00e923e7a8d87d28954fee7503e480f3a03ce4ee https ring=3 flag=stable
+0103bb5b00ad3102b2dbafe9a8a9c59b2be7b5cf email transport=obfs4 ip=4
+0122a8d6e8a1bd1ba2f4e0bbd5ed67e36fa26d4a moat ring=0
+`
+
+func TestParseBridgePoolAssignment(t *testing.T) {
+
+	bpa, err := ParseBridgePoolAssignment(strings.NewReader(testBridgePoolAssignment))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bpa.Published != time.Date(2016, 6, 30, 14, 42, 21, 0, time.UTC) {
+		t.Errorf("Unexpected publication time %s.", bpa.Published)
+	}
+	if len(bpa.Assignments) != 4 {
+		t.Fatalf("Expected 4 assignments but got %d.", len(bpa.Assignments))
+	}
+
+	assignment := bpa.Assignments["00E923E7A8D87D28954FEE7503E480F3A03CE4EE"]
+	if assignment == nil || assignment.Distributor != "https" || assignment.Params["ring"] != "3" || assignment.Params["flag"] != "stable" {
+		t.Error("Unexpected https assignment.", assignment)
+	}
+	assignment = bpa.Assignments["0103BB5B00AD3102B2DBAFE9A8A9C59B2BE7B5CF"]
+	if assignment == nil || assignment.Distributor != "email" || assignment.Params["transport"] != "obfs4" {
+		t.Error("Unexpected email assignment.", assignment)
+	}
+
+	counts := bpa.Distributors()
+	for _, distributor := range []string{"unallocated", "https", "email", "moat"} {
+		if counts[distributor] != 1 {
+			t.Errorf("Expected 1 bridge for %s but got %d.", distributor, counts[distributor])
+		}
+	}
+
+	// The annotation is optional.
+	withoutAnnotation := testBridgePoolAssignment[strings.Index(testBridgePoolAssignment, "\n")+1:]
+	if _, err := ParseBridgePoolAssignment(strings.NewReader(withoutAnnotation)); err != nil {
+		t.Error(err)
+	}
+
+	_, err = ParseBridgePoolAssignment(strings.NewReader("@type bridge-extra-info 1.3\n"))
+	if !errors.Is(err, ErrUnexpectedAnnotation) {
+		t.Errorf("Expected ErrUnexpectedAnnotation but got %v.", err)
+	}
+
+	for _, malformed := range []string{
+		"00b834117566035736fc6bd4ece950eace8e057a unallocated\n",
+		"bridge-pool-assignment 2016-06-30 14:42:21\n00b8341175 https\n",
+	} {
+		if _, err := ParseBridgePoolAssignment(strings.NewReader(malformed)); err == nil {
+			t.Errorf("Expected error for %q.", malformed)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// Provides a small query language to filter objects.
+
+package zoossh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Predicate returns true if the given object passes a filter.
+type Predicate func(Object) bool
+
+// And returns a predicate that is true if all given predicates are true.
+func And(predicates ...Predicate) Predicate {
+
+	return func(obj Object) bool {
+		for _, p := range predicates {
+			if !p(obj) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a predicate that is true if any of the given predicates is true.
+func Or(predicates ...Predicate) Predicate {
+
+	return func(obj Object) bool {
+		for _, p := range predicates {
+			if p(obj) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a predicate that negates the given predicate.
+func Not(p Predicate) Predicate {
+
+	return func(obj Object) bool {
+		return !p(obj)
+	}
+}
+
+// Select returns a channel over all objects of the given set that satisfy the
+// given predicate.
+func Select(set ObjectSet, p Predicate) <-chan Object {
+
+	ch := make(chan Object)
+
+	go func() {
+		for obj := range set.Iterate(nil) {
+			if p(obj) {
+				ch <- obj
+			}
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// queryParser turns a query into a predicate using recursive descent.
+type queryParser struct {
+	tokens []string
+	pos    int
+	locate Locator
+}
+
+// tokenizeQuery splits the given query into words and parentheses.
+func tokenizeQuery(query string) []string {
+
+	query = strings.Replace(query, "(", " ( ", -1)
+	query = strings.Replace(query, ")", " ) ", -1)
+
+	return strings.Fields(query)
+}
+
+func (qp *queryParser) peek() string {
+
+	if qp.pos >= len(qp.tokens) {
+		return ""
+	}
+	return qp.tokens[qp.pos]
+}
+
+func (qp *queryParser) next() string {
+
+	token := qp.peek()
+	qp.pos++
+	return token
+}
+
+// parseOr parses a sequence of conjunctions joined by "or".
+func (qp *queryParser) parseOr() (Predicate, error) {
+
+	p, err := qp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	predicates := []Predicate{p}
+
+	for strings.EqualFold(qp.peek(), "or") {
+		qp.next()
+		p, err := qp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, p)
+	}
+
+	if len(predicates) == 1 {
+		return predicates[0], nil
+	}
+	return Or(predicates...), nil
+}
+
+// parseAnd parses a sequence of unary expressions joined by "and".
+func (qp *queryParser) parseAnd() (Predicate, error) {
+
+	p, err := qp.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	predicates := []Predicate{p}
+
+	for strings.EqualFold(qp.peek(), "and") {
+		qp.next()
+		p, err := qp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, p)
+	}
+
+	if len(predicates) == 1 {
+		return predicates[0], nil
+	}
+	return And(predicates...), nil
+}
+
+// parseUnary parses a negation, a parenthesised expression, or a term.
+func (qp *queryParser) parseUnary() (Predicate, error) {
+
+	token := qp.next()
+
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of query")
+	case strings.EqualFold(token, "not"):
+		p, err := qp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(p), nil
+	case token == "(":
+		p, err := qp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if qp.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return p, nil
+	}
+
+	return qp.parseTerm(token)
+}
+
+// queryOperators lists the comparison operators of query terms.  Longer
+// operators come first so that ">=" is not mistaken for ">".
+var queryOperators = []string{">=", "<=", "!=", ":", ">", "<", "="}
+
+// compareUint applies the given comparison operator.
+func compareUint(a uint64, op string, b uint64) bool {
+
+	switch op {
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case "!=":
+		return a != b
+	}
+
+	return a == b
+}
+
+// parseTerm parses a single term such as "flag:Exit" or "bandwidth>5000".
+func (qp *queryParser) parseTerm(term string) (Predicate, error) {
+
+	// The key ends at the first operator.
+	var key, op, value string
+	for i := 1; i < len(term) && op == ""; i++ {
+		for _, candidate := range queryOperators {
+			if strings.HasPrefix(term[i:], candidate) {
+				key, op, value = strings.ToLower(term[:i]), candidate, term[i+len(candidate):]
+				break
+			}
+		}
+	}
+	if key == "" || value == "" {
+		return nil, fmt.Errorf("malformed query term %q", term)
+	}
+
+	var p Predicate
+
+	switch key {
+	case "bandwidth":
+		threshold, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed bandwidth in query term %q", term)
+		}
+		return func(obj Object) bool {
+			return compareUint(objectBandwidth(obj), op, threshold)
+		}, nil
+
+	case "flag":
+		p = func(obj Object) bool {
+			status, ok := obj.(*RouterStatus)
+			if !ok {
+				return false
+			}
+			for _, name := range status.Flags.flagNames() {
+				if strings.EqualFold(name, value) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case "nickname":
+		p = func(obj Object) bool {
+			return strings.EqualFold(objectNickname(obj), value)
+		}
+
+	case "fingerprint":
+		fpr := SanitiseFingerprint(Fingerprint(value))
+		p = func(obj Object) bool {
+			return SanitiseFingerprint(obj.GetFingerprint()) == fpr
+		}
+
+	case "version":
+		p = func(obj Object) bool {
+			return objectTorVersion(obj) == value
+		}
+
+	case "address":
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("malformed address in query term %q", term)
+			}
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		}
+		p = func(obj Object) bool {
+			for _, addr := range objectAddresses(obj) {
+				if ipNet.Contains(addr) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case "country":
+		if qp.locate == nil {
+			return nil, fmt.Errorf("query term %q requires a locator", term)
+		}
+		locate := qp.locate
+		p = func(obj Object) bool {
+			for _, addr := range objectAddresses(obj) {
+				if strings.EqualFold(locate(addr), value) {
+					return true
+				}
+			}
+			return false
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown key in query term %q", term)
+	}
+
+	switch op {
+	case ":", "=":
+		return p, nil
+	case "!=":
+		return Not(p), nil
+	}
+
+	return nil, fmt.Errorf("operator %q not supported for key %q", op, key)
+}
+
+// objectNickname returns the nickname of router statuses, router descriptors,
+// and bandwidth file relay lines.
+func objectNickname(obj Object) string {
+
+	switch o := obj.(type) {
+	case *RouterStatus:
+		return o.Nickname
+	case *RouterDescriptor:
+		return o.Nickname
+	case *BandwidthRelay:
+		return o.Nickname
+	}
+
+	return ""
+}
+
+// objectTorVersion returns the Tor version of router statuses and router
+// descriptors.
+func objectTorVersion(obj Object) string {
+
+	switch o := obj.(type) {
+	case *RouterStatus:
+		return o.TorVersion
+	case *RouterDescriptor:
+		return o.TorVersion
+	}
+
+	return ""
+}
+
+// objectAddresses returns the IP addresses of router statuses and router
+// descriptors.
+func objectAddresses(obj Object) []net.IP {
+
+	var candidates, addrs []net.IP
+
+	switch o := obj.(type) {
+	case *RouterStatus:
+		candidates = []net.IP{o.Address.IPv4Address, o.Address.IPv6Address}
+	case *RouterDescriptor:
+		candidates = []net.IP{o.Address}
+	}
+
+	for _, addr := range candidates {
+		if addr != nil {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs
+}
+
+// ParseQuery turns the given query into a predicate.  A query consists of
+// terms that can be combined using "and", "or", "not", and parentheses, e.g.,
+// "flag:Exit and bandwidth>5000 and not nickname:foo".  The following terms
+// are supported:
+//
+//	flag:NAME          the router status has the given flag
+//	nickname:NAME      the nickname equals NAME, ignoring case
+//	fingerprint:FPR    the fingerprint equals FPR
+//	version:VERSION    the Tor version equals VERSION
+//	address:ADDR       an IP address equals ADDR or is part of the CIDR ADDR
+//	bandwidth OP N     the bandwidth compares to N, with OP being one of
+//	                   =, !=, <, <=, >, >=
+//
+// All terms other than bandwidth terms can be negated using "!=".
+func ParseQuery(query string) (Predicate, error) {
+
+	return ParseQueryWithLocator(query, nil)
+}
+
+// ParseQueryWithLocator is like ParseQuery but additionally supports
+// "country:CC" terms, which match objects whose IP address the given locator
+// maps to CC.
+func ParseQueryWithLocator(query string, locate Locator) (Predicate, error) {
+
+	qp := &queryParser{tokens: tokenizeQuery(query), locate: locate}
+
+	p, err := qp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if qp.pos < len(qp.tokens) {
+		return nil, fmt.Errorf("unexpected %q in query", qp.peek())
+	}
+
+	return p, nil
+}
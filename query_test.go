@@ -0,0 +1,89 @@
+// Tests functions from "query.go".
+
+package zoossh
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]string{
+		"flag:Exit":                                            {"Karlstad0"},
+		"flag:exit and bandwidth>5000":                         {},
+		"flag:Running and bandwidth>=2670":                     {"Karlstad0"},
+		"not flag:Exit":                                        {"seele"},
+		"nickname:SEELE or nickname:Karlstad0":                 {"seele", "Karlstad0"},
+		"address:193.11.0.0/16":                                {"Karlstad0"},
+		"address:73.15.150.172 and version:0.4.5.6":            {"seele"},
+		"nickname!=seele":                                      {"Karlstad0"},
+		"(flag:Guard or bandwidth<20) and not flag:HSDir":      {"seele"},
+		"fingerprint:000a10d43011ea4928a35f610405f92b4433b4dc": {"seele"},
+	}
+
+	for query, expected := range tests {
+		p, err := ParseQuery(query)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %s", query, err)
+			continue
+		}
+		matches := make(map[string]bool)
+		for obj := range Select(vote, p) {
+			matches[obj.(*RouterStatus).Nickname] = true
+		}
+		if len(matches) != len(expected) {
+			t.Errorf("Query %q matched %v but expected %v.", query, matches, expected)
+			continue
+		}
+		for _, nickname := range expected {
+			if !matches[nickname] {
+				t.Errorf("Query %q did not match %s.", query, nickname)
+			}
+		}
+	}
+
+	for _, query := range []string{
+		"", "flag", "foo:bar", "bandwidth>foo", "flag:Exit and", "(flag:Exit",
+		"flag:Exit)", "flag>Exit", "address:foo", "country:US",
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("Malformed query %q did not raise an error.", query)
+		}
+	}
+}
+
+func TestParseQueryWithLocator(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locate := func(ip net.IP) string {
+		if ip.Equal(net.ParseIP("193.11.166.194")) {
+			return "SE"
+		}
+		return "US"
+	}
+
+	p, err := ParseQueryWithLocator("flag:Running and not country:US", locate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for obj := range Select(vote, p) {
+		if obj.(*RouterStatus).Nickname != "Karlstad0" {
+			t.Error("Unexpected match.", obj)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Expected one match but got %d.", n)
+	}
+}
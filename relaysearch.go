@@ -0,0 +1,298 @@
+// Provides a relay search backend over a consensus and its descriptors.
+
+package zoossh
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Scores that search terms contribute to a result's rank.
+const (
+	scoreExact     = 100
+	scoreAddress   = 80
+	scorePrefix    = 50
+	scoreSubstring = 10
+	scoreAttribute = 1
+)
+
+var hexPrefixRegexp = regexp.MustCompile(`^[0-9A-F]+$`)
+
+// SearchResult is a single relay that matches a search query.
+type SearchResult struct {
+	Status *RouterStatus
+
+	// The relay's descriptor, if descriptors were given.
+	Descriptor *RouterDescriptor
+
+	// The rank of the result.  Exact matches score higher than partial
+	// ones.
+	Score int
+}
+
+// RelaySearch answers search queries over the relays of a consensus, e.g.,
+// for relay search web interfaces or chat bots.  It keeps indexes by
+// nickname, fingerprint, address, flag, and version.  A RelaySearch is safe
+// for concurrent use as long as the consensus and descriptors it was built
+// from are not modified.
+type RelaySearch struct {
+	statuses    map[Fingerprint]*RouterStatus
+	descriptors map[Fingerprint]*RouterDescriptor
+
+	// Sorted fingerprints for prefix search.
+	fingerprints []Fingerprint
+
+	nicknames map[string][]Fingerprint
+	addresses map[string][]Fingerprint
+	flags     map[string][]Fingerprint
+	versions  map[string][]Fingerprint
+}
+
+// NewRelaySearch builds the search indexes for the given consensus.  If
+// descriptors are given, relays can also be found by their additional
+// "or-address" addresses.
+func NewRelaySearch(c *Consensus, rds *RouterDescriptors) *RelaySearch {
+
+	rs := &RelaySearch{
+		statuses:    make(map[Fingerprint]*RouterStatus),
+		descriptors: make(map[Fingerprint]*RouterDescriptor),
+		nicknames:   make(map[string][]Fingerprint),
+		addresses:   make(map[string][]Fingerprint),
+		flags:       make(map[string][]Fingerprint),
+		versions:    make(map[string][]Fingerprint),
+	}
+
+	addAddress := func(ip net.IP, fpr Fingerprint) {
+		if ip != nil {
+			rs.addresses[ip.String()] = append(rs.addresses[ip.String()], fpr)
+		}
+	}
+
+	for fpr, getStatus := range c.RouterStatuses {
+		status := getStatus()
+		rs.statuses[fpr] = status
+		rs.fingerprints = append(rs.fingerprints, fpr)
+
+		nickname := strings.ToLower(status.Nickname)
+		rs.nicknames[nickname] = append(rs.nicknames[nickname], fpr)
+		addAddress(status.Address.IPv4Address, fpr)
+		addAddress(status.Address.IPv6Address, fpr)
+		for _, flag := range status.Flags.flagNames() {
+			flag = strings.ToLower(flag)
+			rs.flags[flag] = append(rs.flags[flag], fpr)
+		}
+		rs.versions[status.TorVersion] = append(rs.versions[status.TorVersion], fpr)
+
+		if rds == nil {
+			continue
+		}
+		if desc, found := rds.Get(fpr); found {
+			rs.descriptors[fpr] = desc
+			for _, endpoint := range desc.ORAddresses {
+				addAddress(endpoint.IP, fpr)
+			}
+		}
+	}
+
+	sort.Slice(rs.fingerprints, func(i, j int) bool { return rs.fingerprints[i] < rs.fingerprints[j] })
+
+	return rs
+}
+
+// matchNickname scores all relays whose nickname contains the given term.
+func (rs *RelaySearch) matchNickname(term string, scores map[Fingerprint]int) {
+
+	term = strings.ToLower(term)
+	for nickname, fprs := range rs.nicknames {
+		score := 0
+		switch {
+		case nickname == term:
+			score = scoreExact
+		case strings.HasPrefix(nickname, term):
+			score = scorePrefix
+		case strings.Contains(nickname, term):
+			score = scoreSubstring
+		default:
+			continue
+		}
+		for _, fpr := range fprs {
+			if score > scores[fpr] {
+				scores[fpr] = score
+			}
+		}
+	}
+}
+
+// matchFingerprint scores all relays whose fingerprint starts with the given
+// term.
+func (rs *RelaySearch) matchFingerprint(term string, scores map[Fingerprint]int) {
+
+	prefix := string(SanitiseFingerprint(Fingerprint(strings.TrimPrefix(term, "$"))))
+	if !hexPrefixRegexp.MatchString(prefix) {
+		return
+	}
+
+	i := sort.Search(len(rs.fingerprints), func(i int) bool { return string(rs.fingerprints[i]) >= prefix })
+	for ; i < len(rs.fingerprints) && strings.HasPrefix(string(rs.fingerprints[i]), prefix); i++ {
+		score := scorePrefix
+		if len(prefix) == len(rs.fingerprints[i]) {
+			score = scoreExact
+		}
+		if score > scores[rs.fingerprints[i]] {
+			scores[rs.fingerprints[i]] = score
+		}
+	}
+}
+
+// parseAddressTerm parses the given term as an IP address or a CIDR range,
+// either of which may be enclosed in brackets, e.g., "[2001:db8::1]" or
+// "[2001:db8::]/32".  It returns false if the term is neither.
+func parseAddressTerm(term string) (net.IP, *net.IPNet, bool) {
+
+	term = strings.NewReplacer("[", "", "]", "").Replace(term)
+	if ip := net.ParseIP(term); ip != nil {
+		return ip, nil, true
+	}
+	if _, ipNet, err := net.ParseCIDR(term); err == nil {
+		return nil, ipNet, true
+	}
+
+	return nil, nil, false
+}
+
+// matchAddress scores all relays that have the given IP address or an
+// address within the given CIDR range.  It returns false if the term is
+// neither.
+func (rs *RelaySearch) matchAddress(term string, scores map[Fingerprint]int) bool {
+
+	ip, ipNet, ok := parseAddressTerm(term)
+	if !ok {
+		return false
+	}
+
+	if ip != nil {
+		for _, fpr := range rs.addresses[ip.String()] {
+			scores[fpr] = scoreAddress
+		}
+		return true
+	}
+
+	for addr, fprs := range rs.addresses {
+		if !ipNet.Contains(net.ParseIP(addr)) {
+			continue
+		}
+		for _, fpr := range fprs {
+			scores[fpr] = scoreAddress
+		}
+	}
+
+	return true
+}
+
+// matchTerm returns the scores of all relays that match the given term.
+func (rs *RelaySearch) matchTerm(term string) (map[Fingerprint]int, error) {
+
+	scores := make(map[Fingerprint]int)
+
+	key, value := "", term
+	// IPv6 addresses contain colons, so addresses must be recognised before
+	// the term is split into key and value.
+	if _, _, isAddress := parseAddressTerm(term); !isAddress {
+		if kv := strings.SplitN(term, ":", 2); len(kv) == 2 {
+			key, value = strings.ToLower(kv[0]), kv[1]
+		}
+	}
+	if value == "" {
+		return nil, fmt.Errorf("empty value in search term %q", term)
+	}
+
+	switch key {
+	case "":
+		rs.matchNickname(value, scores)
+		rs.matchFingerprint(value, scores)
+		rs.matchAddress(value, scores)
+	case "nickname":
+		rs.matchNickname(value, scores)
+	case "fingerprint":
+		rs.matchFingerprint(value, scores)
+	case "address":
+		if !rs.matchAddress(value, scores) {
+			return nil, fmt.Errorf("malformed address in search term %q", term)
+		}
+	case "flag":
+		for _, fpr := range rs.flags[strings.ToLower(value)] {
+			scores[fpr] = scoreAttribute
+		}
+	case "version":
+		for _, fpr := range rs.versions[value] {
+			scores[fpr] = scoreAttribute
+		}
+	default:
+		return nil, fmt.Errorf("unknown key in search term %q", term)
+	}
+
+	return scores, nil
+}
+
+// Search returns the relays that match all terms of the given query, ranked
+// by score and then by consensus weight.  Terms are separated by whitespace
+// and are either of the form "key:value", with key being one of "nickname",
+// "fingerprint", "address", "flag", and "version", or plain values that are
+// matched against nicknames (substring), fingerprints (prefix), and addresses
+// (IP address or CIDR range).  At most limit results are returned unless
+// limit is zero or negative.
+func (rs *RelaySearch) Search(query string, limit int) ([]*SearchResult, error) {
+
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty search query")
+	}
+
+	var total map[Fingerprint]int
+	for _, term := range terms {
+		scores, err := rs.matchTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		if total == nil {
+			total = scores
+			continue
+		}
+		for fpr, score := range total {
+			if s, ok := scores[fpr]; ok {
+				total[fpr] = score + s
+			} else {
+				delete(total, fpr)
+			}
+		}
+	}
+
+	results := make([]*SearchResult, 0, len(total))
+	for fpr, score := range total {
+		results = append(results, &SearchResult{
+			Status:     rs.statuses[fpr],
+			Descriptor: rs.descriptors[fpr],
+			Score:      score,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Status.Bandwidth != b.Status.Bandwidth {
+			return a.Status.Bandwidth > b.Status.Bandwidth
+		}
+		return a.Status.Fingerprint < b.Status.Fingerprint
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
@@ -0,0 +1,98 @@
+// Tests functions from "relaysearch.go".
+
+package zoossh
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRelaySearch(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := NewRelaySearch(vote, nil)
+
+	expected := map[string][]Fingerprint{
+		"karlstad0":                 {"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"},
+		"e":                         {"000A10D43011EA4928A35F610405F92B4433B4DC"},
+		"$000a10":                   {"000A10D43011EA4928A35F610405F92B4433B4DC"},
+		"193.11.166.194":            {"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"},
+		"73.15.0.0/16":              {"000A10D43011EA4928A35F610405F92B4433B4DC"},
+		"flag:Running":              {"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645", "000A10D43011EA4928A35F610405F92B4433B4DC"},
+		"flag:exit version:0.4.4.7": {"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"},
+		"flag:exit version:0.4.5.6": {},
+		"nickname:stad flag:guard":  {"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"},
+	}
+
+	for query, fprs := range expected {
+		results, err := rs.Search(query, 0)
+		if err != nil {
+			t.Fatalf("Search(%q) failed: %s", query, err)
+		}
+		if len(results) != len(fprs) {
+			t.Fatalf("Expected %d results for %q but got %d.", len(fprs), query, len(results))
+		}
+		for i, result := range results {
+			if result.Status.Fingerprint != fprs[i] {
+				t.Errorf("Expected %s at rank %d for %q but got %s.", fprs[i], i, query, result.Status.Fingerprint)
+			}
+		}
+	}
+}
+
+// Test searching for IPv6 addresses, which contain colons.
+func TestRelaySearchIPv6(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	karlstad, _ := vote.Get("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+	karlstad.Address.IPv6Address = net.ParseIP("2001:db8::1")
+	rs := NewRelaySearch(vote, nil)
+
+	for _, query := range []string{"2001:db8::1", "[2001:db8::1]", "2001:db8::/32", "[2001:db8::]/32", "address:[2001:db8::1]"} {
+		results, err := rs.Search(query, 0)
+		if err != nil {
+			t.Fatalf("Search(%q) failed: %s", query, err)
+		}
+		if len(results) != 1 || results[0].Status.Fingerprint != karlstad.Fingerprint {
+			t.Errorf("Expected to find %s for %q.", karlstad.Fingerprint, query)
+		}
+	}
+}
+
+func TestRelaySearchRanking(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := NewRelaySearch(vote, nil)
+
+	// Both relays are valid, so the consensus weight decides.
+	results, err := rs.Search("flag:valid", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status.Nickname != "Karlstad0" {
+		t.Error("Expected the relay with the higher consensus weight first.")
+	}
+
+	results, err = rs.Search("seele flag:valid", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Score != scoreExact+scoreAttribute {
+		t.Error("Expected a single exact nickname match.")
+	}
+
+	for _, query := range []string{"", "foo:bar", "address:foo", "flag:"} {
+		if _, err := rs.Search(query, 0); err == nil {
+			t.Errorf("Expected error for query %q.", query)
+		}
+	}
+}
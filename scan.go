@@ -0,0 +1,122 @@
+// Provides fast searching of archive files for single relays.
+
+package zoossh
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+// scanNeedles returns the byte strings that an entry must contain to possibly
+// match the given filter.  Fingerprints are represented differently across
+// document types: as base64 in router statuses and as space-separated hex
+// groups in server descriptors, so every fingerprint yields several needles.
+// Nickname patterns cannot be searched for, so filters with nickname patterns
+// yield no needles.
+func scanNeedles(filter *ObjectFilter) []string {
+
+	var needles []string
+
+	if len(filter.NicknamePatterns) != 0 {
+		return nil
+	}
+
+	for fpr := range filter.Fingerprints {
+		fpr = SanitiseFingerprint(fpr)
+		needles = append(needles, string(fpr))
+
+		raw, err := hex.DecodeString(string(fpr))
+		if err != nil {
+			continue
+		}
+		needles = append(needles, base64.RawStdEncoding.EncodeToString(raw))
+
+		var groups []string
+		for i := 0; i+4 <= len(fpr); i += 4 {
+			groups = append(groups, string(fpr[i:i+4]))
+		}
+		needles = append(needles, strings.Join(groups, " "))
+	}
+
+	for addr := range filter.IPAddrs {
+		needles = append(needles, addr)
+	}
+
+	for nickname := range filter.Nicknames {
+		needles = append(needles, nickname)
+	}
+
+	return needles
+}
+
+// Scan searches the given annotated document for router statuses or router
+// descriptors that match the given filter.  Unlike regular parsing, Scan first
+// searches the raw bytes of every entry and only parses entries that may
+// match, which makes looking up a single relay across large archives cheap.
+// The returned object set only contains entries that match the filter.
+// Document meta information is parsed as usual.
+func Scan(r io.Reader, filter *ObjectFilter) (ObjectSet, error) {
+
+	header, r, err := readAnnotationHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	annotation := header.annotation
+
+	opts := parseOptions{metadata: header.annotationMetadata()}
+	if filter == nil || filter.IsEmpty() {
+		return parseWithAnnotation(r, annotation, opts)
+	}
+
+	// Without needles, e.g., if the filter only requires flags, all entries
+	// have to be parsed.
+	if needles := scanNeedles(filter); len(needles) > 0 {
+		opts.prefilter = func(blurb string) bool {
+			for _, needle := range needles {
+				if strings.Contains(blurb, needle) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	objs, err := parseWithAnnotation(r, annotation, opts)
+	if err != nil {
+		return objs, err
+	}
+
+	// Byte matches may be false positives, e.g., a nickname that is part of
+	// another one, so we verify all remaining entries.
+	switch set := objs.(type) {
+	case *Consensus:
+		for fpr, getStatus := range set.RouterStatuses {
+			if !filter.MatchesRouterStatus(getStatus()) {
+				delete(set.RouterStatuses, fpr)
+			}
+		}
+	case *RouterDescriptors:
+		for fpr, getDescriptor := range set.RouterDescriptors {
+			if !filter.MatchesRouterDescriptor(getDescriptor()) {
+				delete(set.RouterDescriptors, fpr)
+			}
+		}
+	}
+
+	return objs, nil
+}
+
+// ScanFile is a wrapper around Scan that scans the given file.
+func ScanFile(fileName string, filter *ObjectFilter) (ObjectSet, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	return Scan(fd, filter)
+}
@@ -0,0 +1,125 @@
+// Tests functions from "scan.go".
+
+package zoossh
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+
+	filter := NewObjectFilter()
+	filter.AddNickname("seele")
+
+	objs, err := Scan(strings.NewReader(testVote), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objs.Length() != 1 {
+		t.Fatalf("Expected one matching status but got %d.", objs.Length())
+	}
+
+	// The nickname "Karl" is part of "Karlstad0" but must not match it.
+	filter = NewObjectFilter()
+	filter.AddNickname("Karl")
+	objs, err = Scan(strings.NewReader(testVote), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objs.Length() != 0 {
+		t.Errorf("Expected no matching status but got %d.", objs.Length())
+	}
+
+	// Flags cannot be prefiltered but must still be checked.
+	filter = NewObjectFilter()
+	filter.RequireFlags(RouterFlags{Guard: true})
+	objs, err = Scan(strings.NewReader(testVote), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := objs.GetObject("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645"); !found || objs.Length() != 1 {
+		t.Errorf("Expected only the guard but got %d statuses.", objs.Length())
+	}
+
+	// Nickname patterns cannot be prefiltered either.
+	filter = NewObjectFilter()
+	if err := filter.AddNicknamePattern("^see"); err != nil {
+		t.Fatal(err)
+	}
+	objs, err = Scan(strings.NewReader(testVote), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objs.Length() != 1 {
+		t.Errorf("Expected one matching status but got %d.", objs.Length())
+	}
+
+	// An empty filter matches everything.
+	objs, err = Scan(strings.NewReader(testVote), NewObjectFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objs.Length() != 2 {
+		t.Errorf("Expected two statuses but got %d.", objs.Length())
+	}
+}
+
+func TestScanFile(t *testing.T) {
+
+	// Only run this test if the consensus file is there.
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status *RouterStatus
+	for _, getStatus := range consensus.RouterStatuses {
+		status = getStatus()
+		break
+	}
+
+	filter := NewObjectFilter()
+	filter.AddFingerprint(status.Fingerprint)
+	objs, err := ScanFile(consensusFile, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := objs.GetObject(status.Fingerprint); !found || objs.Length() != 1 {
+		t.Errorf("Failed to find %s by scanning.", status.Fingerprint)
+	}
+}
+
+func TestScanDescriptorFile(t *testing.T) {
+
+	// Only run this test if the descriptors file is there.
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+
+	descs, err := ParseDescriptorFile(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var desc *RouterDescriptor
+	for _, getDescriptor := range descs.RouterDescriptors {
+		desc = getDescriptor()
+		break
+	}
+
+	filter := NewObjectFilter()
+	filter.AddFingerprint(desc.Fingerprint)
+	objs, err := ScanFile(serverDescriptorFile, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := objs.GetObject(desc.Fingerprint); !found {
+		t.Errorf("Failed to find %s by scanning.", desc.Fingerprint)
+	}
+}
@@ -0,0 +1,116 @@
+// Provides first-seen and last-seen computation over series of consensuses.
+
+package zoossh
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// RelaySeen describes when a relay appeared in a series of consensuses.
+type RelaySeen struct {
+	// The valid-after times of the first and last consensus that lists the
+	// relay.
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// The number of consensuses that list the relay.
+	Count int
+
+	// The longest run of consecutive consensuses that list the relay, given
+	// as the valid-after times of its first and last consensus along with
+	// the number of consensuses in the run.
+	LongestRunStart time.Time
+	LongestRunEnd   time.Time
+	LongestRun      int
+
+	// The current run, which may still turn into the longest one.
+	runStart time.Time
+	run      int
+	lastSeq  int
+}
+
+// SeenReport holds the first-seen and last-seen times of all relays in a
+// series of consensuses.
+type SeenReport struct {
+	// The number of consensuses in the series.
+	Consensuses int
+
+	// Maps relay fingerprints to their appearance.
+	Relays map[Fingerprint]*RelaySeen
+}
+
+// ComputeSeen determines for each relay when it was first and last seen in the
+// given series of consensuses, and its longest run of consecutive
+// consensuses.  Consensuses must arrive in chronological order, e.g., as
+// returned by Downsample.  Consensuses that are missing from the series are
+// not noticed, so gaps in an archive do not interrupt runs.
+func ComputeSeen(in <-chan *Consensus) (*SeenReport, error) {
+
+	report := &SeenReport{Relays: make(map[Fingerprint]*RelaySeen)}
+	var last time.Time
+
+	for c := range in {
+		if err := checkChronological(c.ValidAfter, &last); err != nil {
+			drain(in)
+			return nil, err
+		}
+		report.Consensuses++
+		seq := report.Consensuses
+
+		for fpr := range c.RouterStatuses {
+			seen, exists := report.Relays[fpr]
+			if !exists {
+				seen = &RelaySeen{FirstSeen: c.ValidAfter}
+				report.Relays[fpr] = seen
+			}
+
+			if exists && seen.lastSeq == seq-1 {
+				seen.run++
+			} else {
+				seen.run = 1
+				seen.runStart = c.ValidAfter
+			}
+			if seen.run > seen.LongestRun {
+				seen.LongestRun = seen.run
+				seen.LongestRunStart = seen.runStart
+				seen.LongestRunEnd = c.ValidAfter
+			}
+
+			seen.LastSeen = c.ValidAfter
+			seen.Count++
+			seen.lastSeq = seq
+		}
+	}
+
+	return report, nil
+}
+
+// WriteTo writes the report to the given writer, one relay per line, ordered
+// by fingerprint.  Each line contains the fingerprint, the first-seen and
+// last-seen time, the number of consensuses, and the longest run.
+func (report *SeenReport) WriteTo(w io.Writer) (int64, error) {
+
+	fprs := make([]Fingerprint, 0, len(report.Relays))
+	for fpr := range report.Relays {
+		fprs = append(fprs, fpr)
+	}
+	sort.Slice(fprs, func(i, j int) bool { return fprs[i] < fprs[j] })
+
+	var total int64
+	for _, fpr := range fprs {
+		seen := report.Relays[fpr]
+		n, err := fmt.Fprintf(w, "%s,%s,%s,%d,%d\n", fpr,
+			seen.FirstSeen.UTC().Format(time.RFC3339),
+			seen.LastSeen.UTC().Format(time.RFC3339),
+			seen.Count, seen.LongestRun)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,119 @@
+// Tests functions from "seen.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// consensusSeries returns a channel over hourly consensuses, starting at the
+// given time, whose router statuses carry the given fingerprints.
+func consensusSeries(start time.Time, fprs ...[]Fingerprint) <-chan *Consensus {
+
+	ch := make(chan *Consensus)
+	go func() {
+		for i, relays := range fprs {
+			c := NewConsensus()
+			c.ValidAfter = start.Add(time.Duration(i) * time.Hour)
+			for _, fpr := range relays {
+				c.Set(fpr, &RouterStatus{Fingerprint: fpr})
+			}
+			ch <- c
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// unorderedSeries returns a channel over consensuses whose second consensus
+// is two days older than the first, and a channel that is closed once all
+// consensuses were sent.
+func unorderedSeries(start time.Time) (<-chan *Consensus, <-chan struct{}) {
+
+	ch := make(chan *Consensus)
+	done := make(chan struct{})
+	go func() {
+		for _, offset := range []time.Duration{0, -48 * time.Hour, time.Hour, 2 * time.Hour} {
+			ch <- &Consensus{ValidAfter: start.Add(offset)}
+		}
+		close(ch)
+		close(done)
+	}()
+
+	return ch, done
+}
+
+// expectDrained fails the test if the sender of an unordered series is not
+// done shortly.
+func expectDrained(t *testing.T, done <-chan struct{}) {
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Input channel was not drained after an error.")
+	}
+}
+
+func TestComputeSeen(t *testing.T) {
+
+	start := time.Date(2017, time.April, 15, 0, 0, 0, 0, time.UTC)
+	a, b := Fingerprint(strings.Repeat("A", 40)), Fingerprint(strings.Repeat("B", 40))
+
+	report, err := ComputeSeen(consensusSeries(start,
+		[]Fingerprint{a},
+		[]Fingerprint{a, b},
+		[]Fingerprint{b},
+		[]Fingerprint{a, b},
+		[]Fingerprint{a, b},
+		[]Fingerprint{a}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Consensuses != 6 || len(report.Relays) != 2 {
+		t.Fatalf("Unexpected report size: %d consensuses, %d relays.", report.Consensuses, len(report.Relays))
+	}
+
+	seenA := report.Relays[a]
+	if !seenA.FirstSeen.Equal(start) || !seenA.LastSeen.Equal(start.Add(5*time.Hour)) {
+		t.Errorf("Unexpected first/last seen %s/%s.", seenA.FirstSeen, seenA.LastSeen)
+	}
+	if seenA.Count != 5 || seenA.LongestRun != 3 || !seenA.LongestRunStart.Equal(start.Add(3*time.Hour)) {
+		t.Errorf("Unexpected run %+v.", seenA)
+	}
+
+	seenB := report.Relays[b]
+	if seenB.LongestRun != 4 || !seenB.LongestRunEnd.Equal(start.Add(4*time.Hour)) {
+		t.Errorf("Unexpected run %+v.", seenB)
+	}
+
+	var buf bytes.Buffer
+	if _, err := report.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], string(a)) {
+		t.Errorf("Unexpected report output %q.", buf.String())
+	}
+
+	_, err = ComputeSeen(consensusSeries(start.Add(time.Hour), nil, nil))
+	if err != nil {
+		t.Error(err)
+	}
+	in := make(chan *Consensus, 2)
+	in <- &Consensus{ValidAfter: start.Add(time.Hour)}
+	in <- &Consensus{ValidAfter: start}
+	close(in)
+	if _, err := ComputeSeen(in); err == nil {
+		t.Error("Out-of-order consensuses did not raise an error.")
+	}
+
+	unordered, done := unorderedSeries(start)
+	if _, err := ComputeSeen(unordered); err == nil {
+		t.Error("Out-of-order consensuses did not raise an error.")
+	}
+	expectDrained(t, done)
+}
@@ -0,0 +1,151 @@
+// Provides parsing of shared randomness commits and the history of shared
+// random values across series of consensuses.
+
+package zoossh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SharedRandCommit is a commitment of the shared randomness protocol as found
+// on "shared-rand-commit" lines of votes, see srv-spec.txt, Section 3.
+type SharedRandCommit struct {
+	// The protocol version and the hash algorithm, e.g., "sha3-256".
+	Version   int
+	Algorithm string
+
+	// The fingerprint of the committing authority's identity key.
+	Identity Fingerprint
+
+	// The decoded commit, i.e., a timestamp followed by the hash of the
+	// reveal value.
+	Commit []byte
+
+	// The decoded reveal value, i.e., a timestamp followed by the random
+	// number.  Nil during the commit phase.
+	Reveal []byte
+}
+
+// parseSharedRandCommit parses the given words of a "shared-rand-commit"
+// line, without the keyword.
+func parseSharedRandCommit(words []string) (*SharedRandCommit, error) {
+
+	if len(words) != 4 && len(words) != 5 {
+		return nil, fmt.Errorf("malformed shared random commit with %d arguments", len(words))
+	}
+
+	version, err := strconv.Atoi(words[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed shared random commit version %q", words[0])
+	}
+	commit := &SharedRandCommit{
+		Version:   version,
+		Algorithm: words[1],
+		Identity:  SanitiseFingerprint(Fingerprint(words[2])),
+	}
+	if commit.Commit, err = base64.StdEncoding.DecodeString(words[3]); err != nil {
+		return nil, fmt.Errorf("malformed shared random commit: %s", err)
+	}
+	if len(words) == 5 {
+		if commit.Reveal, err = base64.StdEncoding.DecodeString(words[4]); err != nil {
+			return nil, fmt.Errorf("malformed shared random reveal: %s", err)
+		}
+	}
+
+	return commit, nil
+}
+
+// SharedRandPeriod holds the shared random values that consensuses carried
+// during a single protocol period.  Periods last 24 hours and start at
+// midnight UTC, see srv-spec.txt, Section 2.
+type SharedRandPeriod struct {
+	Start    time.Time
+	Previous []byte
+	Current  []byte
+
+	// The number of consensuses of this period in the series.
+	Consensuses int
+}
+
+// SharedRandAnomaly describes a consensus whose shared random values do not
+// follow the expected 24-hour rotation.
+type SharedRandAnomaly struct {
+	ValidAfter time.Time
+	Reason     string
+}
+
+// String implements the Stringer interface for pretty printing.
+func (a SharedRandAnomaly) String() string {
+
+	return fmt.Sprintf("%s: %s", a.ValidAfter.UTC().Format(publishedTimeLayout), a.Reason)
+}
+
+// SharedRandHistory is a timeline of shared random values along with all
+// anomalies that were found.
+type SharedRandHistory struct {
+	Periods   []*SharedRandPeriod
+	Anomalies []SharedRandAnomaly
+}
+
+// SharedRandTimeline walks the given chronological series of consensuses and
+// extracts the shared random values of every period.  It flags consensuses
+// that lack shared random values, values that change within a period, and
+// rotations in which the new previous value does not equal the old current
+// value or in which the current value does not change.
+func SharedRandTimeline(in <-chan *Consensus) (*SharedRandHistory, error) {
+
+	history := &SharedRandHistory{}
+	var period *SharedRandPeriod
+	var last time.Time
+
+	flag := func(c *Consensus, format string, args ...interface{}) {
+		history.Anomalies = append(history.Anomalies, SharedRandAnomaly{c.ValidAfter, fmt.Sprintf(format, args...)})
+	}
+
+	for c := range in {
+		if err := checkChronological(c.ValidAfter, &last); err != nil {
+			drain(in)
+			return nil, err
+		}
+
+		if c.SharedRandCurrent == nil {
+			flag(c, "missing shared random values")
+			continue
+		}
+
+		// Protocol periods start at midnight UTC.
+		start := utcDay(c.ValidAfter)
+		if period != nil && start.Equal(period.Start) {
+			if !bytes.Equal(period.Current, c.SharedRandCurrent) || !bytes.Equal(period.Previous, c.SharedRandPrevious) {
+				flag(c, "shared random values changed within period")
+			}
+			period.Consensuses++
+			continue
+		}
+
+		// A new period started.  If it directly follows the previous one,
+		// the values must have rotated.
+		if period != nil && start.Equal(period.Start.Add(Day)) {
+			if !bytes.Equal(c.SharedRandPrevious, period.Current) {
+				flag(c, "previous value does not equal last period's current value")
+			}
+			if bytes.Equal(c.SharedRandCurrent, period.Current) {
+				flag(c, "current value did not rotate")
+			}
+		}
+
+		period = &SharedRandPeriod{
+			Start:       start,
+			Previous:    c.SharedRandPrevious,
+			Current:     c.SharedRandCurrent,
+			Consensuses: 1,
+		}
+		history.Periods = append(history.Periods, period)
+	}
+
+	return history, nil
+}
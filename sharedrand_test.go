@@ -0,0 +1,104 @@
+// Tests functions from "sharedrand.go".
+
+package zoossh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSharedRandTimeline(t *testing.T) {
+
+	start := time.Date(2017, time.April, 15, 22, 0, 0, 0, time.UTC)
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+
+	values := []struct {
+		previous, current []byte
+	}{
+		{a, b},
+		{a, b},
+		// Rotation at midnight.
+		{b, c},
+		// Change within the period.
+		{b, a},
+		// Missing values.
+		{nil, nil},
+	}
+
+	in := make(chan *Consensus)
+	go func() {
+		for i, v := range values {
+			consensus := NewConsensus()
+			consensus.ValidAfter = start.Add(time.Duration(i) * time.Hour)
+			consensus.SharedRandPrevious = v.previous
+			consensus.SharedRandCurrent = v.current
+			in <- consensus
+		}
+		close(in)
+	}()
+
+	history, err := SharedRandTimeline(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history.Periods) != 2 {
+		t.Fatalf("Expected 2 periods but got %d.", len(history.Periods))
+	}
+	if history.Periods[0].Consensuses != 2 || string(history.Periods[1].Current) != "c" {
+		t.Errorf("Unexpected periods %+v, %+v.", history.Periods[0], history.Periods[1])
+	}
+	if len(history.Anomalies) != 2 {
+		t.Errorf("Expected 2 anomalies but got %v.", history.Anomalies)
+	}
+
+	unordered, done := unorderedSeries(start)
+	if _, err := SharedRandTimeline(unordered); err == nil {
+		t.Error("Out-of-order consensuses did not raise an error.")
+	}
+	expectDrained(t, done)
+}
+
+func TestParseSharedRandCommit(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vote.SharedRandParticipate {
+		t.Error("Expected vote to participate in shared randomness.")
+	}
+	if len(vote.SharedRandCommits) != 1 {
+		t.Fatalf("Expected one commit but got %d.", len(vote.SharedRandCommits))
+	}
+	commit := vote.SharedRandCommits[0]
+	if commit.Version != 1 || commit.Algorithm != "sha3-256" || commit.Identity != "D586D18309DED4CD6D57C18FDB97EFA96D330566" {
+		t.Error("Unexpected commit.", commit)
+	}
+	if len(commit.Commit) != 40 || len(commit.Reveal) != 40 {
+		t.Errorf("Unexpected commit and reveal lengths %d and %d.", len(commit.Commit), len(commit.Reveal))
+	}
+	if len(vote.SharedRandPrevious) != 32 || len(vote.SharedRandCurrent) != 32 {
+		t.Error("Expected shared random values of vote.")
+	}
+
+	// Commits lack the reveal value during the commit phase.
+	commit2, err := parseSharedRandCommit([]string{"1", "sha3-256", "D586D18309DED4CD6D57C18FDB97EFA96D330566",
+		"AAAAAGBBhAA8nF08GzkbzcGmcG6qSaVjcOrKxoAQE52DLb4VcCJ7Lw=="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit2.Reveal != nil {
+		t.Error("Unexpected reveal value.", commit2.Reveal)
+	}
+
+	for _, words := range [][]string{
+		{"1", "sha3-256", "D586D18309DED4CD6D57C18FDB97EFA96D330566"},
+		{"x", "sha3-256", "D586D18309DED4CD6D57C18FDB97EFA96D330566", "AAAA"},
+		{"1", "sha3-256", "D586D18309DED4CD6D57C18FDB97EFA96D330566", "!!!!"},
+	} {
+		if _, err := parseSharedRandCommit(words); err == nil {
+			t.Errorf("Malformed commit %q was accepted.", words)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+// Provides a flat snapshot format for consensus series.
+
+package zoossh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A snapshot holds a series of consensuses in a flat layout that can be
+// scanned in place, e.g., after memory-mapping the file, without
+// deserialising it first.  All integers are little endian.  The layout is:
+//
+//	header       snapshotHeaderSize bytes
+//	consensuses  numConsensuses * snapshotConsensusSize bytes
+//	records      numRecords * snapshotRecordSize bytes
+//	strings      all nicknames, Tor versions, and port lists, concatenated
+//
+// Records of a consensus are stored contiguously and sorted by fingerprint.
+const (
+	snapshotMagic   = "ZOOSSNAP"
+	snapshotVersion = 1
+
+	// magic[8] version[4] numConsensuses[4] numRecords[8] stringsOffset[8]
+	snapshotHeaderSize = 32
+
+	// validAfter[8] firstRecord[8] numRecords[8]
+	snapshotConsensusSize = 24
+
+	snapshotRecordSize = 96
+)
+
+// Field offsets within a record.
+const (
+	recFingerprint = 0  // [20]byte
+	recIPv4        = 20 // [4]byte
+	recIPv4ORPort  = 24 // uint16
+	recIPv4DirPort = 26 // uint16
+	recIPv6        = 28 // [16]byte
+	recIPv6ORPort  = 44 // uint16
+	recFlags       = 48 // uint32
+	recNickOffset  = 52 // uint32
+	recNickLen     = 56 // uint16
+	recVerOffset   = 58 // uint32
+	recVerLen      = 62 // uint16
+	recBandwidth   = 64 // uint64
+	recMeasured    = 72 // uint64
+	recPublished   = 80 // int64
+	recBits        = 88 // uint8
+	recPortsOffset = 89 // uint32
+	recPortsLen    = 93 // uint16
+)
+
+// Bits of a record's recBits field.
+const (
+	recBitHasIPv6 = 1 << iota
+	recBitUnmeasured
+	recBitAccept
+)
+
+func flagsToBits(flags RouterFlags) uint32 {
+
+	var bits uint32
+	for i, isSet := range flagFields(&flags) {
+		if *isSet {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits
+}
+
+func bitsToFlags(bits uint32) RouterFlags {
+
+	var flags RouterFlags
+	for i, isSet := range flagFields(&flags) {
+		*isSet = bits&(1<<uint(i)) != 0
+	}
+
+	return flags
+}
+
+// WriteSnapshot writes the given consensuses to w in the snapshot format.
+// Only router statuses and the consensuses' valid-after times are kept.  An
+// error is returned if a router status has a fingerprint that is not 40 hex
+// digits.
+func WriteSnapshot(w io.Writer, consensuses []*Consensus) error {
+
+	var records, strs bytes.Buffer
+	var table []byte
+	var numRecords uint64
+	stringOffsets := make(map[string]uint32)
+
+	addString := func(s string) (uint32, uint16) {
+		if len(s) > 0xffff {
+			s = s[:0xffff]
+		}
+		if off, ok := stringOffsets[s]; ok {
+			return off, uint16(len(s))
+		}
+		off := uint32(strs.Len())
+		strs.WriteString(s)
+		stringOffsets[s] = off
+		return off, uint16(len(s))
+	}
+
+	for _, c := range consensuses {
+		fprs := make([]string, 0, c.Length())
+		for fpr := range c.RouterStatuses {
+			fprs = append(fprs, string(fpr))
+		}
+		sort.Strings(fprs)
+
+		entry := make([]byte, snapshotConsensusSize)
+		binary.LittleEndian.PutUint64(entry[0:], uint64(c.ValidAfter.Unix()))
+		binary.LittleEndian.PutUint64(entry[8:], numRecords)
+		binary.LittleEndian.PutUint64(entry[16:], uint64(len(fprs)))
+		table = append(table, entry...)
+
+		for _, fpr := range fprs {
+			status := c.RouterStatuses[Fingerprint(fpr)]()
+			rec := make([]byte, snapshotRecordSize)
+
+			raw, err := hex.DecodeString(fpr)
+			if err != nil || len(raw) != 20 {
+				return fmt.Errorf("cannot write fingerprint %q to snapshot", fpr)
+			}
+			copy(rec[recFingerprint:], raw)
+
+			if ip4 := status.Address.IPv4Address.To4(); ip4 != nil {
+				copy(rec[recIPv4:], ip4)
+			}
+			binary.LittleEndian.PutUint16(rec[recIPv4ORPort:], status.Address.IPv4ORPort)
+			binary.LittleEndian.PutUint16(rec[recIPv4DirPort:], status.Address.IPv4DirPort)
+
+			var bits uint8
+			if ip6 := status.Address.IPv6Address.To16(); ip6 != nil {
+				copy(rec[recIPv6:], ip6)
+				bits |= recBitHasIPv6
+			}
+			binary.LittleEndian.PutUint16(rec[recIPv6ORPort:], status.Address.IPv6ORPort)
+			binary.LittleEndian.PutUint32(rec[recFlags:], flagsToBits(status.Flags))
+
+			off, n := addString(status.Nickname)
+			binary.LittleEndian.PutUint32(rec[recNickOffset:], off)
+			binary.LittleEndian.PutUint16(rec[recNickLen:], n)
+			off, n = addString(status.TorVersion)
+			binary.LittleEndian.PutUint32(rec[recVerOffset:], off)
+			binary.LittleEndian.PutUint16(rec[recVerLen:], n)
+			off, n = addString(status.PortList)
+			binary.LittleEndian.PutUint32(rec[recPortsOffset:], off)
+			binary.LittleEndian.PutUint16(rec[recPortsLen:], n)
+
+			binary.LittleEndian.PutUint64(rec[recBandwidth:], status.Bandwidth)
+			binary.LittleEndian.PutUint64(rec[recMeasured:], status.Measured)
+			binary.LittleEndian.PutUint64(rec[recPublished:], uint64(status.Publication.Unix()))
+
+			if status.Unmeasured {
+				bits |= recBitUnmeasured
+			}
+			if status.Accept {
+				bits |= recBitAccept
+			}
+			rec[recBits] = bits
+
+			records.Write(rec)
+			numRecords++
+		}
+	}
+
+	header := make([]byte, snapshotHeaderSize)
+	copy(header, snapshotMagic)
+	binary.LittleEndian.PutUint32(header[8:], snapshotVersion)
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(consensuses)))
+	binary.LittleEndian.PutUint64(header[16:], numRecords)
+	stringsOffset := uint64(snapshotHeaderSize+len(table)) + numRecords*snapshotRecordSize
+	binary.LittleEndian.PutUint64(header[24:], stringsOffset)
+
+	bw := bufio.NewWriter(w)
+	for _, b := range [][]byte{header, table, records.Bytes(), strs.Bytes()} {
+		if _, err := bw.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Snapshot provides read access to a consensus series in the snapshot
+// format.  Records are read directly from the underlying bytes.
+type Snapshot struct {
+	data           []byte
+	numConsensuses int
+	numRecords     uint64
+	strs           []byte
+	closer         func() error
+}
+
+// NewSnapshot returns a snapshot that reads from the given bytes, which are
+// neither copied nor modified.  All offsets and lengths in the snapshot are
+// checked, so a truncated or corrupt snapshot results in an error.
+func NewSnapshot(data []byte) (*Snapshot, error) {
+
+	if len(data) < snapshotHeaderSize || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("not a zoossh snapshot")
+	}
+	if version := binary.LittleEndian.Uint32(data[8:]); version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	numConsensuses := uint64(binary.LittleEndian.Uint32(data[12:]))
+	numRecords := binary.LittleEndian.Uint64(data[16:])
+	stringsOffset := binary.LittleEndian.Uint64(data[24:])
+
+	// Check the counts before multiplying them to rule out overflows.
+	size := uint64(len(data))
+	if numConsensuses > size/snapshotConsensusSize || numRecords > size/snapshotRecordSize {
+		return nil, errors.New("truncated or corrupt snapshot")
+	}
+	expected := snapshotHeaderSize + numConsensuses*snapshotConsensusSize + numRecords*snapshotRecordSize
+	if stringsOffset != expected || stringsOffset > size {
+		return nil, errors.New("truncated or corrupt snapshot")
+	}
+
+	s := &Snapshot{
+		data:           data,
+		numConsensuses: int(numConsensuses),
+		numRecords:     numRecords,
+		strs:           data[stringsOffset:],
+	}
+
+	for i := 0; i < s.numConsensuses; i++ {
+		entry := s.consensusEntry(i)
+		first := binary.LittleEndian.Uint64(entry[8:])
+		n := binary.LittleEndian.Uint64(entry[16:])
+		if n > numRecords || first > numRecords-n {
+			return nil, fmt.Errorf("consensus %d has records out of bounds", i)
+		}
+	}
+
+	records := data[snapshotHeaderSize+numConsensuses*snapshotConsensusSize : stringsOffset]
+	for off := 0; off < len(records); off += snapshotRecordSize {
+		rec := records[off : off+snapshotRecordSize]
+		for _, field := range [][2]int{{recNickOffset, recNickLen}, {recVerOffset, recVerLen}, {recPortsOffset, recPortsLen}} {
+			strOff := uint64(binary.LittleEndian.Uint32(rec[field[0]:]))
+			strLen := uint64(binary.LittleEndian.Uint16(rec[field[1]:]))
+			if strOff+strLen > uint64(len(s.strs)) {
+				return nil, fmt.Errorf("record %d has string out of bounds", off/snapshotRecordSize)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Close releases the resources that back the snapshot, e.g., a memory
+// mapping.  Records must not be used after the snapshot was closed.
+func (s *Snapshot) Close() error {
+
+	if s.closer == nil {
+		return nil
+	}
+	err := s.closer()
+	s.closer = nil
+	s.data = nil
+	return err
+}
+
+// NumConsensuses returns the number of consensuses in the snapshot.
+func (s *Snapshot) NumConsensuses() int {
+
+	return s.numConsensuses
+}
+
+func (s *Snapshot) consensusEntry(i int) []byte {
+
+	off := snapshotHeaderSize + i*snapshotConsensusSize
+	return s.data[off : off+snapshotConsensusSize]
+}
+
+// ValidAfter returns the valid-after time of the i-th consensus.
+func (s *Snapshot) ValidAfter(i int) time.Time {
+
+	return time.Unix(int64(binary.LittleEndian.Uint64(s.consensusEntry(i))), 0).UTC()
+}
+
+// NumRecords returns the number of router statuses in the i-th consensus.
+func (s *Snapshot) NumRecords(i int) int {
+
+	return int(binary.LittleEndian.Uint64(s.consensusEntry(i)[16:]))
+}
+
+// Record returns the j-th router status of the i-th consensus.  Records are
+// sorted by fingerprint.
+func (s *Snapshot) Record(i, j int) SnapshotRecord {
+
+	first := binary.LittleEndian.Uint64(s.consensusEntry(i)[8:])
+	off := uint64(snapshotHeaderSize+s.numConsensuses*snapshotConsensusSize) +
+		(first+uint64(j))*snapshotRecordSize
+
+	return SnapshotRecord{b: s.data[off : off+snapshotRecordSize], strs: s.strs}
+}
+
+// Scan calls fn for every router status of every consensus in chronological
+// order of the snapshot.  Scanning stops if fn returns false.
+func (s *Snapshot) Scan(fn func(consensus int, rec SnapshotRecord) bool) {
+
+	for i := 0; i < s.numConsensuses; i++ {
+		for j, n := 0, s.NumRecords(i); j < n; j++ {
+			if !fn(i, s.Record(i, j)) {
+				return
+			}
+		}
+	}
+}
+
+// SnapshotRecord is a view onto a single router status in a snapshot.  Its
+// accessors decode fields on demand.
+type SnapshotRecord struct {
+	b    []byte
+	strs []byte
+}
+
+// RawFingerprint returns the record's fingerprint in binary form without
+// copying it.
+func (r SnapshotRecord) RawFingerprint() []byte {
+
+	return r.b[recFingerprint : recFingerprint+20]
+}
+
+// Fingerprint returns the record's fingerprint.
+func (r SnapshotRecord) Fingerprint() Fingerprint {
+
+	return Fingerprint(strings.ToUpper(hex.EncodeToString(r.RawFingerprint())))
+}
+
+func (r SnapshotRecord) str(offField, lenField int) string {
+
+	off := binary.LittleEndian.Uint32(r.b[offField:])
+	n := binary.LittleEndian.Uint16(r.b[lenField:])
+	return string(r.strs[off : off+uint32(n)])
+}
+
+// Nickname returns the record's nickname.
+func (r SnapshotRecord) Nickname() string {
+
+	return r.str(recNickOffset, recNickLen)
+}
+
+// TorVersion returns the record's Tor version.
+func (r SnapshotRecord) TorVersion() string {
+
+	return r.str(recVerOffset, recVerLen)
+}
+
+// PortList returns the port list of the record's port policy summary.
+func (r SnapshotRecord) PortList() string {
+
+	return r.str(recPortsOffset, recPortsLen)
+}
+
+// IPv4Address returns the record's IPv4 address without copying it.
+func (r SnapshotRecord) IPv4Address() net.IP {
+
+	return net.IP(r.b[recIPv4 : recIPv4+4])
+}
+
+// Flags returns the record's flags.
+func (r SnapshotRecord) Flags() RouterFlags {
+
+	return bitsToFlags(binary.LittleEndian.Uint32(r.b[recFlags:]))
+}
+
+// Bandwidth returns the record's consensus weight.
+func (r SnapshotRecord) Bandwidth() uint64 {
+
+	return binary.LittleEndian.Uint64(r.b[recBandwidth:])
+}
+
+// Status materialises the record as a router status.
+func (r SnapshotRecord) Status() *RouterStatus {
+
+	status := &RouterStatus{
+		Fingerprint: r.Fingerprint(),
+		Nickname:    r.Nickname(),
+		Publication: time.Unix(int64(binary.LittleEndian.Uint64(r.b[recPublished:])), 0).UTC(),
+		Flags:       r.Flags(),
+		TorVersion:  r.TorVersion(),
+		Bandwidth:   r.Bandwidth(),
+		Measured:    binary.LittleEndian.Uint64(r.b[recMeasured:]),
+		Unmeasured:  r.b[recBits]&recBitUnmeasured != 0,
+		Accept:      r.b[recBits]&recBitAccept != 0,
+		PortList:    r.PortList(),
+	}
+
+	status.Address.IPv4Address = append(net.IP(nil), r.IPv4Address()...)
+	status.Address.IPv4ORPort = binary.LittleEndian.Uint16(r.b[recIPv4ORPort:])
+	status.Address.IPv4DirPort = binary.LittleEndian.Uint16(r.b[recIPv4DirPort:])
+	if r.b[recBits]&recBitHasIPv6 != 0 {
+		status.Address.IPv6Address = append(net.IP(nil), r.b[recIPv6:recIPv6+16]...)
+		status.Address.IPv6ORPort = binary.LittleEndian.Uint16(r.b[recIPv6ORPort:])
+	}
+
+	return status
+}
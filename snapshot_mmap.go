@@ -0,0 +1,42 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package zoossh
+
+import (
+	"os"
+	"syscall"
+)
+
+// OpenSnapshot memory-maps the given snapshot file read-only.  The snapshot
+// must be closed to release the mapping.
+func OpenSnapshot(fileName string) (*Snapshot, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return NewSnapshot(nil)
+	}
+
+	data, err := syscall.Mmap(int(fd.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewSnapshot(data)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	s.closer = func() error { return syscall.Munmap(data) }
+
+	return s, nil
+}
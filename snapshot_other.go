@@ -0,0 +1,20 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package zoossh
+
+import (
+	"io/ioutil"
+)
+
+// OpenSnapshot reads the given snapshot file into memory.  Memory mapping is
+// not supported on this platform.
+func OpenSnapshot(fileName string) (*Snapshot, error) {
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSnapshot(data)
+}
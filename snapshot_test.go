@@ -0,0 +1,114 @@
+// Tests functions from "snapshot.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, []*Consensus{vote, vote}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSnapshot(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.NumConsensuses() != 2 {
+		t.Fatalf("Expected 2 consensuses but got %d.", s.NumConsensuses())
+	}
+	if !s.ValidAfter(1).Equal(vote.ValidAfter) {
+		t.Error("Unexpected valid-after time.", s.ValidAfter(1))
+	}
+
+	count := 0
+	s.Scan(func(i int, rec SnapshotRecord) bool {
+		count++
+		orig, exists := vote.Get(rec.Fingerprint())
+		if !exists {
+			t.Fatalf("Fingerprint %s not in original consensus.", rec.Fingerprint())
+		}
+		if got := rec.Status(); got.String() != orig.String() || got.Bandwidth != orig.Bandwidth ||
+			got.Accept != orig.Accept || got.PortList != orig.PortList {
+			t.Errorf("Snapshot record %q differs from original %q.", got, orig)
+		}
+		return true
+	})
+	if count != 4 {
+		t.Errorf("Expected to scan 4 records but got %d.", count)
+	}
+
+	if _, err := NewSnapshot(buf.Bytes()[:40]); err == nil {
+		t.Error("Truncated snapshot did not raise an error.")
+	}
+	if _, err := NewSnapshot([]byte("foo")); err == nil {
+		t.Error("Invalid snapshot did not raise an error.")
+	}
+
+	// Corrupt offsets must raise an error instead of a panic later on.
+	recordsOffset := snapshotHeaderSize + 2*snapshotConsensusSize
+	corruptions := map[string]func([]byte){
+		"record count": func(b []byte) { b[16+7] = 0xff },
+		"first record": func(b []byte) { b[snapshotHeaderSize+snapshotConsensusSize+8] = 3 },
+		"nickname":     func(b []byte) { b[recordsOffset+recNickOffset+3] = 0xff },
+		"port list":    func(b []byte) { b[recordsOffset+recPortsLen] = 0xff },
+	}
+	for name, corrupt := range corruptions {
+		data := append([]byte(nil), buf.Bytes()...)
+		corrupt(data)
+		if _, err := NewSnapshot(data); err == nil {
+			t.Errorf("Snapshot with corrupt %s did not raise an error.", name)
+		}
+	}
+}
+
+func TestOpenSnapshot(t *testing.T) {
+
+	// Only run this test if the consensus file is there.
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+
+	consensus, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "zoossh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "snapshot")
+	fd, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSnapshot(fd, []*Consensus{consensus}); err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+
+	s, err := OpenSnapshot(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.NumRecords(0) != consensus.Length() {
+		t.Errorf("Expected %d records but got %d.", consensus.Length(), s.NumRecords(0))
+	}
+}
@@ -0,0 +1,105 @@
+// Provides timing statistics of parsing runs.
+
+package zoossh
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseStats breaks down where a parsing run spent its time.  Splitting
+// happens concurrently with parsing, so the durations need not add up to the
+// total.  Comparing runs helps to decide between lazy and eager parsing.
+type ParseStats struct {
+	// The number of entries, e.g., router statuses, that were parsed.
+	Entries int
+
+	// The time spent reading the input and splitting it into entries,
+	// excluding the time spent waiting for the parser.
+	Split time.Duration
+
+	// The time spent parsing entries.  For lazy parsing, this only covers
+	// extracting the fingerprint.  With several workers, it is the sum of
+	// all workers' time.
+	Parse time.Duration
+
+	// The time spent adding parsed entries to their object set.
+	Insert time.Duration
+
+	// The wall-clock time of the entire run.
+	Total time.Duration
+}
+
+// String implements the Stringer interface for pretty printing.
+func (s *ParseStats) String() string {
+
+	return fmt.Sprintf("%d entries in %s (split: %s, parse: %s, insert: %s)",
+		s.Entries, s.Total, s.Split, s.Parse, s.Insert)
+}
+
+// splitDone records the time it took to split the given unit.  All methods
+// of a nil ParseStats are no-ops.
+func (s *ParseStats) splitDone(unit QueueUnit) {
+
+	if s == nil {
+		return
+	}
+	s.Split += unit.Elapsed
+}
+
+// parsed records the given time spent parsing and returns the time at which
+// insertion starts.
+func (s *ParseStats) parsed(elapsed time.Duration) time.Time {
+
+	if s == nil {
+		return time.Time{}
+	}
+	s.Parse += elapsed
+
+	return time.Now()
+}
+
+// insertDone records the time spent inserting since start and counts the
+// entry.
+func (s *ParseStats) insertDone(start time.Time) {
+
+	if s == nil {
+		return
+	}
+	s.Insert += time.Since(start)
+	s.Entries++
+}
+
+// ParseConsensusFileWithStats works like ParseConsensusFile, or
+// LazilyParseConsensusFile if lazy is set, but additionally returns timing
+// statistics of the run.
+func ParseConsensusFileWithStats(fileName string, lazy bool) (*Consensus, *ParseStats, error) {
+
+	stats := &ParseStats{}
+	start := time.Now()
+
+	consensus, err := parseConsensusFile(fileName, parseOptions{lazy: lazy, stats: stats})
+	if err != nil {
+		return nil, nil, err
+	}
+	stats.Total = time.Since(start)
+
+	return consensus, stats, nil
+}
+
+// ParseDescriptorFileWithStats works like ParseDescriptorFile, or
+// LazilyParseDescriptorFile if lazy is set, but additionally returns timing
+// statistics of the run.
+func ParseDescriptorFileWithStats(fileName string, lazy bool) (*RouterDescriptors, *ParseStats, error) {
+
+	stats := &ParseStats{}
+	start := time.Now()
+
+	descriptors, err := parseDescriptorFile(fileName, parseOptions{lazy: lazy, stats: stats})
+	if err != nil {
+		return nil, nil, err
+	}
+	stats.Total = time.Since(start)
+
+	return descriptors, stats, nil
+}
@@ -0,0 +1,55 @@
+// Tests functions from "stats.go".
+
+package zoossh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConsensusFileWithStats(t *testing.T) {
+
+	fileName := filepath.Join(t.TempDir(), "vote")
+	if err := ioutil.WriteFile(fileName, []byte(testVote), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lazy := range []bool{false, true} {
+		consensus, stats, err := ParseConsensusFileWithStats(fileName, lazy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if consensus.Length() != 2 || stats.Entries != 2 {
+			t.Errorf("Expected 2 entries but got %d.", stats.Entries)
+		}
+		if stats.Total <= 0 || stats.Parse > stats.Total {
+			t.Error("Unexpected timing statistics.", stats)
+		}
+		if !strings.HasPrefix(stats.String(), "2 entries in ") {
+			t.Errorf("Unexpected string representation %q.", stats)
+		}
+	}
+
+	if _, _, err := ParseConsensusFileWithStats(filepath.Join(t.TempDir(), "missing"), false); err == nil {
+		t.Error("Expected error for missing file.")
+	}
+}
+
+func TestParseDescriptorFileWithStats(t *testing.T) {
+
+	// Only run this test if the descriptor file is there.
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+
+	descriptors, stats, err := ParseDescriptorFileWithStats(serverDescriptorFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries < descriptors.Length() || stats.Split <= 0 {
+		t.Error("Unexpected timing statistics.", stats)
+	}
+}
@@ -0,0 +1,82 @@
+// Provides streaming parsers that yield entries as they are scanned.
+
+package zoossh
+
+import (
+	"context"
+	"io"
+)
+
+// StreamConsensus is like StreamConsensusContext but cannot be stopped early.
+// Callers must drain the status channel.
+func StreamConsensus(r io.Reader) (<-chan *RouterStatus, <-chan error) {
+
+	return StreamConsensusContext(context.Background(), r)
+}
+
+// StreamConsensusContext parses the network status document read from r,
+// which must start with a type annotation, and yields its router statuses as
+// they are scanned instead of collecting them in a consensus.  That keeps
+// memory usage constant for one-pass analyses of many documents.  The status
+// channel is closed once parsing is done, after which the error channel
+// yields the parsing error, if any, and is closed as well.  Cancelling the
+// given context stops parsing.
+func StreamConsensusContext(ctx context.Context, r io.Reader) (<-chan *RouterStatus, <-chan error) {
+
+	statuses := make(chan *RouterStatus)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(statuses)
+
+		sink := func(status *RouterStatus) error {
+			select {
+			case statuses <- status:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if _, err := parseConsensus(r, parseOptions{ctx: ctx, statusSink: sink}); err != nil {
+			errs <- err
+		}
+	}()
+
+	return statuses, errs
+}
+
+// StreamDescriptors is like StreamDescriptorsContext but cannot be stopped
+// early.  Callers must drain the descriptor channel.
+func StreamDescriptors(r io.Reader) (<-chan *RouterDescriptor, <-chan error) {
+
+	return StreamDescriptorsContext(context.Background(), r)
+}
+
+// StreamDescriptorsContext parses the server or bridge descriptors read from
+// r, which must start with a type annotation, and yields them as they are
+// scanned, like StreamConsensusContext does for router statuses.
+func StreamDescriptorsContext(ctx context.Context, r io.Reader) (<-chan *RouterDescriptor, <-chan error) {
+
+	descriptors := make(chan *RouterDescriptor)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(descriptors)
+
+		sink := func(desc *RouterDescriptor) error {
+			select {
+			case descriptors <- desc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if _, err := parseDescriptor(r, parseOptions{ctx: ctx, descriptorSink: sink}); err != nil {
+			errs <- err
+		}
+	}()
+
+	return descriptors, errs
+}
@@ -0,0 +1,86 @@
+// Tests functions from "stream.go".
+
+package zoossh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Test the function StreamConsensus().
+func TestStreamConsensus(t *testing.T) {
+
+	statuses, errs := StreamConsensus(strings.NewReader(testVote))
+	var nicknames []string
+	for status := range statuses {
+		nicknames = append(nicknames, status.Nickname)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(nicknames, " ") != "seele Karlstad0" {
+		t.Errorf("Unexpected router statuses %v.", nicknames)
+	}
+
+	// Parsing errors end up in the error channel.
+	broken := strings.Replace(testVote, "r seele AAoQ1DAR6kkoo19hBAX5K0QztNw", "r seele !!!", 1)
+	statuses, errs = StreamConsensus(strings.NewReader(broken))
+	for range statuses {
+		t.Error("Unexpected router status.")
+	}
+	if err := <-errs; !errors.Is(err, ErrMalformedField) {
+		t.Errorf("Expected ErrMalformedField but got %v.", err)
+	}
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+	fd, err := os.Open(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	// Stop after the first status.
+	ctx, cancel := context.WithCancel(context.Background())
+	statuses, errs = StreamConsensusContext(ctx, fd)
+	<-statuses
+	cancel()
+	for range statuses {
+	}
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v.", err)
+	}
+}
+
+// Test the function StreamDescriptors().
+func TestStreamDescriptors(t *testing.T) {
+
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+	fd, err := os.Open(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	// Unlike parsed descriptor sets, streams include duplicates.
+	descriptors, errs := StreamDescriptors(fd)
+	count := 0
+	for desc := range descriptors {
+		if desc.Fingerprint == "" {
+			t.Error("Descriptor lacks fingerprint.")
+		}
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if count != 867 {
+		t.Errorf("Expected 867 descriptors but got %d.", count)
+	}
+}
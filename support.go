@@ -0,0 +1,78 @@
+// Provides information on the document types that zoossh can parse.
+
+package zoossh
+
+import (
+	"sort"
+)
+
+// AnnotationSupport describes how zoossh supports documents of a given type
+// annotation.
+type AnnotationSupport struct {
+	Annotation Annotation
+
+	// Entries can be parsed lazily, i.e., when they are accessed.
+	Lazy bool
+
+	// Documents are parsed strictly, i.e., malformed or truncated documents
+	// are rejected rather than parsed as far as possible.
+	Strict bool
+
+	// Documents can be parsed by ParseUnknown and ParseUnknownFile.
+	// Otherwise, they have a dedicated parser only.
+	Generic bool
+}
+
+// annotationSupport lists the annotation sets of all parsers along with the
+// features that the parsers support.
+var annotationSupport = []struct {
+	annotations map[Annotation]bool
+	lazy        bool
+	strict      bool
+	generic     bool
+}{
+	{descriptorAnnotations, true, false, true},
+	{consensusAnnotations, true, true, true},
+	{voteAnnotations, true, true, true},
+	{bridgeNetworkStatusAnnotations, true, false, true},
+	{microdescriptorAnnotations, true, false, true},
+	{bridgeExtraInfoAnnotations, false, false, true},
+	{detachedSignatureAnnotations, false, false, false},
+	{bridgePoolAssignmentAnnotations, false, false, false},
+	{hiddenServiceDescriptorAnnotations, false, false, false},
+	{keyCertificateAnnotations, false, true, false},
+	{bandwidthFileAnnotations, false, true, false},
+}
+
+// SupportedAnnotations returns all type annotations that zoossh can parse
+// along with the features that their parsers support, ordered by annotation.
+// Tools that process mixed archives can use it to route files that zoossh
+// cannot handle elsewhere.
+func SupportedAnnotations() []AnnotationSupport {
+
+	var supported []AnnotationSupport
+	for _, s := range annotationSupport {
+		for annotation := range s.annotations {
+			supported = append(supported, AnnotationSupport{annotation, s.lazy, s.strict, s.generic})
+		}
+	}
+
+	sort.Slice(supported, func(i, j int) bool {
+		return supported[i].Annotation.Compare(&supported[j].Annotation) < 0
+	})
+
+	return supported
+}
+
+// IsSupported returns the support of the given type annotation and true, or
+// false if zoossh cannot parse documents of the given annotation.
+func IsSupported(annotation *Annotation) (AnnotationSupport, bool) {
+
+	for _, s := range annotationSupport {
+		if s.annotations[*annotation] {
+			return AnnotationSupport{*annotation, s.lazy, s.strict, s.generic}, true
+		}
+	}
+
+	return AnnotationSupport{}, false
+}
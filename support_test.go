@@ -0,0 +1,45 @@
+// Tests functions from "support.go".
+
+package zoossh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSupportedAnnotations(t *testing.T) {
+
+	supported := SupportedAnnotations()
+	if len(supported) == 0 {
+		t.Fatal("Expected supported annotations.")
+	}
+
+	for i, s := range supported {
+		if i > 0 && supported[i-1].Annotation.Compare(&s.Annotation) >= 0 {
+			t.Errorf("Annotations are not ordered: %s before %s.", &supported[i-1].Annotation, &s.Annotation)
+		}
+
+		// Generic annotations must have a parser in parseWithAnnotation.
+		_, err := parseWithAnnotation(strings.NewReader(""), &s.Annotation, parseOptions{})
+		hasParser := err == nil || err.Error() != "could not find suitable parser"
+		if s.Generic != hasParser {
+			t.Errorf("Annotation %s is generic: %v, has generic parser: %v.", &s.Annotation, s.Generic, hasParser)
+		}
+	}
+
+	s, ok := IsSupported(&Annotation{"network-status-consensus-3", "1", "0"})
+	if !ok || !s.Lazy || !s.Strict || !s.Generic {
+		t.Error("Unexpected support of consensuses.", s)
+	}
+	s, ok = IsSupported(&Annotation{"bridge-pool-assignment", "1", "0"})
+	if !ok || s.Lazy || s.Generic {
+		t.Error("Unexpected support of bridge pool assignments.", s)
+	}
+	s, ok = IsSupported(&Annotation{"bandwidth-file", "1", "0"})
+	if !ok || s.Lazy || !s.Strict || s.Generic {
+		t.Error("Unexpected support of bandwidth files.", s)
+	}
+	if _, ok := IsSupported(&Annotation{"torperf", "1", "0"}); ok {
+		t.Error("Unexpected support of Torperf files.")
+	}
+}
@@ -0,0 +1,132 @@
+// Parses the members of tarballs as published by CollecTor.
+
+package zoossh
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrStop can be returned by a FileFunc to stop parsing further files
+// without error.
+var ErrStop = errors.New("stop parsing files")
+
+// FileFunc is called for every parsed file, e.g., a member of a tarball, with
+// the file's name and the parsed file, or the error that parsing the file
+// caused.  Returning an error stops parsing further files.
+type FileFunc func(name string, set ObjectSet, err error) error
+
+// ParseTar parses every regular file of the uncompressed tar archive read
+// from r and calls fn for each of them.  The document type of every file is
+// determined as in ParseUnknown.
+func ParseTar(r io.Reader, fn FileFunc) error {
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		set, err := ParseUnknown(tr)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", header.Name, err)
+		}
+		if err := fn(header.Name, set, err); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// ParseTarball parses every regular file of the named tarball, e.g.,
+// "consensuses-2024-01.tar.xz", and calls fn for each of them, without
+// extracting the tarball to disk.  The compression is determined as in
+// ParseTarballReader.  Note that CollecTor's archives are compressed with xz,
+// which requires the xz command in the PATH.  Without it, ParseTarball
+// returns an error that wraps exec.ErrNotFound.
+func ParseTarball(path string, fn FileFunc) error {
+
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	return ParseTarballReader(bufio.NewReader(fd), path, fn)
+}
+
+// ParseTarballReader is like ParseTarball but reads the tarball from r, e.g.,
+// while it is being downloaded.  The compression is determined by the
+// extension of the given name: gzip (".gz" or ".tgz") and bzip2 (".bz2") are
+// supported natively while xz (".xz") requires the xz command.  Other
+// tarballs are read as uncompressed tar archives.
+func ParseTarballReader(r io.Reader, name string, fn FileFunc) error {
+
+	switch {
+	case strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz"):
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+
+	case strings.HasSuffix(name, ".bz2"):
+		r = bzip2.NewReader(r)
+
+	case strings.HasSuffix(name, ".xz"):
+		// Go's standard library lacks an xz decompressor.
+		cmd := exec.Command("xz", "--decompress", "--stdout")
+		cmd.Stdin = r
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("cannot decompress %s: %w", name, err)
+		}
+
+		// Once we stop early, there is no point in decompressing the rest.
+		stopped := false
+		err = ParseTar(stdout, func(member string, set ObjectSet, err error) error {
+			if err := fn(member, set, err); err != nil {
+				stopped = true
+				return err
+			}
+			return nil
+		})
+		if stopped || err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+
+		// Drain the trailing padding of the archive before xz exits.
+		io.Copy(io.Discard, stdout)
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("cannot decompress %s: %s", name, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+
+	return ParseTar(r, fn)
+}
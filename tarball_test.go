@@ -0,0 +1,138 @@
+// Tests functions from "tarball.go".
+
+package zoossh
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// testTarball returns a tar archive containing a vote, microdescriptors, a
+// directory, and a file of unknown type.
+func testTarball(t *testing.T) []byte {
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	members := []struct {
+		name, content string
+	}{
+		{"votes/vote", testVote},
+		{"votes/microdescs", "@type microdescriptor 1.0\n" + testMicrodescriptor1 + testMicrodescriptor2},
+		{"votes/README", "nothing to see here\n"},
+	}
+
+	if err := tw.WriteHeader(&tar.Header{Name: "votes/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range members {
+		header := &tar.Header{Name: member.name, Mode: 0644, Size: int64(len(member.content))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(member.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// checkTarball parses the given tarball and checks the parsed members.
+func checkTarball(t *testing.T, path string) {
+
+	lengths := make(map[string]int)
+	err := ParseTarball(path, func(name string, set ObjectSet, err error) error {
+		if err != nil {
+			lengths[name] = -1
+			return nil
+		}
+		lengths[name] = set.Length()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lengths) != 3 || lengths["votes/vote"] != 2 || lengths["votes/microdescs"] != 2 || lengths["votes/README"] != -1 {
+		t.Errorf("Unexpected members %v of %s.", lengths, path)
+	}
+}
+
+// Test the function ParseTarball().
+func TestParseTarball(t *testing.T) {
+
+	dir := t.TempDir()
+	raw := testTarball(t)
+
+	plain := filepath.Join(dir, "votes.tar")
+	if err := ioutil.WriteFile(plain, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkTarball(t, plain)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(raw)
+	gw.Close()
+	compressed := filepath.Join(dir, "votes.tar.gz")
+	if err := ioutil.WriteFile(compressed, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkTarball(t, compressed)
+
+	// Callbacks can stop the iteration.
+	count := 0
+	err := ParseTarball(compressed, func(name string, set ObjectSet, err error) error {
+		count++
+		return ErrStop
+	})
+	if err != nil || count != 1 {
+		t.Errorf("Expected to stop after one member but got %d members and %v.", count, err)
+	}
+	stop := errors.New("stop")
+	if err := ParseTarball(plain, func(string, ObjectSet, error) error { return stop }); err != stop {
+		t.Errorf("Expected callback error but got %v.", err)
+	}
+
+	if _, err := exec.LookPath("xz"); err != nil {
+		t.Skip("skipping xz test because of missing xz command")
+	}
+	if err := exec.Command("xz", "--keep", plain).Run(); err != nil {
+		t.Fatal(err)
+	}
+	checkTarball(t, plain+".xz")
+	count = 0
+	err = ParseTarball(plain+".xz", func(name string, set ObjectSet, err error) error {
+		count++
+		return ErrStop
+	})
+	if err != nil || count != 1 {
+		t.Errorf("Expected to stop after one member but got %d members and %v.", count, err)
+	}
+}
+
+// Test that ParseTarball() fails cleanly without the xz command.
+func TestParseTarballWithoutXz(t *testing.T) {
+
+	dir := t.TempDir()
+	compressed := filepath.Join(dir, "votes.tar.xz")
+	if err := ioutil.WriteFile(compressed, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A PATH with nothing but an empty directory lacks the xz command.
+	t.Setenv("PATH", dir)
+	err := ParseTarball(compressed, func(string, ObjectSet, error) error { return nil })
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("Expected exec.ErrNotFound but got %v.", err)
+	}
+}
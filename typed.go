@@ -0,0 +1,117 @@
+// Provides type-safe access to object sets.
+
+package zoossh
+
+// Set is a typed view onto an object set whose objects are of type T, e.g.,
+// *RouterStatus for a consensus.  It spares callers the type assertions that
+// ObjectSet requires.  Objects of other types are treated as if they were not
+// part of the set.
+type Set[T Object] struct {
+	objs ObjectSet
+}
+
+// AsSet returns a typed view onto the given object set.
+func AsSet[T Object](objs ObjectSet) Set[T] {
+
+	return Set[T]{objs: objs}
+}
+
+// Statuses returns a typed view onto the consensus' router statuses.
+func (c *Consensus) Statuses() Set[*RouterStatus] {
+
+	return AsSet[*RouterStatus](c)
+}
+
+// Descriptors returns a typed view onto the router descriptors.
+func (rds *RouterDescriptors) Descriptors() Set[*RouterDescriptor] {
+
+	return AsSet[*RouterDescriptor](rds)
+}
+
+// Get returns the object identified by the given fingerprint.  If the object
+// is not present in the set or is not of type T, false is returned, otherwise
+// true.
+func (s Set[T]) Get(fingerprint Fingerprint) (T, bool) {
+
+	var zero T
+
+	obj, exists := s.objs.GetObject(fingerprint)
+	if !exists {
+		return zero, false
+	}
+	typed, ok := obj.(T)
+	if !ok {
+		return zero, false
+	}
+
+	return typed, true
+}
+
+// Iterate returns a channel over all objects of type T that pass the given
+// filter.
+func (s Set[T]) Iterate(filter *ObjectFilter) <-chan T {
+
+	ch := make(chan T)
+
+	go func() {
+		for obj := range s.objs.Iterate(filter) {
+			if typed, ok := obj.(T); ok {
+				ch <- typed
+			}
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// Slice returns all objects of type T in the set.
+func (s Set[T]) Slice() []T {
+
+	var objs []T
+	for obj := range s.Iterate(nil) {
+		objs = append(objs, obj)
+	}
+
+	return objs
+}
+
+// Contains returns true if an object of type T with the given fingerprint is
+// part of the set.
+func (s Set[T]) Contains(fingerprint Fingerprint) bool {
+
+	_, exists := s.Get(fingerprint)
+	return exists
+}
+
+// Length returns the number of objects of type T in the set.  Views onto
+// consensuses and router descriptors of their own object type take the
+// underlying set's length; all other views count objects by iterating over
+// them.
+func (s Set[T]) Length() int {
+
+	var zero T
+	switch s.objs.(type) {
+	case *Consensus:
+		if _, ok := any(zero).(*RouterStatus); ok {
+			return s.objs.Length()
+		}
+	case *RouterDescriptors:
+		if _, ok := any(zero).(*RouterDescriptor); ok {
+			return s.objs.Length()
+		}
+	}
+
+	n := 0
+	for range s.Iterate(nil) {
+		n++
+	}
+
+	return n
+}
+
+// ObjectSet returns the underlying, untyped object set.
+func (s Set[T]) ObjectSet() ObjectSet {
+
+	return s.objs
+}
@@ -0,0 +1,46 @@
+// Tests functions from "typed.go".
+
+package zoossh
+
+import (
+	"testing"
+)
+
+func TestTypedSet(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := vote.Statuses()
+	if statuses.Length() != vote.Length() {
+		t.Errorf("Expected %d statuses but got %d.", vote.Length(), statuses.Length())
+	}
+
+	n := 0
+	for status := range statuses.Iterate(nil) {
+		if _, found := statuses.Get(status.Fingerprint); !found {
+			t.Errorf("Failed to get status %s.", status.Fingerprint)
+		}
+		n++
+	}
+	if n != vote.Length() || len(statuses.Slice()) != vote.Length() {
+		t.Error("Typed iteration missed statuses.")
+	}
+
+	// A view of the wrong type must not return any objects.
+	descs := AsSet[*RouterDescriptor](vote)
+	for status := range statuses.Iterate(nil) {
+		if _, found := descs.Get(status.Fingerprint); found {
+			t.Error("Router status was returned as descriptor.")
+		}
+	}
+	if len(descs.Slice()) != 0 || descs.Length() != 0 {
+		t.Error("Router statuses were returned as descriptors.")
+	}
+
+	if _, found := NewRouterDescriptors().Descriptors().Get("foo"); found {
+		t.Error("Got descriptor from empty set.")
+	}
+}
@@ -4,12 +4,13 @@ package zoossh
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,6 +20,105 @@ import (
 type QueueUnit struct {
 	Blurb string
 	Err   error
+
+	// The position of the blurb relative to the beginning of the dissected
+	// input.
+	Offset int64
+
+	// The time spent reading and extracting the blurb.
+	Elapsed time.Duration
+}
+
+// parseOptions determines how documents are parsed.
+type parseOptions struct {
+	// Delay parsing of single entries until they are accessed.
+	lazy bool
+
+	// Reject documents that are not well-formed.
+	strict bool
+
+	// Accept documents that are not well-formed, e.g., truncated consensuses,
+	// even if their type annotation calls for strict parsing.
+	tolerant bool
+
+	// Do not read and check the type annotation.  Only used by functions
+	// that take options.
+	unchecked bool
+
+	// Reject entries with malformed fields, naming the offending line.
+	validate bool
+
+	// The name of the document, e.g., its file name, for error messages.
+	source string
+
+	// The document's type annotation, if it was read.  Parsers use it to
+	// tell which version-dependent fields to expect.
+	annotation *Annotation
+
+	// The document's annotations other than the type annotation, if they
+	// were read.
+	metadata map[string]string
+
+	// The number of lines that precede the input, e.g., the type annotation.
+	baseLine int
+
+	// Record the position of single entries within their source document.
+	offsets bool
+
+	// The number of bytes that precede the input, e.g., the type annotation.
+	baseOffset int64
+
+	// If set, entries for which prefilter returns false are skipped without
+	// being parsed.
+	prefilter func(blurb string) bool
+
+	// If set, router statuses are shared with other consensuses that were
+	// parsed using the same pool.  Ignored if offsets are recorded.
+	pool *StatusPool
+
+	// If set, lazily parsed entries retain their parsed form within the
+	// budget.
+	budget *MemoryBudget
+
+	// If set, timing statistics of the parsing run are recorded.
+	stats *ParseStats
+
+	// The number of goroutines that parse entries in parallel.  Values
+	// below two parse entries on a single goroutine.
+	workers int
+
+	// If set, parsing stops once the context is done.
+	ctx context.Context
+
+	// If set, parsed entries are handed to the sink instead of being added
+	// to the returned set.  A sink's error stops parsing.
+	statusSink     func(*RouterStatus) error
+	descriptorSink func(*RouterDescriptor) error
+}
+
+// context returns the context of the parsing run.
+func (opts *parseOptions) context() context.Context {
+
+	if opts.ctx == nil {
+		return context.Background()
+	}
+	return opts.ctx
+}
+
+// countingReader counts the number of bytes and lines read from the
+// underlying reader.
+type countingReader struct {
+	r     io.Reader
+	n     int64
+	lines int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	cr.lines += bytes.Count(p[:n], []byte{'\n'})
+	return n, err
 }
 
 type Annotation struct {
@@ -31,9 +131,6 @@ type Annotation struct {
 // the respective parser.
 type StringExtractor func(string) (string, bool, error)
 
-// DescCache maps a descriptor's digest to its router descriptor.
-var DescCache = make(map[string]*RouterDescriptor)
-
 func (a *Annotation) String() string {
 
 	return fmt.Sprintf("@type %s %s.%s", a.Type, a.Major, a.Minor)
@@ -45,6 +142,78 @@ func (a *Annotation) Equals(b *Annotation) bool {
 	return (*a).Type == (*b).Type && (*a).Major == (*b).Major && (*a).Minor == (*b).Minor
 }
 
+// version returns the annotation's major and minor version as integers.
+// Versions that are not numeric are treated as 0.
+func (a *Annotation) version() (int, int) {
+
+	major, _ := strconv.Atoi(a.Major)
+	minor, _ := strconv.Atoi(a.Minor)
+
+	return major, minor
+}
+
+// Compare compares the versions of the two given annotations.  It returns -1
+// if a's version is lower than b's, 0 if both are equal, and 1 if a's version
+// is higher.  Annotations of different types are ordered by type first.
+func (a *Annotation) Compare(b *Annotation) int {
+
+	if a.Type != b.Type {
+		return strings.Compare(a.Type, b.Type)
+	}
+
+	aMajor, aMinor := a.version()
+	bMajor, bMinor := b.version()
+
+	switch {
+	case aMajor < bMajor || (aMajor == bMajor && aMinor < bMinor):
+		return -1
+	case aMajor > bMajor || aMinor > bMinor:
+		return 1
+	}
+
+	return 0
+}
+
+// AtLeast returns true if the annotation's version is at least the given
+// major and minor version.
+func (a *Annotation) AtLeast(major, minor int) bool {
+
+	aMajor, aMinor := a.version()
+
+	return aMajor > major || (aMajor == major && aMinor >= minor)
+}
+
+// Capability names a document field whose presence depends on the version of
+// the document's type annotation.
+type Capability string
+
+const (
+	// The "fingerprint" line of the bridge authority that produced a
+	// bridge network status.
+	CapabilityAuthorityFingerprint Capability = "authority-fingerprint"
+)
+
+// annotationCapabilities maps document types to the capabilities that later
+// versions of the type introduced, and the version that introduced them.
+// Capabilities that all versions of a type support are not listed.
+var annotationCapabilities = map[string]map[Capability]Annotation{
+	"bridge-network-status": {
+		CapabilityAuthorityFingerprint: {"bridge-network-status", "1", "2"},
+	},
+}
+
+// Supports returns true if documents with the given annotation support the
+// given capability.
+func (a *Annotation) Supports(c Capability) bool {
+
+	introduced, ok := annotationCapabilities[a.Type][c]
+	if !ok {
+		return false
+	}
+
+	return a.Compare(&introduced) >= 0
+}
+
 // This is the same regexp Stem uses.
 // https://gitweb.torproject.org/stem.git/tree/stem/descriptor/__init__.py?id=1.4.1#n182
 var annotationRegexp = regexp.MustCompile(`^@type (\S+) (\d+)\.(\d+)$`)
@@ -84,51 +253,118 @@ func Base64ToString(encoded string) (string, error) {
 	return hex.EncodeToString(decoded), nil
 }
 
-// readAnnotation reads and parses the first line of the the io.Reader, then
-// returns the resulting *Annotation as well as a new io.Reader ready to read
-// the rest of the file.
-func readAnnotation(r io.Reader) (*Annotation, io.Reader, error) {
+// annotationHeader holds the annotation lines at the beginning of a document:
+// the type annotation and any other annotations such as "@source" or
+// "@downloaded-at".
+type annotationHeader struct {
+	annotation *Annotation
+
+	// Maps the keyword of other annotations, without the leading "@", to
+	// their value.  Keywords must not repeat.
+	metadata map[string]string
+
+	// The number of bytes and lines that all annotation lines occupy.
+	length int64
+	lines  int
+}
+
+// readAnnotationHeader reads all annotation lines at the beginning of the
+// io.Reader, then returns the resulting annotation header as well as a new
+// io.Reader ready to read the rest of the file.  Exactly one of the lines must
+// be a type annotation.
+func readAnnotationHeader(r io.Reader) (*annotationHeader, io.Reader, error) {
 
 	br := bufio.NewReader(r)
+	header := &annotationHeader{metadata: make(map[string]string)}
 
 	// The annotation is placed in the first line of the file.  See the
 	// following URL for details:
 	// <https://collector.torproject.org/formats.html>
-	// Use ReadSlice rather than ReadBytes in order to get ErrBufferFull
-	// when there is no '\n' byte.
-	slice, err := br.ReadSlice('\n')
-	if err != nil {
-		return nil, nil, err
+	// Some tools prepend or append further annotations, so we read all lines
+	// that start with "@".
+	for {
+		// Use ReadSlice rather than ReadBytes in order to get ErrBufferFull
+		// when there is no '\n' byte.
+		slice, err := br.ReadSlice('\n')
+		if err != nil {
+			return nil, nil, err
+		}
+		header.length += int64(len(slice))
+		header.lines++
+
+		// Trim the trailing '\n'.
+		line := string(slice[:len(slice)-1])
+		if strings.HasPrefix(line, "@type ") || !strings.HasPrefix(line, "@") {
+			if header.annotation != nil {
+				return nil, nil, fmt.Errorf("bad syntax: %q", line)
+			}
+			if header.annotation, err = parseAnnotation(line); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			kv := strings.SplitN(line[1:], " ", 2)
+			if _, exists := header.metadata[kv[0]]; exists {
+				return nil, nil, fmt.Errorf("duplicate annotation: %q", line)
+			}
+			if len(kv) == 2 {
+				header.metadata[kv[0]] = kv[1]
+			} else {
+				header.metadata[kv[0]] = ""
+			}
+		}
+
+		next, _ := br.Peek(1)
+		if header.annotation != nil && (len(next) == 0 || next[0] != '@') {
+			break
+		}
 	}
 
-	// Trim the trailing '\n'.
-	line := string(slice[:len(slice)-1])
-	annotation, err := parseAnnotation(line)
+	return header, br, nil
+}
+
+// annotationMetadata returns the header's annotations other than the type
+// annotation, or nil if there are none.
+func (header *annotationHeader) annotationMetadata() map[string]string {
+
+	if len(header.metadata) == 0 {
+		return nil
+	}
+
+	return header.metadata
+}
+
+// readAnnotation reads and parses the annotation lines of the the io.Reader,
+// then returns the resulting *Annotation as well as a new io.Reader ready to
+// read the rest of the file.  Annotations other than the type annotation are
+// skipped.
+func readAnnotation(r io.Reader) (*Annotation, io.Reader, error) {
+
+	header, r, err := readAnnotationHeader(r)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return annotation, br, nil
+	return header.annotation, r, nil
 }
 
 // Checks the type annotation in the given io.Reader.  The Annotation struct
 // determines what we want to see.  If we don't see the expected annotation, an
 // error string is returned.
-func readAndCheckAnnotation(r io.Reader, expected map[Annotation]bool) (io.Reader, error) {
+func readAndCheckAnnotation(r io.Reader, expected map[Annotation]bool) (*annotationHeader, io.Reader, error) {
 
-	observed, r, err := readAnnotation(r)
+	header, r, err := readAnnotationHeader(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	for annotation := range expected {
 		// We support the observed annotation.
-		if annotation.Equals(observed) {
-			return r, nil
+		if annotation.Equals(header.annotation) {
+			return header, r, nil
 		}
 	}
 
-	return nil, fmt.Errorf("unexpected file annotation: %s", observed)
+	return nil, nil, fmt.Errorf("%w: %s", ErrUnexpectedAnnotation, header.annotation)
 }
 
 // GetAnnotation obtains and returns the given file's annotation.  If anything
@@ -149,6 +385,25 @@ func GetAnnotation(fileName string) (*Annotation, error) {
 	return annotation, nil
 }
 
+// GetAnnotationMetadata returns the annotations of the given file other than
+// the type annotation, e.g., "@source" or "@downloaded-at".  The returned map
+// uses the annotations' keywords without the leading "@" as keys.
+func GetAnnotationMetadata(fileName string) (map[string]string, error) {
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	header, _, err := readAnnotationHeader(fd)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file annotation for %q: %s", fileName, err)
+	}
+
+	return header.metadata, nil
+}
+
 // CheckAnnotation checks the type annotation in the given file.  The Annotation struct
 // determines what we want to see in the file.  If we don't see the expected
 // annotation, an error string is returned.
@@ -185,7 +440,7 @@ func CheckAnnotation(fd *os.File, expected map[Annotation]bool) error {
 		}
 	}
 
-	return fmt.Errorf("unexpected file annotation: %q", annotation)
+	return fmt.Errorf("%w: %q", ErrUnexpectedAnnotation, annotation)
 }
 
 // Dissects the given file into string chunks by using the given string
@@ -193,21 +448,101 @@ func CheckAnnotation(fd *os.File, expected map[Annotation]bool) error {
 // given queue where the receiving end parses them.
 func DissectFile(r io.Reader, extractor bufio.SplitFunc, queue chan QueueUnit) {
 
+	DissectFileContext(context.Background(), r, extractor, queue)
+}
+
+// contextReader is an io.Reader that fails once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// DissectFileContext works like DissectFile but stops reading and closes the
+// queue once the given context is done, even if the receiving end stopped
+// reading from the queue.  Receivers should check the context's error after
+// the queue is closed because the error may not make it into the queue.
+func DissectFileContext(ctx context.Context, r io.Reader, extractor bufio.SplitFunc, queue chan QueueUnit) {
+
 	defer close(queue)
 
-	scanner := bufio.NewScanner(r)
-	scanner.Split(extractor)
+	// Keep track of how many bytes the extractor consumed so far, so we can
+	// tell where each blurb starts.
+	var consumed, offset int64
+	scanner := bufio.NewScanner(&contextReader{ctx, r})
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := extractor(data, atEOF)
+		if token != nil {
+			// Extractors return a sub-slice of data, so the token's
+			// position within data follows from the slices' capacities.
+			offset = consumed + int64(cap(data)-cap(token))
+		}
+		consumed += int64(advance)
+		return advance, token, err
+	})
 
+	// Measure the time spent scanning but not the time spent waiting for
+	// the receiving end.
+	start := time.Now()
 	for scanner.Scan() {
-		unit := scanner.Text()
-		queue <- QueueUnit{unit, nil}
+		unit := QueueUnit{Blurb: scanner.Text(), Offset: offset, Elapsed: time.Since(start)}
+		select {
+		case queue <- unit:
+		case <-ctx.Done():
+			return
+		}
+		start = time.Now()
 	}
 
 	if err := scanner.Err(); err != nil {
-		queue <- QueueUnit{"", err}
+		select {
+		case queue <- QueueUnit{Err: err}:
+		case <-ctx.Done():
+		}
 	}
 }
 
+// splitAtKeyword implements bufio.SplitFunc for documents whose entries
+// start with a line of the given keyword and extend to the next such line or
+// the end of the input.
+func splitAtKeyword(data []byte, atEOF bool, keyword string) (advance int, token []byte, err error) {
+
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	start := findKeywordLine(data, 0, atEOF, keyword)
+	if start < 0 {
+		if atEOF {
+			return 0, nil, fmt.Errorf("%w: %q", ErrNoEntry, keyword)
+		}
+		// Request more data.
+		return 0, nil, nil
+	}
+
+	// Skip the entry's own keyword line.
+	next := len(data)
+	if i := bytes.IndexByte(data[start:], '\n'); i >= 0 {
+		next = start + i + 1
+	}
+
+	if end := findKeywordLine(data, next, atEOF, keyword); end >= 0 {
+		return end, data[start:end], nil
+	}
+	if atEOF {
+		return len(data), data[start:], nil
+	}
+	// Request more data.
+	return start, nil, nil
+}
+
 // Convert the given port string to an unsigned 16-bit integer.  If the
 // conversion fails or the number cannot be represented in 16 bits, 0 is
 // returned.
@@ -229,47 +564,3 @@ func SanitiseFingerprint(fingerprint Fingerprint) Fingerprint {
 
 	return Fingerprint(sanitised)
 }
-
-// LoadDescriptorFromDigest takes as input the descriptor directory, a
-// descriptor's digest, and the date the digest was created.  It then attempts
-// to parse and return the descriptor referenced by the digest.  The descriptor
-// directory expects to contain CollecTor server descriptor archives such as:
-// server-descriptors-2015-03/
-// server-descriptors-2015-04/
-// ...
-func LoadDescriptorFromDigest(descriptorDir, digest string, date time.Time) (*RouterDescriptor, error) {
-
-	// Check if we already have the descriptor in our local cache.
-	if desc, exists := DescCache[digest]; exists {
-		return desc, nil
-	}
-
-	topDir := fmt.Sprintf("server-descriptors-%s", date.Format("2006-01"))
-	prevTopDir := fmt.Sprintf("server-descriptors-%s", date.AddDate(0, -1, 0).Format("2006-01"))
-	fileName := filepath.Join(descriptorDir, topDir, digest[0:1], digest[1:2], digest)
-
-	// If we cannot find the descriptor file, go one month back in time.
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		fileName = filepath.Join(descriptorDir, prevTopDir, digest[0:1], digest[1:2], digest)
-		if _, err := os.Stat(fileName); os.IsNotExist(err) {
-			return nil, fmt.Errorf("could not find digest file %s in %s", digest, descriptorDir)
-		}
-	}
-
-	descs, err := ParseDescriptorFile(fileName)
-	if err != nil {
-		return nil, err
-	}
-
-	if descs.Length() != 1 {
-		return nil, fmt.Errorf("more than one descriptor in digest file %s.  Bug?", fileName)
-	}
-
-	var d *RouterDescriptor
-	for _, getDesc := range descs.RouterDescriptors {
-		d = getDesc()
-		break
-	}
-	DescCache[digest] = d
-	return d, nil
-}
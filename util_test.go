@@ -4,8 +4,10 @@ package zoossh
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -190,6 +192,66 @@ func TestReadAnnotation(t *testing.T) {
 	}
 }
 
+func TestAnnotationCompare(t *testing.T) {
+
+	older := &Annotation{"bridge-network-status", "1", "1"}
+	newer := &Annotation{"bridge-network-status", "1", "10"}
+
+	if older.Compare(newer) != -1 || newer.Compare(older) != 1 || older.Compare(older) != 0 {
+		t.Error("Annotations were not ordered by version.")
+	}
+	if !newer.AtLeast(1, 2) || older.AtLeast(1, 2) || !older.AtLeast(0, 9) || older.AtLeast(2, 0) {
+		t.Error("Unexpected result of AtLeast.")
+	}
+
+	if older.Supports(CapabilityAuthorityFingerprint) || !newer.Supports(CapabilityAuthorityFingerprint) {
+		t.Error("Unexpected capability of bridge network status.")
+	}
+	if (&Annotation{"server-descriptor", "9", "9"}).Supports(CapabilityAuthorityFingerprint) {
+		t.Error("Server descriptor claims unrelated capability.")
+	}
+}
+
+// Test the function readAnnotationHeader().
+func TestReadAnnotationHeader(t *testing.T) {
+
+	var expected = "12345678\n"
+	var input = "@source 128.31.0.34\n@type test 1.0\n@downloaded-at 2021-03-05 01:00:00\n" + expected
+
+	header, r, err := readAnnotationHeader(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.annotation.Equals(&Annotation{"test", "1", "0"}) {
+		t.Error("Unexpected type annotation.", header.annotation)
+	}
+	if header.metadata["source"] != "128.31.0.34" || header.metadata["downloaded-at"] != "2021-03-05 01:00:00" {
+		t.Error("Unexpected annotation metadata.", header.metadata)
+	}
+	if header.length != int64(len(input)-len(expected)) {
+		t.Errorf("Expected header length %d but got %d.", len(input)-len(expected), header.length)
+	}
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, []byte(expected)) {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+
+	for _, bad := range []string{
+		"@source foo\nbad line\n",
+		"@source foo\n",
+		"@type test 1.0\n@type test 1.0\n",
+		"@source foo\n@source bar\n@type test 1.0\n",
+	} {
+		if _, _, err := readAnnotationHeader(bytes.NewBufferString(bad)); err == nil {
+			t.Errorf("%q resulted in no error", bad)
+		}
+	}
+}
+
 // Test the function GetAnnotation() on a server-descriptor input.
 func TestGetAnnotationDescriptor(t *testing.T) {
 
@@ -351,3 +413,31 @@ func TestLoadDescriptorFromDigest(t *testing.T) {
 		}
 	}
 }
+
+// Test the function DissectFileContext().
+func TestDissectFileContext(t *testing.T) {
+
+	entry := "router a\n-----BEGIN SIGNATURE-----\n-----END SIGNATURE-----\n"
+	input := strings.Repeat(entry, 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := make(chan QueueUnit)
+	go DissectFileContext(ctx, strings.NewReader(input), extractDescriptor, queue)
+
+	// Stop reading after the first unit.  The queue must be closed anyway.
+	if unit := <-queue; unit.Blurb != entry {
+		t.Errorf("Unexpected unit %q.", unit.Blurb)
+	}
+	cancel()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-queue:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Queue was not closed after cancellation.")
+		}
+	}
+}
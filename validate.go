@@ -0,0 +1,211 @@
+// Provides strict validation of router statuses and router descriptors.
+
+package zoossh
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validateDigest checks that the given field is a base64-encoded,
+// 20-byte digest as found on "r" lines.
+func validateDigest(encoded string) error {
+
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return err
+	}
+	if len(decoded) != 20 {
+		return fmt.Errorf("expected 20 bytes but got %d", len(decoded))
+	}
+
+	return nil
+}
+
+// validatePort checks that the given field is a port number.
+func validatePort(port string) error {
+
+	_, err := strconv.ParseUint(port, 10, 16)
+
+	return err
+}
+
+// validateStatusLine checks the given words of an "r" line, without the
+// keyword.  It returns the status' fingerprint and an error if a field is
+// malformed.
+func validateStatusLine(words []string, flavour string) (Fingerprint, *ParseError) {
+
+	// Determine the fingerprint first, so that errors can name it.
+	var fingerprint Fingerprint
+	if len(words) > 1 && validateDigest(words[1]) == nil {
+		hexFpr, _ := Base64ToString(words[1])
+		fingerprint = SanitiseFingerprint(Fingerprint(hexFpr))
+	}
+
+	expected := 8
+	if flavour == FlavourMicrodesc {
+		expected = 7
+	}
+	if len(words) != expected {
+		return fingerprint, fieldError("r", "field count", strconv.Itoa(len(words)), fmt.Errorf("expected %d fields", expected))
+	}
+
+	if words[0] == "" {
+		return fingerprint, fieldError("r", "nickname", words[0], fmt.Errorf("empty nickname"))
+	}
+	if err := validateDigest(words[1]); err != nil {
+		return "", fieldError("r", "identity", words[1], err)
+	}
+
+	words = words[2:]
+	if flavour != FlavourMicrodesc {
+		if err := validateDigest(words[0]); err != nil {
+			return fingerprint, fieldError("r", "digest", words[0], err)
+		}
+		words = words[1:]
+	}
+
+	published := words[0] + " " + words[1]
+	if _, err := time.Parse(publishedTimeLayout, published); err != nil {
+		return fingerprint, fieldError("r", "publication time", published, err)
+	}
+	if net.ParseIP(words[2]).To4() == nil {
+		return fingerprint, fieldError("r", "address", words[2], fmt.Errorf("not an IPv4 address"))
+	}
+	if err := validatePort(words[3]); err != nil {
+		return fingerprint, fieldError("r", "ORPort", words[3], err)
+	}
+	if err := validatePort(words[4]); err != nil {
+		return fingerprint, fieldError("r", "DirPort", words[4], err)
+	}
+
+	return fingerprint, nil
+}
+
+// validateStatusEntry checks the "r" and "w" lines of the given raw router
+// status.  It returns the status' fingerprint, as far as it can be
+// determined, and an error if a field is malformed.
+func validateStatusEntry(rawStatus string, flavour string) (Fingerprint, error) {
+
+	var fingerprint Fingerprint
+
+	for i, line := range strings.Split(rawStatus, "\n") {
+		words := strings.Split(line, " ")
+		fail := func(field, value string, err error) (Fingerprint, error) {
+			return fingerprint, atLine(fieldError(words[0], field, value, err), i+1)
+		}
+
+		switch words[0] {
+		case "r":
+			var perr *ParseError
+			fingerprint, perr = validateStatusLine(words[1:], flavour)
+			if perr != nil {
+				return fingerprint, atLine(perr, i+1)
+			}
+
+		case "w":
+			for _, word := range words[1:] {
+				kv := strings.SplitN(word, "=", 2)
+				if len(kv) != 2 {
+					return fail("weight", word, fmt.Errorf("expected key=value"))
+				}
+				if kv[0] != "Bandwidth" && kv[0] != "Measured" {
+					continue
+				}
+				if _, err := strconv.ParseUint(kv[1], 10, 64); err != nil {
+					return fail(kv[0], kv[1], err)
+				}
+			}
+		}
+	}
+
+	return fingerprint, nil
+}
+
+// validateDescriptor checks the "bandwidth" line, the exit policy, the
+// Ed25519 keys and certificates, and the PEM-encoded objects of the given raw
+// router descriptor.  It returns the descriptor's fingerprint, as far as it
+// can be determined, and an error if a field is malformed.
+func validateDescriptor(rawDescriptor string) (Fingerprint, error) {
+
+	var fingerprint Fingerprint
+	var ferr error
+
+	// The keyword of the last line and the lines of the object that
+	// follows it.
+	var keyword string
+	var object []string
+
+	for i, line := range strings.Split(rawDescriptor, "\n") {
+		if strings.HasPrefix(line, "-----BEGIN") {
+			object = []string{}
+		}
+		if object != nil {
+			object = append(object, line)
+			if strings.HasPrefix(line, "-----END") {
+				err := new(RouterDescriptor).parseObject(keyword, strings.Join(object, "\n"))
+				if err != nil && ferr == nil {
+					ferr = atLine(err, i+1)
+				}
+				object = nil
+			}
+			continue
+		}
+
+		words := strings.Split(strings.TrimPrefix(line, "opt "), " ")
+		keyword = words[0]
+
+		switch words[0] {
+		case "fingerprint":
+			fingerprint = SanitiseFingerprint(Fingerprint(strings.Join(words[1:], "")))
+
+		case "bandwidth":
+			if ferr != nil {
+				continue
+			}
+			fields := []string{"average bandwidth", "burst bandwidth", "observed bandwidth"}
+			if len(words)-1 != len(fields) {
+				ferr = atLine(fieldError(words[0], "field count", strconv.Itoa(len(words)-1),
+					fmt.Errorf("expected %d fields", len(fields))), i+1)
+				continue
+			}
+			for j, field := range fields {
+				if _, err := strconv.ParseUint(words[j+1], 10, 64); err != nil {
+					ferr = atLine(fieldError(words[0], field, words[j+1], err), i+1)
+					break
+				}
+			}
+
+		case "accept", "reject", "accept6", "reject6":
+			if ferr != nil || len(words) < 2 {
+				continue
+			}
+			if _, err := parseExitRule(words[0], words[1]); err != nil {
+				ferr = atLine(err, i+1)
+			}
+
+		case "master-key-ed25519", "router-sig-ed25519":
+			if _, err := parseEd25519Line(words); err != nil && ferr == nil {
+				ferr = atLine(err, i+1)
+			}
+
+		case "ntor-onion-key-crosscert":
+			if _, err := parseCrosscertSign(words); err != nil && ferr == nil {
+				ferr = atLine(err, i+1)
+			}
+
+		case "ipv6-policy":
+			if err := parseIPv6Policy(words); err != nil && ferr == nil {
+				ferr = atLine(err, i+1)
+			}
+		}
+	}
+
+	// The "fingerprint" line follows the "bandwidth" line, so we only
+	// return once we have seen the entire descriptor.
+	return fingerprint, ferr
+}
@@ -0,0 +1,127 @@
+// Tests functions from "validate.go".
+
+package zoossh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFile writes the given content to a temporary file and returns the
+// file's name.
+func writeTestFile(t *testing.T, content string) string {
+
+	fileName := filepath.Join(t.TempDir(), "document")
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return fileName
+}
+
+// lineOf returns the line number of the first occurrence of the given string.
+func lineOf(document, s string) int {
+
+	return strings.Count(document[:strings.Index(document, s)], "\n") + 1
+}
+
+// Test the function StrictlyParseConsensusFile().
+func TestStrictlyParseConsensusFile(t *testing.T) {
+
+	if _, err := StrictlyParseConsensusFile(writeTestFile(t, testVote)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		old, new  string
+		field     string
+		tolerated bool
+	}{
+		{"w Bandwidth=2670", "w Bandwidth=lots", "Bandwidth", true},
+		{"193.11.166.194 9000 80", "193.11.166.194 90000 80", "ORPort", true},
+		{"2021-03-04 06:57:54", "2021-03-04 06:57", "publication time", true},
+		{"193.11.166.194 9000 80", "193.11.166.194 9000", "field count", false},
+	}
+
+	for _, test := range tests {
+		broken := strings.Replace(testVote, test.old, test.new, 1)
+		fileName := writeTestFile(t, broken)
+
+		// Tolerant parsing ignores some malformed fields.
+		if _, err := ParseConsensusFile(fileName); (err == nil) != test.tolerated {
+			t.Errorf("Unexpected tolerant parsing result for malformed %s: %v", test.field, err)
+		}
+
+		_, err := StrictlyParseConsensusFile(fileName)
+		if err == nil {
+			t.Errorf("Malformed %s was accepted.", test.field)
+			continue
+		}
+		prefix := fmt.Sprintf("%s:%d: entry 9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645: malformed %s",
+			fileName, lineOf(broken, test.new), test.field)
+		if !strings.HasPrefix(err.Error(), prefix) {
+			t.Errorf("Expected error starting with %q but got %q.", prefix, err)
+		}
+	}
+
+	// Strict parsing also rejects truncated documents.
+	truncated := testVote[:strings.Index(testVote, "directory-footer")]
+	if _, err := StrictlyParseConsensusFile(writeTestFile(t, truncated)); err != ErrNoDirectorySignature {
+		t.Errorf("Expected ErrNoDirectorySignature but got %v.", err)
+	}
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+	if _, err := StrictlyParseConsensusFile(consensusFile); err != nil {
+		t.Error(err)
+	}
+}
+
+// Test the function StrictlyParseDescriptorFile().
+func TestStrictlyParseDescriptorFile(t *testing.T) {
+
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+
+	if _, err := StrictlyParseDescriptorFile(serverDescriptorFile); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := string(content)
+
+	// Break the bandwidth line of the second descriptor.
+	second := strings.Index(document[1:], "\nrouter ") + 2
+	bandwidth := second + strings.Index(document[second:], "\nbandwidth ") + 1
+	end := bandwidth + strings.Index(document[bandwidth:], "\n")
+	broken := document[:bandwidth] + "bandwidth 1 2" + document[end:]
+	fileName := writeTestFile(t, broken)
+
+	descriptor := document[second:]
+	descriptor = descriptor[:strings.Index(descriptor, "\nrouter-signature")]
+	var fingerprint string
+	for _, line := range strings.Split(descriptor, "\n") {
+		if strings.HasPrefix(line, "fingerprint ") || strings.HasPrefix(line, "opt fingerprint ") {
+			fingerprint = strings.Replace(line[strings.Index(line, "fingerprint ")+12:], " ", "", -1)
+		}
+	}
+
+	_, err = StrictlyParseDescriptorFile(fileName)
+	if err == nil {
+		t.Fatal("Malformed bandwidth line was accepted.")
+	}
+	prefix := fmt.Sprintf("%s:%d: entry %s: malformed field count",
+		fileName, strings.Count(broken[:bandwidth], "\n")+1, fingerprint)
+	if !strings.HasPrefix(err.Error(), prefix) {
+		t.Errorf("Expected error starting with %q but got %q.", prefix, err)
+	}
+}
@@ -0,0 +1,202 @@
+// Provides parsing and comparison of Tor versions.
+
+package zoossh
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is a Tor version as defined in version-spec.txt, e.g.,
+// "0.4.5.6-rc".
+type Version struct {
+	Major, Minor, Micro, Patch int
+
+	// The optional status tag, e.g., "alpha" or "rc".
+	Status string
+}
+
+// ParseVersion parses the given Tor version, e.g., "0.4.5.6" or
+// "0.2.5.1-alpha".  A "Tor " prefix and trailing extra information in
+// parentheses are ignored.
+func ParseVersion(s string) (Version, error) {
+
+	var v Version
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "Tor ")
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, v.Status = s[:i], s[i+1:]
+	}
+
+	numbers := strings.Split(s, ".")
+	if len(numbers) < 3 || len(numbers) > 4 {
+		return v, fmt.Errorf("malformed version %q", s)
+	}
+	fields := []*int{&v.Major, &v.Minor, &v.Micro, &v.Patch}
+	for i, number := range numbers {
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("malformed version %q", s)
+		}
+		*fields[i] = n
+	}
+
+	return v, nil
+}
+
+// parseVersionList parses the given comma-separated list of versions as found
+// on "client-versions" and "server-versions" lines and returns the versions
+// in ascending order.
+func parseVersionList(line []byte) ([]Version, error) {
+
+	var versions []Version
+	for _, s := range strings.Split(string(line), ",") {
+		if s == "" {
+			continue
+		}
+		v, err := ParseVersion(s)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Compare(versions[j]) < 0
+	})
+
+	return versions, nil
+}
+
+// Compare returns -1 if the version is lower than the given version, 1 if it
+// is higher, and 0 if both are equal.  Versions are compared by their
+// numbers, and versions without status tag are higher than otherwise equal
+// versions with status tag.  Status tags are compared lexically.
+func (v Version) Compare(o Version) int {
+
+	for _, pair := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Micro, o.Micro}, {v.Patch, o.Patch}} {
+		if pair[0] < pair[1] {
+			return -1
+		} else if pair[0] > pair[1] {
+			return 1
+		}
+	}
+
+	switch {
+	case v.Status == o.Status:
+		return 0
+	case v.Status == "":
+		return 1
+	case o.Status == "":
+		return -1
+	}
+
+	return strings.Compare(v.Status, o.Status)
+}
+
+// String implements the Stringer interface for pretty printing.
+func (v Version) String() string {
+
+	s := fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Micro, v.Patch)
+	if v.Status != "" {
+		s += "-" + v.Status
+	}
+
+	return s
+}
+
+// VersionConstraint restricts Tor versions, e.g., to versions lower than
+// 0.4.7.
+type VersionConstraint struct {
+	// The comparison operator, one of "<", "<=", ">", ">=", "=", and "!=".
+	Operator string
+	Version  Version
+}
+
+// ParseVersionConstraint parses the given version constraint, which consists
+// of an operator followed by a version, e.g., "< 0.4.7" or ">=0.4.8.1".  A
+// version without operator must match exactly.
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+
+	var constraint VersionConstraint
+
+	s = strings.TrimSpace(s)
+	// Operators that are prefixes of others must come last.
+	for _, op := range []string{"<=", ">=", "!=", "<", ">", "="} {
+		if strings.HasPrefix(s, op) {
+			constraint.Operator = op
+			s = s[len(op):]
+			break
+		}
+	}
+	if constraint.Operator == "" {
+		constraint.Operator = "="
+	}
+
+	v, err := ParseVersion(s)
+	if err != nil {
+		return constraint, err
+	}
+	constraint.Version = v
+
+	return constraint, nil
+}
+
+// Matches returns true if the given version meets the constraint.
+func (c VersionConstraint) Matches(v Version) bool {
+
+	cmp := v.Compare(c.Version)
+	switch c.Operator {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	}
+
+	return false
+}
+
+// String implements the Stringer interface for pretty printing.
+func (c VersionConstraint) String() string {
+
+	return c.Operator + " " + c.Version.String()
+}
+
+// containsVersion returns true if the given sorted versions contain the given
+// version.
+func containsVersion(versions []Version, v Version) bool {
+
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].Compare(v) >= 0
+	})
+
+	return i < len(versions) && versions[i].Compare(v) == 0
+}
+
+// IsRecommendedClientVersion returns true if the given version is on the
+// consensus' "client-versions" line.
+func (c *Consensus) IsRecommendedClientVersion(v Version) bool {
+
+	return containsVersion(c.ClientVersions, v)
+}
+
+// IsRecommendedServerVersion returns true if the given version is on the
+// consensus' "server-versions" line.  Use it together with ParseVersion to
+// check a router status' TorVersion.
+func (c *Consensus) IsRecommendedServerVersion(v Version) bool {
+
+	return containsVersion(c.ServerVersions, v)
+}
@@ -0,0 +1,121 @@
+// Tests functions from "version.go".
+
+package zoossh
+
+import (
+	"testing"
+)
+
+// Test the function ParseVersion().
+func TestParseVersion(t *testing.T) {
+
+	tests := map[string]Version{
+		"0.4.5.6":                 {0, 4, 5, 6, ""},
+		"0.2.5.1-alpha":           {0, 2, 5, 1, "alpha"},
+		"Tor 0.4.6.1-alpha-dev":   {0, 4, 6, 1, "alpha-dev"},
+		"0.3.5.7 (git-abcdef123)": {0, 3, 5, 7, ""},
+		"0.1.2":                   {0, 1, 2, 0, ""},
+	}
+	for s, expected := range tests {
+		v, err := ParseVersion(s)
+		if err != nil {
+			t.Errorf("Failed to parse version %q: %s", s, err)
+		}
+		if v != expected {
+			t.Errorf("Expected version %v but got %v.", expected, v)
+		}
+	}
+
+	for _, s := range []string{"", "0.4", "0.4.x.6", "0.4.5.6.7", "0.-4.5"} {
+		if _, err := ParseVersion(s); err == nil {
+			t.Errorf("Malformed version %q was accepted.", s)
+		}
+	}
+}
+
+// Test the method Compare().
+func TestCompareVersions(t *testing.T) {
+
+	ordered := []string{"0.2.4.25", "0.2.5.1-alpha", "0.2.5.7-rc", "0.2.5.10", "0.4.5.6-rc", "0.4.5.6"}
+	for i := 1; i < len(ordered); i++ {
+		lo, _ := ParseVersion(ordered[i-1])
+		hi, _ := ParseVersion(ordered[i])
+		if lo.Compare(hi) != -1 || hi.Compare(lo) != 1 {
+			t.Errorf("Expected %s < %s.", lo, hi)
+		}
+		if hi.Compare(hi) != 0 {
+			t.Errorf("Expected %s = %s.", hi, hi)
+		}
+	}
+}
+
+// Test the functions ParseVersionConstraint() and Matches().
+func TestVersionConstraints(t *testing.T) {
+
+	tests := []struct {
+		constraint string
+		version    string
+		matches    bool
+	}{
+		{"< 0.4.7", "0.4.6.10", true},
+		{"< 0.4.7", "0.4.7.1-alpha", false},
+		{"<0.4.7.1", "0.4.7.1-alpha", true},
+		{"<= 0.4.7", "0.4.7.0", true},
+		{"> 0.4.7", "0.4.7.0", false},
+		{">= 0.4.7", "0.4.8.1", true},
+		{"= 0.4.5.6", "0.4.5.6", true},
+		{"0.4.5.6", "0.4.5.7", false},
+		{"!= 0.4.5.6", "0.4.5.7", true},
+	}
+	for _, test := range tests {
+		c, err := ParseVersionConstraint(test.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := ParseVersion(test.version)
+		if c.Matches(v) != test.matches {
+			t.Errorf("Expected %q to match %s: %t.", test.constraint, test.version, test.matches)
+		}
+	}
+
+	for _, s := range []string{"", "<", "~ 0.4.7", "< 0.4"} {
+		if _, err := ParseVersionConstraint(s); err == nil {
+			t.Errorf("Malformed constraint %q was accepted.", s)
+		}
+	}
+}
+
+// Test recommended versions of consensuses.
+func TestRecommendedVersions(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vote.ServerVersions) != 2 || vote.ServerVersions[0].String() != "0.4.4.7" {
+		t.Error("Unexpected server versions.", vote.ServerVersions)
+	}
+
+	for _, getStatus := range vote.RouterStatuses {
+		status := getStatus()
+		v, err := ParseVersion(status.TorVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !vote.IsRecommendedServerVersion(v) || !vote.IsRecommendedClientVersion(v) {
+			t.Errorf("Expected version %s of %s to be recommended.", v, status.Nickname)
+		}
+	}
+	old, _ := ParseVersion("0.3.5.7")
+	if vote.IsRecommendedServerVersion(old) {
+		t.Error("Unexpected recommended version.", old)
+	}
+
+	versions, err := parseVersionList([]byte("0.2.5.10,0.2.4.23,0.2.5.9-rc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions[0].String() != "0.2.4.23" || versions[2].String() != "0.2.5.10" {
+		t.Error("Versions are not sorted.", versions)
+	}
+}
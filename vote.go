@@ -0,0 +1,28 @@
+// Parses files containing network status votes.
+
+package zoossh
+
+var voteAnnotations = map[Annotation]bool{
+	// The file format we currently (try to) support.
+	Annotation{"network-status-vote-3", "1", "0"}: true,
+}
+
+// extractVoteMetaInfo extracts vote-specific meta information from the
+// already-populated MetaInfo map and writes it to the given consensus.  The
+// values are only present in votes, so consensuses are left untouched.
+func extractVoteMetaInfo(c *Consensus) error {
+
+	if line, ok := c.MetaInfo["bandwidth-file-headers"]; ok {
+		c.BandwidthFileHeaders = parseBandwidthFileHeaders(line)
+	}
+
+	if line, ok := c.MetaInfo["bandwidth-file-digest"]; ok {
+		digests, err := parseBandwidthFileDigests(line)
+		if err != nil {
+			return err
+		}
+		c.BandwidthFileDigests = digests
+	}
+
+	return nil
+}
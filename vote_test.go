@@ -0,0 +1,154 @@
+// Tests functions from "vote.go".
+
+package zoossh
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A trimmed-down network status vote.  Key and signature blocks are
+// shortened.
+const testVote = `@type network-status-vote-3 1.0
+network-status-version 3
+vote-status vote
+consensus-methods 28 29 30 31
+published 2021-03-05 00:50:00
+valid-after 2021-03-05 01:00:00
+fresh-until 2021-03-05 02:00:00
+valid-until 2021-03-05 04:00:00
+voting-delay 300 300
+client-versions 0.4.4.7,0.4.5.6
+server-versions 0.4.4.7,0.4.5.6
+known-flags Authority BadExit Exit Fast Guard HSDir Running Stable V2Dir Valid
+params CircuitPriorityHalflifeMsec=30000 DoSCircuitCreationEnabled=1
+bandwidth-file-headers timestamp=1614905398 version=1.4.0 software=sbws software_version=1.1.0 file_created=2021-03-05T00:50:08 generator_started=2021-03-01T14:42:52 earliest_bandwidth=2021-02-28T00:50:02 latest_bandwidth=2021-03-05T00:49:58
+bandwidth-file-digest sha256=GjgZg8mQ1hOQkyBaDUyESpiAnkgPgmgiSeqEgHIyTLw
+dir-source moria1 D586D18309DED4CD6D57C18FDB97EFA96D330566 128.31.0.34 128.31.0.34 9131 9101
+contact 1024D/EB5A896A28988BF5 arma mit edu
+shared-rand-participate
+shared-rand-commit 1 sha3-256 D586D18309DED4CD6D57C18FDB97EFA96D330566 AAAAAGBBhAA8nF08GzkbzcGmcG6qSaVjcOrKxoAQE52DLb4VcCJ7Lw== AAAAAGBBhADPaSYP+YvUbSzWuxg9jAA4Rj8ofJ9qO4X+yHCu1eO5Kw==
+shared-rand-previous-value 9 R6yGNt2O9K5lmsb0OIT7MIrzK26b27PG2Y2p8wd2XJI=
+shared-rand-current-value 9 ksD0mEb+EcfgLpASYCCVTR4dK1iWsr4vZj5qprGdWG8=
+dir-key-certificate-version 3
+fingerprint D586D18309DED4CD6D57C18FDB97EFA96D330566
+dir-key-published 2020-11-28 00:00:00
+dir-key-expires 2021-11-28 00:00:00
+dir-identity-key
+-----BEGIN RSA PUBLIC KEY-----
+MIIBigKCAYEAxPS7tCkSQEVrJMvXbmHc9jxBHQvjWlp6+qm34Dd5O7vIU7rFW4Gt
+-----END RSA PUBLIC KEY-----
+dir-signing-key
+-----BEGIN RSA PUBLIC KEY-----
+MIIBCgKCAQEAt4ObyfMfmXXVzE6+cc4fUV2eWUw2Vkmk3w8RkdDqKOO4qbs5vFZd
+-----END RSA PUBLIC KEY-----
+dir-key-crosscert
+-----BEGIN ID SIGNATURE-----
+b5GyO4ZVqLIYm2/Ilc4aT1s8kvdaMiTQHJ8iHkjSTtzEpg==
+-----END ID SIGNATURE-----
+dir-key-certification
+-----BEGIN SIGNATURE-----
+sb4lAsj8f+pXsoR/tKpmLM37dBsA1VtaLWsSKNj24ks=
+-----END SIGNATURE-----
+r seele AAoQ1DAR6kkoo19hBAX5K0QztNw bdrzhG0Kk/8DUsnSdmzj7DjFQjY 2021-03-04 12:27:05 73.15.150.172 9001 0
+m 28,29,30 sha256=0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I
+m 31 sha256=xUvv2n4sTHjS2lKIf4B1s1DqZFm4wBpwPE8lDxLgnwY
+s Fast Running Stable Valid
+v Tor 0.4.5.6
+w Bandwidth=18 Measured=20
+p reject 1-65535
+id ed25519 none
+r Karlstad0 m5TNC3uAV+ryG6fwI7ehyMqc5kU f1g9KQhgS0r6+H/7dzAJOpi6lG8 2021-03-04 06:57:54 193.11.166.194 9000 80
+m 28,29,30,31 sha256=q6j9Qmtne8mGhW3YwbDcArz27YTu1xAWcCdkwR/BMnM
+s Exit Fast Guard HSDir Running Stable V2Dir Valid
+v Tor 0.4.4.7
+w Bandwidth=2670 Measured=2500
+p accept 80,443
+id ed25519 4eFKlUwFYQHsnPxhVZQl+jNmt9JQ+Mgl5s4+E0ywC6M
+directory-footer
+directory-signature sha256 D586D18309DED4CD6D57C18FDB97EFA96D330566 C0A0C5F5AE9C2E49A4F2A3DBBA4A0F6AF8E5B6CD
+-----BEGIN SIGNATURE-----
+Mg1/8gSr5wf1UIoREI8KB2EEXxDSxQZG/tzWaXlhSwvuRS8g3SX5+Y2aTqfP7aAk
+-----END SIGNATURE-----
+`
+
+func TestParseVote(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vote.Length() != 2 {
+		t.Errorf("Expected 2 statuses in vote but got %d.", vote.Length())
+	}
+
+	header := vote.BandwidthFileHeaders
+	if header == nil {
+		t.Fatal("Failed to parse bandwidth-file-headers line.")
+	}
+	if header.Software != "sbws" || header.SoftwareVersion != "1.1.0" || header.Version != "1.4.0" {
+		t.Error("Unexpected bandwidth file software or version.", header)
+	}
+	if !header.Timestamp.Equal(time.Unix(1614905398, 0)) {
+		t.Error("Unexpected bandwidth file timestamp.", header.Timestamp)
+	}
+	if header.FileCreated != time.Date(2021, time.March, 5, 0, 50, 8, 0, time.UTC) {
+		t.Error("Unexpected bandwidth file creation time.", header.FileCreated)
+	}
+
+	if len(vote.BandwidthFileDigests) != 1 {
+		t.Fatal("Failed to parse bandwidth-file-digest line.")
+	}
+	digest := vote.BandwidthFileDigests[0]
+	if digest.Algorithm != "sha256" || digest.Digest != "GjgZg8mQ1hOQkyBaDUyESpiAnkgPgmgiSeqEgHIyTLw" {
+		t.Error("Unexpected bandwidth file digest.", digest)
+	}
+}
+
+func TestParseBandwidthFileDigests(t *testing.T) {
+
+	if _, err := parseBandwidthFileDigests([]byte("sha256")); err == nil {
+		t.Error("Malformed bandwidth file digest did not raise an error.")
+	}
+
+	digests, err := parseBandwidthFileDigests([]byte("sha256=foo sha1=bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 2 || digests[1].Algorithm != "sha1" || digests[1].Digest != "bar" {
+		t.Error("Unexpected bandwidth file digests.", digests)
+	}
+}
+
+func TestParseVoteMicrodescDigests(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ := vote.Get("000A10D43011EA4928A35F610405F92B4433B4DC")
+	expected := map[int]string{
+		28: "0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I",
+		29: "0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I",
+		30: "0/lSJVmtWwXASjnqeL2Ih06cJO8OIsumg91bZh0iZ8I",
+		31: "xUvv2n4sTHjS2lKIf4B1s1DqZFm4wBpwPE8lDxLgnwY",
+	}
+	if !reflect.DeepEqual(status.MicrodescDigests, expected) {
+		t.Errorf("Expected microdescriptor digests %v but got %v.", expected, status.MicrodescDigests)
+	}
+	if status.MicrodescDigest != "" {
+		t.Error("Vote status must not have a microdesc consensus digest.")
+	}
+
+	if status.Copy().MicrodescDigests[31] != expected[31] {
+		t.Error("Copy lost microdescriptor digests.")
+	}
+
+	digests := make(map[int]string)
+	if err := parseVoteMicrodescDigests([]string{"28,x", "sha256=foo"}, digests); err == nil {
+		t.Error("Malformed consensus method did not raise an error.")
+	}
+}
@@ -0,0 +1,97 @@
+// Provides a report on how directory authorities voted in a single round.
+
+package zoossh
+
+import (
+	"sort"
+)
+
+// AuthorityDisagreement lists where a single authority's vote disagrees with
+// the consensus.
+type AuthorityDisagreement struct {
+	// Relays that the authority voted on but that did not make it into the
+	// consensus.
+	Excluded []Fingerprint
+
+	// Maps a flag to the relays that the authority assigned the flag to
+	// although the consensus did not, i.e., only a minority of authorities
+	// assigned it.
+	MinorityFlags map[string][]Fingerprint
+}
+
+// BandwidthSpread summarizes the bandwidth measurements that authorities
+// reported for a single relay.
+type BandwidthSpread struct {
+	// The number of votes with a measurement.
+	Votes int
+
+	Min    uint64
+	Median uint64
+	Max    uint64
+}
+
+// VotingReport describes how the authorities' votes of a voting round relate
+// to the resulting consensus.
+type VotingReport struct {
+	// Maps an authority, as named by the caller, to its disagreements.
+	Authorities map[string]*AuthorityDisagreement
+
+	// Maps a relay to the spread of its measured bandwidth across votes.
+	// Only relays with at least one measurement are present.
+	BandwidthSpread map[Fingerprint]*BandwidthSpread
+}
+
+// NewVotingReport compares the given votes, which map an authority's name to
+// its vote, with the given consensus of the same voting round.  Bandwidth
+// spread is computed over the votes' "Measured" values.
+func NewVotingReport(votes map[string]*Consensus, consensus *Consensus) *VotingReport {
+
+	report := &VotingReport{
+		Authorities:     make(map[string]*AuthorityDisagreement),
+		BandwidthSpread: make(map[Fingerprint]*BandwidthSpread),
+	}
+	measurements := make(map[Fingerprint][]uint64)
+
+	for name, vote := range votes {
+		disagreement := &AuthorityDisagreement{MinorityFlags: make(map[string][]Fingerprint)}
+		report.Authorities[name] = disagreement
+
+		for fpr, getStatus := range vote.RouterStatuses {
+			voted := getStatus()
+			if voted.Measured > 0 {
+				measurements[fpr] = append(measurements[fpr], voted.Measured)
+			}
+
+			status, found := consensus.Get(fpr)
+			if !found {
+				disagreement.Excluded = append(disagreement.Excluded, fpr)
+				continue
+			}
+			agreed := flagSet(status.Flags)
+			for _, flag := range voted.Flags.flagNames() {
+				if !agreed[flag] {
+					disagreement.MinorityFlags[flag] = append(disagreement.MinorityFlags[flag], fpr)
+				}
+			}
+		}
+
+		sort.Slice(disagreement.Excluded, func(i, j int) bool {
+			return disagreement.Excluded[i] < disagreement.Excluded[j]
+		})
+		for _, fprs := range disagreement.MinorityFlags {
+			sort.Slice(fprs, func(i, j int) bool { return fprs[i] < fprs[j] })
+		}
+	}
+
+	for fpr, values := range measurements {
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		report.BandwidthSpread[fpr] = &BandwidthSpread{
+			Votes:  len(values),
+			Min:    values[0],
+			Median: values[(len(values)-1)/2],
+			Max:    values[len(values)-1],
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,77 @@
+// Tests functions from "votingreport.go".
+
+package zoossh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewVotingReport(t *testing.T) {
+
+	a := Fingerprint("0000000000000000000000000000000000000001")
+	b := Fingerprint("0000000000000000000000000000000000000002")
+
+	vote := func(statuses ...*RouterStatus) *Consensus {
+		c := NewConsensus()
+		for _, s := range statuses {
+			c.Set(s.Fingerprint, s)
+		}
+		return c
+	}
+
+	votes := map[string]*Consensus{
+		"moria1": vote(
+			&RouterStatus{Fingerprint: a, Flags: RouterFlags{Running: true, Guard: true}, Measured: 100},
+			&RouterStatus{Fingerprint: b, Flags: RouterFlags{Running: true}}),
+		"tor26": vote(
+			&RouterStatus{Fingerprint: a, Flags: RouterFlags{Running: true}, Measured: 300}),
+		"gabelmoo": vote(
+			&RouterStatus{Fingerprint: a, Flags: RouterFlags{Running: true}, Measured: 200}),
+	}
+	consensus := vote(&RouterStatus{Fingerprint: a, Flags: RouterFlags{Running: true}})
+
+	report := NewVotingReport(votes, consensus)
+
+	moria := report.Authorities["moria1"]
+	if len(moria.Excluded) != 1 || moria.Excluded[0] != b {
+		t.Errorf("Unexpected excluded relays %v.", moria.Excluded)
+	}
+	if fprs := moria.MinorityFlags["Guard"]; len(fprs) != 1 || fprs[0] != a {
+		t.Errorf("Unexpected minority flags %v.", moria.MinorityFlags)
+	}
+	if len(report.Authorities["tor26"].MinorityFlags) != 0 {
+		t.Error("Expected no minority flags for tor26.")
+	}
+
+	spread := report.BandwidthSpread[a]
+	if spread == nil || spread.Votes != 3 || spread.Min != 100 || spread.Median != 200 || spread.Max != 300 {
+		t.Errorf("Unexpected bandwidth spread %+v.", spread)
+	}
+	if _, exists := report.BandwidthSpread[b]; exists {
+		t.Error("Expected no bandwidth spread for relay without measurements.")
+	}
+
+	// Measurements are taken from the "Measured" value of parsed votes' "w"
+	// lines.
+	parsed := make(map[string]*Consensus)
+	for name, measured := range map[string]string{"moria1": "2500", "tor26": "2900", "gabelmoo": "2700"} {
+		raw := strings.Replace(testVote, "Bandwidth=2670 Measured=2500", "Bandwidth=2670 Measured="+measured, 1)
+		vote, err := ParseRawConsensus(raw, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed[name] = vote
+	}
+	report = NewVotingReport(parsed, parsed["moria1"])
+
+	karlstad := Fingerprint("9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645")
+	spread = report.BandwidthSpread[karlstad]
+	if spread == nil || spread.Votes != 3 || spread.Min != 2500 || spread.Median != 2700 || spread.Max != 2900 {
+		t.Errorf("Unexpected bandwidth spread %+v of parsed votes.", spread)
+	}
+	seele := Fingerprint("000A10D43011EA4928A35F610405F92B4433B4DC")
+	if spread = report.BandwidthSpread[seele]; spread == nil || spread.Min != 20 || spread.Max != 20 {
+		t.Errorf("Unexpected bandwidth spread %+v of parsed votes.", spread)
+	}
+}
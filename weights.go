@@ -0,0 +1,69 @@
+// Parses the bandwidth weights of consensus footers.
+
+package zoossh
+
+// BandwidthWeights holds the weights of a consensus' "bandwidth-weights"
+// line as defined in dir-spec.txt, Section 3.4.2.  Clients multiply a relay's
+// bandwidth by these weights to select relays for a given position, e.g., Wgd
+// is the weight of Guard+Exit-flagged relays for the guard position.  The
+// weights are scaled by the "bwweightscale" parameter, which defaults to
+// 10000.
+type BandwidthWeights struct {
+	Wbd, Wbe, Wbg, Wbm int
+	Wdb                int
+	Web, Wed, Wee, Weg int
+	Wem                int
+	Wgb, Wgd, Wgg, Wgm int
+	Wmb, Wmd, Wme, Wmg int
+	Wmm                int
+}
+
+// DefaultBandwidthWeightScale is the scale of bandwidth weights unless the
+// consensus' "bwweightscale" parameter says otherwise.
+const DefaultBandwidthWeightScale = 10000
+
+// weights maps the keywords of the "bandwidth-weights" line to the
+// corresponding fields.
+func (bw *BandwidthWeights) weights() map[string]*int {
+
+	return map[string]*int{
+		"Wbd": &bw.Wbd, "Wbe": &bw.Wbe, "Wbg": &bw.Wbg, "Wbm": &bw.Wbm,
+		"Wdb": &bw.Wdb,
+		"Web": &bw.Web, "Wed": &bw.Wed, "Wee": &bw.Wee, "Weg": &bw.Weg,
+		"Wem": &bw.Wem,
+		"Wgb": &bw.Wgb, "Wgd": &bw.Wgd, "Wgg": &bw.Wgg, "Wgm": &bw.Wgm,
+		"Wmb": &bw.Wmb, "Wmd": &bw.Wmd, "Wme": &bw.Wme, "Wmg": &bw.Wmg,
+		"Wmm": &bw.Wmm,
+	}
+}
+
+// parseBandwidthWeights parses the given words of a "bandwidth-weights" line,
+// without the keyword.  Unknown weights are ignored so that future additions
+// to the line don't break parsing.
+func parseBandwidthWeights(words []string) (*BandwidthWeights, error) {
+
+	kvs, err := parseIntKeyValues(words, "bandwidth weight")
+	if err != nil {
+		return nil, err
+	}
+
+	bw := &BandwidthWeights{}
+	for key, field := range bw.weights() {
+		if value, ok := kvs[key]; ok {
+			*field = value
+		}
+	}
+
+	return bw, nil
+}
+
+// BandwidthWeightScale returns the scale of the consensus' bandwidth weights,
+// i.e., its "bwweightscale" parameter or DefaultBandwidthWeightScale.
+func (c *Consensus) BandwidthWeightScale() int {
+
+	if scale, ok := c.Params["bwweightscale"]; ok && scale > 0 {
+		return scale
+	}
+
+	return DefaultBandwidthWeightScale
+}
@@ -0,0 +1,69 @@
+// Tests functions from "weights.go".
+
+package zoossh
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// Test the function parseBandwidthWeights().
+func TestParseBandwidthWeights(t *testing.T) {
+
+	line := "Wbd=202 Wbe=0 Wbg=3850 Wbm=10000 Wdb=10000 Web=10000 Wed=9596 Wee=10000 Weg=9596 " +
+		"Wem=10000 Wgb=10000 Wgd=202 Wgg=6150 Wgm=6150 Wmb=10000 Wmd=202 Wme=0 Wmg=3850 Wmm=10000 Wxx=1"
+
+	bw, err := parseBandwidthWeights(strings.Fields(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bw.Wgg != 6150 || bw.Wgd != 202 || bw.Wee != 10000 || bw.Wme != 0 || bw.Wmm != 10000 {
+		t.Error("Unexpected bandwidth weights.", bw)
+	}
+
+	for _, line := range []string{"Wgg", "Wgg=x", "Wgg=99999999999"} {
+		if _, err := parseBandwidthWeights(strings.Fields(line)); err == nil {
+			t.Errorf("Malformed bandwidth weights %q were accepted.", line)
+		}
+	}
+}
+
+// Test that bandwidth weights are taken from the consensus footer.
+func TestConsensusBandwidthWeights(t *testing.T) {
+
+	vote, err := ParseRawConsensus(testVote, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.BandwidthWeights != nil {
+		t.Error("Vote unexpectedly has bandwidth weights.")
+	}
+	if vote.BandwidthWeightScale() != DefaultBandwidthWeightScale {
+		t.Error("Unexpected bandwidth weight scale.", vote.BandwidthWeightScale())
+	}
+
+	raw := strings.Replace(testVote, "directory-footer\n", "directory-footer\nbandwidth-weights Wgg=5000 Wee=7000\n", 1)
+	raw = strings.Replace(raw, "DoSCircuitCreationEnabled=1", "DoSCircuitCreationEnabled=1 bwweightscale=1000", 1)
+	consensus, err := ParseRawConsensus(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.BandwidthWeights == nil || consensus.BandwidthWeights.Wgg != 5000 || consensus.BandwidthWeights.Wee != 7000 {
+		t.Error("Unexpected bandwidth weights.", consensus.BandwidthWeights)
+	}
+	if consensus.BandwidthWeightScale() != 1000 {
+		t.Error("Unexpected bandwidth weight scale.", consensus.BandwidthWeightScale())
+	}
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+	consensus, err = ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consensus.BandwidthWeights == nil || consensus.BandwidthWeights.Wgg != 6150 || consensus.BandwidthWeights.Wmg != 3850 {
+		t.Error("Unexpected bandwidth weights.", consensus.BandwidthWeights)
+	}
+}
@@ -0,0 +1,101 @@
+// Provides parallel processing of the entries of a document.
+
+package zoossh
+
+import (
+	"context"
+	"time"
+)
+
+// processedUnit is a queue unit along with the result of processing it and
+// the time processing took.
+type processedUnit[R any] struct {
+	QueueUnit
+	result  R
+	elapsed time.Duration
+}
+
+// processUnits reads units from the given queue, processes them using the
+// given number of workers, and returns a channel that yields the processed
+// units in queue order, so that results do not depend on the number of
+// workers.  Units that carry an error are passed on without being processed.
+// The returned channel is closed once the queue is closed or the context is
+// done.
+func processUnits[R any](ctx context.Context, queue <-chan QueueUnit, workers int, process func(string) R) <-chan processedUnit[R] {
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	type job struct {
+		unit   QueueUnit
+		result chan processedUnit[R]
+	}
+	jobs := make(chan job, workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				start := time.Now()
+				result := process(j.unit.Blurb)
+				j.result <- processedUnit[R]{j.unit, result, time.Since(start)}
+			}
+		}()
+	}
+
+	// Results are handed out in the order in which their jobs were
+	// created.  The buffer lets workers run ahead of the receiving end.
+	pending := make(chan chan processedUnit[R], workers)
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+
+		for unit := range queue {
+			result := make(chan processedUnit[R], 1)
+			if unit.Err != nil {
+				result <- processedUnit[R]{QueueUnit: unit}
+			} else {
+				select {
+				case jobs <- job{unit, result}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	units := make(chan processedUnit[R])
+	go func() {
+		defer close(units)
+
+		for result := range pending {
+			select {
+			case units <- <-result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return units
+}
+
+// ParseConsensusFileWithWorkers works like ParseConsensusFile but parses
+// router statuses using the given number of goroutines, e.g.,
+// runtime.NumCPU(), which pays off for eager parsing on multi-core machines.
+func ParseConsensusFileWithWorkers(fileName string, workers int) (*Consensus, error) {
+
+	return parseConsensusFile(fileName, parseOptions{workers: workers})
+}
+
+// ParseDescriptorFileWithWorkers works like ParseDescriptorFile but parses
+// router descriptors using the given number of goroutines.
+func ParseDescriptorFileWithWorkers(fileName string, workers int) (*RouterDescriptors, error) {
+
+	return parseDescriptorFile(fileName, parseOptions{workers: workers})
+}
@@ -0,0 +1,107 @@
+// Tests functions from "workers.go".
+
+package zoossh
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Benchmark parsing a consensus file using one goroutine per CPU.
+func BenchmarkConsensusParsingWorkers(b *testing.B) {
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		b.Skipf("skipping because of missing %s", consensusFile)
+	}
+
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseConsensusFileWithWorkers(consensusFile, 8); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Test the function processUnits().
+func TestProcessUnits(t *testing.T) {
+
+	queue := make(chan QueueUnit)
+	go func() {
+		for i := 0; i < 100; i++ {
+			queue <- QueueUnit{Blurb: strconv.Itoa(i)}
+		}
+		close(queue)
+	}()
+
+	// Early units take longest, so workers finish out of order.
+	process := func(blurb string) int {
+		n, _ := strconv.Atoi(blurb)
+		time.Sleep(time.Duration(100-n) * 10 * time.Microsecond)
+		return n
+	}
+
+	i := 0
+	for unit := range processUnits(context.Background(), queue, 8, process) {
+		if unit.result != i {
+			t.Fatalf("Expected result %d but got %d.", i, unit.result)
+		}
+		i++
+	}
+	if i != 100 {
+		t.Errorf("Expected 100 units but got %d.", i)
+	}
+}
+
+// Test the function ParseConsensusFileWithWorkers().
+func TestParseConsensusFileWithWorkers(t *testing.T) {
+
+	if _, err := os.Stat(consensusFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", consensusFile)
+	}
+
+	sequential, err := ParseConsensusFile(consensusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := ParseConsensusFileWithWorkers(consensusFile, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parallel.Length() != numRouterStatuses {
+		t.Fatalf("Expected %d router statuses but got %d.", numRouterStatuses, parallel.Length())
+	}
+	for fingerprint, getStatus := range sequential.RouterStatuses {
+		status, ok := parallel.Get(fingerprint)
+		if !ok || status.String() != getStatus().String() {
+			t.Fatalf("Router status %s differs.", fingerprint)
+		}
+	}
+}
+
+// Test the function ParseDescriptorFileWithWorkers().
+func TestParseDescriptorFileWithWorkers(t *testing.T) {
+
+	if _, err := os.Stat(serverDescriptorFile); os.IsNotExist(err) {
+		t.Skipf("skipping because of missing %s", serverDescriptorFile)
+	}
+
+	sequential, err := ParseDescriptorFile(serverDescriptorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := ParseDescriptorFileWithWorkers(serverDescriptorFile, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Descriptors of the same relay must be resolved in file order.
+	for fingerprint, getDescriptor := range sequential.RouterDescriptors {
+		desc, ok := parallel.Get(fingerprint)
+		if !ok || desc.Digest() != getDescriptor().Digest() {
+			t.Fatalf("Router descriptor %s differs.", fingerprint)
+		}
+	}
+}
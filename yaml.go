@@ -0,0 +1,199 @@
+// Provides YAML export of object sets.
+
+package zoossh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// keyValue is a single key-value pair of an encoded mapping, e.g., in YAML.
+// Values are strings, integers, booleans, string slices, or nested mappings.
+type keyValue struct {
+	key   string
+	value interface{}
+}
+
+// yamlString quotes the given string.  JSON string literals are valid YAML
+// double-quoted scalars, which spares us YAML's many quoting rules.
+func yamlString(s string) string {
+
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// writeYAMLMapping writes the given fields as a block mapping.  The first
+// line is prefixed with firstPrefix and all following lines with prefix,
+// which allows for writing mappings as sequence items.
+func writeYAMLMapping(w io.Writer, fields []keyValue, firstPrefix, prefix string) error {
+
+	for i, field := range fields {
+		p := prefix
+		if i == 0 {
+			p = firstPrefix
+		}
+
+		var err error
+		switch v := field.value.(type) {
+		case string:
+			_, err = fmt.Fprintf(w, "%s%s: %s\n", p, field.key, yamlString(v))
+		case []string:
+			if len(v) == 0 {
+				_, err = fmt.Fprintf(w, "%s%s: []\n", p, field.key)
+				break
+			}
+			if _, err = fmt.Fprintf(w, "%s%s:\n", p, field.key); err != nil {
+				break
+			}
+			for _, s := range v {
+				if _, err = fmt.Fprintf(w, "%s  - %s\n", prefix, yamlString(s)); err != nil {
+					break
+				}
+			}
+		case []keyValue:
+			if _, err = fmt.Fprintf(w, "%s%s:\n", p, field.key); err != nil {
+				break
+			}
+			err = writeYAMLMapping(w, v, prefix+"  ", prefix+"  ")
+		default:
+			_, err = fmt.Fprintf(w, "%s%s: %v\n", p, field.key, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// yamlTime formats the given time as RFC 3339 string or returns an empty
+// string for the zero time.
+func yamlTime(t time.Time) string {
+
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// keyValues returns the YAML representation of the given router status.
+func (s *RouterStatus) keyValues() []keyValue {
+
+	address := []keyValue{
+		{"ipv4_address", ipString(s.Address.IPv4Address)},
+		{"ipv4_or_port", s.Address.IPv4ORPort},
+		{"ipv4_dir_port", s.Address.IPv4DirPort},
+	}
+	if s.Address.IPv6Address != nil {
+		address = append(address,
+			keyValue{"ipv6_address", s.Address.IPv6Address.String()},
+			keyValue{"ipv6_or_port", s.Address.IPv6ORPort})
+	}
+
+	return []keyValue{
+		{"fingerprint", string(s.Fingerprint)},
+		{"nickname", s.Nickname},
+		{"digest", s.Digest},
+		{"published", yamlTime(s.Publication)},
+		{"address", address},
+		{"flags", s.Flags.flagNames()},
+		{"tor_version", s.TorVersion},
+		{"bandwidth", s.Bandwidth},
+		{"measured", s.Measured},
+		{"unmeasured", s.Unmeasured},
+		{"accept", s.Accept},
+		{"port_list", s.PortList},
+	}
+}
+
+// keyValues returns the YAML representation of the given router descriptor.
+func (rd *RouterDescriptor) keyValues() []keyValue {
+
+	family := []string{}
+	for fpr := range rd.Family {
+		family = append(family, string(fpr))
+	}
+	sort.Strings(family)
+
+	policy := []string{}
+	if rawPolicy := strings.TrimSpace(rd.RawExitPolicy); rawPolicy != "" {
+		policy = strings.Split(rawPolicy, "\n")
+	}
+
+	return []keyValue{
+		{"fingerprint", string(rd.Fingerprint)},
+		{"nickname", rd.Nickname},
+		{"address", ipString(rd.Address)},
+		{"or_port", rd.ORPort},
+		{"dir_port", rd.DirPort},
+		{"published", yamlTime(rd.Published)},
+		{"uptime", rd.Uptime},
+		{"bandwidth_avg", rd.BandwidthAvg},
+		{"bandwidth_burst", rd.BandwidthBurst},
+		{"bandwidth_observed", rd.BandwidthObs},
+		{"operating_system", rd.OperatingSystem},
+		{"tor_version", rd.TorVersion},
+		{"contact", rd.Contact},
+		{"family", family},
+		{"hibernating", rd.Hibernating},
+		{"exit_policy", policy},
+	}
+}
+
+// ipString returns the string representation of the given address or an empty
+// string if the address is not set.
+func ipString(addr interface{ String() string }) string {
+
+	s := addr.String()
+	if s == "<nil>" {
+		return ""
+	}
+
+	return s
+}
+
+// WriteYAML writes all objects of the given object set that pass the given
+// filter to w as a YAML sequence, sorted by fingerprint.  Router statuses and
+// router descriptors are written with all their fields; other objects are
+// written as their fingerprint and string representation.
+func WriteYAML(w io.Writer, objs ObjectSet, filter *ObjectFilter) error {
+
+	var objects []Object
+	for obj := range objs.Iterate(filter) {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].GetFingerprint() < objects[j].GetFingerprint()
+	})
+
+	if len(objects) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+
+	for _, obj := range objects {
+		var fields []keyValue
+		switch o := obj.(type) {
+		case *RouterStatus:
+			fields = o.keyValues()
+		case *RouterDescriptor:
+			fields = o.keyValues()
+		default:
+			fields = []keyValue{
+				{"fingerprint", string(o.GetFingerprint())},
+				{"value", o.String()},
+			}
+		}
+
+		if err := writeYAMLMapping(w, fields, "- ", "  "); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+// Tests functions from "yaml.go".
+
+package zoossh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteYAML(t *testing.T) {
+
+	_, getStatus, err := ParseRawStatus(`r Karlstad0 m5TNC3uAV+ryG6fwI7ehyMqc5kU f1g9KQhgS0r6+H/7dzAJOpi6lG8 2014-12-08 06:57:54 193.11.166.194 9000 80
+a [2002:470:6e:80d::2]:22
+s Fast Guard Running
+v Tor 0.2.4.23
+w Bandwidth=2670
+p reject 1-65535`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consensus := NewConsensus()
+	status := getStatus()
+	consensus.Set(status.Fingerprint, status)
+
+	var buf bytes.Buffer
+	if err := WriteYAML(&buf, consensus, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, expected := range []string{
+		"- fingerprint: \"9B94CD0B7B8057EAF21BA7F023B7A1C8CA9CE645\"\n",
+		"  nickname: \"Karlstad0\"\n",
+		"  address:\n    ipv4_address: \"193.11.166.194\"\n    ipv4_or_port: 9000\n",
+		"    ipv6_address: \"2002:470:6e:80d::2\"\n",
+		"  flags:\n    - \"Fast\"\n    - \"Guard\"\n    - \"Running\"\n",
+		"  bandwidth: 2670\n",
+		"  accept: false\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("YAML output lacks %q:\n%s", expected, out)
+		}
+	}
+
+	buf.Reset()
+	if err := WriteYAML(&buf, NewConsensus(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("Unexpected YAML for empty set: %q", buf.String())
+	}
+}
+
+func TestWriteYAMLDescriptor(t *testing.T) {
+
+	descs := NewRouterDescriptors()
+	desc := NewRouterDescriptor()
+	desc.Fingerprint = "9695DFC35FFEB861329B9F1AB04C46397020CE31"
+	desc.Contact = `Jane "J" Doe: jane at example dot com`
+	desc.RawExitPolicy = "accept *:22\nreject *:*\n"
+	descs.Set(desc.Fingerprint, desc)
+
+	var buf bytes.Buffer
+	if err := WriteYAML(&buf, descs, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, expected := range []string{
+		"  contact: \"Jane \\\"J\\\" Doe: jane at example dot com\"\n",
+		"  family: []\n",
+		"  exit_policy:\n    - \"accept *:22\"\n    - \"reject *:*\"\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("YAML output lacks %q:\n%s", expected, out)
+		}
+	}
+}